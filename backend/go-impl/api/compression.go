@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"mime"
+	"strings"
+)
+
+// DefaultCompressMinSize 小于该字节数的响应不压缩，压缩收益抵不过开销
+const DefaultCompressMinSize = 1024
+
+// DefaultCompressibleTypes 默认压缩的Content-Type：JSON、文本和未压缩的wav音频。
+// mp3、ogg等音频本身已经压缩，再压缩几乎不会变小，不在列表中
+var DefaultCompressibleTypes = []string{
+	"application/json",
+	"text/plain",
+	"text/html",
+	"audio/wav",
+	"audio/x-wav",
+}
+
+// CompressionPolicy 决定哪些响应值得压缩，REST的gzip和WebSocket的permessage-deflate共用
+type CompressionPolicy struct {
+	types map[string]bool
+
+	// MinSize 小于该字节数的响应不压缩
+	MinSize int
+}
+
+// NewCompressionPolicy 只压缩types中的Content-Type，types为空时使用DefaultCompressibleTypes
+func NewCompressionPolicy(types []string) *CompressionPolicy {
+	if len(types) == 0 {
+		types = DefaultCompressibleTypes
+	}
+	p := &CompressionPolicy{
+		types:   make(map[string]bool, len(types)),
+		MinSize: DefaultCompressMinSize,
+	}
+	for _, t := range types {
+		p.types[strings.ToLower(strings.TrimSpace(t))] = true
+	}
+	return p
+}
+
+// Allows 判断contentType（可以带charset等参数）是否在允许压缩的列表中
+func (p *CompressionPolicy) Allows(contentType string) bool {
+	if p == nil || contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return p.types[mediaType]
+}
+
+// AllowsMessage 判断一条WS消息是否值得压缩。消息内嵌音频时按音频格式判断，
+// base64后的mp3等已压缩音频占了消息的绝大部分，压缩收效甚微
+func (p *CompressionPolicy) AllowsMessage(msg []byte) bool {
+	if p == nil || len(msg) < p.MinSize {
+		return false
+	}
+	var audio struct {
+		AudioData   string `json:"audioData"`
+		AudioFormat string `json:"audioFormat"`
+	}
+	if err := json.Unmarshal(msg, &audio); err == nil && audio.AudioData != "" {
+		return p.Allows(AudioContentType(audio.AudioFormat))
+	}
+	return p.Allows("application/json")
+}
+
+// AudioContentType 返回音频格式（文件扩展名，如wav、mp3）对应的Content-Type，未知格式返回application/octet-stream
+func AudioContentType(format string) string {
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "wav":
+		return "audio/wav"
+	case "mp3":
+		return "audio/mpeg"
+	case "ogg":
+		return "audio/ogg"
+	case "flac":
+		return "audio/flac"
+	default:
+		return "application/octet-stream"
+	}
+}
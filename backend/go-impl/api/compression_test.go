@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCompressionPolicy_Allows(t *testing.T) {
+	p := NewCompressionPolicy(nil)
+	tests := []struct {
+		name        string
+		contentType string
+		want        bool
+	}{
+		{name: "JSON", contentType: "application/json; charset=utf-8", want: true},
+		{name: "大小写", contentType: "Text/Plain", want: true},
+		{name: "wav", contentType: "audio/wav", want: true},
+		{name: "mp3", contentType: "audio/mpeg", want: false},
+		{name: "未知类型", contentType: "application/octet-stream", want: false},
+		{name: "空", contentType: "", want: false},
+		{name: "格式错误", contentType: ";;", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Allows(tt.contentType); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.contentType, got, tt.want)
+			}
+		})
+	}
+
+	if (*CompressionPolicy)(nil).Allows("application/json") {
+		t.Error("nil policy allows compression")
+	}
+	if custom := NewCompressionPolicy([]string{" audio/mpeg "}); !custom.Allows("audio/mpeg") || custom.Allows("application/json") {
+		t.Error("custom types not applied")
+	}
+}
+
+func TestCompressionPolicy_AllowsMessage(t *testing.T) {
+	p := NewCompressionPolicy(nil)
+	audio := base64.StdEncoding.EncodeToString(make([]byte, 2048))
+	message := func(resp Response) []byte {
+		msg, _ := json.Marshal(resp)
+		return msg
+	}
+
+	tests := []struct {
+		name string
+		msg  []byte
+		want bool
+	}{
+		{name: "文本回复", msg: message(Response{Type: "reply", Message: strings.Repeat("你好", 500)}), want: true},
+		{name: "小消息", msg: message(Response{Type: "reply", Message: "你好"}), want: false},
+		{name: "内嵌wav", msg: message(Response{Type: "reply", AudioData: audio, AudioFormat: "wav"}), want: true},
+		{name: "内嵌mp3", msg: message(Response{Type: "reply", AudioData: audio, AudioFormat: "mp3"}), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.AllowsMessage(tt.msg); got != tt.want {
+				t.Errorf("AllowsMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketCompression(t *testing.T) {
+	reply := strings.Repeat("你好", 1000)
+	tests := []struct {
+		name        string
+		compression *CompressionPolicy
+		wantDeflate bool
+	}{
+		{name: "开启压缩", compression: NewCompressionPolicy(nil), wantDeflate: true},
+		{name: "未开启压缩", compression: nil, wantDeflate: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wsServer := NewStreamWebSocketHandler(func(ctx context.Context, rawMsg []byte, send func([]byte) error) error {
+				return send([]byte(`{"type":"reply","message":"` + reply + `"}`))
+			})
+			wsServer.Compression = tt.compression
+			server := httptest.NewServer(http.HandlerFunc(wsServer.HandleWebSocket))
+			defer server.Close()
+
+			dialer := websocket.Dialer{EnableCompression: true}
+			ws, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+			if err != nil {
+				t.Fatalf("无法连接到 WebSocket 服务器: %v", err)
+			}
+			defer ws.Close()
+			negotiated := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+			if negotiated != tt.wantDeflate {
+				t.Errorf("permessage-deflate negotiated = %v, want %v", negotiated, tt.wantDeflate)
+			}
+
+			ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"message","content":"hi"}`))
+			ws.SetReadDeadline(time.Now().Add(time.Second))
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatalf("读取响应错误: %v", err)
+			}
+			if !strings.Contains(string(msg), reply) {
+				t.Errorf("response = %.50s..., want reply", msg)
+			}
+		})
+	}
+}
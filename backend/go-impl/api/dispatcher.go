@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"LingChat/internal/errs"
+)
+
+// 其他入站消息类型
+const (
+	// MessageTypeHandshake 客户端连接后发送的握手消息
+	MessageTypeHandshake = "handshake"
+	// MessageTypePing 应用层心跳，不需要回复
+	MessageTypePing = "ping"
+	// ResponseTypeError 处理失败时服务器发送的响应类型
+	ResponseTypeError = "error"
+)
+
+// HandshakeMessage type为handshake的消息
+type HandshakeMessage struct {
+	Content string `json:"content"`
+}
+
+// PingMessage type为ping的消息
+type PingMessage struct{}
+
+// Dispatcher 按type字段分发WS消息：每种type对应一个消息结构体和处理器，用On注册。
+// ServeMessage实现StreamMessageHandler，可直接交给NewStreamWebSocketHandler
+type Dispatcher struct {
+	handlers map[string]StreamMessageHandler
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{handlers: make(map[string]StreamMessageHandler)}
+}
+
+// On 注册msgType的处理器，消息解析为T后交给handler。同一类型重复注册时后注册的生效
+func On[T any](d *Dispatcher, msgType string, handler func(ctx context.Context, msg T, send func([]byte) error) error) {
+	d.handlers[msgType] = func(ctx context.Context, rawMsg []byte, send func([]byte) error) error {
+		var msg T
+		if err := json.Unmarshal(rawMsg, &msg); err != nil {
+			return fmt.Errorf("%w: %s 消息解析错误: %w", errs.ErrInvalidMessage, msgType, err)
+		}
+		return handler(ctx, msg, send)
+	}
+}
+
+// ServeMessage 解析消息的type并交给对应的处理器。
+// 格式错误和未注册的类型返回错误，由WebSocketHandler作为错误响应发送，连接不受影响
+func (d *Dispatcher) ServeMessage(ctx context.Context, rawMsg []byte, send func([]byte) error) error {
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(rawMsg, &envelope); err != nil {
+		return fmt.Errorf("%w: JSON 解析错误: %w", errs.ErrInvalidMessage, err)
+	}
+	handler, ok := d.handlers[envelope.Type]
+	if !ok {
+		return fmt.Errorf("%w \"%s\"", errs.ErrInvalidMessageType, envelope.Type)
+	}
+	return handler(ctx, rawMsg, send)
+}
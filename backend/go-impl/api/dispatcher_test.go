@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"LingChat/internal/errs"
+)
+
+func newTestDispatcher(handled *[]string) *Dispatcher {
+	d := NewDispatcher()
+	On(d, MessageTypeMessage, func(ctx context.Context, msg Message, send func([]byte) error) error {
+		*handled = append(*handled, "message:"+msg.Content)
+		return send([]byte("reply:" + msg.Content))
+	})
+	On(d, MessageTypeHandshake, func(ctx context.Context, msg HandshakeMessage, send func([]byte) error) error {
+		*handled = append(*handled, "handshake:"+msg.Content)
+		return nil
+	})
+	return d
+}
+
+func TestDispatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawMsg  string
+		want    []string
+		wantErr error
+	}{
+		{name: "聊天消息", rawMsg: `{"type":"message","content":"hi"}`, want: []string{"message:hi"}},
+		{name: "握手", rawMsg: `{"type":"handshake","content":"v1"}`, want: []string{"handshake:v1"}},
+		{name: "未知类型", rawMsg: `{"type":"typing"}`, wantErr: errs.ErrInvalidMessageType},
+		{name: "缺少类型", rawMsg: `{"content":"hi"}`, wantErr: errs.ErrInvalidMessageType},
+		{name: "JSON格式错误", rawMsg: `{"type":`, wantErr: errs.ErrInvalidMessage},
+		{name: "字段类型错误", rawMsg: `{"type":"message","content":1}`, wantErr: errs.ErrInvalidMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled []string
+			d := newTestDispatcher(&handled)
+			err := d.ServeMessage(context.Background(), []byte(tt.rawMsg), func([]byte) error { return nil })
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("ServeMessage() error = %v, want %v", err, tt.wantErr)
+			}
+			if strings.Join(handled, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("handled = %v, want %v", handled, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcherUnknownTypeKeepsConnection(t *testing.T) {
+	var handled []string
+	wsServer := NewStreamWebSocketHandler(newTestDispatcher(&handled).ServeMessage)
+	server := httptest.NewServer(http.HandlerFunc(wsServer.HandleWebSocket))
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("无法连接到 WebSocket 服务器: %v", err)
+	}
+	defer ws.Close()
+	read := func() []byte {
+		t.Helper()
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		_, response, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("读取响应错误: %v", err)
+		}
+		return response
+	}
+
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"typing"}`))
+	var resp Response
+	if err := json.Unmarshal(read(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Type != ResponseTypeError || resp.ErrorCode != errs.CodeInvalidMessageType || resp.Code != http.StatusBadRequest {
+		t.Errorf("response = %+v, want invalid_message_type error", resp)
+	}
+
+	// 错误响应之后连接仍然可用
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"message","content":"hi"}`))
+	if got := string(read()); got != "reply:hi" {
+		t.Errorf("response = %s, want reply:hi", got)
+	}
+}
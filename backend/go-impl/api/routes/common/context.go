@@ -12,12 +12,14 @@ const (
 	CurrentUserInfoKey = "current-user-info"
 )
 
+// GetCurrentUserInfo 获取TokenAuth写入gin上下文的当前用户，未登录时返回nil
 func GetCurrentUserInfo(c *gin.Context) *ent.User {
 	val, exist := c.Get(CurrentUserInfoKey)
 	if !exist {
 		return nil
 	}
-	return val.(*ent.User)
+	user, _ := val.(*ent.User)
+	return user
 }
 
 func GetUserFromContext(ctx context.Context) *ent.User {
@@ -35,3 +37,16 @@ func GetUserFromContext(ctx context.Context) *ent.User {
 
 	return user
 }
+
+type debugKey struct{}
+
+// WithDebug 标记请求来自通过校验的调试方，响应中可以包含LLM原始回复等调试信息
+func WithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugKey{}, true)
+}
+
+// IsDebug 请求是否由WithDebug标记
+func IsDebug(ctx context.Context) bool {
+	debug, _ := ctx.Value(debugKey{}).(bool)
+	return debug
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/common"
+)
+
+const (
+	// AdminTokenHeader 管理接口使用的令牌请求头
+	AdminTokenHeader = "X-Admin-Token"
+	// DebugHeader 请求调试信息的请求头，值为raw时响应中附带LLM原始回复
+	DebugHeader = "X-Debug"
+)
+
+// AdminAuth 校验X-Admin-Token是否与配置的管理令牌一致。
+// token为空时管理接口不可用，一律返回403
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !validAdminToken(c, token) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code": http.StatusForbidden,
+				"msg":  "forbidden",
+			})
+			c.Abort()
+		}
+	}
+}
+
+// DebugMode 请求带有 X-Debug: raw 且管理令牌正确时，把请求标记为调试请求（common.WithDebug）。
+// 其他请求不受影响，普通客户端即使带了X-Debug也拿不到调试信息
+func DebugMode(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(DebugHeader) == "raw" && validAdminToken(c, token) {
+			c.Request = c.Request.WithContext(common.WithDebug(c.Request.Context()))
+		}
+	}
+}
+
+// validAdminToken X-Admin-Token与token一致，token为空时总是false
+func validAdminToken(c *gin.Context, token string) bool {
+	got := c.GetHeader(AdminTokenHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"LingChat/api/routes/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		configured string
+		header     string
+		want       int
+	}{
+		{name: "令牌正确", configured: "secret", header: "secret", want: http.StatusOK},
+		{name: "令牌错误", configured: "secret", header: "wrong", want: http.StatusForbidden},
+		{name: "缺少令牌", configured: "secret", want: http.StatusForbidden},
+		{name: "未配置令牌时关闭", configured: "", header: "", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.POST("/admin", AdminAuth(tt.configured), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodPost, "/admin", nil)
+			if tt.header != "" {
+				req.Header.Set(AdminTokenHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebugMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		configured string
+		token      string
+		debug      string
+		want       bool
+	}{
+		{name: "令牌正确", configured: "secret", token: "secret", debug: "raw", want: true},
+		{name: "令牌错误", configured: "secret", token: "wrong", debug: "raw", want: false},
+		{name: "缺少调试头", configured: "secret", token: "secret", want: false},
+		{name: "调试头取值不支持", configured: "secret", token: "secret", debug: "1", want: false},
+		{name: "未配置令牌时关闭", configured: "", token: "", debug: "raw", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bool
+			r := gin.New()
+			r.POST("/chat", DebugMode(tt.configured), func(c *gin.Context) {
+				got = common.IsDebug(c.Request.Context())
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+			if tt.token != "" {
+				req.Header.Set(AdminTokenHeader, tt.token)
+			}
+			if tt.debug != "" {
+				req.Header.Set(DebugHeader, tt.debug)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if got != tt.want {
+				t.Errorf("IsDebug = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api"
+)
+
+// Gzip 客户端的Accept-Encoding支持gzip时压缩响应。响应的Content-Type不在policy允许的列表中、
+// 小于policy.MinSize或已经设置了Content-Encoding时原样发送。policy为nil时不压缩
+func Gzip(policy *api.CompressionPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy == nil || c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+		// 缓存不能把压缩和未压缩的响应混用
+		c.Header("Vary", "Accept-Encoding")
+
+		w := &gzipWriter{ResponseWriter: c.Writer, policy: policy}
+		c.Writer = w
+		defer w.finish()
+		c.Next()
+	}
+}
+
+// acceptsGzip 解析Accept-Encoding，gzip或*的q值不为0时返回true
+func acceptsGzip(header string) bool {
+	for part := range strings.SplitSeq(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := strings.ReplaceAll(strings.ToLower(params), " ", "")
+		if q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipWriter 先缓存响应开头的MinSize字节，够长时再根据Content-Type决定是否压缩
+type gzipWriter struct {
+	gin.ResponseWriter
+	policy *api.CompressionPolicy
+
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.policy.MinSize {
+		if err := w.decide(w.compressible()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow 立即发送响应头时还没有正文，之后的正文只能原样发送
+func (w *gzipWriter) WriteHeaderNow() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush 流式响应要求已写入的内容立即发出，不再等待凑够MinSize
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(len(w.buf) > 0 && w.compressible())
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// compressible 响应头中的Content-Type允许压缩且没有其他编码
+func (w *gzipWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	switch w.Status() {
+	case http.StatusNoContent, http.StatusNotModified:
+		return false
+	}
+	return w.policy.Allows(header.Get("Content-Type"))
+}
+
+// decide 确定是否压缩并写出缓存的内容
+func (w *gzipWriter) decide(compress bool) error {
+	w.decided = true
+	if compress {
+		header := w.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.gz != nil {
+		_, err := w.gz.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish 请求处理完毕：不足MinSize的响应原样写出，压缩的响应写出gzip结尾
+func (w *gzipWriter) finish() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	if w.gz != nil {
+		_ = w.gz.Close()
+	}
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api"
+)
+
+func TestGzip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	big := strings.Repeat("你好", 1000)
+	r := gin.New()
+	r.Use(Gzip(api.NewCompressionPolicy(nil)))
+	r.GET("/json", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"msg": big}) })
+	r.GET("/small", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"msg": "hi"}) })
+	r.GET("/mp3", func(c *gin.Context) { c.Data(http.StatusOK, "audio/mpeg", []byte(big)) })
+	r.GET("/wav", func(c *gin.Context) { c.Data(http.StatusOK, "audio/wav", []byte(big)) })
+	r.GET("/encoded", func(c *gin.Context) {
+		c.Header("Content-Encoding", "br")
+		c.Data(http.StatusOK, "application/json", []byte(big))
+	})
+	r.GET("/chunks", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain")
+		for i := 0; i < 10; i++ {
+			c.Writer.WriteString(strings.Repeat("a", 200))
+		}
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{name: "压缩JSON", path: "/json", acceptEncoding: "gzip, deflate", wantGzip: true},
+		{name: "客户端不支持gzip", path: "/json", acceptEncoding: "", wantGzip: false},
+		{name: "客户端拒绝gzip", path: "/json", acceptEncoding: "gzip;q=0, br", wantGzip: false},
+		{name: "通配符", path: "/json", acceptEncoding: "*", wantGzip: true},
+		{name: "小响应不压缩", path: "/small", acceptEncoding: "gzip", wantGzip: false},
+		{name: "mp3不压缩", path: "/mp3", acceptEncoding: "gzip", wantGzip: false},
+		{name: "压缩wav", path: "/wav", acceptEncoding: "gzip", wantGzip: true},
+		{name: "已有编码不再压缩", path: "/encoded", acceptEncoding: "gzip", wantGzip: false},
+		{name: "多次写入凑够大小后压缩", path: "/chunks", acceptEncoding: "gzip", wantGzip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			gzipped := w.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.wantGzip {
+				t.Fatalf("Content-Encoding = %q, want gzip %v", w.Header().Get("Content-Encoding"), tt.wantGzip)
+			}
+			body := w.Body.Bytes()
+			if gzipped {
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body, err = io.ReadAll(zr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 与不经过压缩的响应内容一致
+			plain := httptest.NewRecorder()
+			r.ServeHTTP(plain, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if string(body) != plain.Body.String() {
+				t.Errorf("body differs from uncompressed response: got %d bytes, want %d", len(body), plain.Body.Len())
+			}
+		})
+	}
+}
+
+func TestGzipDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Gzip(nil))
+	r.GET("/json", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"msg": strings.Repeat("a", 4096)}) })
+
+	req := httptest.NewRequest(http.MethodGet, "/json", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "" {
+		t.Errorf("headers = %v, want no compression", w.Header())
+	}
+}
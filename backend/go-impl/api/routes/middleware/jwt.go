@@ -2,15 +2,21 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
+	"LingChat/api"
 	"LingChat/api/routes/common"
 	"LingChat/internal/data"
 	"LingChat/pkg/jwt"
 )
 
+// TokenAuth 校验Authorization头（或token cookie）中的Bearer JWT，加载对应用户
+// 并写入gin上下文和请求上下文的CurrentUserInfoKey，
+// 服务层可通过common.GetUserFromContext获取。
+// mustLogin为true时缺少或无效的token返回401，否则按未登录继续处理
 func TokenAuth(mustLogin bool, jwt *jwt.JWT, userRepo data.UserRepo) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader("Authorization")
@@ -61,3 +67,39 @@ func TokenAuth(mustLogin bool, jwt *jwt.JWT, userRepo data.UserRepo) gin.Handler
 
 	}
 }
+
+// WebSocket握手认证失败的原因，与TokenAuth返回的msg一致
+var (
+	errNoToken      = errors.New("no token")
+	errInvalidToken = errors.New("invalid token")
+	errNoValidUser  = errors.New("no valid user")
+)
+
+// WSTokenAuth 用作api.WebSocketHandler.Authenticate：校验握手请求中的Bearer JWT（见api.HandshakeToken），
+// 把对应用户写入连接ctx的CurrentUserInfoKey，之后该连接上的消息都能通过common.GetUserFromContext获取。
+// mustLogin为true时缺少或无效的token返回错误（握手以401拒绝），否则按未登录继续处理
+func WSTokenAuth(mustLogin bool, jwt *jwt.JWT, userRepo data.UserRepo) func(r *http.Request) (context.Context, error) {
+	return func(r *http.Request) (context.Context, error) {
+		ctx := r.Context()
+		fail := func(err error) (context.Context, error) {
+			if mustLogin {
+				return nil, err
+			}
+			return ctx, nil
+		}
+
+		token := api.HandshakeToken(r)
+		if token == "" {
+			return fail(errNoToken)
+		}
+		claims, err := jwt.ParseToken(token)
+		if err != nil {
+			return fail(errInvalidToken)
+		}
+		user, err := userRepo.GetByID(ctx, int64(claims.UserID))
+		if err != nil {
+			return fail(errNoValidUser)
+		}
+		return context.WithValue(ctx, common.CurrentUserInfoKey, user), nil
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"LingChat/api/routes/common"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/pkg/jwt"
+)
+
+// fakeUserRepo 只实现GetByID，其他方法调用时会因嵌入的nil接口而panic
+type fakeUserRepo struct {
+	data.UserRepo
+	users map[int64]*ent.User
+}
+
+func (r *fakeUserRepo) GetByID(ctx context.Context, id int64) (*ent.User, error) {
+	if u, ok := r.users[id]; ok {
+		return u, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func TestWSTokenAuth(t *testing.T) {
+	j := jwt.NewJWT([]byte("secret"), "test")
+	valid, _ := j.GenerateToken(jwt.ClaimParams{UserID: 1}, time.Hour)
+	unknownUser, _ := j.GenerateToken(jwt.ClaimParams{UserID: 2}, time.Hour)
+	otherSecret, _ := jwt.NewJWT([]byte("other"), "test").GenerateToken(jwt.ClaimParams{UserID: 1}, time.Hour)
+	repo := &fakeUserRepo{users: map[int64]*ent.User{1: {ID: 1, Username: "alice"}}}
+
+	tests := []struct {
+		name      string
+		mustLogin bool
+		token     string
+		wantErr   error
+		wantUser  int64
+	}{
+		{name: "缺少令牌", mustLogin: true, wantErr: errNoToken},
+		{name: "令牌无效", mustLogin: true, token: "Bearer not-a-jwt", wantErr: errInvalidToken},
+		{name: "签名不匹配", mustLogin: true, token: otherSecret, wantErr: errInvalidToken},
+		{name: "用户不存在", mustLogin: true, token: unknownUser, wantErr: errNoValidUser},
+		{name: "有效令牌", mustLogin: true, token: valid, wantUser: 1},
+		{name: "不要求登录时缺少令牌按未登录处理", mustLogin: false},
+		{name: "不要求登录时令牌无效按未登录处理", mustLogin: false, token: "Bearer not-a-jwt"},
+		{name: "不要求登录时加载有效令牌的用户", mustLogin: false, token: valid, wantUser: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			ctx, err := WSTokenAuth(tt.mustLogin, j, repo)(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WSTokenAuth() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			user := common.GetUserFromContext(ctx)
+			if tt.wantUser == 0 {
+				if user != nil {
+					t.Errorf("user = %+v, want nil", user)
+				}
+				return
+			}
+			if user == nil || user.ID != tt.wantUser {
+				t.Errorf("user = %+v, want id %d", user, tt.wantUser)
+			}
+		})
+	}
+}
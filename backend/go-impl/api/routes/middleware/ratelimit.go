@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/common"
+)
+
+// RateLimiter 按key（用户ID或客户端IP）维护令牌桶
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	rate      float64 // 每秒补充的令牌数
+	burst     float64
+	lastPrune time.Time
+
+	// now 便于测试替换时钟
+	now func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter 每分钟允许requestsPerMinute次请求，最多累积burst个令牌。
+// requestsPerMinute<=0时返回nil，表示不限流
+func NewRateLimiter(requestsPerMinute, burst int) *RateLimiter {
+	if requestsPerMinute <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		rate:    float64(requestsPerMinute) / 60,
+		burst:   float64(max(burst, 1)),
+		now:     time.Now,
+	}
+}
+
+// Allow 消耗key的一个令牌，令牌不足时返回需要等待的时间
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// prune 每分钟清理一次已补满的桶，避免map随key数量无限增长
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimit 需放在TokenAuth之后：已登录用户按用户ID限流，未登录按客户端IP限流。
+// 超出限制时返回429并设置Retry-After（秒）
+func RateLimit(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			return
+		}
+
+		key := "ip:" + c.ClientIP()
+		if user := common.GetCurrentUserInfo(c); user != nil {
+			key = fmt.Sprintf("user:%d", user.ID)
+		}
+
+		ok, wait := limiter.Allow(key)
+		if ok {
+			return
+		}
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"code": http.StatusTooManyRequests,
+			"msg":  "too many requests",
+		})
+		c.Abort()
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(60, 2)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.Allow("user:1"); !ok {
+			t.Fatalf("request %d rejected within burst", i)
+		}
+	}
+	ok, wait := limiter.Allow("user:1")
+	if ok || wait != time.Second {
+		t.Errorf("Allow() = %v, %v, want false, 1s", ok, wait)
+	}
+
+	// 不同key互不影响
+	if ok, _ := limiter.Allow("user:2"); !ok {
+		t.Error("other key rejected")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := limiter.Allow("user:1"); !ok {
+		t.Error("request rejected after refill")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", RateLimit(NewRateLimiter(1, 1)), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	codes := make([]int, 0, 2)
+	var retryAfter string
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+		retryAfter = w.Header().Get("Retry-After")
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("codes = %v, want [200 429]", codes)
+	}
+	if retryAfter != "60" {
+		t.Errorf("Retry-After = %q, want 60", retryAfter)
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/common"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent/user"
+	"LingChat/pkg/jwt"
+)
+
+// RequireRole 要求TokenAuth加载的当前用户具有roles之一，需放在TokenAuth之后。
+// 未登录（包括TokenAuth(false, ...)放行的未登录请求）返回401，角色不符返回403
+func RequireRole(roles ...user.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u := common.GetCurrentUserInfo(c)
+		if u == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code": http.StatusUnauthorized,
+				"msg":  "login required",
+			})
+			c.Abort()
+			return
+		}
+		if !slices.Contains(roles, u.Role) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code": http.StatusForbidden,
+				"msg":  "forbidden",
+			})
+			c.Abort()
+		}
+	}
+}
+
+// AdminTokenOr X-Admin-Token正确时直接放行，供运维脚本等没有用户身份的调用方使用；
+// 否则依次执行handlers（通常是TokenAuth和RequireRole），其中一个中止请求即停止
+func AdminTokenOr(token string, handlers ...gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if validAdminToken(c, token) {
+			return
+		}
+		for _, h := range handlers {
+			h(c)
+			if c.IsAborted() {
+				return
+			}
+		}
+	}
+}
+
+// IsAdmin 请求的管理令牌正确，或TokenAuth加载的当前用户角色为admin，
+// 供只对管理员开放部分功能（而不是整个接口）的处理函数使用
+func IsAdmin(c *gin.Context, token string) bool {
+	if validAdminToken(c, token) {
+		return true
+	}
+	u := common.GetCurrentUserInfo(c)
+	return u != nil && u.Role == user.RoleAdmin
+}
+
+// AdminOnly 管理接口的访问控制：管理令牌正确，或已登录且角色为admin。
+// 不带令牌也未登录时返回401，已登录的普通用户返回403
+func AdminOnly(token string, jwt *jwt.JWT, userRepo data.UserRepo) gin.HandlerFunc {
+	return AdminTokenOr(token, TokenAuth(false, jwt, userRepo), RequireRole(user.RoleAdmin))
+}
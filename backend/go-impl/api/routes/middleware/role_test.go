@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/common"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/data/ent/ent/user"
+)
+
+// withUser 模拟TokenAuth加载了u，u为nil时模拟未登录
+func withUser(u *ent.User) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if u != nil {
+			c.Set(common.CurrentUserInfoKey, u)
+		}
+	}
+}
+
+func TestAdminTokenOr(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		header string
+		user   *ent.User
+		want   int
+	}{
+		{name: "管理员", user: &ent.User{ID: 1, Role: user.RoleAdmin}, want: http.StatusOK},
+		{name: "普通用户", user: &ent.User{ID: 2, Role: user.RoleUser}, want: http.StatusForbidden},
+		{name: "未登录", want: http.StatusUnauthorized},
+		{name: "管理令牌", header: "secret", want: http.StatusOK},
+		{name: "管理令牌错误时按用户校验", header: "wrong", user: &ent.User{ID: 2, Role: user.RoleUser}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.POST("/admin", AdminTokenOr("secret", withUser(tt.user), RequireRole(user.RoleAdmin)), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodPost, "/admin", nil)
+			if tt.header != "" {
+				req.Header.Set(AdminTokenHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		header string
+		user   *ent.User
+		want   bool
+	}{
+		{name: "管理员", user: &ent.User{ID: 1, Role: user.RoleAdmin}, want: true},
+		{name: "普通用户", user: &ent.User{ID: 2, Role: user.RoleUser}},
+		{name: "未登录"},
+		{name: "管理令牌", header: "secret", want: true},
+		{name: "管理令牌错误", header: "wrong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bool
+			r := gin.New()
+			r.POST("/chat", withUser(tt.user), func(c *gin.Context) { got = IsAdmin(c, "secret") })
+
+			req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+			if tt.header != "" {
+				req.Header.Set(AdminTokenHeader, tt.header)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("IsAdmin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
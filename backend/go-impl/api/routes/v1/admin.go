@@ -0,0 +1,94 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/middleware"
+	"LingChat/internal/data"
+	"LingChat/internal/service"
+	"LingChat/pkg/jwt"
+)
+
+type AdminRoute struct {
+	lingChatService *service.LingChatService
+	userRepo        data.UserRepo
+	jwt             *jwt.JWT
+	token           string
+}
+
+// NewAdminRoute 带有正确的管理令牌token，或以admin角色的用户登录才能访问管理接口；token为空时只接受admin用户
+func NewAdminRoute(lingChatService *service.LingChatService, userRepo data.UserRepo, jwt *jwt.JWT, token string) *AdminRoute {
+	return &AdminRoute{
+		lingChatService: lingChatService,
+		userRepo:        userRepo,
+		jwt:             jwt,
+		token:           token,
+	}
+}
+
+func (a *AdminRoute) RegisterRoute(r *gin.RouterGroup) {
+	rg := r.Group("/v1/admin", middleware.AdminOnly(a.token, a.jwt, a.userRepo))
+	{
+		rg.POST("/motions/reload", a.reloadMotions)
+		rg.POST("/reload", a.reload)
+	}
+}
+
+// reloadMotions 重新加载情绪到动作的映射文件，失败时继续使用原来的映射
+//
+// @Summary 重新加载动作映射
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Security BearerAuth
+// @Success 200 {object} response.Envelope{data=object}
+// @Failure 401 {object} response.Envelope
+// @Failure 403 {object} response.Envelope
+// @Failure 500 {object} response.Envelope
+// @Router /api/v1/admin/motions/reload [post]
+func (a *AdminRoute) reloadMotions(c *gin.Context) {
+	if err := a.lingChatService.ReloadMotions(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": http.StatusInternalServerError,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": gin.H{"motions": a.lingChatService.MotionMap.Len()},
+	})
+}
+
+// reload 重新读取配置文件，替换情绪阈值、并发数、人设提示词并重新加载动作映射。
+// 进行中的对话继续使用原来的参数，失败时全部保持不变
+//
+// @Summary 重新读取配置
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Security BearerAuth
+// @Success 200 {object} response.Envelope{data=object}
+// @Failure 401 {object} response.Envelope
+// @Failure 403 {object} response.Envelope
+// @Failure 500 {object} response.Envelope
+// @Router /api/v1/admin/reload [post]
+func (a *AdminRoute) reload(c *gin.Context) {
+	settings, err := a.lingChatService.Reload()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": http.StatusInternalServerError,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": gin.H{
+			"settings": settings,
+			"motions":  a.lingChatService.MotionMap.Len(),
+		},
+	})
+}
@@ -0,0 +1,130 @@
+package v1
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/middleware"
+	"LingChat/api/routes/v1/request"
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/data"
+	"LingChat/internal/errs"
+	"LingChat/internal/service"
+	"LingChat/internal/storage"
+	"LingChat/pkg/jwt"
+)
+
+type AudioRoute struct {
+	lingChatService *service.LingChatService
+	userRepo        data.UserRepo
+	jwt             *jwt.JWT
+
+	// RateLimiter 按用户限流，为nil时不限流
+	RateLimiter *middleware.RateLimiter
+}
+
+func NewAudioRoute(lingChatService *service.LingChatService, userRepo data.UserRepo, jwt *jwt.JWT) *AudioRoute {
+	return &AudioRoute{
+		lingChatService: lingChatService,
+		userRepo:        userRepo,
+		jwt:             jwt,
+	}
+}
+
+func (a *AudioRoute) RegisterRoute(r *gin.RouterGroup) {
+	rg := r.Group("/v1/regenerate-audio")
+	{
+		rg.POST("", middleware.TokenAuth(true, a.jwt, a.userRepo), middleware.RateLimit(a.RateLimiter), a.regenerateAudio)
+	}
+	// 地址中的token不可猜测且只能使用一次，<audio>标签直接请求，不需要登录
+	audio := r.Group("/v1/audio")
+	{
+		audio.GET("/:token", a.getAudio)
+	}
+}
+
+// getAudio 返回内存中保存的语音，取出后即失效
+//
+// @Summary 取出内存中的语音
+// @Tags audio
+// @Produce audio/wav
+// @Param token path string true "生成回复时返回的语音token"
+// @Success 200 {file} binary
+// @Failure 404 {object} response.Envelope
+// @Router /api/v1/audio/{token} [get]
+func (a *AudioRoute) getAudio(c *gin.Context) {
+	data, contentType, err := a.lingChatService.TakeAudio(c.Param("token"))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": http.StatusNotFound,
+			"msg":  "音频不存在或已过期",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": http.StatusInternalServerError,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// regenerateAudio 重新合成回复中的一个分段，前端只需重试出错的那一句。需要登录，文本与用户消息一样经过审核
+//
+// @Summary 重新合成分段语音
+// @Tags audio
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body request.RegenerateAudioRequest true "要合成的文本和声音参数"
+// @Success 200 {object} response.Envelope{data=response.RegenerateAudioResponse}
+// @Failure 400 {object} response.Envelope
+// @Failure 401 {object} response.Envelope
+// @Failure 422 {object} response.Envelope
+// @Failure 429 {object} response.Envelope
+// @Failure 502 {object} response.Envelope
+// @Router /api/v1/regenerate-audio [post]
+func (a *AudioRoute) regenerateAudio(c *gin.Context) {
+	var req request.RegenerateAudioRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	audio, err := a.lingChatService.RegenerateAudio(c.Request.Context(), service.RegenerateAudioRequest{
+		Text:      req.Text,
+		SpeakerID: req.SpeakerID,
+		Speed:     req.Speed,
+		Pitch:     req.Pitch,
+		SSML:      req.SSML,
+	})
+	if err != nil {
+		status := errs.HTTPStatus(err)
+		c.JSON(status, gin.H{
+			"code": status,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	resp := response.RegenerateAudioResponse{
+		AudioFile:   audio.AudioFile,
+		AudioFormat: audio.AudioFormat,
+	}
+	if len(audio.Audio) != 0 {
+		resp.AudioData = base64.StdEncoding.EncodeToString(audio.Audio)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": resp,
+	})
+}
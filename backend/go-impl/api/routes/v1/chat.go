@@ -1,15 +1,20 @@
 package v1
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sashabaranov/go-openai"
 
+	"LingChat/api"
 	"LingChat/api/routes/middleware"
 	"LingChat/api/routes/v1/request"
 	"LingChat/api/routes/v1/response"
+	"LingChat/internal/clients/llm"
 	"LingChat/internal/data"
+	"LingChat/internal/errs"
 	"LingChat/internal/service"
 	"LingChat/pkg/jwt"
 )
@@ -18,6 +23,11 @@ type ChatRoute struct {
 	lingChatService *service.LingChatService
 	userRepo        data.UserRepo
 	jwt             *jwt.JWT
+
+	// RateLimiter 聊天接口的按用户限流，为nil时不限流
+	RateLimiter *middleware.RateLimiter
+	// AdminToken 带此令牌和X-Debug: raw的请求可以拿到LLM原始回复，带此令牌的请求可以设置system_prompt，为空时都不提供
+	AdminToken string
 }
 
 func NewChatRoute(lingChatService *service.LingChatService, userRepo data.UserRepo, jwt *jwt.JWT) *ChatRoute {
@@ -31,12 +41,137 @@ func NewChatRoute(lingChatService *service.LingChatService, userRepo data.UserRe
 func (c *ChatRoute) RegisterRoute(r *gin.RouterGroup) {
 	rg := r.Group("/v1/chat")
 	{
-		rg.POST("/completion", middleware.TokenAuth(false, c.jwt, c.userRepo), c.chatCompletion)
+		rg.POST("", middleware.TokenAuth(false, c.jwt, c.userRepo), middleware.RateLimit(c.RateLimiter), middleware.DebugMode(c.AdminToken), c.chat)
+		rg.POST("/completion", middleware.TokenAuth(false, c.jwt, c.userRepo), middleware.RateLimit(c.RateLimiter), middleware.DebugMode(c.AdminToken), c.chatCompletion)
+		rg.POST("/stream", middleware.TokenAuth(false, c.jwt, c.userRepo), middleware.RateLimit(c.RateLimiter), middleware.DebugMode(c.AdminToken), c.chatStream)
 		rg.GET("/history", middleware.TokenAuth(false, c.jwt, c.userRepo), c.getChatHistory)
 		rg.POST("/history", middleware.TokenAuth(false, c.jwt, c.userRepo), c.loadChatHistory)
 	}
 }
 
+// chat 以请求/响应的方式处理一条与WebSocket格式相同的消息，返回全部回复分段。
+// 幂等键可以放在Idempotency-Key请求头或消息的idempotencyKey字段中，未登录时忽略
+//
+// @Summary 发送一条消息
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param Idempotency-Key header string false "幂等键，与消息中的idempotencyKey二选一，未登录时忽略"
+// @Param body body api.Message true "与WebSocket格式相同的消息"
+// @Success 200 {object} response.Envelope{data=[]api.Response}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 429 {object} response.Envelope
+// @Failure 503 {object} response.ErrorResponse
+// @Router /api/v1/chat [post]
+func (c *ChatRoute) chat(ctx *gin.Context) {
+	var msg api.Message
+	if err := ctx.ShouldBindJSON(&msg); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求格式错误: " + err.Error(),
+		})
+		return
+	}
+	if msg.IdempotencyKey == "" {
+		msg.IdempotencyKey = ctx.GetHeader("Idempotency-Key")
+	}
+
+	resp, err := c.lingChatService.HandleMessage(ctx.Request.Context(), msg)
+	if err != nil {
+		ctx.JSON(errs.HTTPStatus(err), gin.H{
+			"error": "处理聊天请求失败: " + err.Error(),
+		})
+		return
+	}
+	if resp == nil {
+		resp = []api.Response{}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": resp,
+	})
+}
+
+// chatStream 与WebSocket走同一个处理流程，每个回复分段（以及开启的进度、文本等事件）准备好后作为一个SSE事件发送，
+// 事件名为响应的type，data为与WebSocket相同的JSON；全部分段发送后发送done事件（出错时为error事件）并结束响应。
+// 请求体与WebSocket消息相同，前端用fetch读取响应流。只接受POST：GET会被跨站页面直接带cookie发起，
+// EventSource断开后还会自动重连、重复发送这条消息。客户端断开后本轮对话随之取消
+//
+// @Summary 发送一条消息并以SSE接收回复
+// @Tags chat
+// @Accept json
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param body body api.Message true "与WebSocket格式相同的消息"
+// @Success 200 {object} api.Response "每个事件的data"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 429 {object} response.Envelope
+// @Router /api/v1/chat/stream [post]
+func (c *ChatRoute) chatStream(ctx *gin.Context) {
+	msg := api.Message{Type: api.MessageTypeMessage}
+	if err := ctx.ShouldBindJSON(&msg); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求格式错误: " + err.Error(),
+		})
+		return
+	}
+	rawMsg, err := json.Marshal(msg)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "请求格式错误: " + err.Error(),
+		})
+		return
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	// 反向代理不要缓冲事件
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	// 客户端断开时请求的ctx结束，本轮对话随之取消
+	reqCtx := ctx.Request.Context()
+	send := func(data []byte) error {
+		if err := reqCtx.Err(); err != nil {
+			return err
+		}
+		var event struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal(data, &event)
+		ctx.SSEvent(event.Type, string(data))
+		ctx.Writer.Flush()
+		return nil
+	}
+
+	err = c.lingChatService.ChatHandlerStream(reqCtx, rawMsg, send)
+	if reqCtx.Err() != nil {
+		return
+	}
+	resp := api.Response{Type: api.ResponseTypeDone}
+	if err != nil {
+		resp = api.Response{Type: api.ResponseTypeError, Error: err.Error(), Code: errs.HTTPStatus(err), ErrorCode: errs.Code(err)}
+	}
+	data, _ := json.Marshal(resp)
+	_ = send(data)
+}
+
+// chatCompletion 处理一条纯文本消息，返回本轮的对话和消息ID，便于之后接着对话
+//
+// @Summary 发送一条消息并返回对话ID
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body request.ChatCompletionRequest true "消息及所属对话"
+// @Success 200 {object} response.Envelope{data=response.CompletionResponse}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse "非管理员设置了system_prompt"
+// @Failure 429 {object} response.Envelope
+// @Failure 503 {object} response.ErrorResponse
+// @Router /api/v1/chat/completion [post]
 func (c *ChatRoute) chatCompletion(ctx *gin.Context) {
 	var req request.ChatCompletionRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -46,9 +181,22 @@ func (c *ChatRoute) chatCompletion(ctx *gin.Context) {
 		return
 	}
 
-	resp, err := c.lingChatService.LingChat(ctx, req.Message, req.ConversationID, req.PrevMessageID)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
+	reqCtx := ctx.Request.Context()
+	if req.SystemPrompt != "" {
+		// 替换人设只对管理员开放，避免任何调用方借此绕过部署的提示词
+		if !middleware.IsAdmin(ctx, c.AdminToken) {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"error": "只有管理员可以设置system_prompt",
+			})
+			return
+		}
+		reqCtx = llm.WithSystemPrompt(reqCtx, req.SystemPrompt)
+	}
+
+	resp, err := c.lingChatService.LingChat(reqCtx, req.Message, req.ConversationID, req.PrevMessageID)
+	// 未通过内容审核时照常返回安全回复，分段的errorCode为moderated
+	if err != nil && !(resp != nil && errors.Is(err, errs.ErrModerated)) {
+		ctx.JSON(errs.HTTPStatus(err), gin.H{
 			"error": "处理聊天请求失败: " + err.Error(),
 		})
 		return
@@ -60,15 +208,37 @@ func (c *ChatRoute) chatCompletion(ctx *gin.Context) {
 			ConversationID: resp.ConversationID,
 			MessageID:      resp.MessageID,
 			Messages:       resp.Messages,
+			Truncated:      resp.Truncated,
+			RequestID:      resp.RequestID,
+			RawLLMResponse: resp.RawLLMResponse,
 		},
 	})
 }
 
+// getChatHistory 返回旧版临时聊天上下文中的消息
+//
+// @Summary 获取临时聊天上下文
+// @Tags chat
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} object
+// @Router /api/v1/chat/history [get]
 func (c *ChatRoute) getChatHistory(ctx *gin.Context) {
 	history := c.lingChatService.GetChatHistory(ctx)
 	ctx.JSON(http.StatusOK, history)
 }
 
+// loadChatHistory 用请求中的消息替换旧版临时聊天上下文
+//
+// @Summary 替换临时聊天上下文
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body []object true "OpenAI格式的消息列表"
+// @Success 200 {array} object
+// @Failure 400 {object} response.ErrorResponse
+// @Router /api/v1/chat/history [post]
 func (c *ChatRoute) loadChatHistory(ctx *gin.Context) {
 	var messages []openai.ChatCompletionMessage
 	if err := ctx.ShouldBindJSON(&messages); err != nil {
@@ -0,0 +1,270 @@
+package v1
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+
+	"LingChat/api"
+	"LingChat/internal/clients/VitsTTS"
+	"LingChat/internal/clients/emotionPredictor"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/data/ent/ent/conversationmessage"
+	"LingChat/internal/service"
+)
+
+// fakeLLM 返回reply或err；block不为nil时先通知started，再等待ctx结束并把原因发到block
+type fakeLLM struct {
+	reply   string
+	err     error
+	started chan struct{}
+	block   chan error
+}
+
+func (f *fakeLLM) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (string, error) {
+	if f.block != nil {
+		close(f.started)
+		<-ctx.Done()
+		f.block <- ctx.Err()
+		return "", ctx.Err()
+	}
+	return f.reply, f.err
+}
+
+// fakeConversationRepo 只实现一轮新对话用到的方法，其余方法未实现，调用时panic
+type fakeConversationRepo struct {
+	data.ConversationRepo
+
+	mu       sync.Mutex
+	nextID   int64
+	messages map[int64]*ent.ConversationMessage
+	prev     map[int64]int64
+	saves    atomic.Int32
+}
+
+func newFakeConversationRepo() *fakeConversationRepo {
+	return &fakeConversationRepo{messages: make(map[int64]*ent.ConversationMessage), prev: make(map[int64]int64)}
+}
+
+func (r *fakeConversationRepo) newMessage(conversationID, prevID int64, role, content string) *ent.ConversationMessage {
+	r.nextID++
+	msg := &ent.ConversationMessage{ID: r.nextID, ConversationID: conversationID, Role: conversationmessage.Role(role), Content: content}
+	r.messages[msg.ID] = msg
+	r.prev[msg.ID] = prevID
+	return msg
+}
+
+func (r *fakeConversationRepo) GetMessageChain(ctx context.Context, messageID int64) ([]*ent.ConversationMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var chain []*ent.ConversationMessage
+	for id := messageID; id != 0; id = r.prev[id] {
+		chain = append([]*ent.ConversationMessage{r.messages[id]}, chain...)
+	}
+	return chain, nil
+}
+
+func (r *fakeConversationRepo) SaveTurn(ctx context.Context, turn data.TurnInput) (*ent.ConversationMessage, *ent.ConversationMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saves.Add(1)
+	prev := r.messages[turn.PrevMessageID]
+	if turn.Conversation != nil {
+		r.nextID++
+		conversationID := r.nextID
+		for _, m := range turn.Conversation.Messages {
+			var prevID int64
+			if prev != nil {
+				prevID = prev.ID
+			}
+			prev = r.newMessage(conversationID, prevID, m.Role, m.Content)
+		}
+	}
+	userMsg := r.newMessage(prev.ConversationID, prev.ID, string(conversationmessage.RoleUser), turn.UserContent)
+	reply := r.newMessage(prev.ConversationID, userMsg.ID, string(conversationmessage.RoleAssistant), turn.AssistantContent)
+	return userMsg, reply, nil
+}
+
+// newTestChatServer 启动只注册了ChatRoute的服务器，VITS和情绪预测服务返回固定结果
+func newTestChatServer(t *testing.T, llmClient *fakeLLM) (*httptest.Server, *fakeConversationRepo) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	vits := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("audio"))
+	}))
+	t.Cleanup(vits.Close)
+	emotion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"label":"开心","confidence":0.9}`)
+	}))
+	t.Cleanup(emotion.Close)
+
+	repo := newFakeConversationRepo()
+	chatService := service.NewLingChatService(
+		emotionPredictor.NewClient(emotion.URL),
+		VitsTTS.NewClient(vits.URL, "", 0),
+		llmClient,
+		service.NewConversationService(repo, nil, "test-model"),
+		"test-model",
+		t.TempDir(),
+	)
+	chatService.VitsTTSClient.MaxRetries = 0
+
+	r := gin.New()
+	NewChatRoute(chatService, nil, nil).RegisterRoute(r.Group("/api"))
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server, repo
+}
+
+// sseEvent 响应中的一个SSE事件
+type sseEvent struct {
+	name string
+	data api.Response
+}
+
+// readEvents 读取响应中的SSE事件，直到响应结束
+func readEvents(t *testing.T, resp *http.Response) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var name string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			var data api.Response
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &data); err != nil {
+				t.Fatalf("data %q is not a JSON response: %v", line, err)
+			}
+			events = append(events, sseEvent{name: name, data: data})
+		case line == "":
+			name = ""
+		default:
+			t.Errorf("unexpected SSE line %q", line)
+		}
+	}
+	return events
+}
+
+func postStream(ctx context.Context, url, content string) (*http.Response, error) {
+	body, _ := json.Marshal(api.Message{Type: api.MessageTypeMessage, Content: content})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/api/v1/chat/stream", strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return http.DefaultClient.Do(req)
+}
+
+func TestChatRoute_chatStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		llm       *fakeLLM
+		wantTypes []string
+		wantSaves int32
+	}{
+		{
+			name:      "每个分段一个事件，最后为done",
+			llm:       &fakeLLM{reply: "【开心】你好<こんにちは>【难过】再见<さよなら>"},
+			wantTypes: []string{"reply", "reply", api.ResponseTypeDone},
+			wantSaves: 1,
+		},
+		{
+			name:      "出错时以error事件结束",
+			llm:       &fakeLLM{err: errors.New("unavailable")},
+			wantTypes: []string{api.ResponseTypeError},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, repo := newTestChatServer(t, tt.llm)
+			resp, err := postStream(context.Background(), server.URL, "你好")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+				t.Fatalf("status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+			}
+
+			events := readEvents(t, resp)
+			var types []string
+			for _, event := range events {
+				if event.name != event.data.Type {
+					t.Errorf("event %q carries data of type %q", event.name, event.data.Type)
+				}
+				types = append(types, event.name)
+			}
+			if strings.Join(types, ",") != strings.Join(tt.wantTypes, ",") {
+				t.Fatalf("events = %v, want %v", types, tt.wantTypes)
+			}
+			if last := events[len(events)-1].data; last.Type == api.ResponseTypeError && (last.Error == "" || last.Code == 0) {
+				t.Errorf("error event = %+v, want error and code", last)
+			}
+			if got := repo.saves.Load(); got != tt.wantSaves {
+				t.Errorf("saved turns = %d, want %d", got, tt.wantSaves)
+			}
+		})
+	}
+}
+
+func TestChatRoute_chatStreamDisconnect(t *testing.T) {
+	llmClient := &fakeLLM{started: make(chan struct{}), block: make(chan error, 1)}
+	server, repo := newTestChatServer(t, llmClient)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		if resp, err := postStream(ctx, server.URL, "你好"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	select {
+	case <-llmClient.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("LLM not called")
+	}
+	cancel()
+	select {
+	case err := <-llmClient.block:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("LLM ctx error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("turn not cancelled after the client disconnected")
+	}
+	if got := repo.saves.Load(); got != 0 {
+		t.Errorf("saved turns = %d, want 0", got)
+	}
+}
+
+func TestChatRoute_chatStreamPostOnly(t *testing.T) {
+	server, _ := newTestChatServer(t, &fakeLLM{reply: "【开心】你好<こんにちは>"})
+	resp, err := http.Get(server.URL + "/api/v1/chat/stream?content=" + "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Errorf("GET status = %d, want the route to accept POST only", resp.StatusCode)
+	}
+}
@@ -0,0 +1,112 @@
+package v1
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/middleware"
+	"LingChat/api/routes/v1/request"
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/data"
+	"LingChat/internal/errs"
+	"LingChat/internal/service"
+	"LingChat/pkg/jwt"
+)
+
+type DebugRoute struct {
+	lingChatService *service.LingChatService
+	userRepo        data.UserRepo
+	jwt             *jwt.JWT
+	token           string
+}
+
+// NewDebugRoute 调试接口与管理接口的访问控制相同，使用同一个令牌
+func NewDebugRoute(lingChatService *service.LingChatService, userRepo data.UserRepo, jwt *jwt.JWT, token string) *DebugRoute {
+	return &DebugRoute{
+		lingChatService: lingChatService,
+		userRepo:        userRepo,
+		jwt:             jwt,
+		token:           token,
+	}
+}
+
+func (d *DebugRoute) RegisterRoute(r *gin.RouterGroup) {
+	rg := r.Group("/debug", middleware.AdminOnly(d.token, d.jwt, d.userRepo))
+	{
+		rg.POST("/pipeline", d.pipeline)
+	}
+}
+
+// pipeline 跳过LLM，对请求中的文本执行解析、语音合成和情绪预测，返回每个分段的中间结果和各阶段耗时
+//
+// @Summary 调试解析和情绪映射
+// @Tags debug
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Security BearerAuth
+// @Param body body request.DebugPipelineRequest true "按LLM回复格式书写的文本"
+// @Success 200 {object} response.Envelope{data=response.DebugPipelineResponse}
+// @Failure 400 {object} response.Envelope
+// @Failure 401 {object} response.Envelope
+// @Failure 403 {object} response.Envelope
+// @Router /api/debug/pipeline [post]
+func (d *DebugRoute) pipeline(c *gin.Context) {
+	var req request.DebugPipelineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	result, err := d.lingChatService.DebugPipeline(c.Request.Context(), req.Text)
+	if err != nil {
+		status := errs.HTTPStatus(err)
+		c.JSON(status, gin.H{
+			"code": status,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	resp := response.DebugPipelineResponse{
+		Segments: make([]response.PipelineSegment, 0, len(result.Segments)),
+		Timings: response.PipelineTimings{
+			ParseMs:   result.Timings.Parse.Milliseconds(),
+			VoiceMs:   result.Timings.Voice.Milliseconds(),
+			EmotionMs: result.Timings.Emotion.Milliseconds(),
+			TotalMs:   result.Timings.Total.Milliseconds(),
+		},
+	}
+	for _, segment := range result.Segments {
+		part := response.PipelineSegment{
+			Index:         segment.Index,
+			OriginalTag:   segment.OriginalTag,
+			FollowingText: segment.FollowingText,
+			MotionText:    segment.MotionText,
+			JapaneseText:  segment.JapaneseText,
+			SSML:          segment.SSML,
+			Language:      segment.Language,
+			Predicted:     segment.Predicted,
+			Confidence:    segment.Confidence,
+			Motion:        segment.Motion,
+			VoiceFile:     segment.VoiceFile,
+			AudioFile:     segment.AudioURL,
+			DurationMs:    segment.DurationMs,
+			VoiceError:    segment.VoiceError,
+		}
+		if len(segment.Audio) != 0 {
+			part.AudioData = base64.StdEncoding.EncodeToString(segment.Audio)
+			part.AudioFormat = segment.AudioFormat
+		}
+		resp.Segments = append(resp.Segments, part)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": resp,
+	})
+}
@@ -0,0 +1,80 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/middleware"
+	"LingChat/api/routes/v1/request"
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/data"
+	"LingChat/internal/service"
+	"LingChat/pkg/jwt"
+)
+
+type EmotionRoute struct {
+	lingChatService *service.LingChatService
+	userRepo        data.UserRepo
+	jwt             *jwt.JWT
+}
+
+func NewEmotionRoute(lingChatService *service.LingChatService, userRepo data.UserRepo, jwt *jwt.JWT) *EmotionRoute {
+	return &EmotionRoute{
+		lingChatService: lingChatService,
+		userRepo:        userRepo,
+		jwt:             jwt,
+	}
+}
+
+func (e *EmotionRoute) RegisterRoute(r *gin.RouterGroup) {
+	rg := r.Group("/v1/emotion")
+	{
+		rg.POST("", middleware.TokenAuth(false, e.jwt, e.userRepo), e.predict)
+	}
+}
+
+// predict 对单段文本做情绪预测，不经过聊天流程
+//
+// @Summary 预测文本情绪
+// @Tags emotion
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body request.EmotionPredictRequest true "文本和置信度阈值"
+// @Success 200 {object} response.Envelope{data=response.EmotionPredictResponse}
+// @Failure 400 {object} response.Envelope
+// @Failure 502 {object} response.Envelope
+// @Router /api/v1/emotion [post]
+func (e *EmotionRoute) predict(c *gin.Context) {
+	var req request.EmotionPredictRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请求格式错误: " + err.Error(),
+		})
+		return
+	}
+
+	threshold := e.lingChatService.EmotionThreshold
+	if req.Threshold != nil {
+		threshold = *req.Threshold
+	}
+
+	resp, err := e.lingChatService.PredictEmotion(c.Request.Context(), req.Text, threshold)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"code": http.StatusBadGateway,
+			"msg":  "情绪预测失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": response.EmotionPredictResponse{
+			Label:      resp.Label,
+			Confidence: resp.Confidence,
+		},
+	})
+}
@@ -0,0 +1,64 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/service"
+)
+
+// defaultProbeTimeout 健康检查探测下游服务的默认超时，避免拖住负载均衡器
+const defaultProbeTimeout = 2 * time.Second
+
+type HealthRoute struct {
+	lingChatService *service.LingChatService
+
+	// ProbeTimeout 单次健康检查的总超时
+	ProbeTimeout time.Duration
+}
+
+func NewHealthRoute(lingChatService *service.LingChatService) *HealthRoute {
+	return &HealthRoute{
+		lingChatService: lingChatService,
+		ProbeTimeout:    defaultProbeTimeout,
+	}
+}
+
+// Healthz 就绪探针，所有依赖可达时返回200，否则返回503并列出失败的依赖。
+// 负载均衡器通常直接请求根路径，因此不注册在/api下
+//
+// @Summary 就绪探针
+// @Tags health
+// @Produce json
+// @Success 200 {object} response.HealthResponse
+// @Failure 503 {object} response.HealthResponse
+// @Router /healthz [get]
+func (h *HealthRoute) Healthz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.ProbeTimeout)
+	defer cancel()
+
+	resp := response.HealthResponse{
+		Status:       "ok",
+		Dependencies: make(map[string]string),
+		Breakers:     make(map[string]string),
+	}
+	for name, state := range h.lingChatService.BreakerStates() {
+		resp.Breakers[name] = state.String()
+	}
+	code := http.StatusOK
+	for name, err := range h.lingChatService.CheckHealth(ctx) {
+		if err != nil {
+			resp.Status = "unavailable"
+			resp.Dependencies[name] = err.Error()
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Dependencies[name] = "ok"
+	}
+
+	c.JSON(code, resp)
+}
@@ -0,0 +1,136 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/middleware"
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/data"
+	"LingChat/internal/errs"
+	"LingChat/internal/service"
+	"LingChat/pkg/jwt"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 200
+)
+
+type HistoryRoute struct {
+	lingChatService *service.LingChatService
+	userRepo        data.UserRepo
+	jwt             *jwt.JWT
+}
+
+func NewHistoryRoute(lingChatService *service.LingChatService, userRepo data.UserRepo, jwt *jwt.JWT) *HistoryRoute {
+	return &HistoryRoute{
+		lingChatService: lingChatService,
+		userRepo:        userRepo,
+		jwt:             jwt,
+	}
+}
+
+func (h *HistoryRoute) RegisterRoute(r *gin.RouterGroup) {
+	rg := r.Group("/v1/history")
+	{
+		rg.GET("", middleware.TokenAuth(true, h.jwt, h.userRepo), h.getRecentHistory)
+		rg.DELETE("", middleware.TokenAuth(true, h.jwt, h.userRepo), h.deleteHistory)
+	}
+}
+
+// deleteHistory 删除当前用户的全部聊天记录，默认软删除，hard=true时永久删除
+//
+// @Summary 删除聊天记录
+// @Tags history
+// @Produce json
+// @Security BearerAuth
+// @Param hard query bool false "是否永久删除"
+// @Success 200 {object} response.Envelope{data=response.DeleteHistoryResponse}
+// @Failure 400 {object} response.Envelope
+// @Failure 401 {object} response.Envelope
+// @Router /api/v1/history [delete]
+func (h *HistoryRoute) deleteHistory(c *gin.Context) {
+	hard := false
+	if raw := c.Query("hard"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": http.StatusBadRequest,
+				"msg":  "invalid hard",
+			})
+			return
+		}
+		hard = v
+	}
+
+	deleted, err := h.lingChatService.DeleteHistory(c.Request.Context(), hard)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": http.StatusInternalServerError,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": response.DeleteHistoryResponse{Deleted: deleted, Hard: hard},
+	})
+}
+
+// getRecentHistory 按时间顺序返回当前用户最近的消息，带上before时返回该游标之前的一页
+//
+// @Summary 最近的聊天记录
+// @Tags history
+// @Produce json
+// @Security BearerAuth
+// @Param limit query int false "返回的消息数，默认20，最多200"
+// @Param before query string false "上一页响应中的next_cursor"
+// @Success 200 {object} response.Envelope{data=response.HistoryResponse}
+// @Failure 400 {object} response.Envelope
+// @Failure 401 {object} response.Envelope
+// @Router /api/v1/history [get]
+func (h *HistoryRoute) getRecentHistory(c *gin.Context) {
+	limit := defaultHistoryLimit
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": http.StatusBadRequest,
+				"msg":  "invalid limit",
+			})
+			return
+		}
+		limit = min(v, maxHistoryLimit)
+	}
+
+	msgs, next, err := h.lingChatService.GetRecentMessages(c.Request.Context(), limit, c.Query("before"))
+	if err != nil {
+		status := errs.HTTPStatus(err)
+		c.JSON(status, gin.H{
+			"code": status,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	history := make([]response.HistoryMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		history = append(history, response.HistoryMessage{
+			ID:             msg.ID,
+			ConversationID: msg.ConversationID,
+			Role:           string(msg.Role),
+			Content:        msg.Content,
+			Emotion:        msg.Emotion,
+			CreatedAt:      msg.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": response.HistoryResponse{Messages: history, NextCursor: next},
+	})
+}
@@ -0,0 +1,104 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/middleware"
+	"LingChat/api/routes/v1/request"
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/data"
+	"LingChat/internal/errs"
+	"LingChat/internal/service"
+	"LingChat/pkg/jwt"
+)
+
+type PreferencesRoute struct {
+	lingChatService *service.LingChatService
+	userRepo        data.UserRepo
+	jwt             *jwt.JWT
+}
+
+func NewPreferencesRoute(lingChatService *service.LingChatService, userRepo data.UserRepo, jwt *jwt.JWT) *PreferencesRoute {
+	return &PreferencesRoute{
+		lingChatService: lingChatService,
+		userRepo:        userRepo,
+		jwt:             jwt,
+	}
+}
+
+func (p *PreferencesRoute) RegisterRoute(r *gin.RouterGroup) {
+	rg := r.Group("/v1/preferences", middleware.TokenAuth(true, p.jwt, p.userRepo))
+	{
+		rg.GET("", p.getPreferences)
+		rg.PUT("", p.putPreferences)
+	}
+}
+
+// getPreferences 返回当前用户生效的偏好
+//
+// @Summary 获取偏好
+// @Tags preferences
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Envelope{data=response.PreferencesResponse}
+// @Failure 401 {object} response.Envelope
+// @Router /api/v1/preferences [get]
+func (p *PreferencesRoute) getPreferences(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": preferencesResponse(p.lingChatService.GetPreferences(c.Request.Context())),
+	})
+}
+
+// putPreferences 整体替换当前用户的偏好
+//
+// @Summary 替换偏好
+// @Tags preferences
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body request.PreferencesRequest true "新的偏好"
+// @Success 200 {object} response.Envelope{data=response.PreferencesResponse}
+// @Failure 400 {object} response.Envelope
+// @Failure 401 {object} response.Envelope
+// @Router /api/v1/preferences [put]
+func (p *PreferencesRoute) putPreferences(c *gin.Context) {
+	var req request.PreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	prefs, err := p.lingChatService.UpdatePreferences(c.Request.Context(), &data.Preferences{
+		SpeakerID:       req.SpeakerID,
+		Speed:           req.Speed,
+		Language:        req.Language,
+		PredictEmotions: req.PredictEmotions,
+	})
+	if err != nil {
+		status := errs.HTTPStatus(err)
+		c.JSON(status, gin.H{
+			"code": status,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": preferencesResponse(prefs),
+	})
+}
+
+func preferencesResponse(prefs service.Preferences) response.PreferencesResponse {
+	return response.PreferencesResponse{
+		SpeakerID:       prefs.SpeakerID,
+		Speed:           prefs.Speed,
+		Language:        prefs.Language,
+		PredictEmotions: prefs.PredictEmotions,
+	}
+}
@@ -0,0 +1,11 @@
+package request
+
+// RegenerateAudioRequest 重新合成一个分段的语音，声音参数留空时沿用用户偏好和默认设置
+type RegenerateAudioRequest struct {
+	Text      string   `json:"text" binding:"required"`
+	SpeakerID *int     `json:"speakerId,omitempty"`
+	Speed     *float64 `json:"speed,omitempty"`
+	Pitch     *float64 `json:"pitch,omitempty"`
+	// SSML text是否为SSML片段
+	SSML bool `json:"ssml,omitempty"`
+}
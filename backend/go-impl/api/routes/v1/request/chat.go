@@ -4,4 +4,6 @@ type ChatCompletionRequest struct {
 	Message        string `json:"message"`
 	ConversationID string `json:"conversation_id"`
 	PrevMessageID  string `json:"prev_message_id"`
+	// SystemPrompt 仅对本次请求生效的人设提示词，留空使用部署配置；只有管理员可以设置，其他调用方返回403
+	SystemPrompt string `json:"system_prompt,omitempty"`
 }
@@ -0,0 +1,6 @@
+package request
+
+// DebugPipelineRequest 调试流水线的输入，text按LLM回复的格式书写，如"【开心】你好<こんにちは>"
+type DebugPipelineRequest struct {
+	Text string `json:"text" binding:"required" example:"【开心】你好<こんにちは>"`
+}
@@ -0,0 +1,7 @@
+package request
+
+type EmotionPredictRequest struct {
+	Text string `json:"text" binding:"required"`
+	// Threshold 置信度阈值，留空使用服务默认值
+	Threshold *float64 `json:"threshold,omitempty"`
+}
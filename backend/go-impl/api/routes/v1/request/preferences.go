@@ -0,0 +1,10 @@
+package request
+
+// PreferencesRequest 整体替换当前用户的偏好，留空（null）的字段恢复为全局配置
+type PreferencesRequest struct {
+	SpeakerID *int     `json:"speaker_id"`
+	Speed     *float64 `json:"speed"`
+	// Language ISO 639-1语言代码，如zh、en
+	Language        *string `json:"language"`
+	PredictEmotions *bool   `json:"predict_emotions"`
+}
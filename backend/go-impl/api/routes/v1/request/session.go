@@ -0,0 +1,6 @@
+package request
+
+// CreateSessionRequest 创建会话，标题为空时使用默认标题
+type CreateSessionRequest struct {
+	Title string `json:"title"`
+}
@@ -0,0 +1,8 @@
+package response
+
+// RegenerateAudioResponse 重新合成的语音，与回复分段一样，内嵌音频时为audioData，否则为audioFile
+type RegenerateAudioResponse struct {
+	AudioFile   string `json:"audioFile,omitempty"`
+	AudioData   string `json:"audioData,omitempty"`
+	AudioFormat string `json:"audioFormat"`
+}
@@ -8,4 +8,12 @@ type CompletionResponse struct {
 	ConversationID string         `json:"conversation_id"`
 	MessageID      string         `json:"message_id"`
 	Messages       []api.Response `json:"messages"`
+	// Truncated 请求超时，部分分段的语音或情绪未能完成
+	Truncated bool `json:"truncated,omitempty"`
+	// RequestID 本轮对话的请求ID
+	RequestID string `json:"request_id,omitempty"`
+	// RawLLMResponse 调试请求时附带LLM解析前的原始回复
+	RawLLMResponse string `json:"raw_llm_response,omitempty"`
+	// UserEmotion 从用户消息预测出的情绪，未开启或预测未完成时为空
+	UserEmotion string `json:"user_emotion,omitempty"`
 }
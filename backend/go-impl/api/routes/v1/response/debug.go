@@ -0,0 +1,37 @@
+package response
+
+// PipelineSegment 调试流水线中一个分段的中间结果
+type PipelineSegment struct {
+	Index         int    `json:"index"`
+	OriginalTag   string `json:"original_tag"`
+	FollowingText string `json:"following_text"`
+	MotionText    string `json:"motion_text"`
+	JapaneseText  string `json:"japanese_text"`
+	SSML          bool   `json:"ssml"`
+	Language      string `json:"language,omitempty"`
+	// Predicted/Confidence 情绪预测的结果，未调用情绪服务时为标签本身，置信度为1
+	Predicted  string  `json:"predicted"`
+	Confidence float64 `json:"confidence"`
+	Motion     string  `json:"motion,omitempty"`
+	// VoiceFile 分段的语音文件路径，AudioFile为返回给前端的地址
+	VoiceFile   string `json:"voice_file,omitempty"`
+	AudioFile   string `json:"audio_file,omitempty"`
+	AudioData   string `json:"audio_data,omitempty"`
+	AudioFormat string `json:"audio_format,omitempty"`
+	DurationMs  int64  `json:"duration_ms"`
+	// VoiceError 语音合成失败的原因
+	VoiceError string `json:"voice_error,omitempty"`
+}
+
+// PipelineTimings 各阶段耗时（毫秒）
+type PipelineTimings struct {
+	ParseMs   int64 `json:"parse_ms"`
+	VoiceMs   int64 `json:"voice_ms"`
+	EmotionMs int64 `json:"emotion_ms"`
+	TotalMs   int64 `json:"total_ms"`
+}
+
+type DebugPipelineResponse struct {
+	Segments []PipelineSegment `json:"segments"`
+	Timings  PipelineTimings   `json:"timings"`
+}
@@ -0,0 +1,6 @@
+package response
+
+type EmotionPredictResponse struct {
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"`
+}
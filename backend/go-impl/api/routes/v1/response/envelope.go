@@ -0,0 +1,22 @@
+package response
+
+// Envelope 大多数接口的统一响应格式，成功时data为具体结果，失败时msg为错误信息。
+// 接口仍直接返回gin.H，这里只用于生成接口文档
+type Envelope struct {
+	Code int    `json:"code" example:"200"`
+	Msg  string `json:"msg,omitempty"`
+	Data any    `json:"data,omitempty"`
+}
+
+// ErrorResponse 聊天接口失败时的响应格式
+type ErrorResponse struct {
+	Error string `json:"error" example:"处理聊天请求失败: 服务繁忙"`
+}
+
+// UserResponse 注册或登录成功后的用户信息，令牌同时写入名为token的Cookie
+type UserResponse struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Token    string `json:"token"`
+}
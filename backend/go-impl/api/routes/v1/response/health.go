@@ -0,0 +1,10 @@
+package response
+
+type HealthResponse struct {
+	// Status 所有依赖可达时为ok，否则为unavailable
+	Status string `json:"status"`
+	// Dependencies 每个依赖的状态，可达时为ok，否则为错误信息
+	Dependencies map[string]string `json:"dependencies"`
+	// Breakers 每个依赖的熔断器状态：closed、open或half-open
+	Breakers map[string]string `json:"breakers"`
+}
@@ -0,0 +1,28 @@
+package response
+
+import (
+	"time"
+)
+
+// HistoryMessage 历史消息
+type HistoryMessage struct {
+	ID             int64     `json:"id"`
+	ConversationID int64     `json:"conversation_id"`
+	Role           string    `json:"role"`
+	Content        string    `json:"content"`
+	Emotion        string    `json:"emotion,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type HistoryResponse struct {
+	Messages []HistoryMessage `json:"messages"`
+	// NextCursor 作为before请求下一页更早的消息，没有更早的消息时为空
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// DeleteHistoryResponse 删除聊天记录的结果
+type DeleteHistoryResponse struct {
+	// Deleted 删除的消息数
+	Deleted int  `json:"deleted"`
+	Hard    bool `json:"hard"`
+}
@@ -0,0 +1,9 @@
+package response
+
+// PreferencesResponse 当前用户生效的偏好，未设置的项为全局配置的值
+type PreferencesResponse struct {
+	SpeakerID       int     `json:"speaker_id"`
+	Speed           float64 `json:"speed"`
+	Language        string  `json:"language"`
+	PredictEmotions bool    `json:"predict_emotions"`
+}
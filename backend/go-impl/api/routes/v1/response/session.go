@@ -0,0 +1,18 @@
+package response
+
+import (
+	"time"
+)
+
+// SessionResponse 聊天会话
+type SessionResponse struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt 最近一次在会话中发送消息的时间
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SessionListResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
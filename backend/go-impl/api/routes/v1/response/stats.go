@@ -0,0 +1,18 @@
+package response
+
+import (
+	"time"
+)
+
+// EmotionStat 一种情绪出现的次数及平均置信度
+type EmotionStat struct {
+	Emotion       string  `json:"emotion"`
+	Count         int     `json:"count"`
+	AvgConfidence float64 `json:"avg_confidence"`
+}
+
+type EmotionStatsResponse struct {
+	From     *time.Time    `json:"from,omitempty"`
+	To       *time.Time    `json:"to,omitempty"`
+	Emotions []EmotionStat `json:"emotions"`
+}
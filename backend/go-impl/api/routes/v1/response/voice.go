@@ -0,0 +1,8 @@
+package response
+
+// Speaker 可选的VITS说话人
+type Speaker struct {
+	ID   int      `json:"id"`
+	Name string   `json:"name"`
+	Lang []string `json:"lang"`
+}
@@ -0,0 +1,150 @@
+package v1
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/middleware"
+	"LingChat/api/routes/v1/request"
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/errs"
+	"LingChat/internal/logging"
+	"LingChat/internal/service"
+	"LingChat/pkg/jwt"
+)
+
+type SessionRoute struct {
+	lingChatService *service.LingChatService
+	userRepo        data.UserRepo
+	jwt             *jwt.JWT
+}
+
+func NewSessionRoute(lingChatService *service.LingChatService, userRepo data.UserRepo, jwt *jwt.JWT) *SessionRoute {
+	return &SessionRoute{
+		lingChatService: lingChatService,
+		userRepo:        userRepo,
+		jwt:             jwt,
+	}
+}
+
+func (s *SessionRoute) RegisterRoute(r *gin.RouterGroup) {
+	rg := r.Group("/v1/sessions", middleware.TokenAuth(true, s.jwt, s.userRepo))
+	{
+		rg.POST("", s.createSession)
+		rg.GET("", s.listSessions)
+		rg.GET("/:id/export", s.exportSession)
+	}
+}
+
+// createSession 为当前用户创建会话，请求体可以为空
+//
+// @Summary 创建会话
+// @Tags session
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body request.CreateSessionRequest false "会话标题"
+// @Success 200 {object} response.Envelope{data=response.SessionResponse}
+// @Failure 400 {object} response.Envelope
+// @Failure 401 {object} response.Envelope
+// @Router /api/v1/sessions [post]
+func (s *SessionRoute) createSession(c *gin.Context) {
+	var req request.CreateSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	session, err := s.lingChatService.CreateSession(c.Request.Context(), req.Title)
+	if err != nil {
+		status := errs.HTTPStatus(err)
+		c.JSON(status, gin.H{
+			"code": status,
+			"msg":  err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": sessionResponse(session),
+	})
+}
+
+// listSessions 按最近活跃时间从新到旧返回当前用户的会话
+//
+// @Summary 会话列表
+// @Tags session
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Envelope{data=response.SessionListResponse}
+// @Failure 401 {object} response.Envelope
+// @Router /api/v1/sessions [get]
+func (s *SessionRoute) listSessions(c *gin.Context) {
+	sessions, err := s.lingChatService.ListSessions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": http.StatusInternalServerError,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	list := make([]response.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		list = append(list, sessionResponse(session))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": response.SessionListResponse{Sessions: list},
+	})
+}
+
+// exportSession 下载会话中的全部消息，format为txt（默认）或json；消息逐批读取并写出，很长的会话也不会整段读入内存
+//
+// @Summary 导出会话
+// @Tags session
+// @Produce plain,json
+// @Security BearerAuth
+// @Param id path int true "会话ID"
+// @Param format query string false "导出格式" Enums(txt,json) default(txt)
+// @Success 200 {string} string "会话内容，json格式为{session, messages}"
+// @Failure 400 {object} response.Envelope
+// @Failure 401 {object} response.Envelope
+// @Failure 403 {object} response.Envelope
+// @Router /api/v1/sessions/{id}/export [get]
+func (s *SessionRoute) exportSession(c *gin.Context) {
+	export, err := s.lingChatService.ExportSession(c.Request.Context(), c.Param("id"), c.DefaultQuery("format", service.ExportFormatText))
+	if err != nil {
+		status := errs.HTTPStatus(err)
+		c.JSON(status, gin.H{
+			"code": status,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType())
+	c.Header("Content-Disposition", `attachment; filename="`+export.Filename()+`"`)
+	c.Status(http.StatusOK)
+	if err := export.WriteTo(c.Request.Context(), c.Writer); err != nil {
+		// 响应已经开始写出，只能记录错误，客户端收到的内容不完整
+		logging.FromContext(c.Request.Context()).Error("导出会话失败", "session", export.Session.ID, "err", err)
+	}
+}
+
+func sessionResponse(session *ent.Session) response.SessionResponse {
+	return response.SessionResponse{
+		ID:        session.ID,
+		Title:     session.Title,
+		CreatedAt: session.CreatedAt,
+		UpdatedAt: session.UpdatedAt,
+	}
+}
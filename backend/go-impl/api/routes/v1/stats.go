@@ -0,0 +1,106 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/middleware"
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/data"
+	"LingChat/internal/service"
+	"LingChat/pkg/jwt"
+)
+
+type StatsRoute struct {
+	lingChatService *service.LingChatService
+	userRepo        data.UserRepo
+	jwt             *jwt.JWT
+}
+
+func NewStatsRoute(lingChatService *service.LingChatService, userRepo data.UserRepo, jwt *jwt.JWT) *StatsRoute {
+	return &StatsRoute{
+		lingChatService: lingChatService,
+		userRepo:        userRepo,
+		jwt:             jwt,
+	}
+}
+
+func (s *StatsRoute) RegisterRoute(r *gin.RouterGroup) {
+	rg := r.Group("/v1/stats")
+	{
+		rg.GET("/emotions", middleware.TokenAuth(true, s.jwt, s.userRepo), s.emotionStats)
+	}
+}
+
+// emotionStats 按情绪统计当前用户在[from, to)内收到的回复分段数，from和to可省略
+//
+// @Summary 情绪统计
+// @Tags stats
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "起始时间，RFC3339或2006-01-02"
+// @Param to query string false "结束时间（不含），RFC3339或2006-01-02"
+// @Success 200 {object} response.Envelope{data=response.EmotionStatsResponse}
+// @Failure 400 {object} response.Envelope
+// @Failure 401 {object} response.Envelope
+// @Router /api/v1/stats/emotions [get]
+func (s *StatsRoute) emotionStats(c *gin.Context) {
+	from, err := parseTimeQuery(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "invalid from",
+		})
+		return
+	}
+	to, err := parseTimeQuery(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "invalid to",
+		})
+		return
+	}
+
+	counts, err := s.lingChatService.EmotionStats(c.Request.Context(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": http.StatusInternalServerError,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	resp := response.EmotionStatsResponse{Emotions: make([]response.EmotionStat, 0, len(counts))}
+	if !from.IsZero() {
+		resp.From = &from
+	}
+	if !to.IsZero() {
+		resp.To = &to
+	}
+	for _, count := range counts {
+		resp.Emotions = append(resp.Emotions, response.EmotionStat{
+			Emotion:       count.Emotion,
+			Count:         count.Count,
+			AvgConfidence: count.AvgConfidence,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": resp,
+	})
+}
+
+// parseTimeQuery 解析RFC3339时间或"2006-01-02"格式的日期（按本地时区），空字符串返回零值
+func parseTimeQuery(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, raw, time.Local)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"LingChat/api/routes/v1/request"
+	"LingChat/api/routes/v1/response"
 	"LingChat/internal/data"
 	"LingChat/internal/data/ent/ent"
 	"LingChat/internal/service"
@@ -30,6 +31,16 @@ func (u *UserRoute) RegisterRoute(r *gin.RouterGroup) {
 }
 
 // register 用户注册处理
+//
+// @Summary 用户注册
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param body body request.UserRequest true "用户名、密码和邮箱"
+// @Success 200 {object} response.Envelope{data=response.UserResponse}
+// @Failure 400 {object} response.Envelope
+// @Failure 500 {object} response.Envelope
+// @Router /api/v1/user/register [post]
 func (u *UserRoute) register(c *gin.Context) {
 	var req request.UserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -53,22 +64,33 @@ func (u *UserRoute) register(c *gin.Context) {
 		return
 	}
 
-	// 设置Cookie
+	// 设置Cookie，SameSite=Lax时第三方页面发起的跨站请求不带上令牌
+	c.SetSameSite(http.SameSiteLaxMode)
 	c.SetCookie("token", token, 86400, "/", "", false, true) // 1天有效期
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": http.StatusOK,
 		"msg":  "Registration successful",
-		"data": gin.H{
-			"user_id":  user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"token":    token,
+		"data": response.UserResponse{
+			UserID:   user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			Token:    token,
 		},
 	})
 }
 
 // login 用户登录处理
+//
+// @Summary 用户登录
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param body body request.UserRequest false "用户名和密码，为空时按游客登录"
+// @Success 200 {object} response.Envelope{data=response.UserResponse}
+// @Failure 400 {object} response.Envelope
+// @Failure 401 {object} response.Envelope
+// @Router /api/v1/user/login [post]
 func (u *UserRoute) login(c *gin.Context) {
 	var req request.UserRequest
 	var user *ent.User
@@ -98,17 +120,18 @@ func (u *UserRoute) login(c *gin.Context) {
 		return
 	}
 
-	// 设置Cookie
+	// 设置Cookie，SameSite=Lax时第三方页面发起的跨站请求不带上令牌
+	c.SetSameSite(http.SameSiteLaxMode)
 	c.SetCookie("token", token, int(7*24*time.Hour), "/", "", false, true) // 7天有效期
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": http.StatusOK,
 		"msg":  "Login successful",
-		"data": gin.H{
-			"user_id":  user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"token":    token,
+		"data": response.UserResponse{
+			UserID:   user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			Token:    token,
 		},
 	})
 }
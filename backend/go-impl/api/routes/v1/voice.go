@@ -0,0 +1,60 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/service"
+)
+
+type VoiceRoute struct {
+	lingChatService *service.LingChatService
+}
+
+func NewVoiceRoute(lingChatService *service.LingChatService) *VoiceRoute {
+	return &VoiceRoute{
+		lingChatService: lingChatService,
+	}
+}
+
+func (v *VoiceRoute) RegisterRoute(r *gin.RouterGroup) {
+	rg := r.Group("/v1/voices")
+	{
+		rg.GET("", v.listVoices)
+	}
+}
+
+// listVoices 返回VITS服务可用的说话人，供前端选择声音
+//
+// @Summary 可用说话人
+// @Tags voice
+// @Produce json
+// @Success 200 {object} response.Envelope{data=[]response.Speaker}
+// @Failure 502 {object} response.Envelope
+// @Router /api/v1/voices [get]
+func (v *VoiceRoute) listVoices(c *gin.Context) {
+	speakers, err := v.lingChatService.ListSpeakers(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"code": http.StatusBadGateway,
+			"msg":  "获取说话人列表失败: " + err.Error(),
+		})
+		return
+	}
+
+	resp := make([]response.Speaker, 0, len(speakers))
+	for _, speaker := range speakers {
+		resp = append(resp, response.Speaker{
+			ID:   speaker.ID,
+			Name: speaker.Name,
+			Lang: speaker.Lang,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"data": resp,
+	})
+}
@@ -0,0 +1,19 @@
+// Package swagger 由swag根据路由上的注释生成的OpenAPI文档。
+// 只有带swagger构建标签编译时才会注册/swagger页面，生产构建不包含
+//
+// @title LingChat API
+// @version 1.0
+// @description LingChat后端的HTTP接口，WebSocket消息的格式与POST /v1/chat相同
+// @BasePath /
+//
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description 登录返回的令牌，也可以放在名为token的Cookie中
+//
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name X-Admin-Token
+package swagger
+
+//go:generate go tool swag init --quiet -g generate.go -d .,../routes/v1 --parseDependency --parseDepth 1 -o . --ot go,json --packageName swagger
@@ -1,47 +1,153 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+
+	"LingChat/internal/errs"
+)
+
+// WS消息类型
+const (
+	// MessageTypeMessage 用户发送的聊天消息，会取消上一轮未完成的对话
+	MessageTypeMessage = "message"
+	// MessageTypeCancel 取消当前正在处理的对话
+	MessageTypeCancel = "cancel"
+	// ResponseTypeCancelled 对话被取消后服务器发送的响应类型
+	ResponseTypeCancelled = "cancelled"
+	// ResponseTypeStatus 进度事件，Stage为开始的阶段，PartIndex为对应的分段；不认识该类型的客户端可以忽略
+	ResponseTypeStatus = "status"
+	// ResponseTypeAudioChunk 分段语音合成过程中的一块音频，AudioData为该块的base64，
+	// 按ChunkIndex顺序拼接即为PartIndex分段的语音；该分段的reply仍带完整音频，不认识该类型的客户端可以忽略
+	ResponseTypeAudioChunk = "audio_chunk"
+	// ResponseTypeText 回复解析出分段后立即发送的分段文本，语音合成前前端即可显示；
+	// Message、MotionText、OriginalTag与之后同一PartIndex的reply相同，情绪和音频随reply发送
+	ResponseTypeText = "text"
+	// ResponseTypeAudio PartIndex分段的语音已就绪，AudioFile/AudioData与之后的reply相同；
+	// 合成失败的分段不发送，其reply的audioFile为空
+	ResponseTypeAudio = "audio"
+	// ResponseTypeUserEmotion 从用户消息预测出的情绪，在LLM回复之前发送，UserEmotion为情绪
+	ResponseTypeUserEmotion = "user_emotion"
+	// ResponseTypeDone SSE流中本轮对话的全部分段已发送，之后服务器关闭响应
+	ResponseTypeDone = "done"
+)
+
+// 进度事件的阶段
+const (
+	StageLLM     = "llm"
+	StageTTS     = "tts"
+	StageEmotion = "emotion"
 )
 
 // Message 表示预期的 JSON 结构
 type Message struct {
-	Type    string `json:"type"`
-	Content string `json:"content"`
+	Type    string `json:"type" example:"message" enums:"message,cancel,handshake,ping"`
+	Content string `json:"content" example:"你好"`
+	// IdempotencyKey 客户端为每条消息生成的唯一键，网络重试时带上同一个键，
+	// 服务器返回上一次的回复而不是重新生成；只对已登录的请求生效
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// SessionID 消息所属的会话，带上后回复基于该会话的历史；为空时开始一段新对话
+	SessionID string `json:"sessionId,omitempty"`
 }
 
 // Response 表示服务器响应结构
 type Response struct {
-	Type            string `json:"type" yaml:"type"`
-	Emotion         string `json:"emotion" yaml:"emotion"`
-	OriginalTag     string `json:"originalTag" yaml:"originalTag"`
-	Message         string `json:"message" yaml:"message"`
-	MotionText      string `json:"motionText" yaml:"motionText"`
-	AudioFile       string `json:"audioFile" yaml:"audioFile"`
+	Type        string `json:"type" yaml:"type"`
+	Emotion     string `json:"emotion" yaml:"emotion"`
+	OriginalTag string `json:"originalTag" yaml:"originalTag"`
+	Message     string `json:"message" yaml:"message"`
+	MotionText  string `json:"motionText" yaml:"motionText"`
+	// Motion 虚拟形象播放的动作，由情绪映射得到
+	Motion    string `json:"motion,omitempty" yaml:"motion,omitempty"`
+	AudioFile string `json:"audioFile" yaml:"audioFile"`
+	// AudioData 开启内嵌音频时的base64音频，此时AudioFile为空
+	AudioData   string `json:"audioData,omitempty" yaml:"audioData,omitempty"`
+	AudioFormat string `json:"audioFormat,omitempty" yaml:"audioFormat,omitempty"`
+	// DurationMs 该分段语音的时长（毫秒），前端据此安排动作和字幕；没有音频时为0。
+	// 拼接音频时仍为该分段自己的时长，按PartIndex累加即为分段在拼接语音中的起始位置
+	DurationMs int64 `json:"durationMs" yaml:"durationMs"`
+	// CombinedAudio 为true时AudioFile/AudioData是整条回复拼接后的语音，其余分段没有音频
+	CombinedAudio   bool   `json:"combinedAudio,omitempty" yaml:"combinedAudio,omitempty"`
 	OriginalMessage string `json:"originalMessage" yaml:"originalMessage"`
 	IsMultiPart     bool   `json:"isMultiPart" yaml:"isMultiPart"`
 	PartIndex       int    `json:"partIndex" yaml:"partIndex"`
 	TotalParts      int    `json:"totalParts" yaml:"totalParts"`
-	Error           string `json:"error,omitempty"`
+	// AudioUnavailable 该分段的语音合成失败（包括VITS返回空音频），没有AudioFile/AudioData，前端只显示文字。
+	// 拼接音频时其余分段没有音频，但不算不可用
+	AudioUnavailable bool `json:"audioUnavailable,omitempty" yaml:"audioUnavailable,omitempty"`
+	// Truncated 请求超时，该分段的语音或情绪可能不完整
+	Truncated bool `json:"truncated,omitempty" yaml:"truncated,omitempty"`
+	// RequestID 本轮对话的请求ID，反馈问题时可提供
+	RequestID string `json:"requestId,omitempty" yaml:"requestId,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Code 错误响应的状态码，与HTTP接口对同类错误返回的状态码一致
+	Code int `json:"code,omitempty"`
+	// ErrorCode 错误响应的错误码，见errs.Code
+	ErrorCode string `json:"errorCode,omitempty"`
+	// Stage status事件的阶段，见StageLLM等
+	Stage string `json:"stage,omitempty" yaml:"stage,omitempty"`
+	// ChunkIndex audio_chunk事件在该分段中的序号，从0开始（为0时省略）
+	ChunkIndex int `json:"chunkIndex,omitempty" yaml:"chunkIndex,omitempty"`
+	// UserEmotion 从用户消息预测出的情绪，user_emotion事件和第一个分段中返回，未开启或预测未完成时为空
+	UserEmotion string `json:"userEmotion,omitempty" yaml:"userEmotion,omitempty"`
+	// RawLLMResponse 调试请求时在第一个分段中附带LLM解析前的原始回复
+	RawLLMResponse string `json:"rawLLMResponse,omitempty" yaml:"rawLLMResponse,omitempty"`
 }
 
 type Sentence []byte
 
 // MessageHandler 定义消息处理接口
-type MessageHandler func([]byte) ([]Sentence, error)
+type MessageHandler func(ctx context.Context, rawMsg []byte) ([]Sentence, error)
+
+// StreamMessageHandler 定义流式消息处理接口，处理过程中可多次调用send逐条发送响应
+type StreamMessageHandler func(ctx context.Context, rawMsg []byte, send func([]byte) error) error
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 	CheckOrigin:     func(r *http.Request) bool { return true }, // 允许所有来源
+	// 客户端用AuthSubprotocol传递令牌时需要回应该子协议，否则浏览器会断开连接
+	Subprotocols: []string{AuthSubprotocol},
 }
 
-var TestHandler MessageHandler = func(rawMsg []byte) ([]Sentence, error) {
+// AuthSubprotocol 浏览器无法在WebSocket握手中设置请求头，可以用子协议传递登录令牌：
+// new WebSocket(url, ["bearer", token])，token为不带"Bearer "前缀的JWT
+const AuthSubprotocol = "bearer"
+
+// HandshakeToken 取出握手请求中的登录令牌，依次查找Authorization头、token查询参数和AuthSubprotocol子协议，
+// 返回带"Bearer "前缀的令牌，没有时返回空字符串。
+// 不读取token cookie：upgrader接受任意来源，浏览器会为第三方页面发起的握手带上cookie
+func HandshakeToken(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		protocols := websocket.Subprotocols(r)
+		for i, protocol := range protocols {
+			if protocol == AuthSubprotocol && i+1 < len(protocols) {
+				token = protocols[i+1]
+				break
+			}
+		}
+	}
+	if token != "" && !strings.HasPrefix(token, "Bearer ") {
+		token = "Bearer " + token
+	}
+	return token
+}
+
+var TestHandler MessageHandler = func(ctx context.Context, rawMsg []byte) ([]Sentence, error) {
 	var msg Message
 	err := json.Unmarshal(rawMsg, &msg)
 	if err != nil {
@@ -68,34 +174,116 @@ var TestHandler MessageHandler = func(rawMsg []byte) ([]Sentence, error) {
 	return []Sentence{responseJSON}, nil
 }
 
+// 心跳的默认设置
+const (
+	// DefaultPingInterval 服务器发送ping帧的默认间隔
+	DefaultPingInterval = 30 * time.Second
+	// DefaultPongTimeout 发送ping后等待pong的默认超时
+	DefaultPongTimeout = 10 * time.Second
+)
+
 // WebSocketHandler 管理 WebSocket 连接
 type WebSocketHandler struct {
-	handler MessageHandler
+	handler StreamMessageHandler
+
+	// PingInterval 发送ping帧的间隔，<=0表示不发送心跳
+	PingInterval time.Duration
+	// PongTimeout 发送ping后在该时间内没有收到pong或其他消息时关闭连接
+	PongTimeout time.Duration
+	// Compression 客户端支持时启用permessage-deflate，按策略逐条决定是否压缩；为nil时不压缩
+	Compression *CompressionPolicy
+	// Authenticate 升级前校验握手请求（令牌见HandshakeToken），返回处理该连接上所有消息的ctx，
+	// 通常带上common.GetUserFromContext能取到的用户；返回错误时以401拒绝升级。为nil时不校验
+	Authenticate func(r *http.Request) (context.Context, error)
 }
 
 // NewWebSocketHandler 创建新的 WebSocket 服务器
 func NewWebSocketHandler(handler MessageHandler) *WebSocketHandler {
+	return NewStreamWebSocketHandler(func(ctx context.Context, rawMsg []byte, send func([]byte) error) error {
+		rawResp, err := handler(ctx, rawMsg)
+		if err != nil {
+			return err
+		}
+		for _, msg := range rawResp {
+			if err := send(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// NewStreamWebSocketHandler 创建使用流式处理器的 WebSocket 服务器
+func NewStreamWebSocketHandler(handler StreamMessageHandler) *WebSocketHandler {
 	return &WebSocketHandler{
-		handler: handler,
+		handler:      handler,
+		PingInterval: DefaultPingInterval,
+		PongTimeout:  DefaultPongTimeout,
 	}
 }
 
+// HandleWebSocket 处理一条WebSocket连接。
+// 每条"message"消息作为一轮对话在后台处理，连接可以继续接收消息：
+// 新的"message"会取消上一轮尚未完成的处理，前端也可以发送{"type":"cancel"}只取消不开始新的一轮。
+// 被取消的一轮不再推送剩余分段，结束后发送{"type":"cancelled"}
 func (s *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	// 将 HTTP 连接升级为 WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	connCtx := r.Context()
+	if s.Authenticate != nil {
+		var err error
+		if connCtx, err = s.Authenticate(r); err != nil {
+			log.Printf("WebSocket握手认证失败: %s: %v", r.RemoteAddr, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"code": http.StatusUnauthorized, "msg": err.Error()})
+			return
+		}
+	}
+
+	// 将 HTTP 连接升级为 WebSocket，是否实际启用压缩由客户端的握手决定
+	u := upgrader
+	u.EnableCompression = s.Compression != nil
+	conn, err := u.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket升级错误: %v", err)
 		return
 	}
 	defer conn.Close()
 
+	ctx, cancel := context.WithCancel(connCtx)
+	defer cancel()
+
 	log.Printf("新的WebSocket连接已建立: %s", r.RemoteAddr)
 
+	// 后台的对话和读循环都会写连接，需要串行化
+	var writeMu sync.Mutex
+	write := func(msg []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		// 没有协商压缩时EnableWriteCompression不起作用
+		conn.EnableWriteCompression(s.Compression.AllowsMessage(msg))
+		return conn.WriteMessage(websocket.TextMessage, msg)
+	}
+
+	s.keepAlive(ctx, conn)
+
+	var current *turn
+	stopCurrent := func() {
+		if current != nil {
+			current.cancel()
+			<-current.done
+			current = nil
+		}
+	}
+	defer stopCurrent()
+
 	for {
 		// 读取消息
 		_, rawMessage, err := conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("WebSocket心跳超时，关闭连接: %s", r.RemoteAddr)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket连接异常关闭: %v", err)
 			} else {
 				log.Println("读取错误:", err)
@@ -103,30 +291,120 @@ func (s *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Reques
 			break
 		}
 
-		// 处理消息
-		rawResp, err := s.handler(rawMessage)
-		if err != nil {
-			log.Printf("消息处理错误: %v", err)
-			errorResp := Response{
-				Type:  "error",
-				Error: err.Error(),
-			}
-			errorJSON, _ := json.Marshal(errorResp)
-			if err := conn.WriteMessage(websocket.TextMessage, errorJSON); err != nil {
-				log.Printf("发送错误响应失败: %v", err)
-				break
+		s.extendReadDeadline(conn)
+
+		// 格式错误的消息交给处理器报告
+		var msg Message
+		_ = json.Unmarshal(rawMessage, &msg)
+		switch msg.Type {
+		case MessageTypeCancel:
+			stopCurrent()
+		case MessageTypeMessage:
+			stopCurrent()
+			current = s.startTurn(ctx, rawMessage, write, func() { conn.Close() })
+		default:
+			// 其他消息（握手、心跳等）很快处理完，不影响正在进行的对话
+			if !s.handle(ctx, rawMessage, write) {
+				conn.Close()
 			}
-			continue
 		}
+	}
 
-		// 发送响应
-		for _, msg := range rawResp {
-			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-				log.Printf("发送响应失败: %v", err)
-				break
+	log.Printf("WebSocket连接已关闭: %s", r.RemoteAddr)
+}
+
+// keepAlive 每隔PingInterval发送ping，收到pong时延长读超时；
+// 对端失联时ReadMessage超时返回，读循环随之退出并取消连接上的对话。ctx结束时停止发送
+func (s *WebSocketHandler) keepAlive(ctx context.Context, conn *websocket.Conn) {
+	if s.PingInterval <= 0 {
+		return
+	}
+	s.extendReadDeadline(conn)
+	conn.SetPongHandler(func(string) error {
+		s.extendReadDeadline(conn)
+		return nil
+	})
+
+	go func() {
+		ticker := time.NewTicker(s.PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// WriteControl可以与其他写操作并发调用
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.PongTimeout)); err != nil {
+					return
+				}
 			}
 		}
+	}()
+}
+
+// extendReadDeadline 在下一次ping的pong超时之前必须收到数据
+func (s *WebSocketHandler) extendReadDeadline(conn *websocket.Conn) {
+	if s.PingInterval <= 0 {
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(s.PingInterval + s.PongTimeout))
+}
+
+// turn 一轮正在后台处理的对话
+type turn struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startTurn 在后台处理一轮对话，发送失败时调用closeConn关闭连接以结束读循环
+func (s *WebSocketHandler) startTurn(ctx context.Context, rawMessage []byte, write func([]byte) error, closeConn func()) *turn {
+	ctx, cancel := context.WithCancel(ctx)
+	t := &turn{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		defer cancel()
+		if !s.handle(ctx, rawMessage, write) {
+			closeConn()
+		}
+	}()
+	return t
+}
+
+// handle 调用处理器并发送响应或错误，连接不可用时返回false
+func (s *WebSocketHandler) handle(ctx context.Context, rawMessage []byte, write func([]byte) error) bool {
+	var sendErr error
+	send := func(msg []byte) error {
+		// 已取消的对话不再推送
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := write(msg); err != nil {
+			sendErr = err
+			return err
+		}
+		return nil
+	}
+	err := s.handler(ctx, rawMessage, send)
+	if sendErr != nil {
+		log.Printf("发送响应失败: %v", sendErr)
+		return false
 	}
 
-	log.Printf("WebSocket连接已关闭: %s", r.RemoteAddr)
+	var resp Response
+	switch {
+	case ctx.Err() != nil:
+		log.Printf("本轮对话已取消: %v", ctx.Err())
+		resp = Response{Type: ResponseTypeCancelled}
+	case err != nil:
+		log.Printf("消息处理错误: %v", err)
+		resp = Response{Type: ResponseTypeError, Error: err.Error(), Code: errs.HTTPStatus(err), ErrorCode: errs.Code(err)}
+	default:
+		return true
+	}
+	respJSON, _ := json.Marshal(resp)
+	if err := write(respJSON); err != nil {
+		log.Printf("发送响应失败: %v", err)
+		return false
+	}
+	return true
 }
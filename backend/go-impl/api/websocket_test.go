@@ -1,10 +1,13 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -81,3 +84,250 @@ func TestWebSocketServer(t *testing.T) {
 		})
 	}
 }
+
+func TestStreamWebSocketServer(t *testing.T) {
+	parts := []string{"part-0", "part-1", "part-2"}
+	wsServer := NewStreamWebSocketHandler(func(ctx context.Context, rawMsg []byte, send func([]byte) error) error {
+		for _, p := range parts {
+			if err := send([]byte(p)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	server := httptest.NewServer(http.HandlerFunc(wsServer.HandleWebSocket))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("无法连接到 WebSocket 服务器: %v", err)
+	}
+	defer ws.Close()
+
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"message","content":"hi"}`)); err != nil {
+		t.Fatalf("发送消息错误: %v", err)
+	}
+
+	// 每个分段应作为独立的消息按顺序到达
+	for _, expected := range parts {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		_, response, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("读取响应错误: %v", err)
+		}
+		if string(response) != expected {
+			t.Errorf("响应不匹配。期望: %s, 实际: %s", expected, response)
+		}
+	}
+}
+
+func TestWebSocketCancel(t *testing.T) {
+	wsServer := NewStreamWebSocketHandler(func(ctx context.Context, rawMsg []byte, send func([]byte) error) error {
+		var msg Message
+		json.Unmarshal(rawMsg, &msg)
+		if msg.Content == "slow" {
+			// 模拟耗时的LLM/TTS处理，直到被取消
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return send([]byte("done:" + msg.Content))
+	})
+	server := httptest.NewServer(http.HandlerFunc(wsServer.HandleWebSocket))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("无法连接到 WebSocket 服务器: %v", err)
+	}
+	defer ws.Close()
+
+	read := func() string {
+		t.Helper()
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		_, response, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("读取响应错误: %v", err)
+		}
+		return string(response)
+	}
+	cancelledJSON, _ := json.Marshal(Response{Type: ResponseTypeCancelled})
+	cancelled := string(cancelledJSON)
+
+	testCases := []struct {
+		name     string
+		messages []string
+		expected []string
+	}{
+		{
+			name:     "新消息取消上一轮",
+			messages: []string{`{"type":"message","content":"slow"}`, `{"type":"message","content":"next"}`},
+			expected: []string{cancelled, "done:next"},
+		},
+		{
+			name:     "显式取消",
+			messages: []string{`{"type":"message","content":"slow"}`, `{"type":"cancel"}`},
+			expected: []string{cancelled},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, m := range tc.messages {
+				if err := ws.WriteMessage(websocket.TextMessage, []byte(m)); err != nil {
+					t.Fatalf("发送消息错误: %v", err)
+				}
+			}
+			for _, expected := range tc.expected {
+				if got := read(); got != expected {
+					t.Errorf("响应不匹配。期望: %s, 实际: %s", expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWebSocketKeepAlive(t *testing.T) {
+	wsServer := NewWebSocketHandler(TestHandler)
+	wsServer.PingInterval = 50 * time.Millisecond
+	wsServer.PongTimeout = 50 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(wsServer.HandleWebSocket))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	t.Run("回复pong的连接保持打开", func(t *testing.T) {
+		ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("无法连接到 WebSocket 服务器: %v", err)
+		}
+		defer ws.Close()
+
+		// 客户端读取时会自动回复pong
+		responses := make(chan []byte)
+		go func() {
+			for {
+				_, msg, err := ws.ReadMessage()
+				if err != nil {
+					close(responses)
+					return
+				}
+				responses <- msg
+			}
+		}()
+		time.Sleep(300 * time.Millisecond)
+
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"message","content":"hi"}`)); err != nil {
+			t.Fatalf("发送消息错误: %v", err)
+		}
+		select {
+		case msg, ok := <-responses:
+			if !ok {
+				t.Fatal("连接被服务器关闭")
+			}
+			if !strings.Contains(string(msg), "hi") {
+				t.Errorf("响应不匹配: %s", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("读取响应超时")
+		}
+	})
+
+	t.Run("不回复pong的连接被关闭", func(t *testing.T) {
+		ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("无法连接到 WebSocket 服务器: %v", err)
+		}
+		defer ws.Close()
+
+		// 不读取就不会回复pong
+		time.Sleep(300 * time.Millisecond)
+
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			_, _, err := ws.ReadMessage()
+			if err == nil {
+				continue
+			}
+			if netErr, ok := err.(interface{ Timeout() bool }); ok && netErr.Timeout() {
+				t.Fatalf("连接没有被服务器关闭: %v", err)
+			}
+			return
+		}
+	})
+}
+
+func TestWebSocketAuthenticate(t *testing.T) {
+	type userKey struct{}
+	var upgraded atomic.Int32
+	wsServer := NewStreamWebSocketHandler(func(ctx context.Context, rawMsg []byte, send func([]byte) error) error {
+		user, _ := ctx.Value(userKey{}).(string)
+		return send([]byte("user:" + user))
+	})
+	wsServer.Authenticate = func(r *http.Request) (context.Context, error) {
+		switch HandshakeToken(r) {
+		case "":
+			return nil, errors.New("no token")
+		case "Bearer good":
+			upgraded.Add(1)
+			return context.WithValue(r.Context(), userKey{}, "alice"), nil
+		default:
+			return nil, errors.New("invalid token")
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(wsServer.HandleWebSocket))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	tests := []struct {
+		name         string
+		query        string
+		header       http.Header
+		subprotocols []string
+		wantStatus   int
+	}{
+		{name: "缺少令牌", wantStatus: http.StatusUnauthorized},
+		{name: "只有cookie中的令牌", header: http.Header{"Cookie": {"token=good"}, "Origin": {"https://evil.example"}}, wantStatus: http.StatusUnauthorized},
+		{name: "令牌无效", query: "?token=bad", wantStatus: http.StatusUnauthorized},
+		{name: "子协议中的令牌无效", subprotocols: []string{AuthSubprotocol, "bad"}, wantStatus: http.StatusUnauthorized},
+		{name: "查询参数", query: "?token=good", wantStatus: http.StatusSwitchingProtocols},
+		{name: "带前缀的查询参数", query: "?token=Bearer%20good", wantStatus: http.StatusSwitchingProtocols},
+		{name: "Authorization头", header: http.Header{"Authorization": {"Bearer good"}}, wantStatus: http.StatusSwitchingProtocols},
+		{name: "子协议", subprotocols: []string{AuthSubprotocol, "good"}, wantStatus: http.StatusSwitchingProtocols},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upgraded.Store(0)
+			dialer := *websocket.DefaultDialer
+			dialer.Subprotocols = tt.subprotocols
+			ws, resp, err := dialer.Dial(wsURL+tt.query, tt.header)
+			if resp == nil || resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Dial() response = %v, err = %v, want status %d", resp, err, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusSwitchingProtocols {
+				if !errors.Is(err, websocket.ErrBadHandshake) || upgraded.Load() != 0 {
+					t.Errorf("Dial() error = %v, want ErrBadHandshake", err)
+				}
+				return
+			}
+			defer ws.Close()
+			if tt.subprotocols != nil && ws.Subprotocol() != AuthSubprotocol {
+				t.Errorf("Subprotocol() = %q, want %q", ws.Subprotocol(), AuthSubprotocol)
+			}
+
+			// 握手时认证的用户在之后每条消息的ctx中都可用
+			for range 2 {
+				if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"message","content":"hi"}`)); err != nil {
+					t.Fatal(err)
+				}
+				ws.SetReadDeadline(time.Now().Add(time.Second))
+				_, msg, err := ws.ReadMessage()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(msg) != "user:alice" {
+					t.Errorf("response = %q, want user:alice", msg)
+				}
+			}
+		})
+	}
+}
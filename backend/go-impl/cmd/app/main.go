@@ -3,22 +3,34 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"LingChat/api"
 	"LingChat/api/routes"
+	"LingChat/api/routes/middleware"
 	v1 "LingChat/api/routes/v1"
+	"LingChat/internal/breaker"
 	"LingChat/internal/clients/VitsTTS"
 	"LingChat/internal/clients/emotionPredictor"
+	"LingChat/internal/clients/httptransport"
 	"LingChat/internal/clients/llm"
+	"LingChat/internal/clients/moderation"
 	"LingChat/internal/config"
 	"LingChat/internal/data"
 	"LingChat/internal/service"
+	"LingChat/internal/storage"
+	"LingChat/internal/tracing"
 	"LingChat/pkg/jwt"
 )
 
@@ -28,11 +40,24 @@ func main() {
 	defer cancel()
 
 	// init Config
-	err := godotenv.Load()
+	// POST /api/v1/admin/reload 会重新读取同一个文件
+	envFile := config.NewEnvFile(".env")
+	conf, err := envFile.Load()
 	if err != nil {
 		log.Fatal("无法加载 .env 文件: ", err)
 	}
-	conf := config.GetConfigFromEnv()
+
+	// 统一使用slog输出，log包的输出也会经过该handler
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Endpoint:    conf.Tracing.OTLPEndpoint,
+		ServiceName: conf.Tracing.ServiceName,
+		SampleRatio: conf.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Fatal("init tracing failed: ", err)
+	}
 
 	// init pkg instances
 	secBytes, err := base64.StdEncoding.DecodeString(conf.Server.JWTSecret)
@@ -43,8 +68,36 @@ func main() {
 
 	// init Clients
 	emotionPredictorClient := emotionPredictor.NewClient(conf.Emotion.URL)
-	vitsTTSClient := VitsTTS.NewClient(conf.Vits.APIURL, conf.TempDirs.VoiceDir, conf.Vits.SpeakerID)
-	llmClient := llm.NewLLMClient(conf.Chat.BaseURL, conf.Chat.APIKey)
+	emotionPredictorClient.Batch = conf.Emotion.Batch
+	emotionPredictorClient.MaxRetries = conf.Emotion.MaxRetries
+	emotionPredictorClient.BaseDelay = conf.Emotion.RetryBaseDelay
+	emotionPredictorClient.SetTransportConfig(transportConfig(conf.HTTP, conf.Emotion.Headers))
+	if !VitsTTS.ValidAudioFormat(conf.Vits.AudioFormat) {
+		log.Fatalf("不支持的音频格式: %s", conf.Vits.AudioFormat)
+	}
+	if err := VitsTTS.ValidateSampleRate(conf.Vits.SampleRate, conf.Vits.AudioFormat); err != nil {
+		log.Fatalf("VITS_SAMPLE_RATE配置错误: %v", err)
+	}
+	vitsTTSClient := newVitsTTSClient(conf, conf.Vits.APIURL)
+	// 默认说话人必须存在；VITS暂时不可达时只记录警告，不阻止启动。演练模式不请求VITS，不做校验
+	if conf.Chat.DryRun {
+		log.Println("演练模式：不请求VITS和情绪服务")
+	} else if err := vitsTTSClient.ValidateSpeaker(ctx, conf.Vits.SpeakerID); errors.Is(err, VitsTTS.ErrSpeakerNotFound) {
+		log.Fatal(err)
+	} else if err != nil {
+		log.Printf("无法校验VITS说话人: %v", err)
+	}
+	llmClient, err := llm.NewLLMProvider(conf.Chat.Provider, conf.Chat.BaseURL, conf.Chat.APIKey, conf.Chat.SystemPrompt, llmOptions(conf.Chat))
+	if err != nil {
+		log.Fatal("init llm provider failed: ", err)
+	}
+	if configurer, ok := llmClient.(llm.TransportConfigurer); ok {
+		configurer.SetTransportConfig(transportConfig(conf.HTTP, conf.Chat.Headers))
+	}
+	if client, ok := llmClient.(*llm.LLMClient); ok {
+		client.MaxAttempts = conf.Chat.MaxAttempts
+		client.BaseDelay = conf.Chat.RetryBaseDelay
+	}
 
 	// init Data & Repos
 	entClient, err := data.NewEntClient(ctx, conf.Data.DataBase.Driver, conf.Data.DataBase.Source, conf.Data.DataBase.AutoMigrate)
@@ -58,34 +111,366 @@ func main() {
 	}
 	userRepo := data.NewUserRepo(d)
 	conversationRepo := data.NewConversationRepo(d)
+	preferencesRepo := data.NewPreferencesRepo(d)
+	sessionRepo := data.NewSessionRepo(d)
 	legacyTempChatContext := data.NewLegacyTempChatContext()
 
 	// init Service
 	userService := service.NewUserService(userRepo, j)
 	conversationService := service.NewConversationService(conversationRepo, legacyTempChatContext, conf.Chat.Model)
 	chatService := service.NewLingChatService(emotionPredictorClient, vitsTTSClient, llmClient, conversationService, conf.Chat.Model, conf.TempDirs.VoiceDir)
+	if conf.Emotion.Threshold > 0 {
+		chatService.EmotionThreshold = conf.Emotion.Threshold
+	}
+	chatService.SettingsLoader = func() (service.Settings, error) {
+		conf, err := envFile.Load()
+		if err != nil {
+			return service.Settings{}, err
+		}
+		return chatSettings(conf), nil
+	}
+	audioStorage, err := newAudioStorage(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	chatService.Storage = audioStorage
+	voiceNamer, err := service.NewVoiceNamer(conf.Storage.NameTemplate)
+	if err != nil {
+		log.Fatal(err)
+	}
+	chatService.VoiceNamer = voiceNamer
+	chatService.PreferencesRepo = preferencesRepo
+	chatService.SessionRepo = sessionRepo
+	chatService.SessionLLMTitles = conf.Chat.LLMSessionTitles
+	chatService.HistoryTurns = conf.Chat.HistoryTurns
+	chatService.PredictEmotions = conf.Emotion.Predict
+	chatService.PredictUserEmotion = conf.Emotion.PredictUser
+	chatService.MaxHistoryTokens = conf.Chat.MaxHistoryTokens
+	if conf.Emotion.DefaultEmotion != "" {
+		chatService.ParseConfig.DefaultEmotion = conf.Emotion.DefaultEmotion
+	}
+	chatService.MaxConcurrency = conf.Chat.MaxConcurrency
+	chatService.MaxMessageLength = conf.Chat.MaxMessageLength
+	chatService.StripControlChars = conf.Chat.StripControlChars
+	chatService.RequestTimeout = conf.Chat.RequestTimeout
+	chatService.LLMTimeout = conf.Chat.LLMTimeout
+	chatService.LLMTimeoutReply = conf.Chat.LLMTimeoutReply
+	chatService.RetryBudget = conf.Chat.RetryBudget
+	chatService.RetryBudgetWait = conf.Chat.RetryBudgetWait
+	chatService.Fallback = conf.Chat.Fallback
+	chatService.FallbackReply = conf.Chat.FallbackReply
+	chatService.FallbackEmotion = conf.Chat.FallbackEmotion
+	chatService.FallbackVoice = conf.Chat.FallbackVoice
+	if conf.Chat.MaxInFlight > 0 {
+		chatService.Queue = service.NewTurnQueue(conf.Chat.MaxInFlight, conf.Chat.MaxQueued)
+	}
+	chatService.IdempotencyTTL = conf.Chat.IdempotencyTTL
+	chatService.InlineAudio = conf.Vits.InlineAudio
+	chatService.ConcatAudio = conf.Vits.ConcatAudio
+	chatService.StreamAudio = conf.Vits.StreamAudio
+	chatService.ProgressEvents = conf.Server.WSProgressEvents
+	chatService.TextFirst = conf.Server.WSTextFirst
+	chatService.DryRun = conf.Chat.DryRun
+	chatService.Pipeline = conf.Chat.Pipeline
+	chatService.ParseConfig.MaxSegments = conf.Chat.MaxSegments
+	chatService.ParseConfig.MinSegmentLength = conf.Chat.MinSegmentLength
+	chatService.ParseConfig.Markup = conf.Chat.SSMLMarkup
+	if conf.Chat.SanitizeOutput {
+		chatService.Sanitizer = service.NewOutputSanitizer(chatService.ParseConfig, conf.Chat.OutputBlocklist)
+	}
+	if len(conf.Vits.LanguageSpeakers) != 0 {
+		router, err := service.NewLanguageRouter(service.NewLanguageDetector(), conf.Vits.LanguageSpeakers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		router.MinConfidence = conf.Vits.LanguageMinConfidence
+		chatService.LanguageRouter = router
+	}
+	chatService.LLMBreaker = breaker.New(conf.Server.BreakerThreshold, conf.Server.BreakerCooldown)
+	chatService.TTSBreaker = breaker.New(conf.Server.BreakerThreshold, conf.Server.BreakerCooldown)
+	chatService.EmotionBreaker = breaker.New(conf.Server.BreakerThreshold, conf.Server.BreakerCooldown)
+	if conf.Vits.FallbackAPIURL != "" {
+		chatService.TTSProvider = VitsTTS.NewFailover(
+			VitsTTS.NamedProvider{Name: conf.Vits.APIURL, Provider: vitsTTSClient},
+			VitsTTS.NamedProvider{Name: conf.Vits.FallbackAPIURL, Provider: newVitsTTSClient(conf, conf.Vits.FallbackAPIURL)},
+		)
+	}
+	if conf.Vits.Normalize != "" {
+		if conf.Vits.AudioFormat != VitsTTS.FormatWAV {
+			log.Printf("VITS_AUDIO_FORMAT为%s，忽略音量均衡设置", conf.Vits.AudioFormat)
+		} else if conf.Vits.Normalize != VitsTTS.NormalizePeak && conf.Vits.Normalize != VitsTTS.NormalizeRMS {
+			log.Printf("不支持的音量均衡方式%q，不做均衡", conf.Vits.Normalize)
+		} else {
+			normalizing := &VitsTTS.Normalizing{Provider: vitsTTSClient, Mode: conf.Vits.Normalize, Target: VitsTTS.DefaultPeakTarget}
+			if chatService.TTSProvider != nil {
+				normalizing.Provider = chatService.TTSProvider
+			}
+			if conf.Vits.Normalize == VitsTTS.NormalizeRMS {
+				normalizing.Target = VitsTTS.DefaultRMSTarget
+			}
+			if conf.Vits.NormalizeTarget != nil {
+				normalizing.Target = *conf.Vits.NormalizeTarget
+			}
+			chatService.TTSProvider = normalizing
+		}
+	}
+	if conf.Vits.TranscodeFormat != "" {
+		if conf.Vits.AudioFormat != VitsTTS.FormatWAV {
+			log.Printf("VITS_AUDIO_FORMAT为%s，忽略转码设置", conf.Vits.AudioFormat)
+		} else if transcoder, err := VitsTTS.NewFFmpegTranscoder(conf.Vits.FFmpegPath, conf.Vits.TranscodeFormat); err != nil {
+			log.Printf("无法启用音频转码，继续使用wav: %v", err)
+		} else {
+			transcoder.Bitrate = conf.Vits.TranscodeBitrate
+			var provider VitsTTS.TTSProvider = vitsTTSClient
+			if chatService.TTSProvider != nil {
+				provider = chatService.TTSProvider
+			}
+			chatService.TTSProvider = &VitsTTS.Transcoding{Provider: provider, Transcoder: transcoder}
+			chatService.OutputFormat = transcoder.Format
+		}
+	}
+	moderator, err := newModerator(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	chatService.Moderator = moderator
+	if conf.Moderation.Reply != "" {
+		chatService.ModerationReply = conf.Moderation.Reply
+	}
+	if conf.Emotion.MotionMapPath != "" {
+		motionMap, err := service.LoadMotionMap(conf.Emotion.MotionMapPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		chatService.MotionMap = motionMap
+		go reloadMotionsOnSIGHUP(chatService)
+	}
+	if len(conf.Emotion.Labels) != 0 {
+		fallback := conf.Emotion.FallbackLabel
+		if fallback == "" {
+			fallback = chatService.ParseConfig.DefaultEmotion
+		}
+		labels, err := service.NewLabelSet(conf.Emotion.Labels, fallback)
+		if err != nil {
+			log.Fatal(err)
+		}
+		chatService.EmotionLabels = labels
+		// 模型的标签集合变化后动作映射要同步更新，启动时就发现，而不是上线后动作静默失效
+		if err := chatService.CheckMotionCoverage(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if conf.Emotion.Smoothing {
+		smoother := service.NewEmotionSmoother()
+		smoother.Threshold = conf.Emotion.SmoothingThreshold
+		smoother.Window = conf.Emotion.SmoothingWindow
+		chatService.Smoother = smoother
+	}
+	if conf.Emotion.CacheSize > 0 && conf.Emotion.CacheTTL > 0 {
+		chatService.EmotionCache = service.NewEmotionCache(conf.Emotion.CacheSize, conf.Emotion.CacheTTL)
+	}
+	if conf.Server.Warmup {
+		// 在后台预热，下游暂时不可用时不阻塞启动
+		go func() {
+			warmupCtx, cancel := context.WithTimeout(context.Background(), conf.Server.WarmupTimeout)
+			defer cancel()
+			chatService.Warmup(warmupCtx)
+		}()
+	}
+	// 临时语音和过期聊天记录的后台清理由chatService.Shutdown停止
+	chatService.StartTempSweeper(context.Background(), conf.TempDirs.SweepInterval, conf.TempDirs.VoiceTTL)
+	chatService.StartHistoryPurger(context.Background(), conf.Data.HistoryPurgeInterval, conf.Data.HistoryRetention)
 
 	// init HTTP server
 	chatRoute := v1.NewChatRoute(chatService, userRepo, j)
+	chatRoute.RateLimiter = middleware.NewRateLimiter(conf.Server.RateLimitRPM, conf.Server.RateLimitBurst)
+	chatRoute.AdminToken = conf.Server.AdminToken
 	userRoute := v1.NewUserRoute(userService)
-	httpEngine := routes.NewHTTPEngine(conf.Backend.BindAddr+":9876", chatRoute, userRoute)
-	_, err = httpEngine.Run()
+	historyRoute := v1.NewHistoryRoute(chatService, userRepo, j)
+	emotionRoute := v1.NewEmotionRoute(chatService, userRepo, j)
+	statsRoute := v1.NewStatsRoute(chatService, userRepo, j)
+	voiceRoute := v1.NewVoiceRoute(chatService)
+	adminRoute := v1.NewAdminRoute(chatService, userRepo, j, conf.Server.AdminToken)
+	preferencesRoute := v1.NewPreferencesRoute(chatService, userRepo, j)
+	sessionRoute := v1.NewSessionRoute(chatService, userRepo, j)
+	audioRoute := v1.NewAudioRoute(chatService, userRepo, j)
+	// 重新合成语音与聊天共用限流额度
+	audioRoute.RateLimiter = chatRoute.RateLimiter
+	httpRoutes := []routes.Route{chatRoute, userRoute, historyRoute, emotionRoute, statsRoute, voiceRoute, adminRoute, preferencesRoute, sessionRoute, audioRoute}
+	if conf.Server.DebugPipeline {
+		httpRoutes = append(httpRoutes, v1.NewDebugRoute(chatService, userRepo, j, conf.Server.AdminToken))
+	}
+	httpEngine := routes.NewHTTPEngine(conf.Backend.BindAddr+":9876", httpRoutes...)
+	compression := compressionPolicy(conf)
+	httpEngine.Engine.Use(middleware.Gzip(compression))
+	healthRoute := v1.NewHealthRoute(chatService)
+	healthRoute.ProbeTimeout = conf.Server.HealthProbeTimeout
+	httpEngine.Engine.GET("/healthz", healthRoute.Healthz)
+	httpEngine.Engine.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	registerSwagger(httpEngine.Engine)
+	httpServer, err := httpEngine.Run()
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// 创建WebSocket服务器
-	wsServer := api.NewWebSocketHandler(chatService.ChatHandler)
+	wsServer := api.NewStreamWebSocketHandler(chatService.ChatHandlerStream)
+	wsServer.PingInterval = conf.Server.WSPingInterval
+	wsServer.PongTimeout = conf.Server.WSPongTimeout
+	wsServer.Compression = compression
+	wsServer.Authenticate = middleware.WSTokenAuth(conf.Server.WSRequireLogin, j, userRepo)
 
 	// 设置路由
-	http.HandleFunc("/", wsServer.HandleWebSocket)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", wsServer.HandleWebSocket)
 
 	// 启动服务器
 	serverAddr := fmt.Sprintf("%s:%d", conf.Backend.BindAddr, conf.Backend.Port)
+	wsHTTPServer := &http.Server{Addr: serverAddr, Handler: mux}
 	log.Printf("WebSocket服务器启动在 %s", serverAddr)
-	if err := http.ListenAndServe(serverAddr, nil); err != nil {
-		log.Fatal("服务器启动失败: ", err)
+	go func() {
+		if err := wsHTTPServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("服务器启动失败: ", err)
+		}
+	}()
+
+	// 优雅退出：先停止接受新的对话并等待进行中的对话完成，再关闭HTTP服务
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-signalCtx.Done()
+	log.Printf("收到退出信号，等待进行中的对话完成（最长 %s）", conf.Server.ShutdownTimeout)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), conf.Server.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := chatService.Shutdown(shutdownCtx); err != nil {
+		log.Printf("等待对话完成超时，已取消剩余对话: %v", err)
+	}
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("关闭HTTP服务失败: %v", err)
+	}
+	if err := wsHTTPServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("关闭WebSocket服务失败: %v", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("导出剩余的追踪数据失败: %v", err)
 	}
+	log.Println("服务已退出")
+}
+
+// compressionPolicy 未开启压缩时返回nil
+func compressionPolicy(conf *config.Config) *api.CompressionPolicy {
+	if !conf.Server.Compression {
+		return nil
+	}
+	policy := api.NewCompressionPolicy(conf.Server.CompressionTypes)
+	policy.MinSize = conf.Server.CompressionMinSize
+	return policy
+}
 
-	// TODO: 优雅退出没写
+// newModerator 按MODERATION_PROVIDER选择内容审核，默认不审核
+func newModerator(conf *config.Config) (moderation.Moderator, error) {
+	switch conf.Moderation.Provider {
+	case "":
+		return moderation.Noop{}, nil
+	case "openai":
+		client := moderation.NewClient(conf.Moderation.BaseURL, conf.Moderation.APIKey)
+		client.Model = conf.Moderation.Model
+		client.SetTransportConfig(transportConfig(conf.HTTP, nil))
+		return client, nil
+	default:
+		return nil, fmt.Errorf("unsupported moderation provider: %s", conf.Moderation.Provider)
+	}
+}
+
+// reloadMotionsOnSIGHUP 收到SIGHUP时重新加载情绪到动作的映射
+func reloadMotionsOnSIGHUP(chatService *service.LingChatService) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := chatService.ReloadMotions(); err != nil {
+			log.Printf("重新加载动作映射失败，继续使用原来的映射: %v", err)
+			continue
+		}
+		log.Printf("已重新加载动作映射，共 %d 个情绪", chatService.MotionMap.Len())
+	}
+}
+
+// llmOptions 把配置中的生成参数转为LLM客户端的默认Options
+func llmOptions(chat config.ChatConfig) llm.Options {
+	opts := llm.Options{MaxTokens: chat.MaxTokens}
+	if chat.Temperature != nil {
+		opts.Temperature = llm.Float32(float32(*chat.Temperature))
+	}
+	if chat.TopP != nil {
+		opts.TopP = llm.Float32(float32(*chat.TopP))
+	}
+	return opts
+}
+
+// chatSettings 重新加载配置时替换的参数，与启动时的设置方式一致
+func chatSettings(conf *config.Config) service.Settings {
+	threshold := service.DefaultEmotionThreshold
+	if conf.Emotion.Threshold > 0 {
+		threshold = conf.Emotion.Threshold
+	}
+	return service.Settings{
+		EmotionThreshold: threshold,
+		MaxConcurrency:   conf.Chat.MaxConcurrency,
+		SystemPrompt:     conf.Chat.SystemPrompt,
+	}
+}
+
+// newVitsTTSClient 按配置创建apiURL对应的VITS客户端，主服务和备用服务使用相同的设置
+func newVitsTTSClient(conf *config.Config, apiURL string) *VitsTTS.Client {
+	client := VitsTTS.NewClient(apiURL, conf.TempDirs.VoiceDir, conf.Vits.SpeakerID)
+	client.AudioFormat = conf.Vits.AudioFormat
+	client.Speed = conf.Vits.Speed
+	client.Pitch = conf.Vits.Pitch
+	client.SampleRate = conf.Vits.SampleRate
+	client.MaxRetries = conf.Vits.MaxRetries
+	client.BaseDelay = conf.Vits.RetryBaseDelay
+	client.SetCacheSize(conf.Vits.CacheSize)
+	client.SpeakerRefreshInterval = conf.Vits.SpeakerRefreshInterval
+	client.StreamChunkSize = conf.Vits.StreamChunkSize
+	client.MaxAudioBytes = conf.Vits.MaxAudioBytes
+	client.SetTransportConfig(transportConfig(conf.HTTP, conf.Vits.Headers))
+	return client
+}
+
+// newAudioStorage 按AUDIO_STORAGE选择语音的存储位置，默认写入TEMP_VOICE_DIR
+func newAudioStorage(conf *config.Config) (storage.Storage, error) {
+	switch conf.Storage.Backend {
+	case "", "local":
+		return storage.NewLocal(conf.TempDirs.VoiceDir), nil
+	case "memory":
+		return storage.NewMemory(service.AudioURLPrefix, conf.TempDirs.VoiceTTL, conf.Storage.MemoryMaxBytes), nil
+	case "s3":
+		s3, err := storage.NewS3(storage.S3Config{
+			Endpoint:  conf.Storage.S3Endpoint,
+			Region:    conf.Storage.S3Region,
+			Bucket:    conf.Storage.S3Bucket,
+			AccessKey: conf.Storage.S3AccessKey,
+			SecretKey: conf.Storage.S3SecretKey,
+			Prefix:    conf.Storage.S3Prefix,
+			PublicURL: conf.Storage.S3PublicURL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s3.SetTransportConfig(transportConfig(conf.HTTP, nil))
+		return s3, nil
+	default:
+		return nil, fmt.Errorf("unsupported audio storage: %s", conf.Storage.Backend)
+	}
+}
+
+// transportConfig 出站客户端的连接池设置，headers为该下游服务要求附加的请求头
+func transportConfig(conf config.HTTPConfig, headers map[string]string) httptransport.Config {
+	return httptransport.Config{
+		MaxIdleConns:        conf.MaxIdleConns,
+		MaxIdleConnsPerHost: conf.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     conf.MaxConnsPerHost,
+		IdleConnTimeout:     conf.IdleConnTimeout,
+		Headers:             headers,
+	}
 }
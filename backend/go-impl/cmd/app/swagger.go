@@ -0,0 +1,16 @@
+//go:build swagger
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+
+	"LingChat/api/swagger"
+)
+
+// registerSwagger 在/swagger/index.html提供接口文档页面，文档本身为/swagger/doc.json
+func registerSwagger(engine *gin.Engine) {
+	engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.InstanceName(swagger.SwaggerInfo.InstanceName())))
+}
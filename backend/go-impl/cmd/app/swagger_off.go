@@ -0,0 +1,10 @@
+//go:build !swagger
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// registerSwagger 默认构建不包含接口文档，需要时以 -tags swagger 编译
+func registerSwagger(*gin.Engine) {}
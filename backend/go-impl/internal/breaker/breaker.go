@@ -0,0 +1,132 @@
+// Package breaker 为下游服务调用提供熔断：连续失败达到阈值后在冷却期内直接失败，
+// 冷却结束后放行一个探测请求，成功则恢复，失败则重新熔断
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen 熔断器处于打开状态，请求未发送到下游
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State 熔断器状态
+type State int
+
+const (
+	// Closed 正常放行请求
+	Closed State = iota
+	// Open 冷却期内直接失败
+	Open
+	// HalfOpen 冷却结束，正在用一个请求探测下游是否恢复
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker 连续失败计数熔断器，并发安全。nil表示不熔断
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     State
+	failures  int
+	openedAt  time.Time
+
+	// now 便于测试替换时钟
+	now func() time.Time
+}
+
+// New 连续threshold次失败后熔断cooldown。threshold<=0时返回nil，表示不熔断
+func New(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Do 熔断器允许时执行fn并记录结果，否则直接返回ErrOpen。
+// 调用方取消（context.Canceled）不计为失败
+func (b *Breaker) Do(fn func() error) error {
+	if b == nil {
+		return fn()
+	}
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+// State 当前状态，冷却已结束但还没有探测请求时视为HalfOpen
+func (b *Breaker) State() State {
+	if b == nil {
+		return Closed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrOpen
+		}
+		// 冷却结束，只放行这一个探测请求
+		b.state = HalfOpen
+		return nil
+	case HalfOpen:
+		return ErrOpen
+	default:
+		return nil
+	}
+}
+
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case err == nil:
+		b.state = Closed
+		b.failures = 0
+	case errors.Is(err, context.Canceled):
+		// 调用方放弃的请求不能说明下游的状态，探测请求被取消时重新等待下一个探测
+		if b.state == HalfOpen {
+			b.state = Open
+		}
+	default:
+		b.failures++
+		if b.state == HalfOpen || b.failures >= b.threshold {
+			b.state = Open
+			b.openedAt = b.now()
+		}
+	}
+}
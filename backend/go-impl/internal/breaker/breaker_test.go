@@ -0,0 +1,79 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	errDown := errors.New("down")
+	now := time.Now()
+	b := New(2, time.Minute)
+	b.now = func() time.Time { return now }
+	fail := func() error { return errDown }
+	ok := func() error { return nil }
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		fn      func() error
+		wantErr error
+		want    State
+	}{
+		{name: "第一次失败", fn: fail, wantErr: errDown, want: Closed},
+		{name: "连续失败达到阈值后熔断", fn: fail, wantErr: errDown, want: Open},
+		{name: "冷却期内直接失败", fn: ok, wantErr: ErrOpen, want: Open},
+		{name: "冷却结束后探测失败重新熔断", advance: time.Minute, fn: fail, wantErr: errDown, want: Open},
+		{name: "调用方取消不计为失败", advance: time.Minute, fn: func() error { return context.Canceled }, wantErr: context.Canceled, want: HalfOpen},
+		{name: "探测成功后恢复", fn: ok, want: Closed},
+		{name: "恢复后重新计数", fn: fail, wantErr: errDown, want: Closed},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		if err := b.Do(step.fn); !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: Do() error = %v, want %v", step.name, err, step.wantErr)
+		}
+		if got := b.State(); got != step.want {
+			t.Fatalf("%s: State() = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestBreakerHalfOpenSingleProbe(t *testing.T) {
+	now := time.Now()
+	b := New(1, time.Minute)
+	b.now = func() time.Time { return now }
+	b.Do(func() error { return errors.New("down") })
+	now = now.Add(time.Minute)
+
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	go b.Do(func() error {
+		close(probing)
+		<-release
+		return nil
+	})
+	<-probing
+	if err := b.Do(func() error { return nil }); !errors.Is(err, ErrOpen) {
+		t.Errorf("Do() during probe error = %v, want ErrOpen", err)
+	}
+	close(release)
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *Breaker = New(0, time.Minute)
+	if b != nil {
+		t.Fatal("New(0) != nil")
+	}
+	errDown := errors.New("down")
+	for range 3 {
+		if err := b.Do(func() error { return errDown }); err != errDown {
+			t.Errorf("Do() error = %v, want %v", err, errDown)
+		}
+	}
+	if b.State() != Closed {
+		t.Errorf("State() = %v, want closed", b.State())
+	}
+}
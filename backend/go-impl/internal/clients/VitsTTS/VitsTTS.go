@@ -2,14 +2,74 @@ package VitsTTS
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"html"
 	"io"
+	"slices"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
+
+	"LingChat/internal/clients/httptransport"
+	"LingChat/internal/clients/retrybudget"
+)
+
+const (
+	// DefaultMaxRetries VoiceVITS遇到临时错误时的默认重试次数
+	DefaultMaxRetries = 2
+	// DefaultBaseDelay 重试退避的基础间隔，第n次重试等待 BaseDelay * 2^(n-1)
+	DefaultBaseDelay = 500 * time.Millisecond
+	// DefaultSpeakerRefreshInterval 说话人列表缓存的默认刷新间隔
+	DefaultSpeakerRefreshInterval = 10 * time.Minute
+	// DefaultMaxAudioBytes 单个分段音频的默认最大字节数
+	DefaultMaxAudioBytes = 32 << 20
+)
+
+// 支持从VITS服务请求的音频格式
+const (
+	FormatWAV = "wav"
+	FormatMP3 = "mp3"
+	FormatOGG = "ogg"
 )
 
+// AudioFormats 所有支持的音频格式，同时也是保存文件的扩展名
+var AudioFormats = []string{FormatWAV, FormatMP3, FormatOGG}
+
+// ValidAudioFormat 判断format是否为支持的音频格式
+func ValidAudioFormat(format string) bool {
+	return slices.Contains(AudioFormats, format)
+}
+
+// ErrAudioTooLarge VITS返回的音频超过了MaxAudioBytes，不重试
+var ErrAudioTooLarge = errors.New("audio exceeds the size limit")
+
+// ErrSSMLStream 流式合成接口不接受SSML
+var ErrSSMLStream = errors.New("streaming synthesis does not support ssml")
+
+// SupportedSampleRates Voice.SampleRate允许的采样率（Hz）
+var SupportedSampleRates = []int{8000, 16000, 22050, 24000, 32000, 44100, 48000}
+
+// ErrUnsupportedSampleRate 采样率不在SupportedSampleRates中，或音频格式不是wav
+var ErrUnsupportedSampleRate = errors.New("unsupported sample rate")
+
+// ValidateSampleRate 检查format格式下能否输出rate采样率，rate为0表示沿用VITS模型的采样率。
+// 重采样在收到WAV后进行，因此只支持wav格式（之后再转码不受影响）
+func ValidateSampleRate(rate int, format string) error {
+	if rate == 0 {
+		return nil
+	}
+	if !slices.Contains(SupportedSampleRates, rate) {
+		return fmt.Errorf("%w: %d Hz, supported: %v", ErrUnsupportedSampleRate, rate, SupportedSampleRates)
+	}
+	if format != FormatWAV {
+		return fmt.Errorf("%w: resampling requires %s output, got %s", ErrUnsupportedSampleRate, FormatWAV, format)
+	}
+	return nil
+}
+
 type Client struct {
 	resty.Client
 	URL     string
@@ -19,45 +79,281 @@ type Client struct {
 	AudioFormat string
 	Lang        string
 	Enable      bool
+	// Speed/Pitch 默认的语速和音调倍率，见Voice
+	Speed float64
+	Pitch float64
+	// SampleRate 默认的输出采样率，0表示沿用VITS模型的采样率，见Voice
+	SampleRate int
+
+	// MaxRetries 5xx、连接错误、超时等临时错误的最大重试次数，4xx不重试
+	MaxRetries int
+	// BaseDelay 指数退避的基础间隔
+	BaseDelay time.Duration
+
+	// SpeakerRefreshInterval 说话人列表缓存的刷新间隔，<=0表示每次都请求VITS服务
+	SpeakerRefreshInterval time.Duration
+	// StreamChunkSize VoiceVITSChunks每块音频的最大字节数
+	StreamChunkSize int
+	// MaxAudioBytes 单个分段音频的最大字节数，VITS返回的音频超过时中止读取并返回ErrAudioTooLarge，<=0表示不限制
+	MaxAudioBytes int
+
+	// cache 重复文本的音频缓存，通过SetCacheSize开启
+	cache *audioCache
+	// speakers 缓存的说话人列表
+	speakers *speakerCache
+}
+
+// speakerCache 最近一次成功获取的说话人列表
+type speakerCache struct {
+	mu      sync.Mutex
+	list    []Speaker
+	fetched time.Time
+}
+
+// StatusError VITS服务返回了非成功状态码
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("VITS TTS request failed with status code: %d", e.StatusCode)
+}
+
+// RetryError 记录了放弃前已经重试的次数
+type RetryError struct {
+	Retries int
+	Err     error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v (retried %d times)", e.Err, e.Retries)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// 语速和音调的允许范围，1为原始值
+const (
+	MinSpeed = 0.5
+	MaxSpeed = 2.0
+	MinPitch = 0.8
+	MaxPitch = 1.5
+)
+
+// Voice 单次合成使用的声音参数。
+//
+// Speed 语速倍率，映射为VITS的length参数（length = 1/Speed，越大越慢）。
+// Pitch 音调倍率，VITS接口本身不支持音调，这里请求 Pitch 倍时长的音频，
+// 再把WAV头中的采样率乘以Pitch，播放时音调升高而时长不变；仅对wav格式生效。
+// 两者为0时视为1，超出范围时截断到边界。
+//
+// SampleRate 输出WAV的采样率（Hz），0表示沿用VITS模型的采样率。VITS接口没有采样率参数，
+// 收到音频后按线性插值重采样：提高采样率不会增加音质但便于与其他音频混合，降低采样率可以减小文件；
+// 只支持wav格式，取值见SupportedSampleRates。
+//
+// SSML 为true时text是SSML片段（如含<emphasis>、<break>），嵌入<speak><voice>后请求/voice/ssml，
+// 由VITS服务解析，片段须通过ValidateSSML检查；流式合成不支持SSML
+type Voice struct {
+	SpeakerID  int
+	Speed      float64
+	Pitch      float64
+	SampleRate int
+	SSML       bool
+}
+
+// normalize 返回截断到允许范围后的语速和音调
+func (v Voice) normalize() Voice {
+	v.Speed = clampRatio(v.Speed, MinSpeed, MaxSpeed)
+	v.Pitch = clampRatio(v.Pitch, MinPitch, MaxPitch)
+	return v
+}
+
+func clampRatio(v, lo, hi float64) float64 {
+	if v == 0 {
+		return 1
+	}
+	return min(max(v, lo), hi)
+}
+
+// DefaultVoice 使用客户端配置的默认说话人、语速和音调
+func (c *Client) DefaultVoice() Voice {
+	return Voice{SpeakerID: c.SpeakerID, Speed: c.Speed, Pitch: c.Pitch, SampleRate: c.SampleRate}
+}
+
+// pitchShift 当前格式下是否能调整音调
+func (c *Client) pitchShift(voice Voice) bool {
+	return voice.Pitch != 1 && c.AudioFormat == FormatWAV
+}
+
+// lengthParam VITS的length参数
+func (c *Client) lengthParam(voice Voice) string {
+	length := 1 / voice.Speed
+	if c.pitchShift(voice) {
+		length *= voice.Pitch
+	}
+	return strconv.FormatFloat(length, 'f', 3, 64)
 }
 
 func NewClient(url string, tempDir string, speakerid int) *Client {
 	httpClient := resty.New()
 	httpClient.SetTimeout(time.Second * 120)
+	httpClient.SetTransport(httptransport.New(httptransport.DefaultConfig))
 	return &Client{
 		Client:      *httpClient,
 		URL:         url,
 		TempDir:     tempDir,
 		SpeakerID:   speakerid,
-		AudioFormat: "wav",
+		AudioFormat: FormatWAV,
 		Enable:      true,
+		Speed:       1,
+		Pitch:       1,
+		MaxRetries:  DefaultMaxRetries,
+		BaseDelay:   DefaultBaseDelay,
+
+		SpeakerRefreshInterval: DefaultSpeakerRefreshInterval,
+		StreamChunkSize:        DefaultStreamChunkSize,
+		MaxAudioBytes:          DefaultMaxAudioBytes,
+		speakers:               &speakerCache{},
 	}
 }
 
-func (c *Client) VoiceVITS(ctx context.Context, text string) ([]byte, error) {
-	resp, err := c.R().
-		SetContext(ctx).
-		SetQueryParams(map[string]string{
-			"text": text,
-			"id":   strconv.Itoa(c.SpeakerID),
-		}).
-		Get(c.URL + "/voice/vits")
+// SetTransportConfig 按cfg重建连接池，应在开始请求前调用
+func (c *Client) SetTransportConfig(cfg httptransport.Config) {
+	c.SetTransport(httptransport.New(cfg))
+}
+
+// VoiceVITS 以voice指定的声音合成语音，对临时错误按指数退避重试，ctx中的重试预算（见retrybudget）用尽时不再重试，返回的错误为*RetryError。
+// 开启缓存时相同文本和参数直接返回缓存的音频
+func (c *Client) VoiceVITS(ctx context.Context, text string, voice Voice) ([]byte, error) {
+	voice = voice.normalize()
+	if err := ValidateSampleRate(voice.SampleRate, c.AudioFormat); err != nil {
+		return nil, &RetryError{Err: err}
+	}
+	if voice.SSML {
+		if err := ValidateSSML(text); err != nil {
+			return nil, &RetryError{Err: err}
+		}
+	}
+	var key string
+	if c.cache != nil {
+		key = c.voiceCacheKey(text, voice)
+		if data, ok := c.cache.get(key); ok {
+			return data, nil
+		}
+	}
+
+	retries := 0
+	for {
+		data, err := c.voiceVITS(ctx, text, voice)
+		if err == nil {
+			if c.cache != nil && len(data) != 0 {
+				c.cache.put(key, data)
+			}
+			return data, nil
+		}
+		if retries >= c.MaxRetries || !isRetryable(err) || ctx.Err() != nil {
+			return nil, &RetryError{Retries: retries, Err: err}
+		}
+		delay := c.BaseDelay << retries
+		if !retrybudget.Allow(ctx, delay) {
+			return nil, &RetryError{Retries: retries, Err: errors.Join(err, retrybudget.ErrExhausted)}
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, &RetryError{Retries: retries, Err: errors.Join(err, ctx.Err())}
+		}
+		retries++
+	}
+}
+
+// isRetryable 5xx和网络层错误（连接重置、超时等）视为临时错误
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrAudioTooLarge) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+func (c *Client) voiceVITS(ctx context.Context, text string, voice Voice) ([]byte, error) {
+	var resp *resty.Response
+	var err error
+	req := c.R().SetContext(ctx).SetResponseBodyLimit(c.MaxAudioBytes)
+	if voice.SSML {
+		resp, err = req.
+			SetFormData(map[string]string{"ssml": c.ssmlDocument(text, voice)}).
+			Post(c.URL + "/voice/ssml")
+	} else {
+		resp, err = req.
+			SetQueryParams(map[string]string{
+				"text":   text,
+				"id":     strconv.Itoa(voice.SpeakerID),
+				"format": c.AudioFormat,
+				"length": c.lengthParam(voice),
+			}).
+			Get(c.URL + "/voice/vits")
+	}
+	if errors.Is(err, resty.ErrResponseBodyTooLarge) {
+		return nil, c.errAudioTooLarge()
+	}
 	if err != nil {
 		return nil, err
 	}
 	if !resp.IsSuccess() {
-		return nil, fmt.Errorf("VITS TTS request failed with status code: %d", resp.StatusCode())
+		return nil, &StatusError{StatusCode: resp.StatusCode()}
+	}
+
+	data := resp.Body()
+	if len(data) == 0 {
+		return data, nil
+	}
+	if c.pitchShift(voice) {
+		if data, err = scaleWAVSampleRate(data, voice.Pitch); err != nil {
+			return nil, err
+		}
+	}
+	if voice.SampleRate != 0 {
+		return resampleWAV(data, voice.SampleRate)
 	}
+	return data, nil
+}
+
+// ssmlDocument 把SSML片段放进<speak><voice>中，说话人、语速和格式作为<speak>的属性；fragment须已通过ValidateSSML检查
+func (c *Client) ssmlDocument(fragment string, voice Voice) string {
+	lang := ""
+	if c.Lang != "" {
+		lang = fmt.Sprintf(` lang="%s"`, html.EscapeString(c.Lang))
+	}
+	return fmt.Sprintf(`<speak id="%d" length="%s" format="%s"%s><voice>%s</voice></speak>`,
+		voice.SpeakerID, c.lengthParam(voice), html.EscapeString(c.AudioFormat), lang, fragment)
+}
 
-	return resp.Body(), nil
+// errAudioTooLarge 音频超过MaxAudioBytes时返回的错误
+func (c *Client) errAudioTooLarge() error {
+	return fmt.Errorf("%w: more than %d bytes", ErrAudioTooLarge, c.MaxAudioBytes)
 }
 
-func (c *Client) VoiceVITSStream(ctx context.Context, text string) (io.ReadCloser, error) {
+// VoiceVITSStream 流式合成语音，只支持调整语速，不支持调整音调、采样率和SSML。
+// 音频超过MaxAudioBytes时读取返回ErrAudioTooLarge
+func (c *Client) VoiceVITSStream(ctx context.Context, text string, voice Voice) (io.ReadCloser, error) {
+	if voice.SSML {
+		return nil, ErrSSMLStream
+	}
+	voice = voice.normalize()
+	voice.Pitch = 1
 	resp, err := c.R().
 		SetContext(ctx).
 		SetQueryParams(map[string]string{
 			"text":      text,
-			"id":        strconv.Itoa(c.SpeakerID),
+			"id":        strconv.Itoa(voice.SpeakerID),
+			"format":    c.AudioFormat,
+			"length":    c.lengthParam(voice),
 			"streaming": "true",
 		}).
 		SetDoNotParseResponse(true).
@@ -67,7 +363,7 @@ func (c *Client) VoiceVITSStream(ctx context.Context, text string) (io.ReadClose
 	}
 	if !resp.IsSuccess() {
 		resp.RawResponse.Body.Close()
-		return nil, fmt.Errorf("VITS TTS streaming request failed with status code: %d", resp.StatusCode())
+		return nil, &StatusError{StatusCode: resp.StatusCode()}
 	}
 
 	// TODO: 加缓冲？以下实现是不对的不能直接用
@@ -87,5 +383,108 @@ func (c *Client) VoiceVITSStream(ctx context.Context, text string) (io.ReadClose
 	// 	}
 	// }()
 
+	if c.MaxAudioBytes > 0 {
+		return &limitedBody{ReadCloser: resp.RawBody(), limit: c.MaxAudioBytes, err: c.errAudioTooLarge()}, nil
+	}
 	return resp.RawBody(), nil
 }
+
+// limitedBody 读取的总字节数超过limit后返回err，超出的部分不交给调用方
+type limitedBody struct {
+	io.ReadCloser
+	limit int
+	read  int
+	err   error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.read > b.limit {
+		return 0, b.err
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += n
+	if b.read > b.limit {
+		return n - (b.read - b.limit), b.err
+	}
+	return n, err
+}
+
+// Ping 请求说话人列表确认VITS服务可达
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.R().SetContext(ctx).Get(c.URL + "/voice/speakers")
+	if err != nil {
+		return err
+	}
+	if !resp.IsSuccess() {
+		return &StatusError{StatusCode: resp.StatusCode()}
+	}
+	return nil
+}
+
+// Speaker VITS服务提供的说话人
+type Speaker struct {
+	ID   int      `json:"id"`
+	Name string   `json:"name"`
+	Lang []string `json:"lang"`
+}
+
+// ListSpeakers 获取VITS模型可用的说话人列表，结果缓存SpeakerRefreshInterval。
+// 缓存过期后刷新失败时仍返回上一次的列表，从未成功获取过时返回错误
+func (c *Client) ListSpeakers(ctx context.Context) ([]Speaker, error) {
+	c.speakers.mu.Lock()
+	defer c.speakers.mu.Unlock()
+
+	if c.speakers.list != nil && c.SpeakerRefreshInterval > 0 && time.Since(c.speakers.fetched) < c.SpeakerRefreshInterval {
+		return slices.Clone(c.speakers.list), nil
+	}
+	speakers, err := c.fetchSpeakers(ctx)
+	if err != nil {
+		if c.speakers.list != nil {
+			return slices.Clone(c.speakers.list), nil
+		}
+		return nil, err
+	}
+	if speakers == nil {
+		speakers = []Speaker{}
+	}
+	c.speakers.list = speakers
+	c.speakers.fetched = time.Now()
+	return slices.Clone(speakers), nil
+}
+
+// fetchSpeakers 从VITS服务请求说话人列表
+func (c *Client) fetchSpeakers(ctx context.Context) ([]Speaker, error) {
+	var result struct {
+		VITS []Speaker `json:"VITS"`
+	}
+	resp, err := c.R().
+		SetContext(ctx).
+		SetResult(&result).
+		ForceContentType("application/json").
+		Get(c.URL + "/voice/speakers")
+	if err != nil {
+		return nil, err
+	}
+	if !resp.IsSuccess() {
+		return nil, &StatusError{StatusCode: resp.StatusCode()}
+	}
+	return result.VITS, nil
+}
+
+// ErrSpeakerNotFound VITS服务中没有该说话人
+var ErrSpeakerNotFound = errors.New("speaker is not available on the VITS server")
+
+// ValidateSpeaker 检查speakerID是否在VITS服务的说话人列表中，
+// 不存在时返回的错误包含ErrSpeakerNotFound
+func (c *Client) ValidateSpeaker(ctx context.Context, speakerID int) error {
+	speakers, err := c.ListSpeakers(ctx)
+	if err != nil {
+		return fmt.Errorf("list speakers failed: %w", err)
+	}
+	for _, speaker := range speakers {
+		if speaker.ID == speakerID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrSpeakerNotFound, speakerID)
+}
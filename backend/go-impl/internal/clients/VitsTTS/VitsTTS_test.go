@@ -1,23 +1,35 @@
 package VitsTTS
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"LingChat/internal/clients/httptransport"
+	"LingChat/internal/metrics"
 )
 
 func TestVoiceVITS(t *testing.T) {
 	// 初始化客户端
-	client := NewClient("https://artrajz-vits-simple-api.hf.space", "")
-	client.SpeakerID = 164 // 设置测试用的 speaker ID
+	client := NewClient("https://artrajz-vits-simple-api.hf.space", "", 164)
 
 	// 测试文本
 	text := "你好,こんにちは"
 
 	// 测试 VoiceVITS 方法
 	ctx := context.Background()
-	audioData, err := client.VoiceVITS(ctx, text)
+	audioData, err := client.VoiceVITS(ctx, text, client.DefaultVoice())
 	if err != nil {
 		t.Fatalf("VoiceVITS failed: %v", err)
 	}
@@ -30,15 +42,14 @@ func TestVoiceVITS(t *testing.T) {
 
 func TestVoiceVITSStream(t *testing.T) {
 	// 初始化客户端
-	client := NewClient("https://artrajz-vits-simple-api.hf.space", "")
-	client.SpeakerID = 164 // 设置测试用的 speaker ID
+	client := NewClient("https://artrajz-vits-simple-api.hf.space", "", 164)
 
 	// 测试文本
 	text := "你好,こんにちは"
 
 	// 测试 VoiceVITSStream 方法
 	ctx := context.Background()
-	stream, err := client.VoiceVITSStream(ctx, text)
+	stream, err := client.VoiceVITSStream(ctx, text, client.DefaultVoice())
 	if err != nil {
 		t.Fatalf("VoiceVITSStream failed: %v", err)
 	}
@@ -77,8 +88,7 @@ func TestVoiceVITSStream(t *testing.T) {
 
 func TestVoiceVITS_Concurrent(t *testing.T) {
 	// 初始化客户端
-	client := NewClient("https://artrajz-vits-simple-api.hf.space", "")
-	client.SpeakerID = 164 // 设置测试用的 speaker ID
+	client := NewClient("https://artrajz-vits-simple-api.hf.space", "", 164)
 
 	// 测试文本
 	text := "你好,こんにちは"
@@ -87,9 +97,10 @@ func TestVoiceVITS_Concurrent(t *testing.T) {
 	ctx := context.Background()
 	for range 3 {
 		go func() {
-			audioData, err := client.VoiceVITS(ctx, text)
+			audioData, err := client.VoiceVITS(ctx, text, client.DefaultVoice())
 			if err != nil {
-				t.Fatalf("VoiceVITS failed: %v", err)
+				t.Errorf("VoiceVITS failed: %v", err)
+				return
 			}
 
 			// 检查返回的音频数据
@@ -101,3 +112,473 @@ func TestVoiceVITS_Concurrent(t *testing.T) {
 
 	time.Sleep(20 * time.Second)
 }
+
+func TestVoiceVITS_Retry(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		wantErr     bool
+		wantRetries int
+		wantCalls   int32
+	}{
+		{name: "502后恢复", statuses: []int{502, 502, 200}, wantErr: false, wantCalls: 3},
+		{name: "持续5xx", statuses: []int{503, 503, 503, 503}, wantErr: true, wantRetries: 2, wantCalls: 3},
+		{name: "4xx不重试", statuses: []int{400, 200}, wantErr: true, wantRetries: 0, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				w.WriteHeader(tt.statuses[n-1])
+				w.Write([]byte("audio"))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "", 0)
+			client.BaseDelay = time.Millisecond
+
+			audioData, err := client.VoiceVITS(context.Background(), "你好", client.DefaultVoice())
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls.Load(), tt.wantCalls)
+			}
+			if !tt.wantErr {
+				if err != nil || string(audioData) != "audio" {
+					t.Fatalf("VoiceVITS = %q, %v", audioData, err)
+				}
+				return
+			}
+
+			var retryErr *RetryError
+			if !errors.As(err, &retryErr) {
+				t.Fatalf("expected RetryError, got %v", err)
+			}
+			if retryErr.Retries != tt.wantRetries {
+				t.Errorf("Retries = %d, want %d", retryErr.Retries, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestVoiceVITS_Headers(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 重试的请求同样要带上请求头
+		if got := r.Header.Get("X-Api-Key"); got != "secret" {
+			t.Errorf("request %d X-Api-Key = %q, want secret", calls.Load()+1, got)
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("audio"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 0)
+	client.BaseDelay = time.Millisecond
+	client.SetTransportConfig(httptransport.Config{Headers: map[string]string{"X-Api-Key": "secret"}})
+
+	if _, err := client.VoiceVITS(context.Background(), "你好", client.DefaultVoice()); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d, want 2", calls.Load())
+	}
+}
+
+func TestVoiceVITS_Cache(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte("audio-" + r.URL.Query().Get("text")))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 0)
+	client.SetCacheSize(1)
+	ctx := context.Background()
+	hits := testutil.ToFloat64(metrics.TTSCacheLookups.WithLabelValues(metrics.CacheHit))
+	misses := testutil.ToFloat64(metrics.TTSCacheLookups.WithLabelValues(metrics.CacheMiss))
+
+	for _, text := range []string{"你好", "你好", "再见", "你好"} {
+		audioData, err := client.VoiceVITS(ctx, text, client.DefaultVoice())
+		if err != nil || string(audioData) != "audio-"+text {
+			t.Fatalf("VoiceVITS(%q) = %q, %v", text, audioData, err)
+		}
+	}
+
+	// 容量为1，第三次请求会淘汰"你好"
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3", calls.Load())
+	}
+	if hits, misses := client.CacheStats(); hits != 1 || misses != 3 {
+		t.Errorf("CacheStats() = %d, %d, want 1, 3", hits, misses)
+	}
+	gotHits := testutil.ToFloat64(metrics.TTSCacheLookups.WithLabelValues(metrics.CacheHit)) - hits
+	gotMisses := testutil.ToFloat64(metrics.TTSCacheLookups.WithLabelValues(metrics.CacheMiss)) - misses
+	if gotHits != 1 || gotMisses != 3 {
+		t.Errorf("TTSCacheLookups hit, miss += %v, %v, want 1, 3", gotHits, gotMisses)
+	}
+
+	// 不同说话人不应命中缓存
+	if _, err := client.VoiceVITS(ctx, "你好", Voice{SpeakerID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 4 {
+		t.Errorf("calls = %d, want 4", calls.Load())
+	}
+}
+
+func TestVoiceVITS_MaxAudioBytes(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// 不带Content-Length分块发送，客户端只能边读边判断
+		for range 64 {
+			w.Write(bytes.Repeat([]byte{1}, 1024))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		limit   int
+		wantErr error
+		wantLen int
+	}{
+		{name: "未超过上限", limit: 64 << 10, wantLen: 64 << 10},
+		{name: "超过上限", limit: 16 << 10, wantErr: ErrAudioTooLarge},
+		{name: "不限制", limit: 0, wantLen: 64 << 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			client := NewClient(server.URL, "", 0)
+			client.MaxAudioBytes = tt.limit
+			client.BaseDelay = time.Millisecond
+
+			data, err := client.VoiceVITS(context.Background(), "こんにちは", client.DefaultVoice())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VoiceVITS() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(data) != tt.wantLen {
+				t.Errorf("len(data) = %d, want %d", len(data), tt.wantLen)
+			}
+			// 超过上限不是临时错误，不重试
+			if calls.Load() != 1 {
+				t.Errorf("calls = %d, want 1", calls.Load())
+			}
+
+			stream, err := client.VoiceVITSStream(context.Background(), "こんにちは", client.DefaultVoice())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stream.Close()
+			data, err = io.ReadAll(stream)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("stream read error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && len(data) != tt.limit {
+				t.Errorf("stream read %d bytes, want %d", len(data), tt.limit)
+			}
+		})
+	}
+}
+
+func TestVoiceVITS_ConnectionReuse(t *testing.T) {
+	const concurrency = 8
+	var newConns atomic.Int32
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 等同一轮的请求全部到达后再返回，保证每轮都同时占用concurrency个连接
+		arrived <- struct{}{}
+		<-release
+		w.Write([]byte("audio"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 0)
+	client.MaxRetries = 0
+	for round := range 3 {
+		errs := make(chan error, concurrency)
+		for i := range concurrency {
+			go func() {
+				_, err := client.VoiceVITS(context.Background(), fmt.Sprintf("%d-%d", round, i), client.DefaultVoice())
+				errs <- err
+			}()
+		}
+		for range concurrency {
+			<-arrived
+		}
+		for range concurrency {
+			release <- struct{}{}
+		}
+		for range concurrency {
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// http.DefaultTransport每个host只保留2个空闲连接，后两轮会重新建立连接
+	if got := newConns.Load(); got != concurrency {
+		t.Errorf("new connections = %d, want %d", got, concurrency)
+	}
+}
+
+func TestVoiceVITS_Format(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Query().Get("format")))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 0)
+	for _, format := range AudioFormats {
+		client.AudioFormat = format
+		audioData, err := client.VoiceVITS(context.Background(), "你好", client.DefaultVoice())
+		if err != nil || string(audioData) != format {
+			t.Errorf("VoiceVITS() with format %s = %q, %v", format, audioData, err)
+		}
+	}
+}
+
+func TestValidateSpeaker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/voice/speakers" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"VITS":[{"id":0,"name":"a","lang":["zh"]},{"id":4,"name":"b","lang":["ja"]}],"HUBERT-VITS":[]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 0)
+	tests := []struct {
+		name      string
+		speakerID int
+		wantErr   bool
+	}{
+		{name: "存在的说话人", speakerID: 4},
+		{name: "不存在的说话人", speakerID: 5, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := client.ValidateSpeaker(context.Background(), tt.speakerID); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSpeaker(%d) error = %v, wantErr %v", tt.speakerID, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListSpeakersCache(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"VITS":[{"id":4,"name":"b","lang":["ja"]}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 0)
+	client.SpeakerRefreshInterval = time.Hour
+	for range 2 {
+		speakers, err := client.ListSpeakers(context.Background())
+		if err != nil || len(speakers) != 1 || speakers[0].Name != "b" {
+			t.Fatalf("ListSpeakers() = %v, %v", speakers, err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("VITS called %d times, want 1", calls.Load())
+	}
+
+	// 缓存过期后刷新失败，继续使用上一次的列表
+	client.SpeakerRefreshInterval = 0
+	fail.Store(true)
+	if speakers, err := client.ListSpeakers(context.Background()); err != nil || len(speakers) != 1 {
+		t.Errorf("ListSpeakers() after failed refresh = %v, %v", speakers, err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("VITS called %d times, want 2", calls.Load())
+	}
+
+	if _, err := NewClient(server.URL, "", 0).ListSpeakers(context.Background()); err == nil {
+		t.Error("ListSpeakers() without cache error = nil")
+	}
+}
+
+// testWAV 构造一个只有头部和少量采样的PCM WAV
+func testWAV(sampleRate uint32) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("RIFF")
+	binary.Write(buf, binary.LittleEndian, uint32(36+4))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(buf, binary.LittleEndian, uint32(16))
+	binary.Write(buf, binary.LittleEndian, uint16(1))    // PCM
+	binary.Write(buf, binary.LittleEndian, uint16(1))    // 单声道
+	binary.Write(buf, binary.LittleEndian, sampleRate)   // 采样率
+	binary.Write(buf, binary.LittleEndian, sampleRate*2) // 字节率
+	binary.Write(buf, binary.LittleEndian, uint16(2))    // 块对齐
+	binary.Write(buf, binary.LittleEndian, uint16(16))   // 位深
+	buf.WriteString("data")
+	binary.Write(buf, binary.LittleEndian, uint32(4))
+	buf.Write([]byte{1, 2, 3, 4})
+	return buf.Bytes()
+}
+
+func TestVoiceVITS_SpeedPitch(t *testing.T) {
+	var length string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		length = r.URL.Query().Get("length")
+		w.Write(testWAV(22050))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 0)
+	tests := []struct {
+		name       string
+		voice      Voice
+		wantLength string
+		wantRate   uint32
+	}{
+		{name: "默认", voice: Voice{}, wantLength: "1.000", wantRate: 22050},
+		{name: "放慢", voice: Voice{Speed: 0.5}, wantLength: "2.000", wantRate: 22050},
+		{name: "超出范围截断", voice: Voice{Speed: 10, Pitch: 3}, wantLength: "0.750", wantRate: 33075},
+		{name: "升调", voice: Voice{Speed: 1, Pitch: 1.2}, wantLength: "1.200", wantRate: 26460},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := client.VoiceVITS(context.Background(), "你好", tt.voice)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if length != tt.wantLength {
+				t.Errorf("length = %s, want %s", length, tt.wantLength)
+			}
+			if rate := binary.LittleEndian.Uint32(data[24:28]); rate != tt.wantRate {
+				t.Errorf("sample rate = %d, want %d", rate, tt.wantRate)
+			}
+		})
+	}
+}
+
+func TestVoiceVITS_SampleRate(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(testWAV(22050))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		format   string
+		voice    Voice
+		wantRate uint32
+		wantErr  error
+	}{
+		{name: "沿用模型采样率", format: FormatWAV, voice: Voice{}, wantRate: 22050},
+		{name: "重采样", format: FormatWAV, voice: Voice{SampleRate: 16000}, wantRate: 16000},
+		{name: "升调后重采样", format: FormatWAV, voice: Voice{Speed: 1, Pitch: 1.2, SampleRate: 48000}, wantRate: 48000},
+		{name: "不支持的采样率", format: FormatWAV, voice: Voice{SampleRate: 11025}, wantErr: ErrUnsupportedSampleRate},
+		{name: "不是wav格式", format: "mp3", voice: Voice{SampleRate: 16000}, wantErr: ErrUnsupportedSampleRate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(server.URL, "", 0)
+			client.AudioFormat = tt.format
+			requests = 0
+			data, err := client.VoiceVITS(context.Background(), "你好", tt.voice)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VoiceVITS() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// 配置错误不请求VITS
+				if requests != 0 {
+					t.Errorf("requests = %d, want 0", requests)
+				}
+				return
+			}
+			if rate := binary.LittleEndian.Uint32(data[24:28]); rate != tt.wantRate {
+				t.Errorf("sample rate = %d, want %d", rate, tt.wantRate)
+			}
+		})
+	}
+}
+
+func TestVoiceVITS_SSML(t *testing.T) {
+	var path, ssml, text string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ssml, text = r.URL.Path, r.FormValue("ssml"), r.FormValue("text")
+		w.Write([]byte("audio"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 3)
+	client.Lang = "ja"
+	tests := []struct {
+		name     string
+		voice    Voice
+		wantPath string
+		wantSSML string
+	}{
+		{name: "普通文本", voice: Voice{SpeakerID: 3}, wantPath: "/voice/vits"},
+		{
+			name:     "SSML",
+			voice:    Voice{SpeakerID: 3, Speed: 2, SSML: true},
+			wantPath: "/voice/ssml",
+			wantSSML: `<speak id="3" length="0.500" format="wav" lang="ja"><voice><emphasis>大好き</emphasis></voice></speak>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := client.VoiceVITS(context.Background(), "<emphasis>大好き</emphasis>", tt.voice); err != nil {
+				t.Fatal(err)
+			}
+			if path != tt.wantPath || ssml != tt.wantSSML {
+				t.Errorf("request = %s %q, want %s %q", path, ssml, tt.wantPath, tt.wantSSML)
+			}
+			if tt.voice.SSML && text != "" {
+				t.Errorf("text = %q, want empty for ssml request", text)
+			}
+		})
+	}
+
+	if _, err := client.VoiceVITSStream(context.Background(), "<emphasis>大好き</emphasis>", Voice{SSML: true}); !errors.Is(err, ErrSSMLStream) {
+		t.Errorf("VoiceVITSStream() error = %v, want ErrSSMLStream", err)
+	}
+}
+
+func Test_scaleWAVSampleRate(t *testing.T) {
+	if _, err := scaleWAVSampleRate([]byte("not a wav file"), 1.2); !errors.Is(err, ErrInvalidWAV) {
+		t.Errorf("scaleWAVSampleRate() error = %v, want ErrInvalidWAV", err)
+	}
+
+	src := testWAV(16000)
+	out, err := scaleWAVSampleRate(src, 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate := binary.LittleEndian.Uint32(out[24:28]); rate != 24000 {
+		t.Errorf("sample rate = %d, want 24000", rate)
+	}
+	if byteRate := binary.LittleEndian.Uint32(out[28:32]); byteRate != 48000 {
+		t.Errorf("byte rate = %d, want 48000", byteRate)
+	}
+	if binary.LittleEndian.Uint32(src[24:28]) != 16000 {
+		t.Error("source wav was modified")
+	}
+}
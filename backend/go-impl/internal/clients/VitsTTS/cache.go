@@ -0,0 +1,106 @@
+package VitsTTS
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"LingChat/internal/metrics"
+)
+
+// audioCache 按合成参数缓存音频的LRU缓存，并发安全
+type audioCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+
+	// hits/misses 本缓存的查询次数，供CacheStats读取；监控使用metrics.TTSCacheLookups
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cacheEntry struct {
+	key  string
+	data []byte
+}
+
+func newAudioCache(capacity int) *audioCache {
+	return &audioCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// cacheKey 对文本和所有影响合成结果的参数取哈希
+func cacheKey(text string, params ...string) string {
+	h := sha256.New()
+	h.Write([]byte(text))
+	for _, p := range params {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get 命中和未命中计入metrics.TTSCacheLookups
+func (c *audioCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		metrics.TTSCacheLookups.WithLabelValues(metrics.CacheMiss).Inc()
+		return nil, false
+	}
+	c.hits.Add(1)
+	metrics.TTSCacheLookups.WithLabelValues(metrics.CacheHit).Inc()
+	c.ll.MoveToFront(elem)
+	return bytes.Clone(elem.Value.(*cacheEntry).data), true
+}
+
+func (c *audioCache) put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*cacheEntry).data = bytes.Clone(data)
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, data: bytes.Clone(data)})
+	for c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// SetCacheSize 设置音频缓存可容纳的条目数，<=0时关闭缓存
+func (c *Client) SetCacheSize(size int) {
+	if size <= 0 {
+		c.cache = nil
+		return
+	}
+	c.cache = newAudioCache(size)
+}
+
+// CacheStats 返回音频缓存的命中和未命中次数，缓存关闭时均为0
+func (c *Client) CacheStats() (hits, misses uint64) {
+	if c.cache == nil {
+		return 0, 0
+	}
+	return c.cache.hits.Load(), c.cache.misses.Load()
+}
+
+func (c *Client) voiceCacheKey(text string, voice Voice) string {
+	return cacheKey(text, strconv.Itoa(voice.SpeakerID), c.AudioFormat, c.Lang,
+		strconv.FormatFloat(voice.Speed, 'f', 3, 64), strconv.FormatFloat(voice.Pitch, 'f', 3, 64), strconv.Itoa(voice.SampleRate), strconv.FormatBool(voice.SSML))
+}
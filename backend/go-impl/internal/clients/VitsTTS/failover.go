@@ -0,0 +1,56 @@
+package VitsTTS
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"LingChat/internal/logging"
+)
+
+// TTSProvider 语音合成后端，Client实现了该接口
+type TTSProvider interface {
+	VoiceVITS(ctx context.Context, text string, voice Voice) ([]byte, error)
+}
+
+var _ TTSProvider = (*Client)(nil)
+
+// NamedProvider 带名称的语音合成后端，名称用于日志
+type NamedProvider struct {
+	Name     string
+	Provider TTSProvider
+}
+
+// Failover 按顺序尝试多个语音合成后端，前一个失败（已包含其自身的重试）时使用下一个
+type Failover struct {
+	providers []NamedProvider
+}
+
+var _ TTSProvider = (*Failover)(nil)
+
+func NewFailover(providers ...NamedProvider) *Failover {
+	return &Failover{providers: providers}
+}
+
+// VoiceVITS 返回第一个成功的后端合成的音频；ctx结束时不再尝试后续后端，
+// 全部失败时返回各后端错误的合并
+func (f *Failover) VoiceVITS(ctx context.Context, text string, voice Voice) ([]byte, error) {
+	logger := logging.FromContext(ctx)
+	var errs []error
+	for _, p := range f.providers {
+		data, err := p.Provider.VoiceVITS(ctx, text, voice)
+		if err == nil {
+			logger.Info("语音合成完成", "provider", p.Name)
+			return data, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+		if ctx.Err() != nil {
+			break
+		}
+		logger.Warn("语音合成失败，尝试下一个后端", "provider", p.Name, "err", err)
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("没有可用的语音合成后端")
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,63 @@
+package VitsTTS
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeProvider 返回固定结果并记录调用次数
+type fakeProvider struct {
+	data  string
+	err   error
+	calls int
+}
+
+func (p *fakeProvider) VoiceVITS(ctx context.Context, text string, voice Voice) ([]byte, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return []byte(p.data), nil
+}
+
+func TestFailover(t *testing.T) {
+	errDown := errors.New("down")
+	tests := []struct {
+		name      string
+		primary   *fakeProvider
+		fallback  *fakeProvider
+		cancelled bool
+		want      string
+		wantErr   bool
+		wantCalls [2]int
+	}{
+		{name: "主后端成功", primary: &fakeProvider{data: "primary"}, fallback: &fakeProvider{data: "fallback"}, want: "primary", wantCalls: [2]int{1, 0}},
+		{name: "主后端失败时使用备用", primary: &fakeProvider{err: errDown}, fallback: &fakeProvider{data: "fallback"}, want: "fallback", wantCalls: [2]int{1, 1}},
+		{name: "全部失败", primary: &fakeProvider{err: errDown}, fallback: &fakeProvider{err: errDown}, wantErr: true, wantCalls: [2]int{1, 1}},
+		{name: "已取消时不再尝试备用", primary: &fakeProvider{err: context.Canceled}, fallback: &fakeProvider{data: "fallback"}, cancelled: true, wantErr: true, wantCalls: [2]int{1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelled {
+				cancel()
+			}
+			f := NewFailover(NamedProvider{Name: "primary", Provider: tt.primary}, NamedProvider{Name: "fallback", Provider: tt.fallback})
+			data, err := f.VoiceVITS(ctx, "text", Voice{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VoiceVITS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(data) != tt.want {
+				t.Errorf("VoiceVITS() = %q, want %q", data, tt.want)
+			}
+			if calls := [2]int{tt.primary.calls, tt.fallback.calls}; calls != tt.wantCalls {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if tt.wantErr && !tt.cancelled && !errors.Is(err, errDown) {
+				t.Errorf("errors.Is(err, errDown) = false, err = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package VitsTTS
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// 音量均衡的方式
+const (
+	// NormalizePeak 把峰值调整到目标电平
+	NormalizePeak = "peak"
+	// NormalizeRMS 把均方根（平均响度）调整到目标电平，增益受峰值限制，不会削波
+	NormalizeRMS = "rms"
+)
+
+// 各方式的默认目标电平，单位dBFS
+const (
+	DefaultPeakTarget = -1.0
+	DefaultRMSTarget  = -20.0
+)
+
+// NormalizeWAV 按mode把16位PCM WAV的音量调整到target dBFS，只缩放data块中的采样，其余块原样保留。
+// 全部静音时原样返回；不是16位PCM时返回ErrInvalidWAV
+func NormalizeWAV(data []byte, mode string, target float64) ([]byte, error) {
+	if mode != NormalizePeak && mode != NormalizeRMS {
+		return nil, fmt.Errorf("unsupported normalize mode %q", mode)
+	}
+	fmtOff, err := wavFmtOffset(data)
+	if err != nil {
+		return nil, err
+	}
+	format := parseWAVFormat(data, fmtOff)
+	if format.formatTag != 1 || format.bitsPerSample != 16 {
+		return nil, fmt.Errorf("%w: normalizing needs 16-bit PCM, got %s", ErrInvalidWAV, format)
+	}
+	dataOff, dataSize, err := wavChunk(data, "data")
+	if err != nil {
+		return nil, err
+	}
+	pcm := data[dataOff : dataOff+dataSize-dataSize%2]
+
+	var peak, sumSquares float64
+	for i := 0; i < len(pcm); i += 2 {
+		v := float64(int16(binary.LittleEndian.Uint16(pcm[i:])))
+		peak = max(peak, math.Abs(v))
+		sumSquares += v * v
+	}
+	if peak == 0 {
+		return data, nil
+	}
+	// 电平相对于满幅32768
+	level := peak / 32768
+	if mode == NormalizeRMS {
+		level = math.Sqrt(sumSquares/float64(len(pcm)/2)) / 32768
+	}
+	gain := math.Pow(10, target/20) / level
+	if mode == NormalizeRMS {
+		gain = min(gain, 32767/peak)
+	}
+
+	out := bytes.Clone(data)
+	for i := dataOff; i < dataOff+len(pcm); i += 2 {
+		v := float64(int16(binary.LittleEndian.Uint16(out[i:]))) * gain
+		v = max(math.MinInt16, min(math.MaxInt16, math.Round(v)))
+		binary.LittleEndian.PutUint16(out[i:], uint16(int16(v)))
+	}
+	return out, nil
+}
+
+// Normalizing 对Provider合成的WAV音频做音量均衡，Provider需请求wav格式；需要转码时放在转码之前
+type Normalizing struct {
+	Provider TTSProvider
+	// Mode 均衡方式，NormalizePeak或NormalizeRMS
+	Mode string
+	// Target 目标电平，单位dBFS
+	Target float64
+}
+
+var _ TTSProvider = (*Normalizing)(nil)
+
+func (n *Normalizing) VoiceVITS(ctx context.Context, text string, voice Voice) ([]byte, error) {
+	data, err := n.Provider.VoiceVITS(ctx, text, voice)
+	if err != nil || len(data) == 0 {
+		return data, err
+	}
+	return NormalizeWAV(data, n.Mode, n.Target)
+}
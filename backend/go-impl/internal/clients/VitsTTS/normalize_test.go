@@ -0,0 +1,101 @@
+package VitsTTS
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+// pcmWAV 16000Hz单声道16位、采样为samples的WAV
+func pcmWAV(samples ...int16) []byte {
+	data := testWAV(16000)
+	data = data[:len(data)-4]
+	binary.LittleEndian.PutUint32(data[40:44], uint32(len(samples)*2))
+	for _, s := range samples {
+		data = binary.LittleEndian.AppendUint16(data, uint16(s))
+	}
+	binary.LittleEndian.PutUint32(data[4:8], uint32(len(data)-8))
+	return data
+}
+
+func wavSamples(t *testing.T, data []byte) []int16 {
+	t.Helper()
+	off, size, err := wavChunk(data, "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := make([]int16, 0, size/2)
+	for i := off; i < off+size; i += 2 {
+		samples = append(samples, int16(binary.LittleEndian.Uint16(data[i:i+2])))
+	}
+	return samples
+}
+
+func TestNormalizeWAV(t *testing.T) {
+	eightBit := testWAV(16000)
+	binary.LittleEndian.PutUint16(eightBit[34:36], 8)
+	// 20*log10(0.5)，即满幅的一半
+	halfScale := 20 * math.Log10(0.5)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		mode        string
+		target      float64
+		wantSamples []int16
+		wantErr     error
+	}{
+		{name: "峰值放大", data: pcmWAV(1000, -2000, 500), mode: NormalizePeak, target: halfScale, wantSamples: []int16{8192, -16384, 4096}},
+		{name: "峰值缩小", data: pcmWAV(32000, -16000), mode: NormalizePeak, target: halfScale, wantSamples: []int16{16384, -8192}},
+		{name: "均方根", data: pcmWAV(1000, -1000, 1000, -1000), mode: NormalizeRMS, target: DefaultRMSTarget, wantSamples: []int16{3277, -3277, 3277, -3277}},
+		{name: "均方根增益受峰值限制", data: pcmWAV(30000, 0, 0, 0), mode: NormalizeRMS, target: -1, wantSamples: []int16{32767, 0, 0, 0}},
+		{name: "静音原样返回", data: pcmWAV(0, 0), mode: NormalizePeak, target: DefaultPeakTarget, wantSamples: []int16{0, 0}},
+		{name: "不是16位PCM", data: eightBit, mode: NormalizePeak, target: DefaultPeakTarget, wantErr: ErrInvalidWAV},
+		{name: "不是WAV", data: []byte("mp3 data"), mode: NormalizePeak, target: DefaultPeakTarget, wantErr: ErrInvalidWAV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := NormalizeWAV(tt.data, tt.mode, tt.target)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizeWAV() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(out) != len(tt.data) || string(out[:44]) != string(tt.data[:44]) {
+				t.Errorf("header changed: %v, want %v", out[:44], tt.data[:44])
+			}
+			if got := wavSamples(t, out); !slices.Equal(got, tt.wantSamples) {
+				t.Errorf("samples = %v, want %v", got, tt.wantSamples)
+			}
+		})
+	}
+
+	if _, err := NormalizeWAV(pcmWAV(1000), "loudness", -1); err == nil {
+		t.Error("NormalizeWAV() with unknown mode: error = nil")
+	}
+}
+
+func TestNormalizing(t *testing.T) {
+	provider := &Normalizing{
+		Provider: &fakeProvider{data: string(pcmWAV(1000, -2000))},
+		Mode:     NormalizePeak,
+		Target:   0,
+	}
+	data, err := provider.VoiceVITS(context.Background(), "こんにちは", Voice{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := wavSamples(t, data), []int16{16384, -32768}; !slices.Equal(got, want) {
+		t.Errorf("samples = %v, want %v", got, want)
+	}
+
+	// 空音频原样交给调用方处理
+	provider.Provider = &fakeProvider{}
+	if data, err := provider.VoiceVITS(context.Background(), "こんにちは", Voice{}); err != nil || len(data) != 0 {
+		t.Errorf("VoiceVITS() = %v, %v, want empty audio", data, err)
+	}
+}
@@ -0,0 +1,66 @@
+package VitsTTS
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidSSML SSML片段不是格式正确的XML，或含有SSMLElements以外的元素、属性
+var ErrInvalidSSML = errors.New("invalid ssml fragment")
+
+// SSMLElements SSML片段中允许的元素及各元素允许的属性。
+// <speak>、<voice>由ssmlDocument生成，片段中不能再出现
+var SSMLElements = map[string][]string{
+	"emphasis": {"level"},
+	"break":    {"time", "strength"},
+	"prosody":  {"rate", "pitch", "volume"},
+	"say-as":   {"interpret-as", "format"},
+	"sub":      {"alias"},
+	"p":        nil,
+	"s":        nil,
+}
+
+// ValidateSSML 检查fragment是格式正确、只含SSMLElements中元素和属性的XML片段，
+// 不接受注释、处理指令和DTD。通过检查的片段可以直接嵌入<voice>中
+func ValidateSSML(fragment string) error {
+	// 包一层根元素，使片段中的多个元素和文本也能作为一个文档解析
+	d := xml.NewDecoder(strings.NewReader("<ssml>" + fragment + "</ssml>"))
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSSML, err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				continue
+			}
+			attrs, ok := SSMLElements[tok.Name.Local]
+			if !ok || tok.Name.Space != "" {
+				return fmt.Errorf("%w: element <%s> is not allowed", ErrInvalidSSML, tok.Name.Local)
+			}
+			for _, attr := range tok.Attr {
+				if attr.Name.Space != "" || !slices.Contains(attrs, attr.Name.Local) {
+					return fmt.Errorf("%w: attribute %s of <%s> is not allowed", ErrInvalidSSML, attr.Name.Local, tok.Name.Local)
+				}
+			}
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				// 根元素之后还有内容说明片段提前闭合了根元素，比如含有</ssml>
+				if _, err := d.Token(); err != io.EOF {
+					return fmt.Errorf("%w: unbalanced elements", ErrInvalidSSML)
+				}
+				return nil
+			}
+		case xml.Comment, xml.ProcInst, xml.Directive:
+			return fmt.Errorf("%w: only elements and text are allowed", ErrInvalidSSML)
+		}
+	}
+}
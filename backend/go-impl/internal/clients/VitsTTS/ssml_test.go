@@ -0,0 +1,59 @@
+package VitsTTS
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateSSML(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment string
+		wantErr  bool
+	}{
+		{name: "纯文本", fragment: "こんにちは"},
+		{name: "转义字符", fragment: "1 &lt; 2 &amp; 3"},
+		{name: "允许的元素和属性", fragment: `<emphasis level="strong">大好き</emphasis><break time="500ms"/><prosody rate="slow">ね</prosody>`},
+		{name: "闭合voice注入新元素", fragment: `</voice></speak><speak id="0"><voice>x`, wantErr: true},
+		{name: "提前闭合根元素", fragment: "</ssml><ssml>", wantErr: true},
+		{name: "不允许的元素", fragment: `<audio src="http://example.com/a.wav"/>`, wantErr: true},
+		{name: "嵌套voice", fragment: `<voice name="x">こんにちは</voice>`, wantErr: true},
+		{name: "不允许的属性", fragment: `<emphasis onload="x">大好き</emphasis>`, wantErr: true},
+		{name: "未闭合的元素", fragment: "<emphasis>大好き", wantErr: true},
+		{name: "未转义的尖括号", fragment: "1 < 2", wantErr: true},
+		{name: "注释", fragment: "<!-- x -->", wantErr: true},
+		{name: "DTD", fragment: `<!DOCTYPE x [<!ENTITY e "x">]>`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSSML(tt.fragment)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("ValidateSSML(%q) error = %v, wantErr %v", tt.fragment, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSSML) {
+				t.Errorf("ValidateSSML(%q) error = %v, want ErrInvalidSSML", tt.fragment, err)
+			}
+		})
+	}
+}
+
+func TestVoiceVITS_InvalidSSML(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("audio"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 3)
+	_, err := client.VoiceVITS(context.Background(), `x</voice></speak>`, Voice{SSML: true})
+	if !errors.Is(err, ErrInvalidSSML) {
+		t.Errorf("VoiceVITS() error = %v, want ErrInvalidSSML", err)
+	}
+	if requests != 0 {
+		t.Errorf("requests = %d, want 0", requests)
+	}
+}
@@ -0,0 +1,73 @@
+package VitsTTS
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// DefaultStreamChunkSize VoiceVITSChunks每块音频的默认最大字节数
+const DefaultStreamChunkSize = 16 << 10
+
+// AudioChunk 流式合成的一块音频，Seq从0开始按到达顺序递增。
+// Err不为nil时是最后一块，表示读取中途失败，Data为空
+type AudioChunk struct {
+	Seq  int
+	Data []byte
+	Err  error
+}
+
+// StreamProvider 支持边合成边返回音频的语音合成后端，Client实现了该接口
+type StreamProvider interface {
+	VoiceVITSChunks(ctx context.Context, text string, voice Voice) (<-chan AudioChunk, error)
+}
+
+var _ StreamProvider = (*Client)(nil)
+
+// VoiceVITSChunks 在VoiceVITSStream基础上把收到的音频按到达顺序分块发送到返回的channel，
+// 每块不超过StreamChunkSize。请求失败（如VITS服务不支持流式、voice为SSML）时返回错误，不重试；
+// 读完、读取失败或ctx结束后关闭channel，ctx结束时不再发送错误块
+func (c *Client) VoiceVITSChunks(ctx context.Context, text string, voice Voice) (<-chan AudioChunk, error) {
+	body, err := c.VoiceVITSStream(ctx, text, voice)
+	if err != nil {
+		return nil, err
+	}
+	size := c.StreamChunkSize
+	if size <= 0 {
+		size = DefaultStreamChunkSize
+	}
+
+	chunks := make(chan AudioChunk)
+	go func() {
+		defer close(chunks)
+		defer body.Close()
+		send := func(chunk AudioChunk) bool {
+			select {
+			case chunks <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for seq := 0; ; {
+			buf := make([]byte, size)
+			n, err := body.Read(buf)
+			if n > 0 {
+				if !send(AudioChunk{Seq: seq, Data: buf[:n]}) {
+					return
+				}
+				seq++
+			}
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					send(AudioChunk{Seq: seq, Err: err})
+				}
+				return
+			}
+		}
+	}()
+	return chunks, nil
+}
@@ -0,0 +1,112 @@
+package VitsTTS
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVoiceVITSChunks(t *testing.T) {
+	audio := bytes.Repeat([]byte("0123456789"), 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("streaming") != "true" {
+			t.Errorf("streaming = %q, want true", r.URL.Query().Get("streaming"))
+		}
+		for i := 0; i < len(audio); i += 7 {
+			w.Write(audio[i:min(i+7, len(audio))])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 0)
+	client.StreamChunkSize = 5
+	chunks, err := client.VoiceVITSChunks(context.Background(), "こんにちは", client.DefaultVoice())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	seq := 0
+	for chunk := range chunks {
+		if chunk.Err != nil {
+			t.Fatal(chunk.Err)
+		}
+		if chunk.Seq != seq {
+			t.Errorf("chunk seq = %d, want %d", chunk.Seq, seq)
+		}
+		if len(chunk.Data) == 0 || len(chunk.Data) > 5 {
+			t.Errorf("chunk size = %d, want 1..5", len(chunk.Data))
+		}
+		got = append(got, chunk.Data...)
+		seq++
+	}
+	if !bytes.Equal(got, audio) {
+		t.Errorf("chunks = %q, want %q", got, audio)
+	}
+}
+
+func TestVoiceVITSChunks_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, "", 0)
+
+	tests := []struct {
+		name    string
+		voice   Voice
+		wantErr func(error) bool
+	}{
+		{name: "不支持流式", voice: client.DefaultVoice(), wantErr: func(err error) bool {
+			var statusErr *StatusError
+			return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+		}},
+		{name: "SSML", voice: Voice{SSML: true}, wantErr: func(err error) bool { return errors.Is(err, ErrSSMLStream) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := client.VoiceVITSChunks(context.Background(), "こんにちは", tt.voice); !tt.wantErr(err) {
+				t.Errorf("VoiceVITSChunks() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestVoiceVITSChunks_Cancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	chunks, err := client.VoiceVITSChunks(ctx, "こんにちは", client.DefaultVoice())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk := <-chunks; string(chunk.Data) != "first" {
+		t.Fatalf("first chunk = %+v, want first", chunk)
+	}
+	cancel()
+
+	// 取消后channel关闭，不再发送错误块
+	select {
+	case chunk, ok := <-chunks:
+		if ok {
+			t.Errorf("received %+v after cancel, want closed channel", chunk)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+}
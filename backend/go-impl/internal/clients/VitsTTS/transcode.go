@@ -0,0 +1,77 @@
+package VitsTTS
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// DefaultTranscodeBitrate 转码的默认码率
+const DefaultTranscodeBitrate = "64k"
+
+// FFmpegTranscoder 调用ffmpeg把VITS返回的WAV转为体积更小的格式，音频通过标准输入输出传递，不落盘
+type FFmpegTranscoder struct {
+	// Path ffmpeg可执行文件
+	Path string
+	// Format 目标格式，mp3或ogg
+	Format string
+	// Bitrate 目标码率，如"64k"，为空时使用ffmpeg的默认值
+	Bitrate string
+}
+
+// NewFFmpegTranscoder 检查path能否找到ffmpeg以及format是否支持，找不到ffmpeg时返回错误，
+// 调用方可以据此继续使用WAV
+func NewFFmpegTranscoder(path string, format string) (*FFmpegTranscoder, error) {
+	if format != FormatMP3 && format != FormatOGG {
+		return nil, fmt.Errorf("unsupported transcode format %q", format)
+	}
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg not found: %w", err)
+	}
+	return &FFmpegTranscoder{
+		Path:    resolved,
+		Format:  format,
+		Bitrate: DefaultTranscodeBitrate,
+	}, nil
+}
+
+// Transcode 把WAV音频转为Format格式
+func (t *FFmpegTranscoder) Transcode(ctx context.Context, wav []byte) ([]byte, error) {
+	args := []string{"-hide_banner", "-loglevel", "error", "-f", FormatWAV, "-i", "pipe:0"}
+	if t.Bitrate != "" {
+		args = append(args, "-b:a", t.Bitrate)
+	}
+	args = append(args, "-f", t.Format, "pipe:1")
+
+	cmd := exec.CommandContext(ctx, t.Path, args...)
+	cmd.Stdin = bytes.NewReader(wav)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("ffmpeg transcode to %s failed: %w: %s", t.Format, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Transcoding 对Provider合成的WAV音频转码，Provider需请求wav格式
+type Transcoding struct {
+	Provider   TTSProvider
+	Transcoder *FFmpegTranscoder
+}
+
+var _ TTSProvider = (*Transcoding)(nil)
+
+func (t *Transcoding) VoiceVITS(ctx context.Context, text string, voice Voice) ([]byte, error) {
+	data, err := t.Provider.VoiceVITS(ctx, text, voice)
+	if err != nil || len(data) == 0 {
+		return data, err
+	}
+	return t.Transcoder.Transcode(ctx, data)
+}
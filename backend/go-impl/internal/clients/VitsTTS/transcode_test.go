@@ -0,0 +1,79 @@
+package VitsTTS
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeFFmpeg 写一个把参数和标准输入原样输出的脚本代替ffmpeg
+func fakeFFmpeg(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewFFmpegTranscoder(t *testing.T) {
+	path := fakeFFmpeg(t, "exit 0")
+	tests := []struct {
+		name    string
+		path    string
+		format  string
+		wantErr bool
+	}{
+		{name: "mp3", path: path, format: FormatMP3},
+		{name: "ogg", path: path, format: FormatOGG},
+		{name: "不支持转为wav", path: path, format: FormatWAV, wantErr: true},
+		{name: "找不到ffmpeg", path: filepath.Join(t.TempDir(), "missing"), format: FormatMP3, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewFFmpegTranscoder(tt.path, tt.format); (err != nil) != tt.wantErr {
+				t.Errorf("NewFFmpegTranscoder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTranscoding(t *testing.T) {
+	transcoder, err := NewFFmpegTranscoder(fakeFFmpeg(t, `echo "$@"; cat`), FormatMP3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &Transcoding{
+		Provider:   &fakeProvider{data: "wav"},
+		Transcoder: transcoder,
+	}
+
+	data, err := provider.VoiceVITS(context.Background(), "こんにちは", Voice{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, body, _ := strings.Cut(string(data), "\n")
+	if want := "-f wav -i pipe:0 -b:a 64k -f mp3 pipe:1"; !strings.HasSuffix(args, want) {
+		t.Errorf("ffmpeg args = %q, want suffix %q", args, want)
+	}
+	if body != "wav" {
+		t.Errorf("ffmpeg stdin = %q, want %q", body, "wav")
+	}
+}
+
+func TestTranscodingError(t *testing.T) {
+	transcoder, err := NewFFmpegTranscoder(fakeFFmpeg(t, `echo "unknown encoder" >&2; exit 1`), FormatMP3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = transcoder.Transcode(context.Background(), []byte("wav"))
+	if err == nil || !strings.Contains(err.Error(), "unknown encoder") {
+		t.Errorf("Transcode() error = %v, want ffmpeg stderr", err)
+	}
+}
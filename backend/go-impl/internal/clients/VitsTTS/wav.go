@@ -0,0 +1,193 @@
+package VitsTTS
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrInvalidWAV 数据不是可识别的PCM WAV
+var ErrInvalidWAV = errors.New("invalid wav data")
+
+// ErrWAVFormatMismatch 要拼接的WAV采样率、声道数或位深不一致
+var ErrWAVFormatMismatch = errors.New("wav formats differ")
+
+// wavChunk 返回id块的数据在data中的起始位置和长度。块长度超出数据时截断到数据末尾，
+// 流式输出的WAV在data块中写的是占位长度
+func wavChunk(data []byte, id string) (int, int, error) {
+	if len(data) < 12 || !bytes.Equal(data[0:4], []byte("RIFF")) || !bytes.Equal(data[8:12], []byte("WAVE")) {
+		return 0, 0, ErrInvalidWAV
+	}
+	pos := 12
+	for pos+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		if string(data[pos:pos+4]) == id {
+			return pos + 8, min(size, len(data)-pos-8), nil
+		}
+		// 块大小为奇数时有一个填充字节
+		pos += 8 + size + size%2
+	}
+	return 0, 0, ErrInvalidWAV
+}
+
+// wavFmtOffset 返回fmt块数据在data中的起始位置
+func wavFmtOffset(data []byte) (int, error) {
+	off, size, err := wavChunk(data, "fmt ")
+	if err != nil || size < 16 {
+		return 0, ErrInvalidWAV
+	}
+	return off, nil
+}
+
+// wavFormat fmt块中拼接时必须一致的字段
+type wavFormat struct {
+	formatTag     uint16
+	channels      uint16
+	sampleRate    uint32
+	bitsPerSample uint16
+}
+
+func (f wavFormat) String() string {
+	return fmt.Sprintf("%d Hz, %d channels, %d bits", f.sampleRate, f.channels, f.bitsPerSample)
+}
+
+func parseWAVFormat(data []byte, off int) wavFormat {
+	return wavFormat{
+		formatTag:     binary.LittleEndian.Uint16(data[off : off+2]),
+		channels:      binary.LittleEndian.Uint16(data[off+2 : off+4]),
+		sampleRate:    binary.LittleEndian.Uint32(data[off+4 : off+8]),
+		bitsPerSample: binary.LittleEndian.Uint16(data[off+14 : off+16]),
+	}
+}
+
+// ConcatWAV 按顺序拼接多段WAV的采样数据，输出沿用第一段的fmt块。
+// 各段格式必须一致，不做重采样，采样率不同时返回ErrWAVFormatMismatch
+func ConcatWAV(parts [][]byte) ([]byte, error) {
+	if len(parts) == 0 {
+		return nil, ErrInvalidWAV
+	}
+	var fmtChunk []byte
+	var format wavFormat
+	samples := make([][]byte, 0, len(parts))
+	total := 0
+	for i, part := range parts {
+		fmtOff, fmtSize, err := wavChunk(part, "fmt ")
+		if err != nil || fmtSize < 16 {
+			return nil, fmt.Errorf("part %d: %w", i, ErrInvalidWAV)
+		}
+		dataOff, dataSize, err := wavChunk(part, "data")
+		if err != nil {
+			return nil, fmt.Errorf("part %d: %w", i, err)
+		}
+		partFormat := parseWAVFormat(part, fmtOff)
+		if i == 0 {
+			fmtChunk, format = part[fmtOff-8:fmtOff+fmtSize], partFormat
+		} else if partFormat != format {
+			return nil, fmt.Errorf("%w: part %d is %s, part 0 is %s", ErrWAVFormatMismatch, i, partFormat, format)
+		}
+		samples = append(samples, part[dataOff:dataOff+dataSize])
+		total += dataSize
+	}
+	return buildWAV(fmtChunk, total, samples...), nil
+}
+
+// buildWAV 由fmt块（含块头）和按顺序排列的采样数据组成WAV，total为采样数据的总长度
+func buildWAV(fmtChunk []byte, total int, samples ...[]byte) []byte {
+	out := make([]byte, 0, 12+len(fmtChunk)+len(fmtChunk)%2+8+total)
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, 0)
+	out = append(out, "WAVE"...)
+	out = append(out, fmtChunk...)
+	if len(fmtChunk)%2 != 0 {
+		out = append(out, 0)
+	}
+	out = append(out, "data"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(total))
+	for _, s := range samples {
+		out = append(out, s...)
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out
+}
+
+// WAVDuration 按fmt块的字节率和data块的长度计算WAV的播放时长
+func WAVDuration(data []byte) (time.Duration, error) {
+	fmtOff, err := wavFmtOffset(data)
+	if err != nil {
+		return 0, err
+	}
+	byteRate := binary.LittleEndian.Uint32(data[fmtOff+8 : fmtOff+12])
+	if byteRate == 0 {
+		return 0, fmt.Errorf("%w: byte rate is 0", ErrInvalidWAV)
+	}
+	_, dataSize, err := wavChunk(data, "data")
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(int64(dataSize) * int64(time.Second) / int64(byteRate)), nil
+}
+
+// scaleWAVSampleRate 按factor修改WAV头中的采样率和字节率，不改动采样数据，
+// 播放时音调和速度同时变为原来的factor倍
+func scaleWAVSampleRate(data []byte, factor float64) ([]byte, error) {
+	off, err := wavFmtOffset(data)
+	if err != nil {
+		return nil, err
+	}
+	out := bytes.Clone(data)
+	sampleRate := binary.LittleEndian.Uint32(out[off+4 : off+8])
+	blockAlign := binary.LittleEndian.Uint16(out[off+12 : off+14])
+	newRate := uint32(float64(sampleRate)*factor + 0.5)
+	binary.LittleEndian.PutUint32(out[off+4:off+8], newRate)
+	binary.LittleEndian.PutUint32(out[off+8:off+12], newRate*uint32(blockAlign))
+	return out, nil
+}
+
+// resampleWAV 把16位PCM WAV按线性插值重采样到rate，采样率已经是rate时原样返回。
+// 降采样前不做低通滤波，高频会有少量混叠，对语音足够
+func resampleWAV(data []byte, rate int) ([]byte, error) {
+	fmtOff, fmtSize, err := wavChunk(data, "fmt ")
+	if err != nil || fmtSize < 16 {
+		return nil, ErrInvalidWAV
+	}
+	format := parseWAVFormat(data, fmtOff)
+	if int(format.sampleRate) == rate {
+		return data, nil
+	}
+	if format.formatTag != 1 || format.bitsPerSample != 16 || format.channels == 0 || format.sampleRate == 0 {
+		return nil, fmt.Errorf("%w: resampling needs 16-bit PCM, got %s", ErrInvalidWAV, format)
+	}
+	dataOff, dataSize, err := wavChunk(data, "data")
+	if err != nil {
+		return nil, err
+	}
+
+	channels := int(format.channels)
+	frames := dataSize / (2 * channels)
+	outFrames := int(int64(frames) * int64(rate) / int64(format.sampleRate))
+	sample := func(frame, ch int) float64 {
+		i := dataOff + (frame*channels+ch)*2
+		return float64(int16(binary.LittleEndian.Uint16(data[i : i+2])))
+	}
+	ratio := float64(format.sampleRate) / float64(rate)
+	pcm := make([]byte, outFrames*channels*2)
+	for f := range outFrames {
+		pos := float64(f) * ratio
+		i := int(pos)
+		frac := pos - float64(i)
+		j := min(i+1, frames-1)
+		for ch := range channels {
+			v := sample(i, ch)*(1-frac) + sample(j, ch)*frac
+			binary.LittleEndian.PutUint16(pcm[(f*channels+ch)*2:], uint16(int16(math.Round(v))))
+		}
+	}
+
+	fmtChunk := bytes.Clone(data[fmtOff-8 : fmtOff+fmtSize])
+	blockAlign := binary.LittleEndian.Uint16(fmtChunk[8+12 : 8+14])
+	binary.LittleEndian.PutUint32(fmtChunk[8+4:8+8], uint32(rate))
+	binary.LittleEndian.PutUint32(fmtChunk[8+8:8+12], uint32(rate)*uint32(blockAlign))
+	return buildWAV(fmtChunk, len(pcm), pcm), nil
+}
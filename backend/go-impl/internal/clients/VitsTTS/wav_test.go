@@ -0,0 +1,138 @@
+package VitsTTS
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestConcatWAV(t *testing.T) {
+	tests := []struct {
+		name    string
+		parts   [][]byte
+		wantErr error
+		want    []byte
+	}{
+		{name: "单段", parts: [][]byte{testWAV(16000)}, want: []byte{1, 2, 3, 4}},
+		{name: "多段按顺序拼接", parts: [][]byte{testWAV(16000), testWAV(16000), testWAV(16000)}, want: bytes.Repeat([]byte{1, 2, 3, 4}, 3)},
+		{name: "采样率不同", parts: [][]byte{testWAV(16000), testWAV(22050)}, wantErr: ErrWAVFormatMismatch},
+		{name: "不是WAV", parts: [][]byte{testWAV(16000), []byte("mp3 data")}, wantErr: ErrInvalidWAV},
+		{name: "没有音频", parts: nil, wantErr: ErrInvalidWAV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ConcatWAV(tt.parts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ConcatWAV() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if riff := binary.LittleEndian.Uint32(out[4:8]); int(riff) != len(out)-8 {
+				t.Errorf("RIFF size = %d, want %d", riff, len(out)-8)
+			}
+			off, size, err := wavChunk(out, "data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out[off : off+size]; !bytes.Equal(got, tt.want) {
+				t.Errorf("samples = %v, want %v", got, tt.want)
+			}
+			if rate := binary.LittleEndian.Uint32(out[24:28]); rate != 16000 {
+				t.Errorf("sample rate = %d, want 16000", rate)
+			}
+		})
+	}
+}
+
+func TestWAVDuration(t *testing.T) {
+	// 22050Hz单声道16位每秒44100字节
+	long := testWAV(22050)
+	long = append(long[:len(long)-4], bytes.Repeat([]byte{0}, 44100)...)
+	binary.LittleEndian.PutUint32(long[40:44], 44100)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "一秒", data: long, want: time.Second},
+		{name: "不足一毫秒", data: testWAV(16000), want: 125 * time.Microsecond},
+		{name: "不是WAV", data: []byte("mp3 data"), wantErr: true},
+		{name: "为空", data: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := WAVDuration(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WAVDuration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("WAVDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResampleWAV(t *testing.T) {
+	// 16000Hz单声道十个采样，值为0, 100, ..., 900
+	ramp := testWAV(16000)
+	ramp = ramp[:len(ramp)-4]
+	binary.LittleEndian.PutUint32(ramp[40:44], 20)
+	for i := range 10 {
+		ramp = binary.LittleEndian.AppendUint16(ramp, uint16(i*100))
+	}
+	binary.LittleEndian.PutUint32(ramp[4:8], uint32(len(ramp)-8))
+
+	eightBit := testWAV(16000)
+	binary.LittleEndian.PutUint16(eightBit[34:36], 8)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		rate        int
+		wantSamples []int16
+		wantErr     error
+	}{
+		{name: "降采样", data: ramp, rate: 8000, wantSamples: []int16{0, 200, 400, 600, 800}},
+		{name: "升采样插值", data: ramp, rate: 32000, wantSamples: []int16{0, 50, 100, 150, 200, 250, 300, 350, 400, 450, 500, 550, 600, 650, 700, 750, 800, 850, 900, 900}},
+		{name: "采样率相同", data: ramp, rate: 16000, wantSamples: []int16{0, 100, 200, 300, 400, 500, 600, 700, 800, 900}},
+		{name: "不是16位PCM", data: eightBit, rate: 8000, wantErr: ErrInvalidWAV},
+		{name: "不是WAV", data: []byte("mp3 data"), rate: 8000, wantErr: ErrInvalidWAV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := resampleWAV(tt.data, tt.rate)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resampleWAV() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if rate := binary.LittleEndian.Uint32(out[24:28]); int(rate) != tt.rate {
+				t.Errorf("sample rate = %d, want %d", rate, tt.rate)
+			}
+			if byteRate := binary.LittleEndian.Uint32(out[28:32]); int(byteRate) != tt.rate*2 {
+				t.Errorf("byte rate = %d, want %d", byteRate, tt.rate*2)
+			}
+			if riff := binary.LittleEndian.Uint32(out[4:8]); int(riff) != len(out)-8 {
+				t.Errorf("RIFF size = %d, want %d", riff, len(out)-8)
+			}
+			off, size, err := wavChunk(out, "data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]int16, 0, size/2)
+			for i := off; i < off+size; i += 2 {
+				got = append(got, int16(binary.LittleEndian.Uint16(out[i:i+2])))
+			}
+			if !slices.Equal(got, tt.wantSamples) {
+				t.Errorf("samples = %v, want %v", got, tt.wantSamples)
+			}
+		})
+	}
+}
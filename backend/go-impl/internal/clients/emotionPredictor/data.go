@@ -8,6 +8,11 @@ type PredictionResponse struct {
 	Warning    *string    `json:"warning"`
 }
 
+// BatchPredictionResponse /predict_batch的响应，Results与请求的texts顺序一致
+type BatchPredictionResponse struct {
+	Results []PredictionResponse `json:"results"`
+}
+
 // TopLabel represents each entry in the top3 array
 type TopLabel struct {
 	Label       string  `json:"label"`
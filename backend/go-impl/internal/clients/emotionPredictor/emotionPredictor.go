@@ -2,27 +2,120 @@ package emotionPredictor
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-resty/resty/v2"
+
+	"LingChat/internal/clients/httptransport"
+	"LingChat/internal/clients/retrybudget"
+)
+
+const (
+	// DefaultMaxRetries Predict遇到临时错误时的默认重试次数
+	DefaultMaxRetries = 2
+	// DefaultBaseDelay 重试退避的基础间隔，第n次重试等待 BaseDelay * 2^(n-1)
+	DefaultBaseDelay = 100 * time.Millisecond
+)
+
+// ErrBatchUnsupported 未启用批量预测或服务端没有/predict_batch接口
+var ErrBatchUnsupported = errors.New("emotion predictor does not support batch prediction")
+
+// StatusError 情绪预测服务返回了非2xx状态码
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API returned error status: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// Predictor 预测一段文本的情绪，测试中可以替换为假实现
+type Predictor interface {
+	Predict(ctx context.Context, text string, confidenceThreshold float64) (*PredictionResponse, error)
+}
+
+// BatchPredictor 可选接口，一次请求预测多段文本；BatchEnabled为false时调用方逐个调用Predict
+type BatchPredictor interface {
+	BatchEnabled() bool
+	PredictBatch(ctx context.Context, texts []string, confidenceThreshold float64) ([]PredictionResponse, error)
+}
+
+var (
+	_ Predictor      = (*Client)(nil)
+	_ BatchPredictor = (*Client)(nil)
 )
 
 type Client struct {
 	resty.Client
 	URL string
+	// Batch 为true时PredictBatch一次请求预测多段文本
+	Batch bool
+	// MaxRetries Predict遇到5xx、连接错误、超时等临时错误时的最大重试次数，4xx不重试
+	MaxRetries int
+	// BaseDelay 重试退避的基础间隔
+	BaseDelay time.Duration
+
+	// batchUnsupported 服务端返回404/405后不再尝试批量接口
+	batchUnsupported atomic.Bool
 }
 
 func NewClient(url string) *Client {
 	httpClient := resty.New()
 	httpClient.SetTimeout(time.Second * 120)
+	httpClient.SetTransport(httptransport.New(httptransport.DefaultConfig))
 	return &Client{
-		Client: *httpClient,
-		URL:    url,
+		Client:     *httpClient,
+		URL:        url,
+		MaxRetries: DefaultMaxRetries,
+		BaseDelay:  DefaultBaseDelay,
 	}
 }
 
+// SetTransportConfig 按cfg重建连接池，应在开始请求前调用
+func (c *Client) SetTransportConfig(cfg httptransport.Config) {
+	c.SetTransport(httptransport.New(cfg))
+}
+
+// Predict 预测text的情绪，对临时错误按指数退避重试，ctx结束或ctx中的重试预算（见retrybudget）用尽时停止重试并返回最后一次的错误
 func (c *Client) Predict(ctx context.Context, text string, confidenceThreshold float64) (*PredictionResponse, error) {
+	retries := 0
+	for {
+		resp, err := c.predict(ctx, text, confidenceThreshold)
+		if err == nil {
+			return resp, nil
+		}
+		if retries >= c.MaxRetries || !isRetryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		delay := c.BaseDelay << retries
+		if !retrybudget.Allow(ctx, delay) {
+			return nil, errors.Join(err, retrybudget.ErrExhausted)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, errors.Join(err, ctx.Err())
+		}
+		retries++
+	}
+}
+
+// isRetryable 5xx和网络层错误（连接重置、超时等）视为临时错误
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+func (c *Client) predict(ctx context.Context, text string, confidenceThreshold float64) (*PredictionResponse, error) {
 	result := &PredictionResponse{}
 	resp, err := c.R().
 		SetContext(ctx).
@@ -38,9 +131,58 @@ func (c *Client) Predict(ctx context.Context, text string, confidenceThreshold f
 	}
 
 	if !resp.IsSuccess() {
-		return nil, fmt.Errorf("API returned error status: %d, body: %s", resp.StatusCode(), resp.Body())
+		return nil, &StatusError{StatusCode: resp.StatusCode(), Body: string(resp.Body())}
 	}
 
 	return result, nil
 
 }
+
+// BatchEnabled 是否应尝试PredictBatch：启用了Batch且服务端没有报告不支持
+func (c *Client) BatchEnabled() bool {
+	return c.Batch && !c.batchUnsupported.Load()
+}
+
+// PredictBatch 一次请求预测texts中的全部文本，结果与texts顺序一致。
+// 未启用或服务端不支持时返回ErrBatchUnsupported，调用方应逐个调用Predict
+func (c *Client) PredictBatch(ctx context.Context, texts []string, confidenceThreshold float64) ([]PredictionResponse, error) {
+	if !c.BatchEnabled() {
+		return nil, ErrBatchUnsupported
+	}
+	result := &BatchPredictionResponse{}
+	resp, err := c.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(map[string]interface{}{
+			"texts":                texts,
+			"confidence_threshold": confidenceThreshold,
+		}).
+		SetResult(result).
+		Post(c.URL + "/predict_batch")
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode() == http.StatusNotFound || resp.StatusCode() == http.StatusMethodNotAllowed:
+		c.batchUnsupported.Store(true)
+		return nil, ErrBatchUnsupported
+	case !resp.IsSuccess():
+		return nil, fmt.Errorf("API returned error status: %d, body: %s", resp.StatusCode(), resp.Body())
+	case len(result.Results) != len(texts):
+		return nil, fmt.Errorf("batch prediction returned %d results for %d texts", len(result.Results), len(texts))
+	}
+	return result.Results, nil
+}
+
+// Ping 请求/health确认情绪预测服务可达
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.R().SetContext(ctx).Get(c.URL + "/health")
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	if !resp.IsSuccess() {
+		return fmt.Errorf("API returned error status: %d", resp.StatusCode())
+	}
+	return nil
+}
@@ -2,8 +2,16 @@ package emotionPredictor
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"LingChat/internal/clients/httptransport"
 )
 
 func TestPredict(t *testing.T) {
@@ -16,3 +24,173 @@ func TestPredict(t *testing.T) {
 	}
 	fmt.Println(resp)
 }
+
+func TestPredictBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		batch       bool
+		wantErr     error
+		wantLabels  []string
+		wantEnabled bool
+	}{
+		{
+			name: "按顺序返回结果",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Texts []string `json:"texts"`
+				}
+				json.NewDecoder(r.Body).Decode(&req)
+				w.Header().Set("Content-Type", "application/json")
+				var resp BatchPredictionResponse
+				for _, text := range req.Texts {
+					resp.Results = append(resp.Results, PredictionResponse{Label: text + "!"})
+				}
+				json.NewEncoder(w).Encode(resp)
+			},
+			batch:       true,
+			wantLabels:  []string{"开心!", "难过!"},
+			wantEnabled: true,
+		},
+		{
+			name:        "服务端没有批量接口",
+			handler:     http.NotFound,
+			batch:       true,
+			wantErr:     ErrBatchUnsupported,
+			wantEnabled: false,
+		},
+		{
+			name: "结果数量不一致",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"results":[{"label":"开心"}]}`))
+			},
+			batch:       true,
+			wantErr:     errors.New("mismatch"),
+			wantEnabled: true,
+		},
+		{
+			name: "未启用",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				t.Error("unexpected request")
+			},
+			wantErr: ErrBatchUnsupported,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			client := NewClient(server.URL)
+			client.Batch = tt.batch
+
+			got, err := client.PredictBatch(context.Background(), []string{"开心", "难过"}, 0.08)
+			if tt.wantErr != nil {
+				if err == nil || (errors.Is(tt.wantErr, ErrBatchUnsupported) && !errors.Is(err, ErrBatchUnsupported)) {
+					t.Errorf("PredictBatch() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("PredictBatch() error = %v", err)
+			}
+			if len(got) != len(tt.wantLabels) {
+				t.Fatalf("PredictBatch() = %+v, want labels %v", got, tt.wantLabels)
+			}
+			for i, label := range tt.wantLabels {
+				if got[i].Label != label {
+					t.Errorf("results[%d].Label = %q, want %q", i, got[i].Label, label)
+				}
+			}
+			if client.BatchEnabled() != tt.wantEnabled {
+				t.Errorf("BatchEnabled() = %v, want %v", client.BatchEnabled(), tt.wantEnabled)
+			}
+		})
+	}
+}
+
+func TestPredictHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Api-Key"); got != "secret" {
+			t.Errorf("X-Api-Key = %q, want secret", got)
+		}
+		// 附加请求头不影响客户端自己设置的Content-Type
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"label":"开心","confidence":0.9}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.SetTransportConfig(httptransport.Config{Headers: map[string]string{"X-Api-Key": "secret"}})
+	resp, err := client.Predict(context.Background(), "今天天气真好", 0.08)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Label != "开心" {
+		t.Errorf("Label = %q, want 开心", resp.Label)
+	}
+}
+
+func TestPredictRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantErr   bool
+		wantCalls int32
+	}{
+		{name: "503后恢复", statuses: []int{503, 200}, wantCalls: 2},
+		{name: "持续5xx", statuses: []int{500, 502, 503, 503}, wantErr: true, wantCalls: 3},
+		{name: "4xx不重试", statuses: []int{422, 200}, wantErr: true, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.statuses[n-1])
+				w.Write([]byte(`{"label":"开心","confidence":0.9}`))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL)
+			client.BaseDelay = time.Millisecond
+			resp, err := client.Predict(context.Background(), "今天天气真好", 0.08)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Predict() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && resp.Label != "开心" {
+				t.Errorf("Label = %q, want 开心", resp.Label)
+			}
+			var statusErr *StatusError
+			if tt.wantErr && !errors.As(err, &statusErr) {
+				t.Errorf("error = %v, want *StatusError", err)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPredictRetryCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.BaseDelay = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := client.Predict(ctx, "今天天气真好", 0.08); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Predict() error = %v, want DeadlineExceeded", err)
+	}
+	// 退避等待遵循ctx，不会等满BaseDelay
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Predict() returned after %v", elapsed)
+	}
+}
@@ -0,0 +1,69 @@
+// Package httptransport 为LLM、VITS和情绪预测客户端创建共用设置的出站HTTP Transport。
+// http.DefaultTransport每个host只保留2个空闲连接，并发合成语音时多出的连接用完即关，
+// 会留下大量TIME_WAIT连接，因此这里默认放宽空闲连接数
+package httptransport
+
+import (
+	"net/http"
+	"time"
+
+	"LingChat/internal/tracing"
+)
+
+// Config 连接池设置，字段为0时沿用http.DefaultTransport的值
+type Config struct {
+	// MaxIdleConns 所有host合计的最大空闲连接数
+	MaxIdleConns int
+	// MaxIdleConnsPerHost 每个host保留的最大空闲连接数，应不小于对同一服务的并发请求数
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost 每个host的最大连接数（含使用中的），0表示不限制
+	MaxConnsPerHost int
+	// IdleConnTimeout 空闲连接保留时长
+	IdleConnTimeout time.Duration
+	// Headers 附加到每个出站请求（含重试）的请求头，如网关要求的API key；
+	// 与客户端自身设置的同名请求头冲突时以此为准
+	Headers map[string]string
+}
+
+// DefaultConfig 各客户端默认使用的连接池设置
+var DefaultConfig = Config{
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 32,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// New 按cfg创建带链路追踪的Transport，每次调用返回独立的连接池
+func New(cfg Config) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	if len(cfg.Headers) == 0 {
+		return tracing.Transport(transport)
+	}
+	return tracing.Transport(&headerTransport{base: transport, headers: cfg.Headers})
+}
+
+// headerTransport 在发出请求前设置固定的请求头
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper不应修改传入的请求
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	return t.base.RoundTrip(req)
+}
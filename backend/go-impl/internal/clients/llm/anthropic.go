@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/sashabaranov/go-openai"
+
+	"LingChat/internal/clients/httptransport"
+)
+
+const (
+	defaultAnthropicBaseURL   = "https://api.anthropic.com"
+	defaultAnthropicMaxTokens = 1024
+	anthropicAPIVersion       = "2023-06-01"
+)
+
+// AnthropicClient 调用Anthropic的Messages接口
+type AnthropicClient struct {
+	resty.Client
+	BaseURL string
+	apiKey  string
+
+	SystemPrompt string
+	// MaxTokens Messages接口必填的最大输出token数，Options.MaxTokens设置时以其为准
+	MaxTokens int
+	// Options 默认生成参数，可用WithOptions按请求覆盖
+	Options Options
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float32           `json:"temperature,omitempty"`
+	TopP        *float32           `json:"top_p,omitempty"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func NewAnthropicClient(baseURL, apiKey string) *AnthropicClient {
+	if baseURL == "" {
+		baseURL = defaultAnthropicBaseURL
+	}
+	httpClient := resty.New()
+	httpClient.SetTimeout(time.Second * 120)
+	httpClient.SetTransport(httptransport.New(httptransport.DefaultConfig))
+	return &AnthropicClient{
+		Client:    *httpClient,
+		BaseURL:   baseURL,
+		apiKey:    apiKey,
+		MaxTokens: defaultAnthropicMaxTokens,
+	}
+}
+
+// SetTransportConfig 按cfg重建连接池，应在开始请求前调用
+func (a *AnthropicClient) SetTransportConfig(cfg httptransport.Config) {
+	a.SetTransport(httptransport.New(cfg))
+}
+
+// validateAnthropicOptions Anthropic的temperature范围是0~1，比Options.Validate的范围小
+func validateAnthropicOptions(opts Options) error {
+	if opts.Temperature != nil && *opts.Temperature > 1 {
+		return fmt.Errorf("anthropic temperature %v out of range [0, 1]", *opts.Temperature)
+	}
+	return nil
+}
+
+func (a *AnthropicClient) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (string, error) {
+	opts, err := resolveOptions(ctx, a.Options)
+	if err != nil {
+		return "", err
+	}
+	if err := validateAnthropicOptions(opts); err != nil {
+		return "", err
+	}
+	maxTokens := a.MaxTokens
+	if opts.MaxTokens > 0 {
+		maxTokens = opts.MaxTokens
+	}
+
+	// Anthropic的system提示词是单独的字段，不能出现在messages中
+	messages = applySystemPrompt(ctx, a.SystemPrompt, messages)
+	var system []string
+	reqMessages := make([]anthropicMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role == openai.ChatMessageRoleSystem {
+			system = append(system, msg.Content)
+			continue
+		}
+		reqMessages = append(reqMessages, anthropicMessage{Role: msg.Role, Content: msg.Content})
+	}
+
+	result := &anthropicResponse{}
+	resp, err := a.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("x-api-key", a.apiKey).
+		SetHeader("anthropic-version", anthropicAPIVersion).
+		SetBody(anthropicRequest{
+			Model:       model,
+			MaxTokens:   maxTokens,
+			Temperature: opts.Temperature,
+			TopP:        opts.TopP,
+			System:      strings.Join(system, "\n"),
+			Messages:    reqMessages,
+		}).
+		SetResult(result).
+		SetError(result).
+		ForceContentType("application/json").
+		Post(a.BaseURL + "/v1/messages")
+	if err != nil {
+		return "", errors.Join(errors.New("anthropic chat error"), err)
+	}
+	if !resp.IsSuccess() {
+		msg := ""
+		if result.Error != nil {
+			msg = result.Error.Message
+		}
+		return "", fmt.Errorf("anthropic returned error status: %d, error: %s", resp.StatusCode(), msg)
+	}
+
+	var text strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return text.String(), nil
+}
+
+// Ping 请求/v1/models确认服务可达且api key有效
+func (a *AnthropicClient) Ping(ctx context.Context) error {
+	resp, err := a.R().
+		SetContext(ctx).
+		SetHeader("x-api-key", a.apiKey).
+		SetHeader("anthropic-version", anthropicAPIVersion).
+		Get(a.BaseURL + "/v1/models")
+	if err != nil {
+		return errors.Join(errors.New("anthropic ping error"), err)
+	}
+	if !resp.IsSuccess() {
+		return fmt.Errorf("anthropic returned error status: %d", resp.StatusCode())
+	}
+	return nil
+}
@@ -5,66 +5,155 @@ import (
 	"errors"
 	"io"
 	"log"
+	"net/http"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
+
+	"LingChat/internal/clients/httptransport"
 )
 
 type LLMClient struct {
-	client  *openai.Client
-	apiKey  string
-	BaseURL string
+	client     *openai.Client
+	httpClient *http.Client
+	apiKey     string
+	BaseURL    string
+
+	// SystemPrompt 部署级的人设提示词，非空时作为system消息放在请求最前面，
+	// 会替换消息链中原有的system消息
+	SystemPrompt string
+	// Options 默认生成参数，可用WithOptions按请求覆盖
+	Options Options
+	// MaxToolRounds Chat中最多执行几轮工具调用，<=0时使用DefaultMaxToolRounds
+	MaxToolRounds int
+	// MaxAttempts 429、5xx和网络错误时的最大尝试次数（含首次请求），其余4xx不重试
+	MaxAttempts int
+	// BaseDelay 指数退避的基础间隔，服务端返回Retry-After时以其为准
+	BaseDelay time.Duration
+
+	tools toolRegistry
+}
+
+type systemPromptKey struct{}
+
+// WithSystemPrompt 为单次请求覆盖SystemPrompt，便于不重启地对比不同人设
+func WithSystemPrompt(ctx context.Context, prompt string) context.Context {
+	return context.WithValue(ctx, systemPromptKey{}, prompt)
+}
+
+// SystemPromptFrom 返回ctx中用WithSystemPrompt设置的提示词，未设置时为空
+func SystemPromptFrom(ctx context.Context) string {
+	prompt, _ := ctx.Value(systemPromptKey{}).(string)
+	return prompt
+}
+
+// applySystemPrompt 按 请求覆盖 > 客户端默认 的优先级设置system消息，都为空时原样返回
+func applySystemPrompt(ctx context.Context, prompt string, messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if override := SystemPromptFrom(ctx); override != "" {
+		prompt = override
+	}
+	if prompt == "" {
+		return messages
+	}
+
+	system := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: prompt,
+	}
+	if len(messages) > 0 && messages[0].Role == openai.ChatMessageRoleSystem {
+		return append([]openai.ChatCompletionMessage{system}, messages[1:]...)
+	}
+	return append([]openai.ChatCompletionMessage{system}, messages...)
 }
 
 func NewLLMClient(baseURL, apiKey string) *LLMClient {
 	clientConfig := openai.DefaultConfig(apiKey)
 	clientConfig.BaseURL = baseURL
+	httpClient := &http.Client{Transport: &retryAfterTransport{base: httptransport.New(httptransport.DefaultConfig)}}
+	clientConfig.HTTPClient = httpClient
 	return &LLMClient{
-		client:  openai.NewClientWithConfig(clientConfig),
-		apiKey:  apiKey,
-		BaseURL: baseURL,
+		client:     openai.NewClientWithConfig(clientConfig),
+		httpClient: httpClient,
+		apiKey:     apiKey,
+		BaseURL:    baseURL,
+
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultBaseDelay,
 	}
 }
 
+// SetTransportConfig 按cfg重建连接池，应在开始请求前调用
+func (l *LLMClient) SetTransportConfig(cfg httptransport.Config) {
+	l.httpClient.Transport = &retryAfterTransport{base: httptransport.New(cfg)}
+}
+
+// newRequest 按system提示词和生成参数构造请求
+func (l *LLMClient) newRequest(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (openai.ChatCompletionRequest, error) {
+	opts, err := resolveOptions(ctx, l.Options)
+	if err != nil {
+		return openai.ChatCompletionRequest{}, err
+	}
+	return openai.ChatCompletionRequest{
+		Model:       model,
+		Messages:    applySystemPrompt(ctx, l.SystemPrompt, messages),
+		Temperature: openAIFloat(opts.Temperature),
+		TopP:        openAIFloat(opts.TopP),
+		MaxTokens:   opts.MaxTokens,
+	}, nil
+}
+
+// Chat 请求一次回复，临时错误按MaxAttempts和BaseDelay重试。注册了工具时模型可以先调用工具，见RegisterTool和MaxToolRounds
 func (l *LLMClient) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (string, error) {
-	// 创建聊天完成请求
-	resp, err := l.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model:    model,
-			Messages: messages,
-		},
-	)
+	req, err := l.newRequest(ctx, messages, model)
+	if err != nil {
+		return "", err
+	}
+	req.Tools = l.tools.definitions()
 
+	// 创建聊天完成请求
+	content, err := l.chatWithTools(ctx, req)
 	if err != nil {
 		err = errors.Join(errors.New("ChatCompletion error"), err)
 		log.Println(err)
 		return "", err
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	return content, nil
 }
 
-func (l *LLMClient) ChatStream(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (<-chan string, error) {
-	// 创建流式聊天请求
-	stream, err := l.client.CreateChatCompletionStream(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model:    model,
-			Messages: messages,
-		},
-	)
+// ChatStream 流式请求回复，不向模型提供已注册的工具。
+// 开始接收内容后出错时最后发送一个带Err的StreamChunk再关闭通道；ctx结束时直接关闭通道
+func (l *LLMClient) ChatStream(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (<-chan StreamChunk, error) {
+	req, err := l.newRequest(ctx, messages, model)
+	if err != nil {
+		return nil, err
+	}
+	// 创建流式聊天请求，开始接收内容前的失败可以重试
+	stream, err := withRetry(ctx, l, func(ctx context.Context) (*openai.ChatCompletionStream, error) {
+		return l.client.CreateChatCompletionStream(ctx, req)
+	})
 	if err != nil {
 		return nil, errors.Join(errors.New("ChatCompletionStream error"), err)
 	}
 
 	// 创建通道用于返回流式结果
-	ch := make(chan string)
+	ch := make(chan StreamChunk)
 
 	// 启动goroutine处理流式响应
+	// ctx取消时请求随之中断，Recv返回错误后关闭上游body并关闭通道；
+	// 发送时同样监听ctx，避免调用方不再读取时goroutine阻塞泄漏
 	go func() {
 		defer close(ch)
 		defer stream.Close()
 
+		send := func(chunk StreamChunk) bool {
+			select {
+			case ch <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
 		for {
 			response, err := stream.Recv()
 			if errors.Is(err, io.EOF) {
@@ -72,14 +161,33 @@ func (l *LLMClient) ChatStream(ctx context.Context, messages []openai.ChatComple
 			}
 
 			if err != nil {
-				log.Printf("Stream error: %v\n", err)
+				if ctx.Err() == nil {
+					send(StreamChunk{Err: errors.Join(errors.New("ChatCompletionStream recv error"), err)})
+				}
 				return
 			}
 
+			if len(response.Choices) == 0 {
+				continue
+			}
 			content := response.Choices[0].Delta.Content
-			ch <- content
+			if content == "" {
+				continue
+			}
+
+			if !send(StreamChunk{Content: content}) {
+				return
+			}
 		}
 	}()
 
 	return ch, nil
 }
+
+// Ping 请求模型列表确认服务可达且api key有效
+func (l *LLMClient) Ping(ctx context.Context) error {
+	if _, err := l.client.ListModels(ctx); err != nil {
+		return errors.Join(errors.New("ListModels error"), err)
+	}
+	return nil
+}
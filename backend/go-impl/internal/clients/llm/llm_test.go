@@ -3,16 +3,24 @@ package llm
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/sashabaranov/go-openai"
 )
 
+var helloMessages = []openai.ChatCompletionMessage{
+	{Role: openai.ChatMessageRoleUser, Content: "你好"},
+}
+
 func TestLLMClient_Chat(t *testing.T) {
 	client := NewLLMClient("", "")
 	ctx := context.Background()
 
 	// 测试基本聊天功能
-	response, err := client.Chat(ctx, "你好", "deepseek-chat")
+	response, err := client.Chat(ctx, helloMessages, "deepseek-chat")
 	if err != nil {
 		t.Fatalf("Chat failed: %v", err)
 	}
@@ -29,7 +37,7 @@ func TestLLMClient_ChatStream(t *testing.T) {
 	ctx := context.Background()
 
 	// 测试流式聊天功能
-	ch, err := client.ChatStream(ctx, "你好")
+	ch, err := client.ChatStream(ctx, helloMessages, "deepseek-chat")
 	if err != nil {
 		t.Fatalf("ChatStream failed: %v", err)
 	}
@@ -40,8 +48,11 @@ func TestLLMClient_ChatStream(t *testing.T) {
 	done := make(chan bool)
 
 	go func() {
-		for content := range ch {
-			fullResponse += content
+		for chunk := range ch {
+			if chunk.Err != nil {
+				t.Errorf("stream error: %v", chunk.Err)
+			}
+			fullResponse += chunk.Content
 		}
 		done <- true
 	}()
@@ -69,7 +80,7 @@ func TestLLMClient_ConcurrentAccess(t *testing.T) {
 
 	for i := 0; i < concurrency; i++ {
 		go func() {
-			_, err := client.Chat(ctx, "你好", "deepseek-chat")
+			_, err := client.Chat(ctx, helloMessages, "deepseek-chat")
 			if err != nil {
 				t.Errorf("Concurrent chat failed: %v", err)
 			}
@@ -82,3 +93,103 @@ func TestLLMClient_ConcurrentAccess(t *testing.T) {
 		<-done
 	}
 }
+
+func TestLLMClient_ChatStreamCancel(t *testing.T) {
+	// 模拟一个发送一段内容后就挂起的SSE服务
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"你好\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewLLMClient(server.URL, "test")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch, err := client.ChatStream(ctx, helloMessages, "deepseek-chat")
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+
+	if chunk := <-ch; chunk.Content != "你好" {
+		t.Fatalf("unexpected first chunk: %+v", chunk)
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("expected channel to be closed after cancel")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("channel not closed after context cancel")
+	}
+}
+
+func TestLLMClient_ChatStreamError(t *testing.T) {
+	// 发送一段内容后返回无法解析的事件
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"你好\"}}]}\n\n")
+		fmt.Fprint(w, "data: {broken\n\n")
+	}))
+	defer server.Close()
+
+	client := NewLLMClient(server.URL, "test")
+	ch, err := client.ChatStream(context.Background(), helloMessages, "deepseek-chat")
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	var chunks []StreamChunk
+	for chunk := range ch {
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) != 2 || chunks[0].Content != "你好" || chunks[1].Err == nil {
+		t.Errorf("chunks = %+v, want 你好 then an error", chunks)
+	}
+}
+
+func Test_applySystemPrompt(t *testing.T) {
+	history := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "old"},
+		{Role: openai.ChatMessageRoleUser, Content: "你好"},
+	}
+
+	tests := []struct {
+		name       string
+		client     string
+		override   string
+		messages   []openai.ChatCompletionMessage
+		wantSystem string
+		wantLen    int
+	}{
+		{name: "都未设置时保持原样", messages: history, wantSystem: "old", wantLen: 2},
+		{name: "替换已有system消息", client: "persona", messages: history, wantSystem: "persona", wantLen: 2},
+		{name: "无system消息时前置", client: "persona", messages: helloMessages, wantSystem: "persona", wantLen: 2},
+		{name: "请求级覆盖优先", client: "persona", override: "ab-test", messages: history, wantSystem: "ab-test", wantLen: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.override != "" {
+				ctx = WithSystemPrompt(ctx, tt.override)
+			}
+
+			got := applySystemPrompt(ctx, tt.client, tt.messages)
+			if len(got) != tt.wantLen {
+				t.Fatalf("len = %d, want %d", len(got), tt.wantLen)
+			}
+			if got[0].Role != openai.ChatMessageRoleSystem || got[0].Content != tt.wantSystem {
+				t.Errorf("system = %+v, want %q", got[0], tt.wantSystem)
+			}
+		})
+	}
+}
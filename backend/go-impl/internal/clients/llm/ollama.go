@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/sashabaranov/go-openai"
+
+	"LingChat/internal/clients/httptransport"
+)
+
+// OllamaClient 调用Ollama的/api/chat接口
+type OllamaClient struct {
+	resty.Client
+	BaseURL string
+
+	SystemPrompt string
+	// Options 默认生成参数，可用WithOptions按请求覆盖
+	Options Options
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaOptions struct {
+	Temperature *float32 `json:"temperature,omitempty"`
+	TopP        *float32 `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Message ollamaMessage `json:"message"`
+	Error   string        `json:"error,omitempty"`
+}
+
+func NewOllamaClient(baseURL string) *OllamaClient {
+	httpClient := resty.New()
+	httpClient.SetTimeout(time.Second * 120)
+	httpClient.SetTransport(httptransport.New(httptransport.DefaultConfig))
+	return &OllamaClient{
+		Client:  *httpClient,
+		BaseURL: baseURL,
+	}
+}
+
+// SetTransportConfig 按cfg重建连接池，应在开始请求前调用
+func (o *OllamaClient) SetTransportConfig(cfg httptransport.Config) {
+	o.SetTransport(httptransport.New(cfg))
+}
+
+func (o *OllamaClient) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (string, error) {
+	opts, err := resolveOptions(ctx, o.Options)
+	if err != nil {
+		return "", err
+	}
+	var reqOptions *ollamaOptions
+	if opts != (Options{}) {
+		reqOptions = &ollamaOptions{Temperature: opts.Temperature, TopP: opts.TopP, NumPredict: opts.MaxTokens}
+	}
+	messages = applySystemPrompt(ctx, o.SystemPrompt, messages)
+	reqMessages := make([]ollamaMessage, 0, len(messages))
+	for _, msg := range messages {
+		reqMessages = append(reqMessages, ollamaMessage{Role: msg.Role, Content: msg.Content})
+	}
+
+	result := &ollamaChatResponse{}
+	resp, err := o.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(ollamaChatRequest{
+			Model:    model,
+			Messages: reqMessages,
+			Stream:   false,
+			Options:  reqOptions,
+		}).
+		SetResult(result).
+		SetError(result).
+		ForceContentType("application/json").
+		Post(o.BaseURL + "/api/chat")
+	if err != nil {
+		return "", errors.Join(errors.New("ollama chat error"), err)
+	}
+	if !resp.IsSuccess() {
+		return "", fmt.Errorf("ollama returned error status: %d, error: %s", resp.StatusCode(), result.Error)
+	}
+
+	return result.Message.Content, nil
+}
+
+// Ping 请求/api/tags确认Ollama服务可达
+func (o *OllamaClient) Ping(ctx context.Context) error {
+	resp, err := o.R().SetContext(ctx).Get(o.BaseURL + "/api/tags")
+	if err != nil {
+		return errors.Join(errors.New("ollama ping error"), err)
+	}
+	if !resp.IsSuccess() {
+		return fmt.Errorf("ollama returned error status: %d", resp.StatusCode())
+	}
+	return nil
+}
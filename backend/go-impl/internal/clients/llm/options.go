@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Options 生成参数。字段为零值（nil或0）时不设置，沿用客户端默认值，客户端也未设置时由服务端决定。
+// 各字段对应的请求参数：
+//
+//	Temperature  OpenAI/Anthropic的temperature，Ollama的options.temperature
+//	TopP         OpenAI/Anthropic的top_p，Ollama的options.top_p
+//	MaxTokens    OpenAI/Anthropic的max_tokens，Ollama的options.num_predict
+type Options struct {
+	// Temperature 采样温度，0~2，越低回复越稳定；Anthropic只接受0~1
+	Temperature *float32
+	// TopP 核采样概率，0~1
+	TopP *float32
+	// MaxTokens 最大输出token数，0表示不限制（Anthropic使用客户端的MaxTokens）
+	MaxTokens int
+}
+
+// Float32 返回v的指针，便于设置Options中可以为0的字段
+func Float32(v float32) *float32 {
+	return &v
+}
+
+// Validate 检查参数范围
+func (o Options) Validate() error {
+	if o.Temperature != nil && (*o.Temperature < 0 || *o.Temperature > 2) {
+		return fmt.Errorf("temperature %v out of range [0, 2]", *o.Temperature)
+	}
+	if o.TopP != nil && (*o.TopP < 0 || *o.TopP > 1) {
+		return fmt.Errorf("top_p %v out of range [0, 1]", *o.TopP)
+	}
+	if o.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens %d must not be negative", o.MaxTokens)
+	}
+	return nil
+}
+
+// merge 用override中设置了的字段覆盖o
+func (o Options) merge(override Options) Options {
+	if override.Temperature != nil {
+		o.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		o.TopP = override.TopP
+	}
+	if override.MaxTokens != 0 {
+		o.MaxTokens = override.MaxTokens
+	}
+	return o
+}
+
+type optionsKey struct{}
+
+// WithOptions 为单次请求覆盖客户端默认的生成参数，只覆盖opts中设置了的字段
+func WithOptions(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, opts)
+}
+
+// resolveOptions 按 请求覆盖 > 客户端默认 的优先级合并生成参数并校验
+func resolveOptions(ctx context.Context, defaults Options) (Options, error) {
+	opts := defaults
+	if override, ok := ctx.Value(optionsKey{}).(Options); ok {
+		opts = opts.merge(override)
+	}
+	if err := opts.Validate(); err != nil {
+		return Options{}, err
+	}
+	return opts, nil
+}
+
+// openAIFloat go-openai的temperature/top_p带omitempty，显式设置的0需换成最小正数才会发送
+func openAIFloat(v *float32) float32 {
+	switch {
+	case v == nil:
+		return 0
+	case *v == 0:
+		return math.SmallestNonzeroFloat32
+	default:
+		return *v
+	}
+}
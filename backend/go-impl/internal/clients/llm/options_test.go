@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveOptions(t *testing.T) {
+	defaults := Options{Temperature: Float32(0.7), MaxTokens: 512}
+	tests := []struct {
+		name     string
+		override *Options
+		want     Options
+		wantErr  bool
+	}{
+		{name: "使用客户端默认值", want: defaults},
+		{
+			name:     "按请求覆盖",
+			override: &Options{Temperature: Float32(0), TopP: Float32(0.9)},
+			want:     Options{Temperature: Float32(0), TopP: Float32(0.9), MaxTokens: 512},
+		},
+		{name: "温度超出范围", override: &Options{Temperature: Float32(2.1)}, wantErr: true},
+		{name: "top_p超出范围", override: &Options{TopP: Float32(1.1)}, wantErr: true},
+		{name: "max_tokens为负数", override: &Options{MaxTokens: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.override != nil {
+				ctx = WithOptions(ctx, *tt.override)
+			}
+			got, err := resolveOptions(ctx, defaults)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !equalFloat(got.Temperature, tt.want.Temperature) || !equalFloat(got.TopP, tt.want.TopP) || got.MaxTokens != tt.want.MaxTokens {
+				t.Errorf("resolveOptions() = %s, want %s", formatOptions(got), formatOptions(tt.want))
+			}
+		})
+	}
+}
+
+func equalFloat(a, b *float32) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func formatOptions(o Options) string {
+	raw, _ := json.Marshal(o)
+	return string(raw)
+}
+
+func TestLLMClient_ChatOptions(t *testing.T) {
+	var req map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"你好"}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewLLMClient(server.URL, "test")
+	client.Options = Options{Temperature: Float32(0.7), MaxTokens: 256}
+	ctx := WithOptions(context.Background(), Options{Temperature: Float32(0)})
+	if _, err := client.Chat(ctx, helloMessages, "deepseek-chat"); err != nil {
+		t.Fatal(err)
+	}
+	// 显式设置的温度0也要发送
+	if temperature, ok := req["temperature"].(float64); !ok || temperature > 1e-6 {
+		t.Errorf("temperature = %v, want 0", req["temperature"])
+	}
+	if req["max_tokens"] != float64(256) {
+		t.Errorf("max_tokens = %v, want 256", req["max_tokens"])
+	}
+	if _, ok := req["top_p"]; ok {
+		t.Errorf("top_p = %v, want unset", req["top_p"])
+	}
+}
+
+func TestOllamaClient_ChatOptions(t *testing.T) {
+	var req ollamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(ollamaChatResponse{Message: ollamaMessage{Role: "assistant", Content: "你好"}})
+	}))
+	defer server.Close()
+
+	client := NewOllamaClient(server.URL)
+	client.Options = Options{TopP: Float32(0.9), MaxTokens: 128}
+	if _, err := client.Chat(context.Background(), helloMessages, "qwen2"); err != nil {
+		t.Fatal(err)
+	}
+	if req.Options == nil || req.Options.Temperature != nil || !equalFloat(req.Options.TopP, Float32(0.9)) || req.Options.NumPredict != 128 {
+		t.Errorf("options = %+v", req.Options)
+	}
+
+	if _, err := client.Chat(WithOptions(context.Background(), Options{TopP: Float32(2)}), helloMessages, "qwen2"); err == nil {
+		t.Error("Chat() with invalid top_p succeeded, want error")
+	}
+}
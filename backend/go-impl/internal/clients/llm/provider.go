@@ -0,0 +1,103 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"LingChat/internal/clients/httptransport"
+)
+
+// 支持的LLM服务提供方
+const (
+	ProviderOpenAI    = "openai"
+	ProviderOllama    = "ollama"
+	ProviderAnthropic = "anthropic"
+)
+
+// LLMProvider 统一不同LLM后端的聊天接口，消息格式沿用OpenAI的定义
+type LLMProvider interface {
+	Chat(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (string, error)
+}
+
+// Pinger 可选接口，用于健康检查时探测LLM服务是否可达
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// StreamChunk 流式回复的一个片段，Err不为nil时生成中途出错，这是通道中的最后一项
+type StreamChunk struct {
+	Content string
+	Err     error
+}
+
+// Streamer 可选接口，边生成边返回回复的片段，通道正常关闭时依次拼接即完整的回复。
+// 生成中途出错时最后一项带Err；ctx结束时直接关闭通道，此时回复不完整，调用方应以ctx.Err()判断
+type Streamer interface {
+	ChatStream(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (<-chan StreamChunk, error)
+}
+
+// TransportConfigurer 可选接口，用于调整出站HTTP连接池
+type TransportConfigurer interface {
+	SetTransportConfig(cfg httptransport.Config)
+}
+
+var (
+	_ LLMProvider = (*LLMClient)(nil)
+	_ LLMProvider = (*OllamaClient)(nil)
+	_ LLMProvider = (*AnthropicClient)(nil)
+
+	_ Pinger = (*LLMClient)(nil)
+	_ Pinger = (*OllamaClient)(nil)
+	_ Pinger = (*AnthropicClient)(nil)
+
+	_ Streamer = (*LLMClient)(nil)
+
+	_ TransportConfigurer = (*LLMClient)(nil)
+	_ TransportConfigurer = (*OllamaClient)(nil)
+	_ TransportConfigurer = (*AnthropicClient)(nil)
+)
+
+// NewLLMProvider 根据provider选择实现并校验必填项和生成参数，provider为空时使用OpenAI兼容接口
+func NewLLMProvider(provider, baseURL, apiKey, systemPrompt string, opts Options) (LLMProvider, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(provider) {
+	case "", ProviderOpenAI:
+		if baseURL == "" {
+			return nil, errors.New("openai provider requires base url")
+		}
+		if apiKey == "" {
+			return nil, errors.New("openai provider requires api key")
+		}
+		client := NewLLMClient(baseURL, apiKey)
+		client.SystemPrompt = systemPrompt
+		client.Options = opts
+		return client, nil
+	case ProviderOllama:
+		if baseURL == "" {
+			return nil, errors.New("ollama provider requires base url")
+		}
+		client := NewOllamaClient(baseURL)
+		client.SystemPrompt = systemPrompt
+		client.Options = opts
+		return client, nil
+	case ProviderAnthropic:
+		if apiKey == "" {
+			return nil, errors.New("anthropic provider requires api key")
+		}
+		if err := validateAnthropicOptions(opts); err != nil {
+			return nil, err
+		}
+		client := NewAnthropicClient(baseURL, apiKey)
+		client.SystemPrompt = systemPrompt
+		client.Options = opts
+		return client, nil
+	default:
+		return nil, fmt.Errorf("unsupported llm provider: %s", provider)
+	}
+}
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestNewLLMProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		baseURL  string
+		apiKey   string
+		opts     Options
+		wantErr  bool
+	}{
+		{name: "默认openai", provider: "", baseURL: "https://api.deepseek.com", apiKey: "sk", wantErr: false},
+		{name: "openai缺少key", provider: "openai", baseURL: "https://api.deepseek.com", wantErr: true},
+		{name: "openai缺少url", provider: "openai", apiKey: "sk", wantErr: true},
+		{name: "ollama", provider: "ollama", baseURL: "http://localhost:11434", wantErr: false},
+		{name: "ollama缺少url", provider: "ollama", wantErr: true},
+		{name: "anthropic默认url", provider: "anthropic", apiKey: "sk", wantErr: false},
+		{name: "anthropic缺少key", provider: "anthropic", wantErr: true},
+		{name: "未知provider", provider: "unknown", baseURL: "x", apiKey: "y", wantErr: true},
+		{name: "温度超出范围", provider: "ollama", baseURL: "http://localhost:11434", opts: Options{Temperature: Float32(2.5)}, wantErr: true},
+		{name: "anthropic温度超过1", provider: "anthropic", apiKey: "sk", opts: Options{Temperature: Float32(1.5)}, wantErr: true},
+		{name: "openai温度1.5", provider: "openai", baseURL: "https://api.deepseek.com", apiKey: "sk", opts: Options{Temperature: Float32(1.5)}, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLLMProvider(tt.provider, tt.baseURL, tt.apiKey, "", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLLMProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOllamaClient_Chat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if r.URL.Path != "/api/chat" || req.Stream || len(req.Messages) != 2 || req.Messages[0].Role != "system" {
+			t.Errorf("unexpected request: %s %+v", r.URL.Path, req)
+		}
+		json.NewEncoder(w).Encode(ollamaChatResponse{Message: ollamaMessage{Role: "assistant", Content: "【高兴】你好"}})
+	}))
+	defer server.Close()
+
+	client := NewOllamaClient(server.URL)
+	client.SystemPrompt = "persona"
+	got, err := client.Chat(context.Background(), helloMessages, "qwen2")
+	if err != nil || got != "【高兴】你好" {
+		t.Fatalf("Chat() = %q, %v", got, err)
+	}
+}
+
+func TestAnthropicClient_Chat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if r.Header.Get("x-api-key") != "sk" || req.System != "persona" || len(req.Messages) != 1 {
+			t.Errorf("unexpected request: %+v", req)
+		}
+		w.Write([]byte(`{"content":[{"type":"text","text":"【高兴】"},{"type":"text","text":"你好"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient(server.URL, "sk")
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "persona"},
+		{Role: openai.ChatMessageRoleUser, Content: "你好"},
+	}
+	got, err := client.Chat(context.Background(), messages, "claude")
+	if err != nil || got != "【高兴】你好" {
+		t.Fatalf("Chat() = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,198 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"LingChat/internal/clients/retrybudget"
+)
+
+const (
+	// DefaultMaxAttempts LLMClient请求遇到临时错误时的默认最大尝试次数（含首次请求）
+	DefaultMaxAttempts = 3
+	// DefaultBaseDelay 重试退避的基础间隔，第n次重试在 [0, BaseDelay * 2^(n-1)) 内随机等待
+	DefaultBaseDelay = 500 * time.Millisecond
+	// MaxRetryDelay 单次重试的最长等待，服务端Retry-After更长时也按此截断
+	MaxRetryDelay = 30 * time.Second
+)
+
+// RetryError 多次尝试仍失败，Errs按顺序记录每次尝试的错误
+type RetryError struct {
+	Errs []error
+}
+
+func (e *RetryError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = fmt.Sprintf("attempt %d: %v", i+1, err)
+	}
+	return fmt.Sprintf("failed after %d attempts: %s", len(e.Errs), strings.Join(msgs, "; "))
+}
+
+func (e *RetryError) Unwrap() []error {
+	return e.Errs
+}
+
+// statusCode 返回go-openai错误中的HTTP状态码，不是HTTP错误时返回0
+func statusCode(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
+
+// isRetryable 429、5xx和网络层错误（连接重置等）视为临时错误，其余4xx和ctx取消不重试
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if code := statusCode(err); code != 0 {
+		return code == http.StatusTooManyRequests || code >= 500
+	}
+	return true
+}
+
+// retryHint 记录最近一次响应的Retry-After，由retryAfterTransport写入
+type retryHint struct {
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+func (h *retryHint) set(d time.Duration) {
+	h.mu.Lock()
+	h.delay = d
+	h.mu.Unlock()
+}
+
+// take 返回并清空记录的等待时间
+func (h *retryHint) take() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d := h.delay
+	h.delay = 0
+	return d
+}
+
+type retryHintKey struct{}
+
+// retryAfterTransport go-openai的错误不带响应头，由transport把Retry-After记到请求ctx中的retryHint
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if hint, ok := req.Context().Value(retryHintKey{}).(*retryHint); ok {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			hint.set(d)
+		}
+	}
+	return resp, nil
+}
+
+// parseRetryAfter 解析秒数或HTTP日期两种格式的Retry-After
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// backoff 第retry次重试（从1开始）的等待时间：服务端给了Retry-After时照办，
+// 否则在指数增长的区间内随机取值（full jitter），避免多个请求同时重试
+func (l *LLMClient) backoff(retry int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, MaxRetryDelay)
+	}
+	base := l.BaseDelay
+	if base <= 0 {
+		base = DefaultBaseDelay
+	}
+	ceiling := min(base<<(retry-1), MaxRetryDelay)
+	if ceiling <= 0 {
+		ceiling = MaxRetryDelay
+	}
+	return rand.N(ceiling) + 1
+}
+
+// maxAttempts MaxAttempts未设置时使用DefaultMaxAttempts
+func (l *LLMClient) maxAttempts() int {
+	if l.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return l.MaxAttempts
+}
+
+// withRetry 执行do，遇到临时错误时按退避重试。等待会超过ctx的截止时间或ctx中的重试预算（见retrybudget）用尽时不再重试，
+// 多次尝试都失败时返回*RetryError，只尝试了一次时原样返回错误
+func withRetry[T any](ctx context.Context, l *LLMClient, do func(ctx context.Context) (T, error)) (T, error) {
+	hint := &retryHint{}
+	ctx = context.WithValue(ctx, retryHintKey{}, hint)
+
+	var errs []error
+	for attempt := 1; ; attempt++ {
+		result, err := do(ctx)
+		if err == nil {
+			return result, nil
+		}
+		errs = append(errs, err)
+
+		retryAfter := hint.take()
+		if attempt >= l.maxAttempts() || !isRetryable(err) {
+			return result, retryResult(errs)
+		}
+		delay := l.backoff(attempt, retryAfter)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return result, retryResult(errs)
+		}
+		if !retrybudget.Allow(ctx, delay) {
+			errs[len(errs)-1] = errors.Join(err, retrybudget.ErrExhausted)
+			return result, retryResult(errs)
+		}
+
+		log.Printf("llm request failed, retrying in %v: %v", delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			errs[len(errs)-1] = errors.Join(err, ctx.Err())
+			return result, retryResult(errs)
+		}
+	}
+}
+
+func retryResult(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return &RetryError{Errs: errs}
+}
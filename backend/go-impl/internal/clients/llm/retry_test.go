@@ -0,0 +1,261 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"LingChat/internal/clients/httptransport"
+	"LingChat/internal/clients/retrybudget"
+)
+
+const okCompletion = `{"choices":[{"message":{"role":"assistant","content":"你好"}}]}`
+
+// statusSequence 依次返回statuses中的状态码，用完后返回200
+func statusSequence(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		w.Header().Set("Content-Type", "application/json")
+		if n <= len(statuses) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(statuses[n-1])
+			w.Write([]byte(`{"error":{"message":"busy","type":"server_error"}}`))
+			return
+		}
+		w.Write([]byte(okCompletion))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestLLMClient_ChatRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantCalls int32
+		wantErr   bool
+	}{
+		{name: "限流后重试成功", statuses: []int{http.StatusTooManyRequests}, wantCalls: 2},
+		{name: "5xx后重试成功", statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable}, wantCalls: 3},
+		{name: "超过最大尝试次数", statuses: []int{500, 500, 500}, wantCalls: 3, wantErr: true},
+		{name: "4xx不重试", statuses: []int{http.StatusBadRequest}, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := statusSequence(t, "", tt.statuses...)
+			client := NewLLMClient(server.URL, "test")
+			client.BaseDelay = time.Millisecond
+
+			reply, err := client.Chat(context.Background(), helloMessages, "deepseek-chat")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Chat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && reply != "你好" {
+				t.Errorf("Chat() = %q, want 你好", reply)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestLLMClient_ChatRetryError(t *testing.T) {
+	server, _ := statusSequence(t, "", 500, 502, 503)
+	client := NewLLMClient(server.URL, "test")
+	client.BaseDelay = time.Millisecond
+
+	_, err := client.Chat(context.Background(), helloMessages, "deepseek-chat")
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("error = %v, want *RetryError", err)
+	}
+	// 每次尝试的错误都要保留，便于排查
+	var codes []int
+	for _, attemptErr := range retryErr.Errs {
+		codes = append(codes, statusCode(attemptErr))
+	}
+	if len(codes) != 3 || codes[0] != 500 || codes[1] != 502 || codes[2] != 503 {
+		t.Errorf("attempt status codes = %v, want [500 502 503]", codes)
+	}
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		t.Errorf("error = %v, want to wrap *openai.APIError", err)
+	}
+}
+
+func TestLLMClient_ChatRetryAfter(t *testing.T) {
+	server, calls := statusSequence(t, "1", http.StatusTooManyRequests)
+	client := NewLLMClient(server.URL, "test")
+	client.BaseDelay = time.Millisecond
+
+	start := time.Now()
+	if _, err := client.Chat(context.Background(), helloMessages, "deepseek-chat"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want to honor Retry-After of 1s", elapsed)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func TestLLMClient_ChatRetryDeadline(t *testing.T) {
+	// Retry-After超出ctx截止时间时直接返回，不白白等待
+	server, calls := statusSequence(t, "10", http.StatusTooManyRequests)
+	client := NewLLMClient(server.URL, "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.Chat(ctx, helloMessages, "deepseek-chat"); err == nil {
+		t.Fatal("Chat() error = nil, want error")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("returned after %v, want immediately", elapsed)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("calls = %d, want 1", got)
+	}
+}
+
+func TestLLMClient_ChatRetryBudget(t *testing.T) {
+	server, calls := statusSequence(t, "", 500, 500, 500, 500, 500, 500)
+	client := NewLLMClient(server.URL, "test")
+	client.BaseDelay = time.Millisecond
+	ctx := retrybudget.WithBudget(context.Background(), retrybudget.New(1, 0))
+
+	// 第一次调用用掉唯一的一次重试，之后同一请求中的调用不再重试
+	if _, err := client.Chat(ctx, helloMessages, "deepseek-chat"); !errors.Is(err, retrybudget.ErrExhausted) {
+		t.Fatalf("Chat() error = %v, want ErrExhausted", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+	if _, err := client.Chat(ctx, helloMessages, "deepseek-chat"); err == nil {
+		t.Fatal("Chat() error = nil, want error")
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("calls = %d, want 3", got)
+	}
+}
+
+func TestLLMClient_ChatStreamRetry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"你好\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewLLMClient(server.URL, "test")
+	client.BaseDelay = time.Millisecond
+	ch, err := client.ChatStream(context.Background(), helloMessages, "deepseek-chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply string
+	for chunk := range ch {
+		if chunk.Err != nil {
+			t.Fatal(chunk.Err)
+		}
+		reply += chunk.Content
+	}
+	if reply != "你好" {
+		t.Errorf("reply = %q, want 你好", reply)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func TestLLMClient_ChatRetryHeaders(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Gateway-Key"); got != "secret" {
+			t.Errorf("request %d X-Gateway-Key = %q, want secret", calls.Load()+1, got)
+		}
+		// 配置的请求头覆盖客户端自身的同名请求头
+		if got := r.Header.Get("Authorization"); got != "Bearer gateway" {
+			t.Errorf("Authorization = %q, want Bearer gateway", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"message":"busy","type":"server_error"}}`))
+			return
+		}
+		w.Write([]byte(okCompletion))
+	}))
+	defer server.Close()
+
+	client := NewLLMClient(server.URL, "test")
+	client.BaseDelay = time.Millisecond
+	client.SetTransportConfig(httptransport.Config{Headers: map[string]string{
+		"X-Gateway-Key": "secret",
+		"Authorization": "Bearer gateway",
+	}})
+
+	if _, err := client.Chat(context.Background(), helloMessages, "deepseek-chat"); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "秒数", value: "3", want: 3 * time.Second, wantOK: true},
+		{name: "HTTP日期", value: now.Add(5 * time.Second).Format(http.TimeFormat), want: 5 * time.Second, wantOK: true},
+		{name: "过去的日期", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, wantOK: true},
+		{name: "为空", value: "", wantOK: false},
+		{name: "负数", value: "-1", wantOK: false},
+		{name: "无法解析", value: "soon", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLLMClient_backoff(t *testing.T) {
+	client := NewLLMClient("http://localhost", "test")
+	client.BaseDelay = 100 * time.Millisecond
+	for retry := 1; retry <= 4; retry++ {
+		ceiling := client.BaseDelay << (retry - 1)
+		for range 50 {
+			if d := client.backoff(retry, 0); d <= 0 || d > ceiling {
+				t.Fatalf("backoff(%d) = %v, want (0, %v]", retry, d, ceiling)
+			}
+		}
+	}
+	if d := client.backoff(1, time.Hour); d != MaxRetryDelay {
+		t.Errorf("backoff with long Retry-After = %v, want %v", d, MaxRetryDelay)
+	}
+}
@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultMaxToolRounds 单次Chat中最多执行的工具调用轮数
+const DefaultMaxToolRounds = 4
+
+// ToolHandler 执行一次工具调用，arguments是模型给出的JSON参数，返回值作为工具结果发回模型
+type ToolHandler func(ctx context.Context, arguments string) (string, error)
+
+// toolNamePattern OpenAI要求的函数名格式
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+type registeredTool struct {
+	definition openai.Tool
+	handler    ToolHandler
+}
+
+// toolRegistry 已注册的工具，按注册顺序发给模型，并发安全
+type toolRegistry struct {
+	mu    sync.RWMutex
+	names []string
+	tools map[string]registeredTool
+}
+
+// RegisterTool 注册一个模型可以调用的工具。schema是参数的JSON Schema（type为object），
+// 其顶层的description作为工具说明发给模型。同名工具不能重复注册
+func (l *LLMClient) RegisterTool(name string, schema json.RawMessage, handler ToolHandler) error {
+	if !toolNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid tool name %q", name)
+	}
+	if handler == nil {
+		return fmt.Errorf("tool %s has no handler", name)
+	}
+	var header struct {
+		Type        string `json:"type"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(schema, &header); err != nil || header.Type != "object" {
+		return fmt.Errorf("tool %s schema must be a JSON object schema", name)
+	}
+
+	l.tools.mu.Lock()
+	defer l.tools.mu.Unlock()
+	if _, ok := l.tools.tools[name]; ok {
+		return fmt.Errorf("tool %s already registered", name)
+	}
+	if l.tools.tools == nil {
+		l.tools.tools = make(map[string]registeredTool)
+	}
+	l.tools.names = append(l.tools.names, name)
+	l.tools.tools[name] = registeredTool{
+		definition: openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        name,
+				Description: header.Description,
+				Parameters:  schema,
+			},
+		},
+		handler: handler,
+	}
+	return nil
+}
+
+// definitions 按注册顺序返回全部工具定义，没有工具时返回nil
+func (r *toolRegistry) definitions() []openai.Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.names) == 0 {
+		return nil
+	}
+	tools := make([]openai.Tool, 0, len(r.names))
+	for _, name := range r.names {
+		tools = append(tools, r.tools[name].definition)
+	}
+	return tools
+}
+
+// call 执行模型请求的工具调用。未知工具和执行失败也作为结果告诉模型，由模型决定如何回复
+func (r *toolRegistry) call(ctx context.Context, call openai.ToolCall) openai.ChatCompletionMessage {
+	r.mu.RLock()
+	tool, ok := r.tools[call.Function.Name]
+	r.mu.RUnlock()
+
+	var content string
+	if !ok {
+		content = fmt.Sprintf("error: unknown tool %q", call.Function.Name)
+	} else if result, err := tool.handler(ctx, call.Function.Arguments); err != nil {
+		log.Printf("tool %s failed: %v", call.Function.Name, err)
+		content = "error: " + err.Error()
+	} else {
+		content = result
+	}
+	return openai.ChatCompletionMessage{
+		Role:       openai.ChatMessageRoleTool,
+		Content:    content,
+		Name:       call.Function.Name,
+		ToolCallID: call.ID,
+	}
+}
+
+// maxToolRounds MaxToolRounds未设置时使用DefaultMaxToolRounds
+func (l *LLMClient) maxToolRounds() int {
+	if l.MaxToolRounds <= 0 {
+		return DefaultMaxToolRounds
+	}
+	return l.MaxToolRounds
+}
+
+// chatWithTools 发送请求，模型请求调用工具时执行对应的handler并把结果发回，直到模型给出回复。
+// 为防止模型反复调用工具陷入死循环，执行maxToolRounds轮后的请求设置tool_choice为none，要求模型直接回复
+func (l *LLMClient) chatWithTools(ctx context.Context, req openai.ChatCompletionRequest) (string, error) {
+	// 追加工具消息时不能写入调用方切片的底层数组
+	req.Messages = slices.Clip(req.Messages)
+	for round := 0; ; round++ {
+		if req.Tools != nil && round >= l.maxToolRounds() {
+			req.ToolChoice = "none"
+		}
+		resp, err := withRetry(ctx, l, func(ctx context.Context) (openai.ChatCompletionResponse, error) {
+			return l.client.CreateChatCompletion(ctx, req)
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", errors.New("empty choices in response")
+		}
+
+		msg := resp.Choices[0].Message
+		if len(msg.ToolCalls) == 0 || req.ToolChoice == "none" {
+			return msg.Content, nil
+		}
+
+		// 工具调用与结果都要放进后续请求的消息链中，模型才能把结果对应到调用上
+		req.Messages = append(req.Messages, msg)
+		for _, call := range msg.ToolCalls {
+			req.Messages = append(req.Messages, l.tools.call(ctx, call))
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const weatherSchema = `{"type":"object","description":"查询城市天气","properties":{"city":{"type":"string"}},"required":["city"]}`
+
+func TestLLMClient_RegisterTool(t *testing.T) {
+	handler := func(context.Context, string) (string, error) { return "", nil }
+	tests := []struct {
+		name     string
+		toolName string
+		schema   string
+		handler  ToolHandler
+		wantErr  bool
+	}{
+		{name: "正常注册", toolName: "get_weather", schema: weatherSchema, handler: handler},
+		{name: "重复注册", toolName: "get_weather", schema: weatherSchema, handler: handler, wantErr: true},
+		{name: "名称不合法", toolName: "查天气", schema: weatherSchema, handler: handler, wantErr: true},
+		{name: "schema不是object", toolName: "get_time", schema: `{"type":"string"}`, handler: handler, wantErr: true},
+		{name: "schema不是JSON", toolName: "get_time", schema: `not json`, handler: handler, wantErr: true},
+		{name: "没有handler", toolName: "get_time", schema: weatherSchema, wantErr: true},
+	}
+
+	client := NewLLMClient("http://localhost", "test")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := client.RegisterTool(tt.toolName, json.RawMessage(tt.schema), tt.handler)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RegisterTool() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if tools := client.tools.definitions(); len(tools) != 1 || tools[0].Function.Description != "查询城市天气" {
+		t.Errorf("definitions() = %+v", tools)
+	}
+}
+
+// toolServer 模拟OpenAI接口，依次返回replies中的消息并记录收到的请求
+type toolServer struct {
+	mu       sync.Mutex
+	requests []openai.ChatCompletionRequest
+	replies  func(n int) openai.ChatCompletionMessage
+}
+
+func (s *toolServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	n := len(s.requests)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: s.replies(n)}},
+	})
+}
+
+func toolCallMessage(id, name, arguments string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleAssistant,
+		ToolCalls: []openai.ToolCall{{
+			ID:       id,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: name, Arguments: arguments},
+		}},
+	}
+}
+
+func TestLLMClient_ChatWithTools(t *testing.T) {
+	srv := &toolServer{replies: func(n int) openai.ChatCompletionMessage {
+		if n == 1 {
+			return toolCallMessage("call_1", "get_weather", `{"city":"东京"}`)
+		}
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "【高兴】东京今天晴"}
+	}}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	client := NewLLMClient(server.URL, "test")
+	var gotArgs string
+	err := client.RegisterTool("get_weather", json.RawMessage(weatherSchema), func(ctx context.Context, arguments string) (string, error) {
+		gotArgs = arguments
+		return "晴", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "东京天气怎么样"}}
+	got, err := client.Chat(context.Background(), messages, "deepseek-chat")
+	if err != nil || got != "【高兴】东京今天晴" {
+		t.Fatalf("Chat() = %q, %v", got, err)
+	}
+	if gotArgs != `{"city":"东京"}` {
+		t.Errorf("tool arguments = %q", gotArgs)
+	}
+	if len(srv.requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(srv.requests))
+	}
+	if len(srv.requests[0].Tools) != 1 || srv.requests[0].Tools[0].Function.Name != "get_weather" {
+		t.Errorf("first request tools = %+v", srv.requests[0].Tools)
+	}
+	followUp := srv.requests[1].Messages
+	if len(followUp) != 3 || len(followUp[1].ToolCalls) != 1 {
+		t.Fatalf("follow-up messages = %+v", followUp)
+	}
+	if result := followUp[2]; result.Role != openai.ChatMessageRoleTool || result.ToolCallID != "call_1" || result.Content != "晴" {
+		t.Errorf("tool result message = %+v", result)
+	}
+	if len(messages) != 1 {
+		t.Errorf("caller messages modified: %+v", messages)
+	}
+}
+
+func TestLLMClient_ChatToolRoundsLimit(t *testing.T) {
+	// 模型一直请求调用工具，执行MaxToolRounds轮后要求它直接回复
+	srv := &toolServer{replies: func(n int) openai.ChatCompletionMessage {
+		msg := toolCallMessage(fmt.Sprintf("call_%d", n), "get_weather", `{}`)
+		msg.Content = "算了，直接回答"
+		return msg
+	}}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	client := NewLLMClient(server.URL, "test")
+	client.MaxToolRounds = 2
+	var calls int
+	client.RegisterTool("get_weather", json.RawMessage(weatherSchema), func(context.Context, string) (string, error) {
+		calls++
+		return "", errors.New("service unavailable")
+	})
+
+	got, err := client.Chat(context.Background(), helloMessages, "deepseek-chat")
+	if err != nil || got != "算了，直接回答" {
+		t.Fatalf("Chat() = %q, %v", got, err)
+	}
+	if calls != 2 || len(srv.requests) != 3 {
+		t.Errorf("tool calls = %d, requests = %d, want 2 and 3", calls, len(srv.requests))
+	}
+	if choice := srv.requests[2].ToolChoice; choice != "none" {
+		t.Errorf("last request tool_choice = %v, want none", choice)
+	}
+	if result := srv.requests[1].Messages[len(srv.requests[1].Messages)-1]; result.Content != "error: service unavailable" {
+		t.Errorf("failed tool result = %q", result.Content)
+	}
+}
@@ -0,0 +1,132 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"LingChat/internal/clients/httptransport"
+)
+
+// Moderator 内容审核。CheckInput在调用LLM前检查用户消息，CheckOutput在返回前检查LLM的回复。
+// 内容违规时返回*Violation，其他错误表示审核本身失败
+type Moderator interface {
+	CheckInput(ctx context.Context, text string) error
+	CheckOutput(ctx context.Context, text string) error
+}
+
+var (
+	_ Moderator = Noop{}
+	_ Moderator = (*Client)(nil)
+)
+
+// Violation 内容未通过审核，Categories为命中的类别
+type Violation struct {
+	Categories []string
+}
+
+func (v *Violation) Error() string {
+	if len(v.Categories) == 0 {
+		return "content flagged by moderation"
+	}
+	return "content flagged by moderation: " + strings.Join(v.Categories, ", ")
+}
+
+// IsViolation err是否为内容违规，而不是审核服务出错
+func IsViolation(err error) bool {
+	var violation *Violation
+	return errors.As(err, &violation)
+}
+
+// Noop 不做审核，所有内容都通过
+type Noop struct{}
+
+func (Noop) CheckInput(context.Context, string) error  { return nil }
+func (Noop) CheckOutput(context.Context, string) error { return nil }
+
+// Client 调用OpenAI兼容的/moderations接口审核内容，输入和输出使用同样的规则
+type Client struct {
+	resty.Client
+	URL string
+	// Model 审核模型，为空时由服务端决定
+	Model string
+}
+
+func NewClient(baseURL, apiKey string) *Client {
+	httpClient := resty.New()
+	httpClient.SetTimeout(time.Second * 30)
+	httpClient.SetTransport(httptransport.New(httptransport.DefaultConfig))
+	if apiKey != "" {
+		httpClient.SetAuthToken(apiKey)
+	}
+	return &Client{
+		Client: *httpClient,
+		URL:    strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// SetTransportConfig 按cfg重建连接池，应在开始请求前调用
+func (c *Client) SetTransportConfig(cfg httptransport.Config) {
+	c.SetTransport(httptransport.New(cfg))
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+func (c *Client) CheckInput(ctx context.Context, text string) error {
+	return c.check(ctx, text)
+}
+
+func (c *Client) CheckOutput(ctx context.Context, text string) error {
+	return c.check(ctx, text)
+}
+
+// check 任一结果被标记即视为违规，命中的类别按名称排序
+func (c *Client) check(ctx context.Context, text string) error {
+	body := map[string]string{"input": text}
+	if c.Model != "" {
+		body["model"] = c.Model
+	}
+	result := &moderationResponse{}
+	resp, err := c.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		SetResult(result).
+		Post(c.URL + "/moderations")
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	if !resp.IsSuccess() {
+		return fmt.Errorf("API returned error status: %d, body: %s", resp.StatusCode(), resp.Body())
+	}
+
+	var violation *Violation
+	for _, r := range result.Results {
+		if !r.Flagged {
+			continue
+		}
+		if violation == nil {
+			violation = &Violation{}
+		}
+		for category, hit := range r.Categories {
+			if hit && !slices.Contains(violation.Categories, category) {
+				violation.Categories = append(violation.Categories, category)
+			}
+		}
+	}
+	if violation == nil {
+		return nil
+	}
+	slices.Sort(violation.Categories)
+	return violation
+}
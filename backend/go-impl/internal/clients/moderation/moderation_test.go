@@ -0,0 +1,62 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestClient_Check(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		status         int
+		wantViolation  bool
+		wantCategories []string
+		wantErr        bool
+	}{
+		{name: "通过", body: `{"results":[{"flagged":false,"categories":{"hate":false}}]}`},
+		{name: "违规", body: `{"results":[{"flagged":true,"categories":{"violence":true,"hate":true,"sexual":false}}]}`, wantViolation: true, wantCategories: []string{"hate", "violence"}},
+		{name: "服务端错误", body: `{"error":"boom"}`, status: http.StatusInternalServerError, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req map[string]string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/moderations" || r.Header.Get("Authorization") != "Bearer test" {
+					t.Errorf("request %s with auth %q", r.URL.Path, r.Header.Get("Authorization"))
+				}
+				json.NewDecoder(r.Body).Decode(&req)
+				w.Header().Set("Content-Type", "application/json")
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL+"/", "test")
+			client.Model = "omni-moderation-latest"
+			err := client.CheckInput(context.Background(), "你好")
+			if req["input"] != "你好" || req["model"] != "omni-moderation-latest" {
+				t.Errorf("request body = %v", req)
+			}
+
+			var violation *Violation
+			isViolation := errors.As(err, &violation)
+			if isViolation != tt.wantViolation {
+				t.Fatalf("CheckInput() error = %v, want violation %v", err, tt.wantViolation)
+			}
+			if isViolation && !slices.Equal(violation.Categories, tt.wantCategories) {
+				t.Errorf("Categories = %v, want %v", violation.Categories, tt.wantCategories)
+			}
+			if !tt.wantViolation && (err != nil) != tt.wantErr {
+				t.Errorf("CheckInput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
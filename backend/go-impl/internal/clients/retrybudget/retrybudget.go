@@ -0,0 +1,88 @@
+// Package retrybudget 为一次请求中的所有下游调用（LLM、VITS、情绪预测）提供共享的重试预算：
+// 各客户端重试前从ctx中的预算扣除一次重试和本次退避的等待时间，预算用尽后不再重试，直接返回最后一次的错误，
+// 避免多个调用各自重试叠加出很长的一轮对话
+package retrybudget
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrExhausted 重试预算已用尽，客户端放弃了本可以进行的重试
+var ErrExhausted = errors.New("retry budget exhausted")
+
+// Budget 一次请求的重试预算，并发安全。nil表示不限制
+type Budget struct {
+	mu sync.Mutex
+	// retries 剩余的重试次数，<0表示不限制
+	retries int
+	// wait 剩余的退避等待时间，<0表示不限制
+	wait time.Duration
+}
+
+// New 最多重试retries次、退避等待累计不超过wait的预算，<=0表示该项不限制；两项都不限制时返回nil
+func New(retries int, wait time.Duration) *Budget {
+	if retries <= 0 && wait <= 0 {
+		return nil
+	}
+	b := &Budget{retries: -1, wait: -1}
+	if retries > 0 {
+		b.retries = retries
+	}
+	if wait > 0 {
+		b.wait = wait
+	}
+	return b
+}
+
+// Take 为一次等待delay后的重试扣除预算，剩余的次数或等待时间不够时不扣除并返回false
+func (b *Budget) Take(delay time.Duration) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.retries == 0 || (b.wait >= 0 && b.wait < delay) {
+		return false
+	}
+	if b.retries > 0 {
+		b.retries--
+	}
+	if b.wait >= 0 {
+		b.wait -= delay
+	}
+	return true
+}
+
+// Remaining 剩余的重试次数和等待时间，-1表示不限制
+func (b *Budget) Remaining() (int, time.Duration) {
+	if b == nil {
+		return -1, -1
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retries, b.wait
+}
+
+type budgetKey struct{}
+
+// WithBudget 把b放入ctx，之后用ctx发起的下游调用共享b。b为nil时原样返回ctx
+func WithBudget(ctx context.Context, b *Budget) context.Context {
+	if b == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+// FromContext 取出ctx中的预算，没有时返回nil
+func FromContext(ctx context.Context) *Budget {
+	b, _ := ctx.Value(budgetKey{}).(*Budget)
+	return b
+}
+
+// Allow 客户端在等待delay并重试前调用：ctx中没有预算或预算足够时扣除并返回true
+func Allow(ctx context.Context, delay time.Duration) bool {
+	return FromContext(ctx).Take(delay)
+}
@@ -0,0 +1,66 @@
+package retrybudget
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBudget_Take(t *testing.T) {
+	tests := []struct {
+		name    string
+		retries int
+		wait    time.Duration
+		delays  []time.Duration
+		want    []bool
+	}{
+		{name: "次数用尽", retries: 2, delays: []time.Duration{time.Second, time.Second, time.Second}, want: []bool{true, true, false}},
+		{name: "等待时间用尽", wait: time.Second, delays: []time.Duration{400 * time.Millisecond, 400 * time.Millisecond, 400 * time.Millisecond}, want: []bool{true, true, false}},
+		{name: "等待时间不够时不扣除", wait: time.Second, delays: []time.Duration{800 * time.Millisecond, 400 * time.Millisecond, 200 * time.Millisecond}, want: []bool{true, false, true}},
+		{name: "两项都限制", retries: 1, wait: time.Second, delays: []time.Duration{100 * time.Millisecond, 100 * time.Millisecond}, want: []bool{true, false}},
+		{name: "不限制", delays: []time.Duration{time.Hour, time.Hour}, want: []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(tt.retries, tt.wait)
+			got := make([]bool, 0, len(tt.delays))
+			for _, d := range tt.delays {
+				got = append(got, b.Take(d))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Take() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllow_Shared(t *testing.T) {
+	ctx := WithBudget(context.Background(), New(5, 0))
+	if retries, _ := FromContext(ctx).Remaining(); retries != 5 {
+		t.Fatalf("Remaining() retries = %d, want 5", retries)
+	}
+
+	// 多个调用并发重试，合计只能重试预算内的次数
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for Allow(ctx, time.Millisecond) {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := allowed.Load(); got != 5 {
+		t.Errorf("allowed retries = %d, want 5", got)
+	}
+
+	if !Allow(context.Background(), time.Hour) {
+		t.Error("Allow() without budget = false, want true")
+	}
+}
@@ -3,25 +3,100 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config 应用程序的总体配置
 type Config struct {
-	Server   Server         `json:"server" yaml:"server"`
-	Data     Data           `json:"data" yaml:"data"`
-	Chat     ChatConfig     `json:"chat" yaml:"chat"`
-	Backend  BackendConfig  `json:"backend" yaml:"backend"`
-	Vits     VitsConfig     `json:"vits" yaml:"vits"`
-	Emotion  EmotionConfig  `json:"emotion" yaml:"emotion"`
-	TempDirs TempDirsConfig `json:"temp_dirs" yaml:"temp_dirs"`
+	Server     Server           `json:"server" yaml:"server"`
+	Data       Data             `json:"data" yaml:"data"`
+	Chat       ChatConfig       `json:"chat" yaml:"chat"`
+	Backend    BackendConfig    `json:"backend" yaml:"backend"`
+	Vits       VitsConfig       `json:"vits" yaml:"vits"`
+	Emotion    EmotionConfig    `json:"emotion" yaml:"emotion"`
+	TempDirs   TempDirsConfig   `json:"temp_dirs" yaml:"temp_dirs"`
+	Storage    StorageConfig    `json:"storage" yaml:"storage"`
+	Tracing    TracingConfig    `json:"tracing" yaml:"tracing"`
+	HTTP       HTTPConfig       `json:"http" yaml:"http"`
+	Moderation ModerationConfig `json:"moderation" yaml:"moderation"`
+}
+
+// ModerationConfig 内容审核配置
+type ModerationConfig struct {
+	// Provider 为空表示不审核，openai使用OpenAI兼容的/moderations接口
+	Provider string `json:"provider" yaml:"provider"`
+	BaseURL  string `json:"base_url" yaml:"base_url"`
+	APIKey   string `json:"api_key,omitempty" yaml:"api_key,omitempty"`
+	Model    string `json:"model" yaml:"model"`
+	// Reply 未通过审核时代替回复的安全回复
+	Reply string `json:"reply" yaml:"reply"`
+}
+
+// HTTPConfig LLM、VITS和情绪预测客户端共用的出站连接池配置
+type HTTPConfig struct {
+	MaxIdleConns        int `json:"max_idle_conns" yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host" yaml:"max_idle_conns_per_host"`
+	// MaxConnsPerHost 每个host的最大连接数，0表示不限制
+	MaxConnsPerHost int           `json:"max_conns_per_host" yaml:"max_conns_per_host"`
+	IdleConnTimeout time.Duration `json:"idle_conn_timeout" yaml:"idle_conn_timeout"`
+}
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	// OTLPEndpoint OTLP/HTTP接收地址，为空时不导出
+	OTLPEndpoint string `json:"otlp_endpoint" yaml:"otlp_endpoint"`
+	ServiceName  string `json:"service_name" yaml:"service_name"`
+	// SampleRatio 采样比例，0~1
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio"`
 }
 
 type Server struct {
 	JWTSecret string `json:"jwt_secret" yaml:"jwt_secret"`
+	// AdminToken 管理接口的令牌，为空时只有admin角色的用户能访问管理接口
+	AdminToken string `json:"admin_token,omitempty" yaml:"admin_token,omitempty"`
+	// DebugPipeline 注册POST /api/debug/pipeline，跳过LLM调试解析和情绪映射，需要AdminToken或admin用户
+	DebugPipeline bool `json:"debug_pipeline" yaml:"debug_pipeline"`
+	// RateLimitRPM 聊天接口每个用户（未登录按IP）每分钟的请求数，<=0表示不限流
+	RateLimitRPM int `json:"rate_limit_rpm" yaml:"rate_limit_rpm"`
+	// RateLimitBurst 允许的突发请求数
+	RateLimitBurst int `json:"rate_limit_burst" yaml:"rate_limit_burst"`
+	// HealthProbeTimeout /healthz 探测下游服务的超时
+	HealthProbeTimeout time.Duration `json:"health_probe_timeout" yaml:"health_probe_timeout"`
+	// Warmup 启动时向LLM、VITS、情绪服务发送预热请求
+	Warmup bool `json:"warmup" yaml:"warmup"`
+	// WarmupTimeout 预热请求的超时
+	WarmupTimeout time.Duration `json:"warmup_timeout" yaml:"warmup_timeout"`
+	// WSPingInterval WebSocket心跳间隔
+	WSPingInterval time.Duration `json:"ws_ping_interval" yaml:"ws_ping_interval"`
+	// WSPongTimeout 等待心跳回应的超时
+	WSPongTimeout time.Duration `json:"ws_pong_timeout" yaml:"ws_pong_timeout"`
+	// WSRequireLogin WebSocket握手时必须带有效的登录令牌，否则以401拒绝连接
+	WSRequireLogin bool `json:"ws_require_login" yaml:"ws_require_login"`
+	// WSProgressEvents 推送对话各阶段的status进度事件
+	WSProgressEvents bool `json:"ws_progress_events" yaml:"ws_progress_events"`
+	// WSTextFirst 先推送各分段的文本，语音就绪后再推送audio事件
+	WSTextFirst bool `json:"ws_text_first" yaml:"ws_text_first"`
+	// Compression 客户端支持时压缩REST响应（gzip）和WebSocket消息（permessage-deflate）
+	Compression bool `json:"compression" yaml:"compression"`
+	// CompressionTypes 允许压缩的Content-Type，为空时使用默认列表
+	CompressionTypes []string `json:"compression_types" yaml:"compression_types"`
+	// CompressionMinSize 小于该字节数的响应不压缩
+	CompressionMinSize int `json:"compression_min_size" yaml:"compression_min_size"`
+	// ShutdownTimeout 退出时等待进行中对话完成的最长时间
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+	// BreakerThreshold LLM、VITS、情绪服务连续失败多少次后熔断，<=0表示不熔断
+	BreakerThreshold int `json:"breaker_threshold" yaml:"breaker_threshold"`
+	// BreakerCooldown 熔断后直接失败的时长，之后放行一个请求探测是否恢复
+	BreakerCooldown time.Duration `json:"breaker_cooldown" yaml:"breaker_cooldown"`
 }
 
 type Data struct {
 	DataBase DataBase `json:"database" yaml:"database"`
+	// HistoryRetention 聊天记录保留时长，超过后由后台任务永久删除，<=0表示永久保留
+	HistoryRetention time.Duration `json:"history_retention" yaml:"history_retention"`
+	// HistoryPurgeInterval 清理过期聊天记录的间隔
+	HistoryPurgeInterval time.Duration `json:"history_purge_interval" yaml:"history_purge_interval"`
 }
 
 type DataBase struct {
@@ -32,9 +107,72 @@ type DataBase struct {
 
 // ChatConfig 聊天API配置
 type ChatConfig struct {
-	APIKey  string `json:"api_key,omitempty" yaml:"api_key,omitempty"`
-	BaseURL string `json:"base_url" yaml:"base_url"`
-	Model   string `json:"model" yaml:"model"`
+	Provider     string `json:"provider" yaml:"provider"`
+	APIKey       string `json:"api_key,omitempty" yaml:"api_key,omitempty"`
+	BaseURL      string `json:"base_url" yaml:"base_url"`
+	Model        string `json:"model" yaml:"model"`
+	HistoryTurns int    `json:"history_turns" yaml:"history_turns"`
+	// MaxHistoryTokens 发给LLM的历史token预算
+	MaxHistoryTokens int    `json:"max_history_tokens" yaml:"max_history_tokens"`
+	SystemPrompt     string `json:"system_prompt" yaml:"system_prompt"`
+	// Temperature 生成温度，nil表示使用服务端默认值
+	Temperature *float64 `json:"temperature,omitempty" yaml:"temperature,omitempty"`
+	// TopP 核采样概率，nil表示使用服务端默认值
+	TopP *float64 `json:"top_p,omitempty" yaml:"top_p,omitempty"`
+	// MaxTokens 单次回复的最大token数，0表示不限制
+	MaxTokens int `json:"max_tokens" yaml:"max_tokens"`
+	// MaxMessageLength 用户消息的最大字符数
+	MaxMessageLength int `json:"max_message_length" yaml:"max_message_length"`
+	// StripControlChars 是否删除用户消息中的控制字符
+	StripControlChars bool `json:"strip_control_chars" yaml:"strip_control_chars"`
+	// MaxSegments 一条回复最多拆出的分段数，超出部分合并到最后一个分段
+	MaxSegments int `json:"max_segments" yaml:"max_segments"`
+	// MinSegmentLength 日语部分短于该字符数的分段与相邻的同情绪分段合并
+	MinSegmentLength int `json:"min_segment_length" yaml:"min_segment_length"`
+	// SSMLMarkup 把日语部分的*强调*标记转换为SSML交给VITS合成
+	SSMLMarkup bool `json:"ssml_markup" yaml:"ssml_markup"`
+	// SanitizeOutput 解析后去掉显示文本中漏出的标签和残缺的括号
+	SanitizeOutput bool `json:"sanitize_output" yaml:"sanitize_output"`
+	// OutputBlocklist 从显示文本中删除的短语，开启SanitizeOutput时生效
+	OutputBlocklist []string `json:"output_blocklist" yaml:"output_blocklist"`
+	// MaxConcurrency 分段合成语音和预测情绪时的最大并发请求数
+	MaxConcurrency int `json:"max_concurrency" yaml:"max_concurrency"`
+	// MaxInFlight 同时处理的对话数，0表示不限制
+	MaxInFlight int `json:"max_in_flight" yaml:"max_in_flight"`
+	// MaxQueued 超出MaxInFlight后最多排队等待的对话数
+	MaxQueued int `json:"max_queued" yaml:"max_queued"`
+	// RequestTimeout 单次聊天请求的超时
+	RequestTimeout time.Duration `json:"request_timeout" yaml:"request_timeout"`
+	// LLMTimeout 单次LLM调用的超时，0表示只受RequestTimeout控制
+	LLMTimeout time.Duration `json:"llm_timeout" yaml:"llm_timeout"`
+	// LLMTimeoutReply LLM调用超时时代替回复的文本，为空时返回超时错误
+	LLMTimeoutReply string `json:"llm_timeout_reply,omitempty" yaml:"llm_timeout_reply,omitempty"`
+	// Fallback LLM调用失败时用兜底回复代替错误
+	Fallback bool `json:"fallback" yaml:"fallback"`
+	// FallbackReply 兜底回复的文本
+	FallbackReply string `json:"fallback_reply" yaml:"fallback_reply"`
+	// FallbackEmotion 兜底回复的情绪
+	FallbackEmotion string `json:"fallback_emotion" yaml:"fallback_emotion"`
+	// FallbackVoice 兜底回复用于合成语音的日语
+	FallbackVoice string `json:"fallback_voice" yaml:"fallback_voice"`
+	// IdempotencyTTL 带幂等键的消息的回复保留时长
+	IdempotencyTTL time.Duration `json:"idempotency_ttl" yaml:"idempotency_ttl"`
+	// DryRun 只调用LLM并解析回复，不请求VITS和情绪服务
+	DryRun bool `json:"dry_run" yaml:"dry_run"`
+	// Pipeline 流式对话边接收LLM回复边合成已解析出的分段的语音
+	Pipeline bool `json:"pipeline" yaml:"pipeline"`
+	// LLMSessionTitles 由LLM概括会话的第一条消息作为标题
+	LLMSessionTitles bool `json:"llm_session_titles" yaml:"llm_session_titles"`
+	// MaxAttempts OpenAI兼容接口遇到429、5xx或网络错误时的最大尝试次数
+	MaxAttempts int `json:"max_attempts" yaml:"max_attempts"`
+	// RetryBaseDelay 重试退避的基础间隔
+	RetryBaseDelay time.Duration `json:"retry_base_delay" yaml:"retry_base_delay"`
+	// RetryBudget 单次聊天请求中LLM、VITS和情绪预测合计的最大重试次数，0表示不限制
+	RetryBudget int `json:"retry_budget" yaml:"retry_budget"`
+	// RetryBudgetWait 单次聊天请求中所有重试的退避等待累计上限，0表示不限制
+	RetryBudgetWait time.Duration `json:"retry_budget_wait" yaml:"retry_budget_wait"`
+	// Headers 附加到每个LLM请求的请求头
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
 }
 
 // BackendConfig 后端服务配置
@@ -47,18 +185,110 @@ type BackendConfig struct {
 
 // VitsConfig 语音合成配置
 type VitsConfig struct {
-	APIURL    string `json:"api_url" yaml:"api_url"`
-	SpeakerID int    `json:"speaker_id" yaml:"speaker_id"`
+	APIURL string `json:"api_url" yaml:"api_url"`
+	// FallbackAPIURL 主VITS服务失败时使用的备用服务，为空表示不启用
+	FallbackAPIURL string  `json:"fallback_api_url" yaml:"fallback_api_url"`
+	SpeakerID      int     `json:"speaker_id" yaml:"speaker_id"`
+	AudioFormat    string  `json:"audio_format" yaml:"audio_format"`
+	Speed          float64 `json:"speed" yaml:"speed"`
+	Pitch          float64 `json:"pitch" yaml:"pitch"`
+	// SampleRate 输出WAV的采样率，0表示沿用VITS模型的采样率
+	SampleRate     int           `json:"sample_rate" yaml:"sample_rate"`
+	MaxRetries     int           `json:"max_retries" yaml:"max_retries"`
+	RetryBaseDelay time.Duration `json:"retry_base_delay" yaml:"retry_base_delay"`
+	CacheSize      int           `json:"cache_size" yaml:"cache_size"`
+	// SpeakerRefreshInterval 说话人列表缓存的刷新间隔
+	SpeakerRefreshInterval time.Duration `json:"speaker_refresh_interval" yaml:"speaker_refresh_interval"`
+	// InlineAudio 音频以base64直接放在响应里，不写入临时目录
+	InlineAudio bool `json:"inline_audio" yaml:"inline_audio"`
+	// ConcatAudio 把一条回复各分段的语音拼接为一个文件返回
+	ConcatAudio bool `json:"concat_audio" yaml:"concat_audio"`
+	// StreamAudio WS对话通过VITS流式接口合成，边合成边推送语音块
+	StreamAudio bool `json:"stream_audio" yaml:"stream_audio"`
+	// StreamChunkSize 流式合成时每块语音的最大字节数
+	StreamChunkSize int `json:"stream_chunk_size" yaml:"stream_chunk_size"`
+	// MaxAudioBytes 单个分段语音的最大字节数，超过时该分段只返回文字，<=0表示不限制
+	MaxAudioBytes int `json:"max_audio_bytes" yaml:"max_audio_bytes"`
+	// TranscodeFormat VITS返回WAV后用ffmpeg转码的目标格式，为空表示不转码
+	TranscodeFormat string `json:"transcode_format" yaml:"transcode_format"`
+	// TranscodeBitrate 转码的码率
+	TranscodeBitrate string `json:"transcode_bitrate" yaml:"transcode_bitrate"`
+	// Normalize 音量均衡方式，peak或rms，为空表示不均衡
+	Normalize string `json:"normalize" yaml:"normalize"`
+	// NormalizeTarget 音量均衡的目标电平（dBFS），为nil时使用该方式的默认值
+	NormalizeTarget *float64 `json:"normalize_target,omitempty" yaml:"normalize_target,omitempty"`
+	// FFmpegPath ffmpeg可执行文件路径
+	FFmpegPath string `json:"ffmpeg_path" yaml:"ffmpeg_path"`
+	// LanguageSpeakers 语言代码（ISO 639-1）到说话人ID的映射，为空表示不按语言选择说话人
+	LanguageSpeakers map[string]int `json:"language_speakers,omitempty" yaml:"language_speakers,omitempty"`
+	// Headers 附加到每个VITS请求的请求头，主服务和备用服务相同
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// LanguageMinConfidence 语言检测的最低置信度，低于该值时使用默认说话人
+	LanguageMinConfidence float64 `json:"language_min_confidence" yaml:"language_min_confidence"`
 }
 
 // EmotionConfig 情感分类配置
 type EmotionConfig struct {
-	URL string `json:"url" yaml:"url"`
+	URL       string  `json:"url" yaml:"url"`
+	Threshold float64 `json:"threshold" yaml:"threshold"`
+	// Predict 是否调用情绪预测服务，关闭时直接使用LLM给出的情绪标签
+	Predict bool `json:"predict" yaml:"predict"`
+	// Batch 是否尝试一次请求预测一条回复的全部情绪标签，服务端不支持时自动逐个请求
+	Batch bool `json:"batch" yaml:"batch"`
+	// DefaultEmotion 回复中没有情绪标签时使用的情绪
+	DefaultEmotion string `json:"default_emotion" yaml:"default_emotion"`
+	// MotionMapPath 情绪到虚拟形象动作的映射文件，为空表示不返回动作
+	MotionMapPath string `json:"motion_map_path" yaml:"motion_map_path"`
+	// Labels 情绪预测模型的标签集合，为空表示不校验预测结果
+	Labels []string `json:"labels" yaml:"labels"`
+	// FallbackLabel 预测出未知标签时使用的情绪，为空时使用DefaultEmotion
+	FallbackLabel string `json:"fallback_label" yaml:"fallback_label"`
+	// MaxRetries 单个标签预测遇到5xx或网络错误时的重试次数，重试用尽后才记为unknown
+	MaxRetries int `json:"max_retries" yaml:"max_retries"`
+	// RetryBaseDelay 重试退避的基础间隔
+	RetryBaseDelay time.Duration `json:"retry_base_delay" yaml:"retry_base_delay"`
+	// Headers 附加到每个情绪预测请求的请求头
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// PredictUser 与LLM请求并行预测用户消息的情绪
+	PredictUser bool `json:"predict_user" yaml:"predict_user"`
+	// Smoothing 平滑相邻分段中低置信度的情绪预测
+	Smoothing bool `json:"smoothing" yaml:"smoothing"`
+	// SmoothingThreshold 置信度低于该值的预测沿用前一分段的情绪
+	SmoothingThreshold float64 `json:"smoothing_threshold" yaml:"smoothing_threshold"`
+	// SmoothingWindow 连续沿用前一情绪的最大分段数
+	SmoothingWindow int `json:"smoothing_window" yaml:"smoothing_window"`
+	// CacheSize 跨请求缓存的情绪预测结果条数，0表示关闭缓存
+	CacheSize int `json:"cache_size" yaml:"cache_size"`
+	// CacheTTL 缓存的预测结果保留时长
+	CacheTTL time.Duration `json:"cache_ttl" yaml:"cache_ttl"`
 }
 
 // TempDirsConfig 临时目录配置
 type TempDirsConfig struct {
 	VoiceDir string `json:"voice_dir" yaml:"voice_dir"`
+	// SweepInterval 清理过期语音文件的间隔
+	SweepInterval time.Duration `json:"sweep_interval" yaml:"sweep_interval"`
+	// VoiceTTL 语音文件保留时长，超过后由后台任务删除
+	VoiceTTL time.Duration `json:"voice_ttl" yaml:"voice_ttl"`
+}
+
+// StorageConfig 生成语音的存储位置
+type StorageConfig struct {
+	// Backend local写入TempDirs.VoiceDir，s3写入S3兼容的对象存储，memory保存在进程内存中
+	Backend string `json:"backend" yaml:"backend"`
+	// MemoryMaxBytes memory存储最多保存的音频字节数
+	MemoryMaxBytes int    `json:"memory_max_bytes" yaml:"memory_max_bytes"`
+	S3Endpoint     string `json:"s3_endpoint" yaml:"s3_endpoint"`
+	S3Region       string `json:"s3_region" yaml:"s3_region"`
+	S3Bucket       string `json:"s3_bucket" yaml:"s3_bucket"`
+	S3AccessKey    string `json:"s3_access_key,omitempty" yaml:"s3_access_key,omitempty"`
+	S3SecretKey    string `json:"s3_secret_key,omitempty" yaml:"s3_secret_key,omitempty"`
+	// S3Prefix 对象key的前缀
+	S3Prefix string `json:"s3_prefix" yaml:"s3_prefix"`
+	// S3PublicURL 前端访问语音的地址前缀，为空时使用 S3Endpoint/S3Bucket
+	S3PublicURL string `json:"s3_public_url" yaml:"s3_public_url"`
+	// NameTemplate 语音文件名的模板，见service.NewVoiceNamer
+	NameTemplate string `json:"name_template" yaml:"name_template"`
 }
 
 func GetConfigFromEnv() *Config {
@@ -68,22 +298,77 @@ func GetConfigFromEnv() *Config {
 
 	autoMigrate, _ := strconv.ParseBool(os.Getenv("AUTO_MIGRATE"))
 
+	emotionThreshold, _ := strconv.ParseFloat(os.Getenv("EMOTION_CONFIDENCE_THRESHOLD"), 64)
+
 	// 创建并返回配置结构体
 	return &Config{
 		Server: Server{
-			JWTSecret: os.Getenv("JWT_SECRET"),
+			JWTSecret:          os.Getenv("JWT_SECRET"),
+			AdminToken:         os.Getenv("ADMIN_TOKEN"),
+			DebugPipeline:      getEnvBool("DEBUG_PIPELINE", false),
+			RateLimitRPM:       getEnvInt("RATE_LIMIT_RPM", 20),
+			RateLimitBurst:     getEnvInt("RATE_LIMIT_BURST", 5),
+			HealthProbeTimeout: getEnvDuration("HEALTH_PROBE_TIMEOUT", 2*time.Second),
+			Warmup:             getEnvBool("WARMUP", false),
+			WarmupTimeout:      getEnvDuration("WARMUP_TIMEOUT", time.Minute),
+			ShutdownTimeout:    getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+			WSPingInterval:     getEnvDuration("WS_PING_INTERVAL", 30*time.Second),
+			WSPongTimeout:      getEnvDuration("WS_PONG_TIMEOUT", 10*time.Second),
+			WSRequireLogin:     getEnvBool("WS_REQUIRE_LOGIN", true),
+			WSProgressEvents:   getEnvBool("WS_PROGRESS_EVENTS", false),
+			WSTextFirst:        getEnvBool("WS_TEXT_FIRST", false),
+			Compression:        getEnvBool("COMPRESSION", false),
+			CompressionTypes:   getEnvList("COMPRESSION_TYPES"),
+			CompressionMinSize: getEnvInt("COMPRESSION_MIN_SIZE", 1024),
+			BreakerThreshold:   getEnvInt("BREAKER_THRESHOLD", 5),
+			BreakerCooldown:    getEnvDuration("BREAKER_COOLDOWN", 30*time.Second),
 		},
 		Data: Data{
-			DataBase{
+			DataBase: DataBase{
 				Driver:      os.Getenv("DATABASE_DRIVER"),
 				Source:      os.Getenv("DATABASE_SOURCE"),
 				AutoMigrate: autoMigrate,
 			},
+			HistoryRetention:     getEnvDuration("HISTORY_RETENTION", 0),
+			HistoryPurgeInterval: getEnvDuration("HISTORY_PURGE_INTERVAL", time.Hour),
 		},
 		Chat: ChatConfig{
-			APIKey:  os.Getenv("CHAT_API_KEY"),
-			BaseURL: os.Getenv("CHAT_BASE_URL"),
-			Model:   os.Getenv("MODEL_TYPE"),
+			Provider:          os.Getenv("CHAT_PROVIDER"),
+			APIKey:            os.Getenv("CHAT_API_KEY"),
+			BaseURL:           os.Getenv("CHAT_BASE_URL"),
+			Model:             os.Getenv("MODEL_TYPE"),
+			HistoryTurns:      getEnvInt("CHAT_HISTORY_TURNS", 0),
+			MaxHistoryTokens:  getEnvInt("CHAT_MAX_HISTORY_TOKENS", 0),
+			SystemPrompt:      os.Getenv("SYSTEM_PROMPT"),
+			Temperature:       getEnvOptionalFloat("CHAT_TEMPERATURE"),
+			TopP:              getEnvOptionalFloat("CHAT_TOP_P"),
+			MaxTokens:         getEnvInt("CHAT_MAX_TOKENS", 0),
+			MaxConcurrency:    getEnvInt("CHAT_MAX_CONCURRENCY", 4),
+			MaxInFlight:       getEnvInt("CHAT_MAX_IN_FLIGHT", 0),
+			MaxQueued:         getEnvInt("CHAT_MAX_QUEUED", 32),
+			MaxMessageLength:  getEnvInt("CHAT_MAX_MESSAGE_LENGTH", 2000),
+			StripControlChars: getEnvBool("CHAT_STRIP_CONTROL_CHARS", true),
+			RequestTimeout:    getEnvDuration("CHAT_REQUEST_TIMEOUT", 2*time.Minute),
+			LLMTimeout:        getEnvDuration("CHAT_LLM_TIMEOUT", 0),
+			LLMTimeoutReply:   os.Getenv("CHAT_LLM_TIMEOUT_REPLY"),
+			Fallback:          getEnvBool("CHAT_FALLBACK", false),
+			FallbackReply:     getEnv("CHAT_FALLBACK_REPLY", "对不起，我现在有点累，稍后再聊好吗？"),
+			FallbackEmotion:   getEnv("CHAT_FALLBACK_EMOTION", "难过"),
+			FallbackVoice:     getEnv("CHAT_FALLBACK_VOICE", "ごめんね、今ちょっと疲れてるの。また後で話そう？"),
+			IdempotencyTTL:    getEnvDuration("CHAT_IDEMPOTENCY_TTL", 10*time.Minute),
+			DryRun:            getEnvBool("CHAT_DRY_RUN", false),
+			Pipeline:          getEnvBool("CHAT_PIPELINE", false),
+			LLMSessionTitles:  getEnvBool("CHAT_LLM_SESSION_TITLES", false),
+			MaxAttempts:       getEnvInt("CHAT_MAX_ATTEMPTS", 3),
+			RetryBaseDelay:    getEnvDuration("CHAT_RETRY_BASE_DELAY", 500*time.Millisecond),
+			RetryBudget:       getEnvInt("CHAT_RETRY_BUDGET", 0),
+			RetryBudgetWait:   getEnvDuration("CHAT_RETRY_BUDGET_WAIT", 0),
+			Headers:           getEnvStringMap("CHAT_HEADERS"),
+			MaxSegments:       getEnvInt("CHAT_MAX_SEGMENTS", 32),
+			MinSegmentLength:  getEnvInt("CHAT_MIN_SEGMENT_LENGTH", 0),
+			SSMLMarkup:        getEnvBool("CHAT_SSML_MARKUP", false),
+			SanitizeOutput:    getEnvBool("CHAT_SANITIZE_OUTPUT", true),
+			OutputBlocklist:   getEnvList("CHAT_OUTPUT_BLOCKLIST"),
 		},
 		Backend: BackendConfig{
 			LogDir:   os.Getenv("BACKEND_LOG_DIR"),
@@ -92,14 +377,182 @@ func GetConfigFromEnv() *Config {
 			Port:     backendPort,
 		},
 		Vits: VitsConfig{
-			APIURL:    os.Getenv("VITS_API_URL"),
-			SpeakerID: vitsSpkID,
+			APIURL:                 os.Getenv("VITS_API_URL"),
+			FallbackAPIURL:         os.Getenv("VITS_FALLBACK_API_URL"),
+			SpeakerID:              vitsSpkID,
+			AudioFormat:            getEnv("VITS_AUDIO_FORMAT", "wav"),
+			Speed:                  getEnvFloat("VITS_SPEED", 1),
+			Pitch:                  getEnvFloat("VITS_PITCH", 1),
+			SampleRate:             getEnvInt("VITS_SAMPLE_RATE", 0),
+			MaxRetries:             getEnvInt("VITS_MAX_RETRIES", 2),
+			RetryBaseDelay:         getEnvDuration("VITS_RETRY_BASE_DELAY", 500*time.Millisecond),
+			CacheSize:              getEnvInt("VITS_CACHE_SIZE", 128),
+			SpeakerRefreshInterval: getEnvDuration("VITS_SPEAKER_REFRESH_INTERVAL", 10*time.Minute),
+			InlineAudio:            getEnvBool("VITS_INLINE_AUDIO", false),
+			ConcatAudio:            getEnvBool("VITS_CONCAT_AUDIO", false),
+			StreamAudio:            getEnvBool("VITS_STREAM_AUDIO", false),
+			StreamChunkSize:        getEnvInt("VITS_STREAM_CHUNK_SIZE", 16<<10),
+			MaxAudioBytes:          getEnvInt("VITS_MAX_AUDIO_BYTES", 32<<20),
+			TranscodeFormat:        os.Getenv("VITS_TRANSCODE_FORMAT"),
+			TranscodeBitrate:       getEnv("VITS_TRANSCODE_BITRATE", "64k"),
+			Normalize:              os.Getenv("VITS_NORMALIZE"),
+			NormalizeTarget:        getEnvOptionalFloat("VITS_NORMALIZE_TARGET"),
+			FFmpegPath:             getEnv("FFMPEG_PATH", "ffmpeg"),
+			LanguageSpeakers:       getEnvIntMap("VITS_LANGUAGE_SPEAKERS"),
+			Headers:                getEnvStringMap("VITS_HEADERS"),
+			LanguageMinConfidence:  getEnvFloat("VITS_LANGUAGE_MIN_CONFIDENCE", 0.5),
 		},
 		Emotion: EmotionConfig{
-			URL: os.Getenv("EMOTION_PREDICT_URL"),
+			URL:                os.Getenv("EMOTION_PREDICT_URL"),
+			Threshold:          emotionThreshold,
+			Predict:            getEnvBool("EMOTION_PREDICT_ENABLED", true),
+			Batch:              getEnvBool("EMOTION_PREDICT_BATCH", true),
+			DefaultEmotion:     os.Getenv("DEFAULT_EMOTION"),
+			MotionMapPath:      os.Getenv("EMOTION_MOTION_MAP"),
+			Labels:             getEnvList("EMOTION_LABELS"),
+			FallbackLabel:      os.Getenv("EMOTION_FALLBACK_LABEL"),
+			MaxRetries:         getEnvInt("EMOTION_MAX_RETRIES", 2),
+			RetryBaseDelay:     getEnvDuration("EMOTION_RETRY_BASE_DELAY", 100*time.Millisecond),
+			Headers:            getEnvStringMap("EMOTION_HEADERS"),
+			PredictUser:        getEnvBool("EMOTION_PREDICT_USER", false),
+			Smoothing:          getEnvBool("EMOTION_SMOOTHING", false),
+			SmoothingThreshold: getEnvFloat("EMOTION_SMOOTHING_THRESHOLD", 0.5),
+			SmoothingWindow:    getEnvInt("EMOTION_SMOOTHING_WINDOW", 2),
+			CacheSize:          getEnvInt("EMOTION_CACHE_SIZE", 256),
+			CacheTTL:           getEnvDuration("EMOTION_CACHE_TTL", 10*time.Minute),
 		},
 		TempDirs: TempDirsConfig{
-			VoiceDir: os.Getenv("TEMP_VOICE_DIR"),
+			VoiceDir:      os.Getenv("TEMP_VOICE_DIR"),
+			SweepInterval: getEnvDuration("TEMP_VOICE_SWEEP_INTERVAL", time.Minute),
+			VoiceTTL:      getEnvDuration("TEMP_VOICE_TTL", 10*time.Minute),
+		},
+		Storage: StorageConfig{
+			Backend:        getEnv("AUDIO_STORAGE", "local"),
+			MemoryMaxBytes: getEnvInt("AUDIO_MEMORY_MAX_BYTES", 64<<20),
+			S3Endpoint:     os.Getenv("S3_ENDPOINT"),
+			S3Region:       os.Getenv("S3_REGION"),
+			S3Bucket:       os.Getenv("S3_BUCKET"),
+			S3AccessKey:    os.Getenv("S3_ACCESS_KEY"),
+			S3SecretKey:    os.Getenv("S3_SECRET_KEY"),
+			S3Prefix:       os.Getenv("S3_PREFIX"),
+			S3PublicURL:    os.Getenv("S3_PUBLIC_URL"),
+			NameTemplate:   getEnv("AUDIO_NAME_TEMPLATE", "c{conversation}_m{message}_{token}_"),
 		},
+		Tracing: TracingConfig{
+			OTLPEndpoint: os.Getenv("TRACING_OTLP_ENDPOINT"),
+			ServiceName:  getEnv("TRACING_SERVICE_NAME", "lingchat"),
+			SampleRatio:  getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+		},
+		HTTP: HTTPConfig{
+			MaxIdleConns:        getEnvInt("HTTP_MAX_IDLE_CONNS", 100),
+			MaxIdleConnsPerHost: getEnvInt("HTTP_MAX_IDLE_CONNS_PER_HOST", 32),
+			MaxConnsPerHost:     getEnvInt("HTTP_MAX_CONNS_PER_HOST", 0),
+			IdleConnTimeout:     getEnvDuration("HTTP_IDLE_CONN_TIMEOUT", 90*time.Second),
+		},
+		Moderation: ModerationConfig{
+			Provider: os.Getenv("MODERATION_PROVIDER"),
+			BaseURL:  getEnv("MODERATION_BASE_URL", "https://api.openai.com/v1"),
+			APIKey:   os.Getenv("MODERATION_API_KEY"),
+			Model:    os.Getenv("MODERATION_MODEL"),
+			Reply:    os.Getenv("MODERATION_REPLY"),
+		},
+	}
+}
+
+// getEnv 读取字符串环境变量，未设置时返回默认值
+func getEnv(key string, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// getEnvInt 读取整数环境变量，未设置或格式错误时返回默认值
+func getEnvInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// getEnvFloat 读取浮点数环境变量，未设置或格式错误时返回默认值
+func getEnvFloat(key string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// getEnvOptionalFloat 读取可选的浮点数环境变量，未设置或格式错误时返回nil
+func getEnvOptionalFloat(key string) *float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// getEnvList 读取以逗号分隔的列表，去掉空项，未设置时返回nil
+func getEnvList(key string) []string {
+	var list []string
+	for item := range strings.SplitSeq(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvIntMap 读取以逗号分隔的 key:整数 列表（如"zh:4,en:7"），跳过格式错误的项，未设置时返回nil
+func getEnvIntMap(key string) map[string]int {
+	var m map[string]int
+	for _, item := range getEnvList(key) {
+		k, v, ok := strings.Cut(item, ":")
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if !ok || err != nil || strings.TrimSpace(k) == "" {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]int)
+		}
+		m[strings.TrimSpace(k)] = n
+	}
+	return m
+}
+
+// getEnvStringMap 读取以逗号分隔的 key:value 列表（如"X-Api-Key:abc,X-Tenant:lingchat"），
+// 只按第一个冒号切分，跳过格式错误的项，未设置时返回nil
+func getEnvStringMap(key string) map[string]string {
+	var m map[string]string
+	for _, item := range getEnvList(key) {
+		k, v, ok := strings.Cut(item, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]string)
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return m
+}
+
+// getEnvBool 读取布尔环境变量，未设置或格式错误时返回默认值
+func getEnvBool(key string, def bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// getEnvDuration 读取时长环境变量（如"500ms"、"2s"），未设置或格式错误时返回默认值
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
 	}
+	return v
 }
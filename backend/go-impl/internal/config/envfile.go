@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+)
+
+// EnvFile 从.env文件读取配置，可以在运行中再次调用Load重新读取。
+// 与godotenv.Load一样，创建EnvFile时进程环境中已有的变量优先于文件中的值
+type EnvFile struct {
+	path string
+
+	mu     sync.Mutex
+	preset map[string]bool
+	// loaded 上次从文件设置的变量，文件中删除的变量在重新读取时清除
+	loaded map[string]bool
+}
+
+// NewEnvFile 记录当前进程的环境变量，之后从path读取的值不会覆盖它们
+func NewEnvFile(path string) *EnvFile {
+	preset := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		if key, _, ok := strings.Cut(kv, "="); ok {
+			preset[key] = true
+		}
+	}
+	return &EnvFile{path: path, preset: preset}
+}
+
+// Load 读取文件更新环境变量并返回新的配置，文件无法读取或解析时不修改环境变量
+func (f *EnvFile) Load() (*Config, error) {
+	env, err := godotenv.Read(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key := range f.loaded {
+		if _, ok := env[key]; !ok {
+			os.Unsetenv(key)
+		}
+	}
+	loaded := make(map[string]bool, len(env))
+	for key, value := range env {
+		if f.preset[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		loaded[key] = true
+	}
+	f.loaded = loaded
+	return GetConfigFromEnv(), nil
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("CHAT_MAX_CONCURRENCY", "9")
+	os.Unsetenv("SYSTEM_PROMPT")
+	os.Unsetenv("MODEL_TYPE")
+	t.Cleanup(func() {
+		os.Unsetenv("SYSTEM_PROMPT")
+		os.Unsetenv("MODEL_TYPE")
+	})
+
+	f := NewEnvFile(path)
+	write("CHAT_MAX_CONCURRENCY=2\nSYSTEM_PROMPT=old\nMODEL_TYPE=m1\n")
+	conf, err := f.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 进程环境中已有的变量优先于文件
+	if conf.Chat.MaxConcurrency != 9 || conf.Chat.SystemPrompt != "old" || conf.Chat.Model != "m1" {
+		t.Errorf("first load = %d, %q, %q", conf.Chat.MaxConcurrency, conf.Chat.SystemPrompt, conf.Chat.Model)
+	}
+
+	write("SYSTEM_PROMPT=new\n")
+	conf, err = f.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Chat.SystemPrompt != "new" {
+		t.Errorf("SystemPrompt = %q, want new", conf.Chat.SystemPrompt)
+	}
+	// 文件中删除的变量不再生效
+	if conf.Chat.Model != "" {
+		t.Errorf("Model = %q, want empty after removal", conf.Chat.Model)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Load(); err == nil {
+		t.Error("Load() missing file succeeded, want error")
+	}
+	if got := os.Getenv("SYSTEM_PROMPT"); got != "new" {
+		t.Errorf("SYSTEM_PROMPT after failed load = %q, want new", got)
+	}
+}
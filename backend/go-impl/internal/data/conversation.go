@@ -3,11 +3,14 @@ package data
 import (
 	"context"
 	"errors"
+	"slices"
+	"strings"
 	"time"
 
 	"LingChat/internal/data/ent/ent"
 	"LingChat/internal/data/ent/ent/conversation"
 	"LingChat/internal/data/ent/ent/conversationmessage"
+	"LingChat/internal/data/ent/ent/messageemotion"
 )
 
 var (
@@ -34,8 +37,20 @@ type ConversationRepo interface {
 	AppendMessageToConversation(ctx context.Context, conversationID int64, role, content, model string) (*ent.ConversationMessage, error)
 	GetMessage(ctx context.Context, id int64) (*ent.ConversationMessage, error)
 	ListMessages(ctx context.Context, conversationID int64, offset, limit int) ([]*ent.ConversationMessage, int, error)
+	ListConversationMessages(ctx context.Context, conversationID int64, after *MessageCursor, limit int) ([]*ent.ConversationMessage, error)
 	GetMessageChain(ctx context.Context, messageID int64) ([]*ent.ConversationMessage, error)
 	UpdateMessageStatus(ctx context.Context, id int64, status string) error
+	UpdateMessageEmotion(ctx context.Context, id int64, emotion string) error
+	ListRecentUserMessages(ctx context.Context, userID int64, limit int, before *MessageCursor) ([]*ent.ConversationMessage, error)
+	SaveTurn(ctx context.Context, turn TurnInput) (*ent.ConversationMessage, *ent.ConversationMessage, error)
+
+	// 删除与保留期相关操作
+	DeleteUserHistory(ctx context.Context, userID int64, hard bool) (int, error)
+	PurgeHistory(ctx context.Context, before time.Time) (int, error)
+
+	// 情绪统计相关操作
+	SaveMessageEmotions(ctx context.Context, messageID, userID int64, emotions []SegmentEmotion) error
+	CountEmotions(ctx context.Context, userID int64, from, to time.Time) ([]EmotionCount, error)
 }
 
 // conversationRepo 是实现 ConversationRepo 接口的仓库
@@ -336,6 +351,28 @@ func (r *conversationRepo) ListMessages(ctx context.Context, conversationID int6
 	return msgs, count, nil
 }
 
+// ListConversationMessages 按(created_at, id)正序列出对话中晚于after的limit条非系统消息，after为nil时从头开始。
+// 用于逐批读取很长的对话，不统计总数
+func (r *conversationRepo) ListConversationMessages(ctx context.Context, conversationID int64, after *MessageCursor, limit int) ([]*ent.ConversationMessage, error) {
+	query := r.data.db.ConversationMessage.Query().
+		Where(conversationmessage.ConversationID(conversationID)).
+		Where(conversationmessage.DeletedAtIsNil()).
+		Where(conversationmessage.RoleNEQ(conversationmessage.RoleSystem))
+	if after != nil {
+		query = query.Where(conversationmessage.Or(
+			conversationmessage.CreatedAtGT(after.CreatedAt),
+			conversationmessage.And(
+				conversationmessage.CreatedAtEQ(after.CreatedAt),
+				conversationmessage.IDGT(after.ID),
+			),
+		))
+	}
+	return query.
+		Order(ent.Asc(conversationmessage.FieldCreatedAt), ent.Asc(conversationmessage.FieldID)).
+		Limit(limit).
+		All(ctx)
+}
+
 // GetMessageChain 获取消息链（从给定消息追溯到最初消息）
 func (r *conversationRepo) GetMessageChain(ctx context.Context, messageID int64) ([]*ent.ConversationMessage, error) {
 	// 获取起始消息
@@ -397,6 +434,191 @@ func (r *conversationRepo) UpdateMessageStatus(ctx context.Context, id int64, st
 		Exec(ctx)
 }
 
+// UpdateMessageEmotion 更新消息的主情绪
+func (r *conversationRepo) UpdateMessageEmotion(ctx context.Context, id int64, emotion string) error {
+	return r.data.db.ConversationMessage.UpdateOneID(id).
+		SetEmotion(emotion).
+		Exec(ctx)
+}
+
+// MessageCursor 按(created_at, id)定位一条消息，用于分页；id在created_at相同时保证顺序稳定
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// ListRecentUserMessages 列出用户所有对话中最近的limit条非系统消息，按时间正序返回；
+// before不为nil时只列出早于before的消息。按(created_at, id)倒序走created_at索引，翻页不受偏移量影响
+func (r *conversationRepo) ListRecentUserMessages(ctx context.Context, userID int64, limit int, before *MessageCursor) ([]*ent.ConversationMessage, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	query := r.data.db.ConversationMessage.Query().
+		Where(conversationmessage.HasConversationWith(
+			conversation.UserID(userID),
+			conversation.DeletedAtIsNil(),
+		)).
+		Where(conversationmessage.DeletedAtIsNil()).
+		Where(conversationmessage.RoleNEQ(conversationmessage.RoleSystem))
+	if before != nil {
+		query = query.Where(conversationmessage.Or(
+			conversationmessage.CreatedAtLT(before.CreatedAt),
+			conversationmessage.And(
+				conversationmessage.CreatedAtEQ(before.CreatedAt),
+				conversationmessage.IDLT(before.ID),
+			),
+		))
+	}
+	msgs, err := query.
+		Order(ent.Desc(conversationmessage.FieldCreatedAt), ent.Desc(conversationmessage.FieldID)).
+		Limit(limit).
+		All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(msgs)
+	return msgs, nil
+}
+
+// DeleteUserHistory 删除用户的全部对话、消息及分段情绪，返回删除的消息数。
+// hard为false时只设置deleted_at（软删除），行仍保留到PurgeHistory清理；为true时直接删除
+func (r *conversationRepo) DeleteUserHistory(ctx context.Context, userID int64, hard bool) (int, error) {
+	tx, err := r.data.db.Tx(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	convIDs, err := tx.Conversation.Query().
+		Where(conversation.UserID(userID)).
+		IDs(ctx)
+	if err != nil {
+		return 0, rollback(tx, err)
+	}
+	msgIDs, err := tx.ConversationMessage.Query().
+		Where(conversationmessage.ConversationIDIn(convIDs...)).
+		Where(conversationmessage.DeletedAtIsNil()).
+		IDs(ctx)
+	if err != nil {
+		return 0, rollback(tx, err)
+	}
+
+	if hard {
+		err = deleteConversations(ctx, tx, convIDs)
+	} else {
+		now := time.Now()
+		if _, err = tx.MessageEmotion.Update().
+			Where(messageemotion.UserID(userID), messageemotion.DeletedAtIsNil()).
+			SetDeletedAt(now).
+			Save(ctx); err != nil {
+			return 0, rollback(tx, err)
+		}
+		if _, err = tx.ConversationMessage.Update().
+			Where(conversationmessage.IDIn(msgIDs...)).
+			SetDeletedAt(now).
+			Save(ctx); err != nil {
+			return 0, rollback(tx, err)
+		}
+		_, err = tx.Conversation.Update().
+			Where(conversation.IDIn(convIDs...), conversation.DeletedAtIsNil()).
+			SetDeletedAt(now).
+			Save(ctx)
+	}
+	if err != nil {
+		return 0, rollback(tx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(msgIDs), nil
+}
+
+// PurgeHistory 永久删除before之前就不再活跃（updated_at早于before）或已被软删除的对话，
+// 以及before之前软删除的单条消息，返回删除的消息数。按整个对话删除，避免留下断开的消息链
+func (r *conversationRepo) PurgeHistory(ctx context.Context, before time.Time) (int, error) {
+	tx, err := r.data.db.Tx(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	convIDs, err := tx.Conversation.Query().
+		Where(conversation.Or(
+			conversation.UpdatedAtLT(before),
+			conversation.DeletedAtLT(before),
+		)).
+		IDs(ctx)
+	if err != nil {
+		return 0, rollback(tx, err)
+	}
+	msgIDs, err := tx.ConversationMessage.Query().
+		Where(conversationmessage.Or(
+			conversationmessage.ConversationIDIn(convIDs...),
+			conversationmessage.DeletedAtLT(before),
+		)).
+		IDs(ctx)
+	if err != nil {
+		return 0, rollback(tx, err)
+	}
+
+	if err := deleteConversations(ctx, tx, convIDs); err != nil {
+		return 0, rollback(tx, err)
+	}
+	if err := deleteMessages(ctx, tx, msgIDs); err != nil {
+		return 0, rollback(tx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(msgIDs), nil
+}
+
+// deleteConversations 在事务中永久删除对话及其消息和分段情绪
+func deleteConversations(ctx context.Context, tx *ent.Tx, convIDs []int64) error {
+	if len(convIDs) == 0 {
+		return nil
+	}
+	msgIDs, err := tx.ConversationMessage.Query().
+		Where(conversationmessage.ConversationIDIn(convIDs...)).
+		IDs(ctx)
+	if err != nil {
+		return err
+	}
+	if err := deleteMessages(ctx, tx, msgIDs); err != nil {
+		return err
+	}
+	_, err = tx.Conversation.Delete().
+		Where(conversation.IDIn(convIDs...)).
+		Exec(ctx)
+	return err
+}
+
+// deleteMessages 在事务中永久删除消息及其分段情绪
+func deleteMessages(ctx context.Context, tx *ent.Tx, msgIDs []int64) error {
+	if len(msgIDs) == 0 {
+		return nil
+	}
+	if _, err := tx.MessageEmotion.Delete().
+		Where(messageemotion.MessageIDIn(msgIDs...)).
+		Exec(ctx); err != nil {
+		return err
+	}
+	_, err := tx.ConversationMessage.Delete().
+		Where(conversationmessage.IDIn(msgIDs...)).
+		Exec(ctx)
+	return err
+}
+
+// rollback 回滚事务并返回原来的错误
+func rollback(tx *ent.Tx, err error) error {
+	if rbErr := tx.Rollback(); rbErr != nil {
+		return errors.Join(err, rbErr)
+	}
+	return err
+}
+
 // MessageInput 定义创建消息的输入结构
 type MessageInput struct {
 	Role    string
@@ -514,3 +736,208 @@ func (r *conversationRepo) AppendMessageToConversation(ctx context.Context, conv
 	// 对话有最新消息，追加到最新消息后
 	return r.AppendMessage(ctx, *conv.LatestMessageID, role, content, model)
 }
+
+// TurnInput 一轮对话中需要一起保存的用户消息、助手回复及回复的情绪
+type TurnInput struct {
+	// PrevMessageID 用户消息接在这条消息之后，Conversation不为nil时忽略
+	PrevMessageID int64
+	// Conversation 不为nil时在同一事务中先创建这个对话，用户消息接在它开头的消息之后
+	Conversation     *NewConversation
+	UserContent      string
+	AssistantContent string
+	// Model 生成回复的模型
+	Model string
+	// Emotion 回复的主情绪，为空时不设置
+	Emotion string
+	// UserID 分段情绪所属的用户
+	UserID   int64
+	Emotions []SegmentEmotion
+}
+
+// NewConversation 与第一轮对话一起创建的对话
+type NewConversation struct {
+	Title  string
+	UserID int64
+	// Messages 对话开头的消息，第一条须为系统消息
+	Messages []MessageInput
+}
+
+// SaveTurn 在一个事务中追加用户消息和助手回复、保存回复的分段情绪并更新对话的最新消息，
+// 新对话（turn.Conversation）也在同一事务中创建。任何一步失败都整轮回滚，
+// 不会留下空对话、只有用户消息或缺少分段情绪的回复。返回保存后的用户消息和助手回复
+func (r *conversationRepo) SaveTurn(ctx context.Context, turn TurnInput) (*ent.ConversationMessage, *ent.ConversationMessage, error) {
+	var prevMsg *ent.ConversationMessage
+	if turn.Conversation == nil {
+		var err error
+		if prevMsg, err = r.GetMessage(ctx, turn.PrevMessageID); err != nil {
+			return nil, nil, ErrBaseMessageNotFound
+		}
+	} else if msgs := turn.Conversation.Messages; len(msgs) == 0 || msgs[0].Role != string(conversationmessage.RoleSystem) {
+		return nil, nil, errors.New("invalid head message: role is not system")
+	}
+
+	tx, err := r.data.db.Tx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if turn.Conversation != nil {
+		if prevMsg, err = createConversationTx(ctx, tx, turn.Conversation); err != nil {
+			return nil, nil, rollback(tx, err)
+		}
+	}
+	userMsg, err := appendMessageTx(ctx, tx, prevMsg, conversationmessage.RoleUser, turn.UserContent, "", "")
+	if err != nil {
+		return nil, nil, rollback(tx, err)
+	}
+	assistantMsg, err := appendMessageTx(ctx, tx, userMsg, conversationmessage.RoleAssistant, turn.AssistantContent, turn.Model, turn.Emotion)
+	if err != nil {
+		return nil, nil, rollback(tx, err)
+	}
+	if err := tx.Conversation.UpdateOneID(prevMsg.ConversationID).
+		SetLatestMessageID(assistantMsg.ID).
+		Exec(ctx); err != nil {
+		return nil, nil, rollback(tx, err)
+	}
+	if len(turn.Emotions) > 0 {
+		builders := make([]*ent.MessageEmotionCreate, 0, len(turn.Emotions))
+		for _, e := range turn.Emotions {
+			builders = append(builders, tx.MessageEmotion.Create().
+				SetMessageID(assistantMsg.ID).
+				SetUserID(turn.UserID).
+				SetSegmentIndex(e.Index).
+				SetEmotion(e.Emotion).
+				SetConfidence(e.Confidence))
+		}
+		if err := tx.MessageEmotion.CreateBulk(builders...).Exec(ctx); err != nil {
+			return nil, nil, rollback(tx, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return userMsg, assistantMsg, nil
+}
+
+// createConversationTx 在事务中创建对话及其开头的消息，返回最后一条消息，不更新对话的最新消息
+func createConversationTx(ctx context.Context, tx *ent.Tx, conv *NewConversation) (*ent.ConversationMessage, error) {
+	created, err := tx.Conversation.Create().
+		SetTitle(conv.Title).
+		SetUserID(conv.UserID).
+		Save(ctx)
+	if err != nil {
+		return nil, err
+	}
+	head := conv.Messages[0]
+	create := tx.ConversationMessage.Create().
+		SetConversationID(created.ID).
+		SetRole(conversationmessage.Role(head.Role)).
+		SetContent(head.Content).
+		SetParentMessageIds([]int{}).
+		SetStatus("created")
+	if head.Model != "" {
+		create.SetModel(head.Model)
+	}
+	prev, err := create.Save(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range conv.Messages[1:] {
+		if prev, err = appendMessageTx(ctx, tx, prev, conversationmessage.Role(m.Role), m.Content, m.Model, ""); err != nil {
+			return nil, err
+		}
+	}
+	return prev, nil
+}
+
+// appendMessageTx 在事务中把消息接在prev之后并更新prev的nextMessageID，不更新对话的最新消息
+func appendMessageTx(ctx context.Context, tx *ent.Tx, prev *ent.ConversationMessage, role conversationmessage.Role, content, model, emotion string) (*ent.ConversationMessage, error) {
+	create := tx.ConversationMessage.Create().
+		SetConversationID(prev.ConversationID).
+		SetRole(role).
+		SetContent(content).
+		SetParentMessageIds(append(slices.Clone(prev.ParentMessageIds), int(prev.ID))).
+		SetStatus("created")
+	if model != "" {
+		create.SetModel(model)
+	}
+	if emotion != "" {
+		create.SetEmotion(emotion)
+	}
+	msg, err := create.Save(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.ConversationMessage.UpdateOne(prev).SetNextMessageID(msg.ID).Exec(ctx); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// SegmentEmotion 回复中一个分段的情绪
+type SegmentEmotion struct {
+	Index      int
+	Emotion    string
+	Confidence float64
+}
+
+// EmotionCount 一段时间内某种情绪出现的次数及平均置信度
+type EmotionCount struct {
+	Emotion       string
+	Count         int
+	AvgConfidence float64
+}
+
+// SaveMessageEmotions 批量保存一条回复中各分段的情绪
+func (r *conversationRepo) SaveMessageEmotions(ctx context.Context, messageID, userID int64, emotions []SegmentEmotion) error {
+	if len(emotions) == 0 {
+		return nil
+	}
+	builders := make([]*ent.MessageEmotionCreate, 0, len(emotions))
+	for _, e := range emotions {
+		builders = append(builders, r.data.db.MessageEmotion.Create().
+			SetMessageID(messageID).
+			SetUserID(userID).
+			SetSegmentIndex(e.Index).
+			SetEmotion(e.Emotion).
+			SetConfidence(e.Confidence))
+	}
+	return r.data.db.MessageEmotion.CreateBulk(builders...).Exec(ctx)
+}
+
+// CountEmotions 统计用户在[from, to)内每种情绪出现的次数，按次数从多到少返回；from或to为零值时不限制该端
+func (r *conversationRepo) CountEmotions(ctx context.Context, userID int64, from, to time.Time) ([]EmotionCount, error) {
+	query := r.data.db.MessageEmotion.Query().
+		Where(messageemotion.UserID(userID)).
+		Where(messageemotion.DeletedAtIsNil())
+	if !from.IsZero() {
+		query = query.Where(messageemotion.CreatedAtGTE(from))
+	}
+	if !to.IsZero() {
+		query = query.Where(messageemotion.CreatedAtLT(to))
+	}
+
+	var rows []struct {
+		Emotion string  `json:"emotion"`
+		Count   int     `json:"count"`
+		Mean    float64 `json:"mean"`
+	}
+	err := query.
+		GroupBy(messageemotion.FieldEmotion).
+		Aggregate(ent.Count(), ent.Mean(messageemotion.FieldConfidence)).
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]EmotionCount, 0, len(rows))
+	for _, row := range rows {
+		counts = append(counts, EmotionCount{Emotion: row.Emotion, Count: row.Count, AvgConfidence: row.Mean})
+	}
+	slices.SortFunc(counts, func(a, b EmotionCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Emotion, b.Emotion)
+	})
+	return counts, nil
+}
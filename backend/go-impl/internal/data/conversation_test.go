@@ -0,0 +1,203 @@
+//go:build cgo
+
+// SQLite驱动go-sqlite3需要cgo，CGO_ENABLED=0时跳过本文件的测试
+
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/data/ent/ent/enttest"
+	"LingChat/internal/data/ent/ent/hook"
+	"LingChat/internal/data/ent/ent/migrate"
+)
+
+// newTestRepo 使用内存SQLite的ConversationRepo，返回仓库、底层的ent客户端和一个只有系统消息的对话
+func newTestRepo(t *testing.T) (*conversationRepo, *ent.Client, *ent.Conversation, *ent.ConversationMessage) {
+	t.Helper()
+	client := enttest.Open(t, "sqlite3", "file:"+t.Name()+"?mode=memory&cache=shared&_fk=1",
+		enttest.WithMigrateOptions(migrate.WithForeignKeys(false)))
+	t.Cleanup(func() { client.Close() })
+
+	repo := &conversationRepo{data: &Data{db: client}}
+	conv, msgs, err := repo.CreateConversationWithMessages(context.Background(), "测试", 1, MessageInput{Role: "system", Content: "你是助手"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, client, conv, msgs[0]
+}
+
+func TestConversationRepo_SaveTurn(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name string
+		// failOn/failAt 创建第failAt条failOn类型的记录时返回错误，failOn为空表示不出错
+		failOn       string
+		failAt       int
+		wantMessages int
+		wantEmotions int
+	}{
+		{name: "保存整轮对话", wantMessages: 3, wantEmotions: 2},
+		{name: "保存回复失败时回滚用户消息", failOn: ent.TypeConversationMessage, failAt: 2, wantMessages: 1},
+		{name: "保存分段情绪失败时回滚整轮", failOn: ent.TypeMessageEmotion, failAt: 2, wantMessages: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, client, conv, head := newTestRepo(t)
+			ctx := context.Background()
+			created := 0
+			client.Use(hook.On(func(next ent.Mutator) ent.Mutator {
+				return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
+					if m.Type() == tt.failOn {
+						if created++; created == tt.failAt {
+							return nil, errBoom
+						}
+					}
+					return next.Mutate(ctx, m)
+				})
+			}, ent.OpCreate))
+
+			userMsg, reply, err := repo.SaveTurn(ctx, TurnInput{
+				PrevMessageID:    head.ID,
+				UserContent:      "你好",
+				AssistantContent: "【开心】你好<こんにちは>【难过】再见<さよなら>",
+				Model:            "test-model",
+				Emotion:          "开心",
+				UserID:           conv.UserID,
+				Emotions:         []SegmentEmotion{{Index: 0, Emotion: "开心", Confidence: 0.9}, {Index: 1, Emotion: "难过", Confidence: 0.8}},
+			})
+			if tt.failOn != "" {
+				if !errors.Is(err, errBoom) {
+					t.Fatalf("SaveTurn() error = %v, want %v", err, errBoom)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if n := client.ConversationMessage.Query().CountX(ctx); n != tt.wantMessages {
+				t.Errorf("messages = %d, want %d", n, tt.wantMessages)
+			}
+			if n := client.MessageEmotion.Query().CountX(ctx); n != tt.wantEmotions {
+				t.Errorf("emotions = %d, want %d", n, tt.wantEmotions)
+			}
+			head = client.ConversationMessage.GetX(ctx, head.ID)
+			latest := client.Conversation.GetX(ctx, conv.ID).LatestMessageID
+			if tt.failOn != "" {
+				if head.NextMessageID != nil || latest == nil || *latest != head.ID {
+					t.Errorf("head next = %v, latest = %v, want unchanged", head.NextMessageID, latest)
+				}
+				return
+			}
+
+			if reply.Emotion != "开心" || reply.Role != "assistant" || userMsg.Role != "user" {
+				t.Errorf("reply = %+v, user = %+v", reply, userMsg)
+			}
+			if latest == nil || *latest != reply.ID {
+				t.Errorf("latest message = %v, want %d", latest, reply.ID)
+			}
+			chain, err := repo.GetMessageChain(ctx, reply.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chain) != 3 || chain[1].ID != userMsg.ID || chain[2].ID != reply.ID {
+				t.Errorf("chain = %v, want head, user, reply", chain)
+			}
+		})
+	}
+}
+
+func TestConversationRepo_SaveTurnNewConversation(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name string
+		// failAt 创建第failAt条消息时返回错误，0表示不出错
+		failAt            int
+		wantConversations int
+		wantMessages      int
+	}{
+		{name: "与本轮一起创建对话", wantConversations: 1, wantMessages: 3},
+		{name: "保存用户消息失败时不留下对话", failAt: 2},
+		{name: "保存回复失败时不留下对话", failAt: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, client, _, _ := newTestRepo(t)
+			ctx := context.Background()
+			// newTestRepo已创建的对话不计入
+			baseConversations := client.Conversation.Query().CountX(ctx)
+			baseMessages := client.ConversationMessage.Query().CountX(ctx)
+			created := 0
+			client.Use(hook.On(func(next ent.Mutator) ent.Mutator {
+				return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
+					if m.Type() == ent.TypeConversationMessage {
+						if created++; created == tt.failAt {
+							return nil, errBoom
+						}
+					}
+					return next.Mutate(ctx, m)
+				})
+			}, ent.OpCreate))
+
+			userMsg, reply, err := repo.SaveTurn(ctx, TurnInput{
+				Conversation: &NewConversation{
+					Title:    "你好",
+					UserID:   2,
+					Messages: []MessageInput{{Role: "system", Content: "你是助手"}},
+				},
+				UserContent:      "你好",
+				AssistantContent: "【开心】你好<こんにちは>",
+				UserID:           2,
+			})
+			if tt.failAt != 0 {
+				if !errors.Is(err, errBoom) {
+					t.Fatalf("SaveTurn() error = %v, want %v", err, errBoom)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if n := client.Conversation.Query().CountX(ctx) - baseConversations; n != tt.wantConversations {
+				t.Errorf("conversations = %d, want %d", n, tt.wantConversations)
+			}
+			if n := client.ConversationMessage.Query().CountX(ctx) - baseMessages; n != tt.wantMessages {
+				t.Errorf("messages = %d, want %d", n, tt.wantMessages)
+			}
+			if tt.failAt != 0 {
+				return
+			}
+
+			conv := client.Conversation.GetX(ctx, userMsg.ConversationID)
+			if conv.UserID != 2 || conv.Title != "你好" || conv.LatestMessageID == nil || *conv.LatestMessageID != reply.ID {
+				t.Errorf("conversation = %+v, want user 2 with latest message %d", conv, reply.ID)
+			}
+			chain, err := repo.GetMessageChain(ctx, reply.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chain) != 3 || chain[0].Role != "system" || chain[1].ID != userMsg.ID {
+				t.Errorf("chain = %v, want system, user, reply", chain)
+			}
+		})
+	}
+}
+
+func TestConversationRepo_SaveTurnNewConversationWithoutSystem(t *testing.T) {
+	repo, client, _, _ := newTestRepo(t)
+	ctx := context.Background()
+	before := client.Conversation.Query().CountX(ctx)
+	_, _, err := repo.SaveTurn(ctx, TurnInput{
+		Conversation: &NewConversation{Messages: []MessageInput{{Role: "user", Content: "你好"}}},
+		UserContent:  "你好",
+	})
+	if err == nil {
+		t.Fatal("SaveTurn() error = nil, want an error for a conversation not starting with a system message")
+	}
+	if n := client.Conversation.Query().CountX(ctx); n != before {
+		t.Errorf("conversations = %d, want %d", n, before)
+	}
+}
@@ -48,6 +48,9 @@ func (ConversationMessage) Fields() []ent.Field {
 			Optional().
 			Nillable().
 			Comment("The ID of the next message"),
+		field.String("emotion").
+			Optional().
+			Comment("The dominant emotion of the message"),
 	}
 }
 
@@ -65,6 +68,8 @@ func (ConversationMessage) Edges() []ent.Edge {
 			Field("next_message_id").
 			Unique().
 			Comment("The messages following this message"),
+		edge.To("emotions", MessageEmotion.Type).
+			Comment("The per-segment emotions of the message"),
 	}
 }
 
@@ -73,6 +78,8 @@ func (ConversationMessage) Indexes() []ent.Index {
 	return []ent.Index{
 		index.Fields("conversation_id"),
 		index.Fields("next_message_id"),
+		// 最近消息的分页按(created_at, id)倒序
+		index.Fields("created_at", "id"),
 	}
 }
 
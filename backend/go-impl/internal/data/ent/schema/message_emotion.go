@@ -0,0 +1,69 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// MessageEmotion holds the schema definition for the MessageEmotion entity.
+// 每条助手回复中每个分段的情绪，用于统计
+type MessageEmotion struct {
+	ent.Schema
+}
+
+// Fields of the MessageEmotion.
+func (MessageEmotion) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int64("id").
+			Positive().
+			Immutable().
+			Unique(),
+		field.Int64("message_id").
+			Immutable().
+			Comment("The assistant message the segment belongs to"),
+		field.Int64("user_id").
+			Immutable().
+			Comment("The owner of the conversation, denormalized for per-user statistics"),
+		field.Int("segment_index").
+			Immutable().
+			Comment("The index of the segment in the reply"),
+		field.String("emotion").
+			NotEmpty().
+			Immutable().
+			Comment("The predicted emotion of the segment"),
+		field.Float("confidence").
+			Immutable().
+			Comment("The confidence of the prediction"),
+	}
+}
+
+// Edges of the MessageEmotion.
+func (MessageEmotion) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("message", ConversationMessage.Type).
+			Ref("emotions").
+			Field("message_id").
+			Unique().
+			Required().
+			Immutable().
+			Comment("The assistant message the segment belongs to"),
+	}
+}
+
+// Indexes of the MessageEmotion.
+func (MessageEmotion) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("message_id"),
+		index.Fields("emotion", "created_at"),
+		index.Fields("user_id", "created_at"),
+	}
+}
+
+// Mixin of the MessageEmotion.
+func (MessageEmotion) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimestampMixin{},
+	}
+}
@@ -0,0 +1,70 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// Session holds the schema definition for the Session entity.
+// 会话是用户的一个聊天线程，消息链保存在创建会话时一同创建的对话中
+type Session struct {
+	ent.Schema
+}
+
+// Fields of the Session.
+func (Session) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int64("id").
+			Positive().
+			Immutable().
+			Unique(),
+		field.String("title").
+			NotEmpty().
+			MaxLen(128).
+			Comment("The title of the session"),
+		field.Bool("titled").
+			Default(false).
+			Comment("Whether the title was given by the user or generated from the first message"),
+		field.Int64("user_id").
+			Positive().
+			Immutable().
+			Comment("The ID of the user who owns the session"),
+		field.Int64("conversation_id").
+			Immutable().
+			Comment("The conversation holding the session's messages"),
+	}
+}
+
+func (Session) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimestampMixin{},
+	}
+}
+
+// Edges of the Session.
+func (Session) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("user", User.Type).
+			Ref("sessions").
+			Field("user_id").
+			Unique().
+			Required().
+			Immutable().
+			Comment("The user who owns the session"),
+		edge.To("conversation", Conversation.Type).
+			Field("conversation_id").
+			Unique().
+			Required().
+			Immutable().
+			Comment("The conversation holding the session's messages"),
+	}
+}
+
+// Indexes of the Session.
+func (Session) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("user_id"),
+	}
+}
@@ -13,6 +13,12 @@ type User struct {
 	ent.Schema
 }
 
+// Role enum for User
+const (
+	UserRoleUser  string = "user"
+	UserRoleAdmin string = "admin"
+)
+
 // Fields of the User.
 func (User) Fields() []ent.Field {
 	return []ent.Field{
@@ -28,6 +34,15 @@ func (User) Fields() []ent.Field {
 			Optional().
 			Unique().
 			MaxLen(128),
+		field.Int("speaker_id").
+			Optional().
+			Nillable().
+			NonNegative().
+			Comment("The preferred VITS speaker, nil means the configured default"),
+		field.Enum("role").
+			Values(UserRoleUser, UserRoleAdmin).
+			Default(UserRoleUser).
+			Comment("The access role, admin users can call the admin endpoints"),
 	}
 }
 
@@ -44,6 +59,11 @@ func (User) Edges() []ent.Edge {
 			Unique(),
 		edge.To("conversations", Conversation.Type).
 			Comment("The conversations owned by the user"),
+		edge.To("preferences", UserPreferences.Type).
+			Unique().
+			Comment("The per-user reply preferences"),
+		edge.To("sessions", Session.Type).
+			Comment("The chat sessions owned by the user"),
 	}
 }
 
@@ -0,0 +1,63 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+)
+
+// UserPreferences holds the schema definition for the UserPreferences entity.
+// 每个用户一条偏好设置，未设置的字段为NULL，使用全局配置
+type UserPreferences struct {
+	ent.Schema
+}
+
+// Fields of the UserPreferences.
+func (UserPreferences) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int64("id").
+			Positive().
+			Immutable().
+			Unique(),
+		field.Int64("user_id").
+			Positive().
+			Unique().
+			Immutable(),
+		field.Int("speaker_id").
+			Optional().
+			Nillable().
+			NonNegative().
+			Comment("The preferred VITS speaker"),
+		field.Float("speed").
+			Optional().
+			Nillable().
+			Comment("The preferred speech speed ratio"),
+		field.String("language").
+			Optional().
+			Nillable().
+			MaxLen(16).
+			Comment("The preferred language (ISO 639-1), used when the reply language cannot be detected"),
+		field.Bool("predict_emotions").
+			Optional().
+			Nillable().
+			Comment("Whether replies run emotion prediction"),
+	}
+}
+
+func (UserPreferences) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		TimestampMixin{},
+	}
+}
+
+// Edges of the UserPreferences.
+func (UserPreferences) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("user", User.Type).
+			Ref("preferences").
+			Field("user_id").
+			Unique().
+			Required().
+			Immutable(),
+	}
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"context"
+
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/data/ent/ent/userpreferences"
+)
+
+// Preferences 用户偏好，字段为nil表示未设置，使用全局配置
+type Preferences struct {
+	SpeakerID       *int
+	Speed           *float64
+	Language        *string
+	PredictEmotions *bool
+}
+
+// PreferencesRepo 用户偏好的仓库接口
+type PreferencesRepo interface {
+	// Get 返回用户的偏好，没有记录时返回全部未设置的Preferences
+	Get(ctx context.Context, userID int64) (*Preferences, error)
+	// Save 用p整体替换用户的偏好，nil字段清除为未设置
+	Save(ctx context.Context, userID int64, p *Preferences) (*Preferences, error)
+}
+
+// preferencesRepo 是实现 PreferencesRepo 接口的仓库
+type preferencesRepo struct {
+	data *Data
+}
+
+// NewPreferencesRepo 创建用户偏好仓库
+func NewPreferencesRepo(data *Data) PreferencesRepo {
+	return &preferencesRepo{
+		data: data,
+	}
+}
+
+// Get 返回用户的偏好，没有记录时返回全部未设置的Preferences
+func (r *preferencesRepo) Get(ctx context.Context, userID int64) (*Preferences, error) {
+	row, err := r.data.db.UserPreferences.
+		Query().
+		Where(userpreferences.UserID(userID)).
+		Only(ctx)
+	if ent.IsNotFound(err) {
+		return &Preferences{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toPreferences(row), nil
+}
+
+// Save 用p整体替换用户的偏好，没有记录时创建
+func (r *preferencesRepo) Save(ctx context.Context, userID int64, p *Preferences) (*Preferences, error) {
+	n, err := r.update(ctx, userID, p)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		_, err = r.data.db.UserPreferences.
+			Create().
+			SetUserID(userID).
+			SetNillableSpeakerID(p.SpeakerID).
+			SetNillableSpeed(p.Speed).
+			SetNillableLanguage(p.Language).
+			SetNillablePredictEmotions(p.PredictEmotions).
+			Save(ctx)
+		// 并发请求已经创建了记录时改为更新
+		if ent.IsConstraintError(err) {
+			_, err = r.update(ctx, userID, p)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r.Get(ctx, userID)
+}
+
+// update 更新已有的记录，返回更新的行数
+func (r *preferencesRepo) update(ctx context.Context, userID int64, p *Preferences) (int, error) {
+	update := r.data.db.UserPreferences.
+		Update().
+		Where(userpreferences.UserID(userID))
+	if p.SpeakerID != nil {
+		update.SetSpeakerID(*p.SpeakerID)
+	} else {
+		update.ClearSpeakerID()
+	}
+	if p.Speed != nil {
+		update.SetSpeed(*p.Speed)
+	} else {
+		update.ClearSpeed()
+	}
+	if p.Language != nil {
+		update.SetLanguage(*p.Language)
+	} else {
+		update.ClearLanguage()
+	}
+	if p.PredictEmotions != nil {
+		update.SetPredictEmotions(*p.PredictEmotions)
+	} else {
+		update.ClearPredictEmotions()
+	}
+	return update.Save(ctx)
+}
+
+func toPreferences(row *ent.UserPreferences) *Preferences {
+	return &Preferences{
+		SpeakerID:       row.SpeakerID,
+		Speed:           row.Speed,
+		Language:        row.Language,
+		PredictEmotions: row.PredictEmotions,
+	}
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"context"
+	"errors"
+
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/data/ent/ent/conversation"
+	"LingChat/internal/data/ent/ent/session"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// SessionRepo 聊天会话的仓库接口
+type SessionRepo interface {
+	// Create 为用户创建会话，conversationID是保存会话消息的对话；titled表示标题由用户指定，不再自动生成
+	Create(ctx context.Context, userID int64, title string, titled bool, conversationID int64) (*ent.Session, error)
+	// Get 获取会话，不存在或其对话已删除时返回ErrSessionNotFound
+	Get(ctx context.Context, id int64) (*ent.Session, error)
+	// List 按最近活跃时间从新到旧列出用户的会话
+	List(ctx context.Context, userID int64) ([]*ent.Session, error)
+	// Touch 更新会话的活跃时间
+	Touch(ctx context.Context, id int64) error
+	// SetAutoTitle 会话还没有标题时设置自动生成的标题，返回是否设置成功
+	SetAutoTitle(ctx context.Context, id int64, title string) (bool, error)
+	// UpdateTitle 修改会话标题
+	UpdateTitle(ctx context.Context, id int64, title string) error
+}
+
+// sessionRepo 是实现 SessionRepo 接口的仓库
+type sessionRepo struct {
+	data *Data
+}
+
+// NewSessionRepo 创建会话仓库
+func NewSessionRepo(data *Data) SessionRepo {
+	return &sessionRepo{
+		data: data,
+	}
+}
+
+// Create 为用户创建会话
+func (r *sessionRepo) Create(ctx context.Context, userID int64, title string, titled bool, conversationID int64) (*ent.Session, error) {
+	return r.data.db.Session.Create().
+		SetUserID(userID).
+		SetTitle(title).
+		SetTitled(titled).
+		SetConversationID(conversationID).
+		Save(ctx)
+}
+
+// Get 获取会话，删除聊天记录后会话随对话一起失效
+func (r *sessionRepo) Get(ctx context.Context, id int64) (*ent.Session, error) {
+	s, err := r.data.db.Session.Query().
+		Where(session.ID(id), session.DeletedAtIsNil()).
+		Where(session.HasConversationWith(conversation.DeletedAtIsNil())).
+		Only(ctx)
+	if ent.IsNotFound(err) {
+		return nil, ErrSessionNotFound
+	}
+	return s, err
+}
+
+// List 按最近活跃时间从新到旧列出用户的会话
+func (r *sessionRepo) List(ctx context.Context, userID int64) ([]*ent.Session, error) {
+	return r.data.db.Session.Query().
+		Where(session.UserID(userID), session.DeletedAtIsNil()).
+		Where(session.HasConversationWith(conversation.DeletedAtIsNil())).
+		Order(ent.Desc(session.FieldUpdatedAt), ent.Desc(session.FieldID)).
+		All(ctx)
+}
+
+// Touch 更新会话的活跃时间，updated_at由UpdateDefault设置
+func (r *sessionRepo) Touch(ctx context.Context, id int64) error {
+	return r.data.db.Session.UpdateOneID(id).Exec(ctx)
+}
+
+// SetAutoTitle 只更新titled为false的会话，同一会话的并发消息中只有一条能设置成功
+func (r *sessionRepo) SetAutoTitle(ctx context.Context, id int64, title string) (bool, error) {
+	n, err := r.data.db.Session.Update().
+		Where(session.ID(id), session.Titled(false)).
+		SetTitle(title).
+		SetTitled(true).
+		Save(ctx)
+	return n > 0, err
+}
+
+// UpdateTitle 修改会话标题
+func (r *sessionRepo) UpdateTitle(ctx context.Context, id int64, title string) error {
+	return r.data.db.Session.UpdateOneID(id).
+		SetTitle(title).
+		SetTitled(true).
+		Exec(ctx)
+}
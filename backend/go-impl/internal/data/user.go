@@ -41,6 +41,8 @@ type User struct {
 	Username string
 	Password string
 	Email    string
+	// SpeakerID 偏好的VITS说话人，nil表示不修改
+	SpeakerID *int
 }
 
 // userRepo 用户仓库实现
@@ -156,6 +158,10 @@ func (r *userRepo) Update(ctx context.Context, id int64, u *User) (*ent.User, er
 		update = update.SetEmail(u.Email)
 	}
 
+	if u.SpeakerID != nil {
+		update = update.SetSpeakerID(*u.SpeakerID)
+	}
+
 	return update.Save(ctx)
 }
 
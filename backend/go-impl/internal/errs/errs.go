@@ -0,0 +1,107 @@
+// Package errs 定义聊天流程中常见的错误类型，以及它们对应的HTTP/WS状态码
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"LingChat/internal/breaker"
+)
+
+var (
+	// ErrInvalidMessage 消息格式错误，无法解析
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrEmptyMessage 消息内容为空或只有空白
+	ErrEmptyMessage = fmt.Errorf("%w: 消息内容为空", ErrInvalidMessage)
+	// ErrMessageTooLong 消息内容超过长度限制
+	ErrMessageTooLong = fmt.Errorf("%w: 消息内容过长", ErrInvalidMessage)
+	// ErrInvalidMessageType 不支持的消息类型
+	ErrInvalidMessageType = errors.New("invalid message type")
+	// ErrLLM LLM请求失败
+	ErrLLM = errors.New("llm request failed")
+	// ErrTTS 语音合成失败
+	ErrTTS = errors.New("tts request failed")
+	// ErrEmptyAudio VITS返回成功但音频为空，该分段按语音合成失败处理
+	ErrEmptyAudio = fmt.Errorf("%w: 语音为空", ErrTTS)
+	// ErrShuttingDown 服务正在关闭，不再接受新的对话
+	ErrShuttingDown = errors.New("服务正在关闭")
+	// ErrOverloaded 等待处理的对话已达上限，客户端稍后重试
+	ErrOverloaded = errors.New("服务繁忙")
+	// ErrIdempotencyConflict 同一个幂等键被用于内容不同的消息
+	ErrIdempotencyConflict = errors.New("幂等键已用于其他消息")
+	// ErrInvalidArgument 请求参数不合法，如超出范围的偏好设置
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrForbidden 请求的资源不属于当前用户，如其他用户的会话
+	ErrForbidden = errors.New("forbidden")
+	// ErrModerated 用户消息或LLM回复未通过内容审核，返回给用户的是预设的安全回复
+	ErrModerated = errors.New("content moderated")
+)
+
+// 错误响应中的错误码，客户端据此区分错误类型而不必解析错误信息
+const (
+	CodeInvalidMessage     = "invalid_message"
+	CodeInvalidMessageType = "invalid_message_type"
+	CodeInvalidArgument    = "invalid_argument"
+	CodeForbidden          = "forbidden"
+	CodeConflict           = "conflict"
+	CodeModerated          = "moderated"
+	CodeUnavailable        = "unavailable"
+	CodeTimeout            = "timeout"
+	CodeLLM                = "llm_error"
+	CodeTTS                = "tts_error"
+	CodeInternal           = "internal_error"
+)
+
+// Code 返回err对应的错误码，nil返回空字符串，未知错误返回CodeInternal
+func Code(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrInvalidMessage):
+		return CodeInvalidMessage
+	case errors.Is(err, ErrInvalidMessageType):
+		return CodeInvalidMessageType
+	case errors.Is(err, ErrInvalidArgument):
+		return CodeInvalidArgument
+	case errors.Is(err, ErrForbidden):
+		return CodeForbidden
+	case errors.Is(err, ErrIdempotencyConflict):
+		return CodeConflict
+	case errors.Is(err, ErrModerated):
+		return CodeModerated
+	case errors.Is(err, ErrShuttingDown), errors.Is(err, ErrOverloaded), errors.Is(err, breaker.ErrOpen):
+		return CodeUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, ErrLLM):
+		return CodeLLM
+	case errors.Is(err, ErrTTS):
+		return CodeTTS
+	default:
+		return CodeInternal
+	}
+}
+
+// HTTPStatus 返回err对应的HTTP状态码，WS的错误响应也使用同样的code；nil返回200，未知错误返回500
+func HTTPStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrInvalidMessage), errors.Is(err, ErrInvalidMessageType), errors.Is(err, ErrInvalidArgument):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrIdempotencyConflict), errors.Is(err, ErrModerated):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrShuttingDown), errors.Is(err, ErrOverloaded), errors.Is(err, breaker.ErrOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrLLM), errors.Is(err, ErrTTS):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,70 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"LingChat/internal/breaker"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "无错误", err: nil, want: http.StatusOK},
+		{name: "消息格式错误", err: fmt.Errorf("%w: unexpected EOF", ErrInvalidMessage), want: http.StatusBadRequest},
+		{name: "消息类型错误", err: fmt.Errorf("%w: \"foo\"", ErrInvalidMessageType), want: http.StatusBadRequest},
+		{name: "参数不合法", err: fmt.Errorf("%w: speed", ErrInvalidArgument), want: http.StatusBadRequest},
+		{name: "无权访问", err: fmt.Errorf("%w: session 3", ErrForbidden), want: http.StatusForbidden},
+		{name: "LLM失败", err: fmt.Errorf("%w: connection refused", ErrLLM), want: http.StatusBadGateway},
+		{name: "语音合成失败", err: ErrTTS, want: http.StatusBadGateway},
+		{name: "幂等键冲突", err: ErrIdempotencyConflict, want: http.StatusUnprocessableEntity},
+		{name: "未通过内容审核", err: fmt.Errorf("%w: hate", ErrModerated), want: http.StatusUnprocessableEntity},
+		{name: "服务关闭中", err: ErrShuttingDown, want: http.StatusServiceUnavailable},
+		{name: "排队已满", err: ErrOverloaded, want: http.StatusServiceUnavailable},
+		{name: "熔断中", err: fmt.Errorf("%w: %w", ErrLLM, breaker.ErrOpen), want: http.StatusServiceUnavailable},
+		{name: "LLM超时", err: fmt.Errorf("%w: %w", ErrLLM, context.DeadlineExceeded), want: http.StatusGatewayTimeout},
+		{name: "未知错误", err: errors.New("boom"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTTPStatus(tt.err); got != tt.want {
+				t.Errorf("HTTPStatus(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "无错误", err: nil, want: ""},
+		{name: "消息格式错误", err: ErrEmptyMessage, want: CodeInvalidMessage},
+		{name: "消息类型错误", err: fmt.Errorf("%w: \"foo\"", ErrInvalidMessageType), want: CodeInvalidMessageType},
+		{name: "参数不合法", err: fmt.Errorf("%w: speed", ErrInvalidArgument), want: CodeInvalidArgument},
+		{name: "无权访问", err: fmt.Errorf("%w: session 3", ErrForbidden), want: CodeForbidden},
+		{name: "幂等键冲突", err: ErrIdempotencyConflict, want: CodeConflict},
+		{name: "未通过内容审核", err: fmt.Errorf("%w: hate", ErrModerated), want: CodeModerated},
+		{name: "排队已满", err: ErrOverloaded, want: CodeUnavailable},
+		{name: "熔断中", err: fmt.Errorf("%w: %w", ErrLLM, breaker.ErrOpen), want: CodeUnavailable},
+		{name: "LLM超时", err: fmt.Errorf("%w: %w", ErrLLM, context.DeadlineExceeded), want: CodeTimeout},
+		{name: "LLM失败", err: fmt.Errorf("%w: connection refused", ErrLLM), want: CodeLLM},
+		{name: "语音合成失败", err: ErrTTS, want: CodeTTS},
+		{name: "未知错误", err: errors.New("boom"), want: CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Code(tt.err); got != tt.want {
+				t.Errorf("Code(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(old)
+
+	ctx := WithRequestID(context.Background(), "abc123")
+	if got := RequestID(ctx); got != "abc123" {
+		t.Errorf("RequestID() = %q, want abc123", got)
+	}
+	if got := RequestID(EnsureRequestID(ctx)); got != "abc123" {
+		t.Errorf("EnsureRequestID() replaced id with %q", got)
+	}
+
+	FromContext(ctx).Info("hello")
+	if !strings.Contains(buf.String(), "request_id=abc123") {
+		t.Errorf("log line %q missing request_id", buf.String())
+	}
+}
+
+func TestEnsureRequestID(t *testing.T) {
+	ctx := EnsureRequestID(context.Background())
+	if len(RequestID(ctx)) != 16 {
+		t.Errorf("RequestID() = %q, want 16 hex chars", RequestID(ctx))
+	}
+}
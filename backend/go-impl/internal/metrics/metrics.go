@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 指标中的status取值
+const (
+	StatusSuccess   = "success"
+	StatusFailure   = "failure"
+	StatusTruncated = "truncated"
+	StatusModerated = "moderated"
+)
+
+// 下游服务名称，用于DownstreamErrors的downstream标签
+const (
+	DownstreamLLM     = "llm"
+	DownstreamVITS    = "vits"
+	DownstreamEmotion = "emotion"
+)
+
+// 缓存指标中的result取值
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+var (
+	// ChatRequests 聊天请求数
+	ChatRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lingchat",
+		Name:      "chat_requests_total",
+		Help:      "Number of chat turns by status.",
+	}, []string{"status"})
+
+	// DownstreamErrors 下游服务调用失败次数
+	DownstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lingchat",
+		Name:      "downstream_errors_total",
+		Help:      "Number of failed calls to downstream services.",
+	}, []string{"downstream"})
+
+	// LLMDuration LLM回复耗时
+	LLMDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "lingchat",
+		Name:      "llm_duration_seconds",
+		Help:      "Time spent waiting for the LLM reply.",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+	}, []string{"status"})
+
+	// TTSDuration 单个分段的语音合成耗时
+	TTSDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "lingchat",
+		Name:      "tts_segment_duration_seconds",
+		Help:      "Time spent generating voice for one segment.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"status"})
+
+	// TTSEmptyAudio VITS返回成功但音频为空的次数，持续增长说明VITS服务异常
+	TTSEmptyAudio = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "lingchat",
+		Name:      "tts_empty_audio_total",
+		Help:      "Number of TTS calls that succeeded with zero-length audio.",
+	})
+
+	// TTSCacheLookups VITS音频缓存的查询次数，result为hit或miss
+	TTSCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lingchat",
+		Name:      "tts_cache_lookups_total",
+		Help:      "Number of TTS audio cache lookups by result.",
+	}, []string{"result"})
+
+	// EmotionDuration 单次情绪预测耗时
+	EmotionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "lingchat",
+		Name:      "emotion_prediction_duration_seconds",
+		Help:      "Time spent predicting the emotion of one segment.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"emotion", "status"})
+
+	// EmotionBatchDuration 一次批量情绪预测请求的耗时，每次请求只记录一次，与分段数无关
+	EmotionBatchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "lingchat",
+		Name:      "emotion_batch_prediction_duration_seconds",
+		Help:      "Time spent on one batch emotion prediction request.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"status"})
+
+	// EmotionBatchLabels 批量情绪预测得到的各标签数
+	EmotionBatchLabels = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lingchat",
+		Name:      "emotion_batch_predictions_total",
+		Help:      "Number of labels returned by batch emotion predictions.",
+	}, []string{"emotion"})
+
+	// EmotionCacheLookups 情绪预测缓存的查询次数，result为hit或miss
+	EmotionCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lingchat",
+		Name:      "emotion_cache_lookups_total",
+		Help:      "Number of emotion prediction cache lookups by result.",
+	}, []string{"result"})
+
+	// ChatQueueDepth 排队等待处理的对话数
+	ChatQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "lingchat",
+		Name:      "chat_queue_depth",
+		Help:      "Number of chat turns waiting for a free slot.",
+	})
+
+	// ChatInFlight 正在处理的对话数，只在开启排队时统计
+	ChatInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "lingchat",
+		Name:      "chat_in_flight",
+		Help:      "Number of chat turns being processed.",
+	})
+)
+
+// Status 根据err返回status标签
+func Status(err error) string {
+	if err != nil {
+		return StatusFailure
+	}
+	return StatusSuccess
+}
+
+// ObserveLLM 记录一次LLM调用
+func ObserveLLM(start time.Time, err error) {
+	LLMDuration.WithLabelValues(Status(err)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		DownstreamErrors.WithLabelValues(DownstreamLLM).Inc()
+	}
+}
+
+// ObserveTTS 记录一个分段的语音合成
+func ObserveTTS(start time.Time, err error) {
+	TTSDuration.WithLabelValues(Status(err)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		DownstreamErrors.WithLabelValues(DownstreamVITS).Inc()
+	}
+}
+
+// ObserveEmotion 记录一次情绪预测，emotion为预测出的标签
+func ObserveEmotion(start time.Time, emotion string, err error) {
+	EmotionDuration.WithLabelValues(emotion, Status(err)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		DownstreamErrors.WithLabelValues(DownstreamEmotion).Inc()
+	}
+}
+
+// ObserveEmotionBatch 记录一次批量情绪预测，emotions为预测出的各标签，失败时为空
+func ObserveEmotionBatch(start time.Time, emotions []string, err error) {
+	EmotionBatchDuration.WithLabelValues(Status(err)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		DownstreamErrors.WithLabelValues(DownstreamEmotion).Inc()
+		return
+	}
+	for _, emotion := range emotions {
+		EmotionBatchLabels.WithLabelValues(emotion).Inc()
+	}
+}
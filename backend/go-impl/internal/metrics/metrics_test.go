@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestObserveEmotion(t *testing.T) {
+	before := testutil.ToFloat64(DownstreamErrors.WithLabelValues(DownstreamEmotion))
+
+	ObserveEmotion(time.Now(), "开心", nil)
+	ObserveEmotion(time.Now(), "unknown", errors.New("boom"))
+
+	if got := testutil.ToFloat64(DownstreamErrors.WithLabelValues(DownstreamEmotion)) - before; got != 1 {
+		t.Errorf("downstream errors += %v, want 1", got)
+	}
+	if n := testutil.CollectAndCount(EmotionDuration); n < 2 {
+		t.Errorf("emotion duration series = %d, want >= 2", n)
+	}
+}
+
+func TestObserveEmotionBatch(t *testing.T) {
+	errorsBefore := testutil.ToFloat64(DownstreamErrors.WithLabelValues(DownstreamEmotion))
+	happyBefore := testutil.ToFloat64(EmotionBatchLabels.WithLabelValues("开心"))
+	samples := func() uint64 {
+		return histogramCount(t, EmotionBatchDuration.WithLabelValues(StatusSuccess).(prometheus.Histogram))
+	}
+	samplesBefore := samples()
+
+	ObserveEmotionBatch(time.Now(), []string{"开心", "难过", "开心"}, nil)
+	ObserveEmotionBatch(time.Now(), nil, errors.New("boom"))
+
+	// 一次批量请求只记录一个耗时样本
+	if got := samples() - samplesBefore; got != 1 {
+		t.Errorf("batch duration samples += %d, want 1", got)
+	}
+	if got := testutil.ToFloat64(EmotionBatchLabels.WithLabelValues("开心")) - happyBefore; got != 2 {
+		t.Errorf("batch labels 开心 += %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(DownstreamErrors.WithLabelValues(DownstreamEmotion)) - errorsBefore; got != 1 {
+		t.Errorf("downstream errors += %v, want 1", got)
+	}
+}
+
+func histogramCount(t *testing.T, h prometheus.Histogram) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"LingChat/internal/storage"
+)
+
+// AudioURLPrefix 语音保存在内存中时取音频的接口地址前缀
+const AudioURLPrefix = "/api/v1/audio/"
+
+// TakeAudio 按token取出内存中的语音，取出后即删除，返回音频和Content-Type。
+// 未使用内存存储，或token不存在、已被取过、已过期时返回storage.ErrNotFound
+func (l *LingChatService) TakeAudio(token string) ([]byte, string, error) {
+	memory, ok := l.storage().(*storage.Memory)
+	if !ok {
+		return nil, "", storage.ErrNotFound
+	}
+	return memory.Take(token)
+}
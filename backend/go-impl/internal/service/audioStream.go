@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"LingChat/api"
+	"LingChat/internal/clients/VitsTTS"
+	"LingChat/internal/logging"
+	"LingChat/internal/metrics"
+	"LingChat/internal/tracing"
+)
+
+type audioChunkKey struct{}
+
+// WithAudioChunks 开启StreamAudio时，分段语音边合成边以audio_chunk事件（见api.ResponseTypeAudioChunk）交给report，
+// ctx中没有report时整段合成。report在持有锁时调用，不会并发执行
+func WithAudioChunks(ctx context.Context, report func(api.Response)) context.Context {
+	return context.WithValue(ctx, audioChunkKey{}, &progressReporter{report: report})
+}
+
+// segmentAudio 合成第idx个分段的语音。能流式合成时同时推送语音块，返回的仍是完整的语音；
+// 一块都没有推送就失败时（如VITS服务不支持流式）退回整段合成
+func (l *LingChatService) segmentAudio(ctx context.Context, idx int, text string, voice VitsTTS.Voice) ([]byte, error) {
+	reporter, ok := ctx.Value(audioChunkKey{}).(*progressReporter)
+	provider, streamable := l.ttsProvider().(VitsTTS.StreamProvider)
+	// 流式接口不能调整音调和采样率，也不接受SSML
+	pitched := voice.Pitch != 0 && voice.Pitch != 1
+	if !l.StreamAudio || !ok || !streamable || voice.SSML || pitched || voice.SampleRate != 0 || l.streamUnsupported.Load() {
+		return l.voiceVITS(ctx, text, voice)
+	}
+
+	data, sent, err := l.streamVITS(ctx, provider, idx, text, voice, reporter)
+	if err == nil || sent > 0 || ctx.Err() != nil {
+		return data, err
+	}
+	var statusErr *VitsTTS.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode < 500 {
+		l.streamUnsupported.Store(true)
+		logging.FromContext(ctx).Warn("VITS服务不支持流式合成，之后都整段合成", "status", statusErr.StatusCode)
+	} else {
+		logging.FromContext(ctx).Warn("流式合成失败，改为整段合成", "segment", idx, "err", err)
+	}
+	return l.voiceVITS(ctx, text, voice)
+}
+
+// streamVITS 流式合成语音，每收到一块就推送并累积，返回完整的语音和已推送的块数
+func (l *LingChatService) streamVITS(ctx context.Context, provider VitsTTS.StreamProvider, idx int, text string, voice VitsTTS.Voice, reporter *progressReporter) ([]byte, int, error) {
+	ctx, span := tracing.Start(ctx, "tts.stream",
+		attribute.Int("text_length", utf8.RuneCountInString(text)),
+		attribute.Int("speaker_id", voice.SpeakerID),
+	)
+	start := time.Now()
+	format := l.audioFormat()
+	var data []byte
+	sent := 0
+	err := l.TTSBreaker.Do(func() error {
+		chunks, err := provider.VoiceVITSChunks(ctx, text, voice)
+		if err != nil {
+			return err
+		}
+		for chunk := range chunks {
+			if chunk.Err != nil {
+				return chunk.Err
+			}
+			data = append(data, chunk.Data...)
+			reporter.send(ctx, api.Response{
+				Type:        api.ResponseTypeAudioChunk,
+				PartIndex:   idx,
+				ChunkIndex:  chunk.Seq,
+				AudioData:   base64.StdEncoding.EncodeToString(chunk.Data),
+				AudioFormat: format,
+				RequestID:   logging.RequestID(ctx),
+			})
+			sent++
+		}
+		// ctx结束时channel提前关闭，此时语音不完整
+		return ctx.Err()
+	})
+	err = emptyAudio(data, err)
+	metrics.ObserveTTS(start, err)
+	tracing.End(span, err)
+	return data, sent, err
+}
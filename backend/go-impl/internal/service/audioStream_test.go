@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"LingChat/api"
+)
+
+// streamingVITS 流式请求时把text逐字节刷新发出，supported为false时拒绝流式请求
+func streamingVITS(supported bool, streamed *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		text := r.URL.Query().Get("text")
+		if r.URL.Query().Get("streaming") != "true" {
+			w.Write([]byte(text))
+			return
+		}
+		streamed.Add(1)
+		if !supported {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for i := range len(text) {
+			w.Write([]byte{text[i]})
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func Test_ChatHandlerStreamAudioChunks(t *testing.T) {
+	tests := []struct {
+		name      string
+		supported bool
+		wantChunk bool
+	}{
+		{name: "流式合成", supported: true, wantChunk: true},
+		{name: "不支持流式时整段合成", supported: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var streamed atomic.Int32
+			l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>",
+				streamingVITS(tt.supported, &streamed),
+				emotionHandler("开心"),
+			)
+			l.StreamAudio = true
+			l.InlineAudio = true
+			l.VitsTTSClient.StreamChunkSize = 4
+
+			for turn := range 2 {
+				var mu sync.Mutex
+				var received []api.Response
+				err := l.ChatHandlerStream(context.Background(), []byte(`{"type":"message","content":"你好"}`), func(msg []byte) error {
+					var resp api.Response
+					if err := json.Unmarshal(msg, &resp); err != nil {
+						t.Error(err)
+					}
+					mu.Lock()
+					received = append(received, resp)
+					mu.Unlock()
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				chunks := make(map[int][]byte)
+				counts := make(map[int]int)
+				replies := 0
+				for _, resp := range received {
+					data, err := base64.StdEncoding.DecodeString(resp.AudioData)
+					if err != nil {
+						t.Fatal(err)
+					}
+					switch resp.Type {
+					case api.ResponseTypeAudioChunk:
+						// 同一分段的语音块按顺序到达，且都在该分段的reply之前
+						if resp.ChunkIndex != counts[resp.PartIndex] {
+							t.Errorf("part %d chunk index = %d, want %d", resp.PartIndex, resp.ChunkIndex, counts[resp.PartIndex])
+						}
+						if len(data) > 4 {
+							t.Errorf("chunk size = %d, want <= 4", len(data))
+						}
+						counts[resp.PartIndex]++
+						chunks[resp.PartIndex] = append(chunks[resp.PartIndex], data...)
+					case "reply":
+						replies++
+						if tt.wantChunk && string(chunks[resp.PartIndex]) != string(data) {
+							t.Errorf("part %d chunks = %q, want %q", resp.PartIndex, chunks[resp.PartIndex], data)
+						}
+						if string(data) == "" {
+							t.Errorf("part %d reply has no audio", resp.PartIndex)
+						}
+					}
+				}
+				if replies != 2 {
+					t.Errorf("turn %d: replies = %d, want 2", turn, replies)
+				}
+				if got := len(chunks) != 0; got != tt.wantChunk {
+					t.Errorf("turn %d: received chunks = %v, want %v", turn, got, tt.wantChunk)
+				}
+			}
+			// 两轮各两个分段；VITS服务拒绝过流式请求后不再尝试，最多是第一轮并发的两个分段
+			got := streamed.Load()
+			if tt.supported && got != 4 {
+				t.Errorf("streaming requests = %d, want 4", got)
+			}
+			if !tt.supported && (got < 1 || got > 2) {
+				t.Errorf("streaming requests = %d, want 1 or 2", got)
+			}
+		})
+	}
+}
+
+func Test_LingChatStreamAudioNotRequested(t *testing.T) {
+	var streamed atomic.Int32
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		streamingVITS(true, &streamed),
+		emotionHandler("开心"),
+	)
+	l.StreamAudio = true
+
+	// 调用方没有接收语音块（如HTTP接口）时整段合成
+	if _, err := l.LingChatStream(context.Background(), "你好", "", "", func(api.Response) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if got := streamed.Load(); got != 0 {
+		t.Errorf("streaming requests = %d, want 0", got)
+	}
+}
@@ -2,9 +2,12 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 
@@ -12,6 +15,7 @@ import (
 	"LingChat/internal/data"
 	"LingChat/internal/data/ent/ent"
 	"LingChat/internal/data/ent/ent/conversationmessage"
+	"LingChat/internal/errs"
 )
 
 // ConversationService 处理与对话相关的业务逻辑
@@ -34,11 +38,33 @@ func NewConversationService(
 	}
 }
 
-// RecordConversationAndMessage 处理会话和消息存储逻辑
-func (s *ConversationService) RecordConversationAndMessage(ctx context.Context, message string, conversationID, prevMessageID string) (*ent.Conversation, *ent.ConversationMessage, error) {
-	var userMsgObj *ent.ConversationMessage
-	var conv *ent.Conversation
+// Turn 一轮对话：用户消息Message接在Parent之后，Reply为助手回复（LLM的原始输出）。
+// 用户消息和回复在SaveTurn中一起保存，保存前UserMessage和ReplyMessage为nil。
+// 新对话也在SaveTurn中创建，保存前Conversation的ID为0、Parent为nil
+type Turn struct {
+	Conversation *ent.Conversation
+	Parent       *ent.ConversationMessage
+	Message      string
+	Reply        string
 
+	UserMessage  *ent.ConversationMessage
+	ReplyMessage *ent.ConversationMessage
+
+	// head 新对话开头的消息，与本轮一起保存；对话已存在时为nil
+	head []data.MessageInput
+}
+
+// parentID Parent的ID，新对话为0
+func (t *Turn) parentID() int64 {
+	if t.Parent == nil {
+		return 0
+	}
+	return t.Parent.ID
+}
+
+// PrepareTurn 确定用户消息所在的对话和接在哪条消息之后，此时还不保存用户消息。
+// 两个ID都为空时开始只有系统提示词的新对话，对话在SaveTurn中才创建；只有对话ID时接在对话的最新消息之后；有前一条消息ID时接在它之后，无视对话ID
+func (s *ConversationService) PrepareTurn(ctx context.Context, message string, conversationID, prevMessageID string) (*Turn, error) {
 	user := common.GetUserFromContext(ctx)
 	if user == nil {
 		user = &ent.User{}
@@ -50,101 +76,89 @@ func (s *ConversationService) RecordConversationAndMessage(ctx context.Context,
 		title = title[:20] + "..."
 	}
 
-	// 将会话存储到数据库中
+	turn := &Turn{Message: message}
 	switch {
 	case conversationID == "" && prevMessageID == "":
-		// 两者都为空，创建新的对话和消息
-		var userMsgObjs []*ent.ConversationMessage
-		var err error
-		conv, userMsgObjs, err = s.conversationRepo.CreateConversationWithMessages(
-			ctx,
-			title, // 使用用户消息的前20个字符作为标题
-			user.ID,
-			data.MessageInput{
-				Role:    string(conversationmessage.RoleSystem),
-				Content: data.SystemPrompt,
-			},
-			data.MessageInput{
-				Role:    string(conversationmessage.RoleUser),
-				Content: message,
-			},
-		)
-		if err != nil {
-			return nil, nil, fmt.Errorf("创建对话失败: %w", err)
-		}
-		userMsgObj = userMsgObjs[len(userMsgObjs)-1]
+		// 两者都为空，开始新的对话，使用用户消息的前20个字符作为标题。
+		// 对话与本轮一起保存，本轮失败时不留下空对话
+		turn.Conversation = &ent.Conversation{Title: title, UserID: user.ID}
+		turn.head = []data.MessageInput{{
+			Role:    string(conversationmessage.RoleSystem),
+			Content: data.SystemPrompt,
+		}}
 
 	case conversationID != "" && prevMessageID == "":
 		// 有对话ID但没有前一条消息ID，在对话末尾添加
 		convID, err := strconv.ParseInt(conversationID, 10, 64)
 		if err != nil {
-			return nil, nil, fmt.Errorf("无效的对话ID: %w", err)
+			return nil, fmt.Errorf("无效的对话ID: %w", err)
 		}
 
 		// 获取对话
-		var getErr error
-		conv, getErr = s.conversationRepo.GetConversation(ctx, convID)
-		if getErr != nil {
-			return nil, nil, fmt.Errorf("获取对话失败: %w", getErr)
+		conv, err := s.conversationRepo.GetConversation(ctx, convID)
+		if err != nil {
+			return nil, fmt.Errorf("获取对话失败: %w", err)
 		}
 
 		// 检查权限：会话所属用户必须与当前用户一致，或者会话所属用户ID为0（表示可以被所有人使用）
 		if conv.UserID != 0 && conv.UserID != user.ID {
-			return nil, nil, fmt.Errorf("无权访问此对话")
+			return nil, fmt.Errorf("无权访问此对话")
+		}
+		if conv.LatestMessageID == nil {
+			return nil, fmt.Errorf("添加消息到对话失败: 对话还没有消息")
 		}
 
-		userMsgObj, err = s.conversationRepo.AppendMessageToConversation(
-			ctx,
-			convID,
-			string(conversationmessage.RoleUser),
-			message,
-			"",
-		)
+		latest, err := s.conversationRepo.GetMessage(ctx, *conv.LatestMessageID)
 		if err != nil {
-			return nil, nil, fmt.Errorf("添加消息到对话失败: %w", err)
+			return nil, fmt.Errorf("获取对话的最新消息失败: %w", err)
 		}
+		turn.Conversation, turn.Parent = conv, latest
 
 	default:
 		// 有前一条消息ID，直接在其后追加，无视是否传入对话ID
 		prevMsgID, err := strconv.ParseInt(prevMessageID, 10, 64)
 		if err != nil {
-			return nil, nil, fmt.Errorf("无效的消息ID: %w", err)
+			return nil, fmt.Errorf("无效的消息ID: %w", err)
 		}
 
 		// 获取消息
-		prevMsg, getErr := s.conversationRepo.GetMessage(ctx, prevMsgID)
-		if getErr != nil {
-			return nil, nil, fmt.Errorf("获取前一条消息失败: %w", getErr)
+		prevMsg, err := s.conversationRepo.GetMessage(ctx, prevMsgID)
+		if err != nil {
+			return nil, fmt.Errorf("获取前一条消息失败: %w", err)
 		}
 
 		// 获取对话
-		conv, getErr = s.conversationRepo.GetConversation(ctx, prevMsg.ConversationID)
-		if getErr != nil {
-			return nil, nil, fmt.Errorf("获取对话失败: %w", getErr)
+		conv, err := s.conversationRepo.GetConversation(ctx, prevMsg.ConversationID)
+		if err != nil {
+			return nil, fmt.Errorf("获取对话失败: %w", err)
 		}
 
 		// 检查权限：会话所属用户必须与当前用户一致，或者会话所属用户ID为0（表示可以被所有人使用）
 		if conv.UserID != 0 && conv.UserID != user.ID {
-			return nil, nil, fmt.Errorf("无权访问此对话")
+			return nil, fmt.Errorf("无权访问此对话")
 		}
+		turn.Conversation, turn.Parent = conv, prevMsg
+	}
 
-		userMsgObj, err = s.conversationRepo.AppendMessage(
-			ctx,
-			prevMsgID,
-			string(conversationmessage.RoleUser),
-			message,
-			"",
-		)
-		if err != nil {
-			return nil, nil, fmt.Errorf("追加消息失败: %w", err)
+	return turn, nil
+}
+
+// TurnContext 获取发给LLM的消息链：Parent及之前的历史，最后是尚未保存的用户消息
+func (s *ConversationService) TurnContext(ctx context.Context, turn *Turn) ([]openai.ChatCompletionMessage, error) {
+	var messages []openai.ChatCompletionMessage
+	if turn.Parent != nil {
+		var err error
+		if messages, err = s.GetChatContext(ctx, turn.Parent.ID); err != nil {
+			return nil, err
 		}
 	}
-
-	if userMsgObj == nil {
-		return nil, nil, errors.New("无法处理聊天历史")
+	for _, m := range turn.head {
+		messages = append(messages, openai.ChatCompletionMessage{Role: m.Role, Content: m.Content})
 	}
-
-	return conv, userMsgObj, nil
+	return append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: turn.Message,
+	}), nil
 }
 
 // GetChatContext 获取消息链
@@ -165,19 +179,139 @@ func (s *ConversationService) GetChatContext(ctx context.Context, messageID int6
 	return messages, nil
 }
 
-// SaveAssistantMessage 将助手回复保存到数据库
-func (s *ConversationService) SaveAssistantMessage(ctx context.Context, prevMessageID int64, content string) (*ent.ConversationMessage, error) {
-	assistantMsg, err := s.conversationRepo.AppendMessage(
-		ctx,
-		prevMessageID,
-		string(conversationmessage.RoleAssistant),
-		content,
-		s.configModel,
-	)
+// limitHistoryTurns 保留开头的系统提示词、最近turns轮历史以及最后一条当前用户消息
+func limitHistoryTurns(messages []openai.ChatCompletionMessage, turns int) []openai.ChatCompletionMessage {
+	if turns <= 0 {
+		return messages
+	}
+
+	head := 0
+	for head < len(messages) && messages[head].Role == openai.ChatMessageRoleSystem {
+		head++
+	}
+
+	keep := turns*2 + 1
+	if len(messages)-head <= keep {
+		return messages
+	}
+
+	limited := make([]openai.ChatCompletionMessage, 0, head+keep)
+	limited = append(limited, messages[:head]...)
+	return append(limited, messages[len(messages)-keep:]...)
+}
+
+// SaveTurn 在一个事务中保存本轮的用户消息和助手回复（turn.Reply），以及results中各分段预测的情绪和出现最多的主情绪，
+// 新对话也在同一事务中创建。失败时整轮都不保存，避免留下空对话或只有用户消息的记录。
+// 成功后设置turn.UserMessage和turn.ReplyMessage，新对话还会设置turn.Conversation的ID
+func (s *ConversationService) SaveTurn(ctx context.Context, turn *Turn, results []Result) error {
+	emotions := make([]data.SegmentEmotion, 0, len(results))
+	for _, result := range results {
+		if result.Predicted == "" {
+			continue
+		}
+		emotions = append(emotions, data.SegmentEmotion{
+			Index:      result.Index,
+			Emotion:    result.Predicted,
+			Confidence: result.Confidence,
+		})
+	}
+	input := data.TurnInput{
+		PrevMessageID:    turn.parentID(),
+		UserContent:      turn.Message,
+		AssistantContent: turn.Reply,
+		Model:            s.configModel,
+		Emotion:          dominantEmotion(results),
+		UserID:           turn.Conversation.UserID,
+		Emotions:         emotions,
+	}
+	if turn.head != nil {
+		input.Conversation = &data.NewConversation{Title: turn.Conversation.Title, UserID: turn.Conversation.UserID, Messages: turn.head}
+	}
+	userMsg, replyMsg, err := s.conversationRepo.SaveTurn(ctx, input)
+	if err != nil {
+		return fmt.Errorf("保存用户消息和回复失败: %w", err)
+	}
+	turn.UserMessage, turn.ReplyMessage = userMsg, replyMsg
+	if turn.head != nil {
+		turn.Conversation.ID, turn.head = userMsg.ConversationID, nil
+	}
+	return nil
+}
+
+// EmotionStats 统计当前用户在[from, to)内各情绪出现的次数
+func (s *ConversationService) EmotionStats(ctx context.Context, from, to time.Time) ([]data.EmotionCount, error) {
+	user := common.GetUserFromContext(ctx)
+	if user == nil {
+		return nil, errors.New("未登录")
+	}
+	return s.conversationRepo.CountEmotions(ctx, user.ID, from, to)
+}
+
+// DeleteHistory 删除当前用户的全部对话和消息，返回删除的消息数；hard为false时软删除
+func (s *ConversationService) DeleteHistory(ctx context.Context, hard bool) (int, error) {
+	user := common.GetUserFromContext(ctx)
+	if user == nil {
+		return 0, errors.New("未登录")
+	}
+	return s.conversationRepo.DeleteUserHistory(ctx, user.ID, hard)
+}
+
+// PurgeHistory 永久删除before之前不再活跃或已软删除的聊天记录，返回删除的消息数
+func (s *ConversationService) PurgeHistory(ctx context.Context, before time.Time) (int, error) {
+	return s.conversationRepo.PurgeHistory(ctx, before)
+}
+
+// GetRecentMessages 获取当前用户早于before的最近limit条消息，before为空时从最新的消息开始。
+// 还有更早的消息时返回下一页的游标，否则游标为空
+func (s *ConversationService) GetRecentMessages(ctx context.Context, limit int, before string) ([]*ent.ConversationMessage, string, error) {
+	user := common.GetUserFromContext(ctx)
+	if user == nil {
+		return nil, "", errors.New("未登录")
+	}
+	var cursor *data.MessageCursor
+	if before != "" {
+		c, err := parseHistoryCursor(before)
+		if err != nil {
+			return nil, "", err
+		}
+		cursor = &c
+	}
+
+	// 多取一条判断是否还有下一页
+	msgs, err := s.conversationRepo.ListRecentUserMessages(ctx, user.ID, limit+1, cursor)
+	if err != nil || len(msgs) <= limit {
+		return msgs, "", err
+	}
+	msgs = msgs[len(msgs)-limit:]
+	return msgs, historyCursor(msgs[0]), nil
+}
+
+// historyCursor 编码msg的位置，客户端只应原样传回
+func historyCursor(msg *ent.ConversationMessage) string {
+	raw := strconv.FormatInt(msg.CreatedAt.UnixNano(), 10) + "_" + strconv.FormatInt(msg.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parseHistoryCursor 解析historyCursor生成的游标
+func parseHistoryCursor(cursor string) (data.MessageCursor, error) {
+	invalid := fmt.Errorf("%w: invalid cursor", errs.ErrInvalidArgument)
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
 	if err != nil {
-		return nil, fmt.Errorf("保存助手回复失败: %w", err)
+		return data.MessageCursor{}, invalid
+	}
+	nanos, id, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return data.MessageCursor{}, invalid
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return data.MessageCursor{}, invalid
+	}
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || i <= 0 {
+		return data.MessageCursor{}, invalid
 	}
-	return assistantMsg, nil
+	return data.MessageCursor{CreatedAt: time.Unix(0, n), ID: i}, nil
 }
 
 // GetChatHistory 获取聊天历史
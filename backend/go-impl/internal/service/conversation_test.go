@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"LingChat/api/routes/common"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/errs"
+)
+
+func TestConversationService_GetRecentMessages(t *testing.T) {
+	repo := newFakeConversationRepo()
+	s := NewConversationService(repo, data.NewLegacyTempChatContext(), "")
+	_, msgs, _ := repo.CreateConversationWithMessages(context.Background(), "", 1,
+		data.MessageInput{Role: "system", Content: "提示词"},
+		data.MessageInput{Role: "user", Content: "1"},
+		data.MessageInput{Role: "assistant", Content: "2"},
+		data.MessageInput{Role: "user", Content: "3"},
+		data.MessageInput{Role: "assistant", Content: "4"},
+		data.MessageInput{Role: "user", Content: "5"},
+	)
+	repo.CreateConversationWithMessages(context.Background(), "", 2, data.MessageInput{Role: "user", Content: "其他用户"})
+	// 同一时刻的消息按id排序，翻页时不重复也不遗漏
+	created := time.Now()
+	for i, msg := range msgs {
+		msg.CreatedAt = created.Add(time.Duration(i/3) * time.Second)
+	}
+	ctx := context.WithValue(context.Background(), common.CurrentUserInfoKey, &ent.User{ID: 1})
+
+	var pages [][]string
+	cursor := ""
+	for range 5 {
+		page, next, err := s.GetRecentMessages(ctx, 2, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var contents []string
+		for _, msg := range page {
+			contents = append(contents, msg.Content)
+		}
+		pages = append(pages, contents)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	want := [][]string{{"4", "5"}, {"2", "3"}, {"1"}}
+	if !slices.EqualFunc(pages, want, slices.Equal) {
+		t.Errorf("pages = %v, want %v", pages, want)
+	}
+
+	// 恰好取完时没有下一页
+	if _, next, _ := s.GetRecentMessages(ctx, 5, ""); next != "" {
+		t.Errorf("next cursor = %q, want empty when all messages fit", next)
+	}
+	if _, _, err := s.GetRecentMessages(ctx, 2, "not a cursor"); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Errorf("invalid cursor error = %v, want ErrInvalidArgument", err)
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"LingChat/internal/clients/emotionPredictor"
+	"LingChat/internal/metrics"
+)
+
+// 情绪预测缓存的默认参数
+const (
+	// DefaultEmotionCacheSize 缓存的(标签, 阈值)组合数
+	DefaultEmotionCacheSize = 256
+	// DefaultEmotionCacheTTL 缓存的预测结果保留时长，过期后重新请求，重新训练的模型最迟在这之后生效
+	DefaultEmotionCacheTTL = 10 * time.Minute
+)
+
+// EmotionCache 按(情绪标签, 置信度阈值)缓存情绪预测服务的原始结果，跨请求复用常见标签的预测。
+// 超过Size条时淘汰最久未使用的，超过TTL的条目视为未命中。并发安全，为nil时不缓存
+type EmotionCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[emotionCacheKey]*list.Element
+}
+
+type emotionCacheKey struct {
+	tag       string
+	threshold float64
+}
+
+type emotionCacheEntry struct {
+	key     emotionCacheKey
+	resp    emotionPredictor.PredictionResponse
+	expires time.Time
+}
+
+// NewEmotionCache 最多缓存size条、每条保留ttl的缓存，<=0时分别使用DefaultEmotionCacheSize和DefaultEmotionCacheTTL
+func NewEmotionCache(size int, ttl time.Duration) *EmotionCache {
+	if size <= 0 {
+		size = DefaultEmotionCacheSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultEmotionCacheTTL
+	}
+	return &EmotionCache{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[emotionCacheKey]*list.Element),
+	}
+}
+
+// get 取出now时仍有效的预测结果，过期的条目顺便删除。命中和未命中计入metrics.EmotionCacheLookups
+func (c *EmotionCache) get(tag string, threshold float64, now time.Time) (emotionPredictor.PredictionResponse, bool) {
+	if c == nil {
+		return emotionPredictor.PredictionResponse{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[emotionCacheKey{tag, threshold}]
+	if ok && now.After(elem.Value.(*emotionCacheEntry).expires) {
+		c.remove(elem)
+		ok = false
+	}
+	if !ok {
+		metrics.EmotionCacheLookups.WithLabelValues(metrics.CacheMiss).Inc()
+		return emotionPredictor.PredictionResponse{}, false
+	}
+	metrics.EmotionCacheLookups.WithLabelValues(metrics.CacheHit).Inc()
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*emotionCacheEntry).resp, true
+}
+
+// put 缓存now时得到的预测结果
+func (c *EmotionCache) put(tag string, threshold float64, resp emotionPredictor.PredictionResponse, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := emotionCacheKey{tag, threshold}
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*emotionCacheEntry)
+		entry.resp, entry.expires = resp, now.Add(c.ttl)
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&emotionCacheEntry{key: key, resp: resp, expires: now.Add(c.ttl)})
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *EmotionCache) remove(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*emotionCacheEntry).key)
+}
+
+// Len 缓存中的条目数，包括已过期但还没被访问到的
+func (c *EmotionCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"LingChat/internal/clients/emotionPredictor"
+	"LingChat/internal/metrics"
+)
+
+func Test_EmotionCache(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	type lookup struct {
+		tag       string
+		threshold float64
+		elapsed   time.Duration
+		want      bool
+	}
+	tests := []struct {
+		name    string
+		size    int
+		puts    []string
+		lookups []lookup
+	}{
+		{name: "命中", size: 2, puts: []string{"开心"}, lookups: []lookup{{tag: "开心", threshold: 0.5, want: true}}},
+		{name: "阈值不同不命中", size: 2, puts: []string{"开心"}, lookups: []lookup{{tag: "开心", threshold: 0.3}}},
+		{name: "过期后不命中", size: 2, puts: []string{"开心"}, lookups: []lookup{
+			{tag: "开心", threshold: 0.5, elapsed: time.Minute, want: true},
+			{tag: "开心", threshold: 0.5, elapsed: time.Minute + time.Second},
+		}},
+		{name: "超过容量淘汰最久未使用的", size: 2, puts: []string{"开心", "难过", "开心", "害羞"}, lookups: []lookup{
+			{tag: "开心", threshold: 0.5, want: true},
+			{tag: "难过", threshold: 0.5},
+			{tag: "害羞", threshold: 0.5, want: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewEmotionCache(tt.size, time.Minute)
+			for _, tag := range tt.puts {
+				c.put(tag, 0.5, emotionPredictor.PredictionResponse{Label: tag + "标签", Confidence: 0.9}, start)
+			}
+			for _, l := range tt.lookups {
+				resp, ok := c.get(l.tag, l.threshold, start.Add(l.elapsed))
+				if ok != l.want {
+					t.Fatalf("get(%q, %v) after %s ok = %v, want %v", l.tag, l.threshold, l.elapsed, ok, l.want)
+				}
+				if ok && resp.Label != l.tag+"标签" {
+					t.Errorf("get(%q) label = %q, want %q", l.tag, resp.Label, l.tag+"标签")
+				}
+			}
+		})
+	}
+
+	var nilCache *EmotionCache
+	nilCache.put("开心", 0.5, emotionPredictor.PredictionResponse{Label: "开心"}, start)
+	if _, ok := nilCache.get("开心", 0.5, start); ok {
+		t.Error("nil cache get() ok = true")
+	}
+}
+
+func Test_EmotionCacheConcurrent(t *testing.T) {
+	c := NewEmotionCache(8, time.Minute)
+	now := time.Now()
+	hits := testutil.ToFloat64(metrics.EmotionCacheLookups.WithLabelValues(metrics.CacheHit))
+	misses := testutil.ToFloat64(metrics.EmotionCacheLookups.WithLabelValues(metrics.CacheMiss))
+
+	tags := []string{"开心", "难过", "生气", "害羞"}
+	var wg sync.WaitGroup
+	for i := range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tag := tags[i%len(tags)]
+			if _, ok := c.get(tag, 0.5, now); !ok {
+				c.put(tag, 0.5, emotionPredictor.PredictionResponse{Label: tag}, now)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.Len() != len(tags) {
+		t.Errorf("Len() = %d, want %d", c.Len(), len(tags))
+	}
+	gotHits := testutil.ToFloat64(metrics.EmotionCacheLookups.WithLabelValues(metrics.CacheHit)) - hits
+	gotMisses := testutil.ToFloat64(metrics.EmotionCacheLookups.WithLabelValues(metrics.CacheMiss)) - misses
+	if gotHits+gotMisses != 100 || gotMisses < float64(len(tags)) {
+		t.Errorf("hits = %v, misses = %v, want 100 lookups with at least %d misses", gotHits, gotMisses, len(tags))
+	}
+}
+
+func Test_EmoPredictBatchCache(t *testing.T) {
+	predictor := &fakePredictor{label: "高兴"}
+	l := NewLingChatService(predictor, nil, nil, nil, "", "")
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l.Clock = func() time.Time { return now }
+	l.EmotionCache = NewEmotionCache(16, time.Minute)
+	segments := func() []Result {
+		return []Result{{OriginalTag: "开心"}, {OriginalTag: "难过"}, {OriginalTag: "开心"}}
+	}
+
+	l.EmoPredictBatch(t.Context(), segments())
+	if got := predictor.calls.Load(); got != 2 {
+		t.Fatalf("first batch predictor calls = %d, want 2", got)
+	}
+
+	// 第二次请求的标签都已缓存，不再请求情绪预测服务
+	results := l.EmoPredictBatch(t.Context(), segments())
+	if got := predictor.calls.Load(); got != 2 {
+		t.Errorf("cached batch predictor calls = %d, want 2", got)
+	}
+	for i, result := range results {
+		if result.Predicted != "高兴" || result.Confidence != 0.8 {
+			t.Errorf("results[%d] = %q (%v), want 高兴 (0.8)", i, result.Predicted, result.Confidence)
+		}
+	}
+
+	// 阈值变化后的结果可能不同，不使用原阈值的缓存
+	l.EmotionThreshold = 0.3
+	l.EmoPredictBatch(t.Context(), segments())
+	if got := predictor.calls.Load(); got != 4 {
+		t.Errorf("predictor calls after threshold change = %d, want 4", got)
+	}
+
+	// 过期后重新请求，模型更新后的结果得以生效
+	predictor.label = "悲伤"
+	now = now.Add(2 * time.Minute)
+	results = l.EmoPredictBatch(t.Context(), segments())
+	if got := predictor.calls.Load(); got != 6 {
+		t.Errorf("predictor calls after expiry = %d, want 6", got)
+	}
+	if results[0].Predicted != "悲伤" {
+		t.Errorf("results[0] after expiry = %q, want 悲伤", results[0].Predicted)
+	}
+
+	// 预测失败的结果不缓存
+	predictor.err = errors.New("connection refused")
+	now = now.Add(2 * time.Minute)
+	l.EmoPredictBatch(t.Context(), segments())
+	predictor.err = nil
+	l.EmoPredictBatch(t.Context(), segments())
+	if got := predictor.calls.Load(); got != 10 {
+		t.Errorf("predictor calls after failure = %d, want 10", got)
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"LingChat/internal/logging"
+)
+
+// EmotionLabel 情绪标签。情绪预测模型输出的标签必须与动作映射和前端素材中的情绪一致
+type EmotionLabel string
+
+// LabelSet 已配置的情绪标签集合。预测出集合外的标签时换成Fallback，
+// 避免模型更换标签后动作和前端素材静默失效。为nil时不校验
+type LabelSet struct {
+	labels []EmotionLabel
+	known  map[EmotionLabel]bool
+	// Fallback 未知标签替换成的情绪，总是视为已知
+	Fallback EmotionLabel
+}
+
+// NewLabelSet 由配置的标签列表创建集合，忽略空白项和重复项；fallback为空或labels为空时返回错误
+func NewLabelSet(labels []string, fallback string) (*LabelSet, error) {
+	fallback = strings.TrimSpace(fallback)
+	if fallback == "" {
+		return nil, errors.New("fallback emotion label is empty")
+	}
+	s := &LabelSet{
+		known:    make(map[EmotionLabel]bool, len(labels)+1),
+		Fallback: EmotionLabel(fallback),
+	}
+	for _, label := range labels {
+		label := EmotionLabel(strings.TrimSpace(label))
+		if label == "" || s.known[label] {
+			continue
+		}
+		s.known[label] = true
+		s.labels = append(s.labels, label)
+	}
+	if len(s.labels) == 0 {
+		return nil, errors.New("emotion label set is empty")
+	}
+	s.known[s.Fallback] = true
+	return s, nil
+}
+
+// Labels 按配置顺序返回集合中的标签，不包括未在配置中列出的Fallback
+func (s *LabelSet) Labels() []EmotionLabel {
+	if s == nil {
+		return nil
+	}
+	return slices.Clone(s.labels)
+}
+
+// Known 判断label是否在集合中；s为nil时都视为已知
+func (s *LabelSet) Known(label string) bool {
+	return s == nil || s.known[EmotionLabel(label)]
+}
+
+// Normalize 已知标签原样返回，未知标签返回Fallback，第二个返回值表示label是否已知
+func (s *LabelSet) Normalize(label string) (EmotionLabel, bool) {
+	if s.Known(label) {
+		return EmotionLabel(label), true
+	}
+	return s.Fallback, false
+}
+
+// knownEmotion 把预测出的未知标签换成安全的默认情绪并记录警告。预测失败时的unknown也会被替换，
+// 失败原因已单独记录，不再重复警告
+func (l *LingChatService) knownEmotion(ctx context.Context, tag, label string) string {
+	normalized, ok := l.EmotionLabels.Normalize(label)
+	if !ok && label != unknownEmotion {
+		logging.FromContext(ctx).Warn("情绪预测返回了未配置的标签，使用默认情绪",
+			"tag", tag, "label", label, "fallback", string(normalized))
+	}
+	return string(normalized)
+}
+
+// MissingMotions 返回labels中在动作映射里没有单独配置动作的标签，这些情绪只能播放默认动作
+func (m *MotionMap) MissingMotions(labels *LabelSet) []EmotionLabel {
+	if m == nil || labels == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var missing []EmotionLabel
+	for _, label := range labels.labels {
+		if _, ok := m.motions[string(label)]; !ok {
+			missing = append(missing, label)
+		}
+	}
+	return missing
+}
+
+// CheckMotionCoverage 检查动作映射是否为每个已知情绪标签配置了动作，未配置动作映射或标签集合时不检查
+func (l *LingChatService) CheckMotionCoverage() error {
+	missing := l.MotionMap.MissingMotions(l.EmotionLabels)
+	if len(missing) == 0 {
+		return nil
+	}
+	names := make([]string, len(missing))
+	for i, label := range missing {
+		names[i] = string(label)
+	}
+	return fmt.Errorf("动作映射缺少以下情绪的动作: %s", strings.Join(names, ","))
+}
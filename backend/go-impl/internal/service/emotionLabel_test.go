@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"LingChat/internal/clients/emotionPredictor"
+)
+
+func TestNewLabelSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   []string
+		fallback string
+		want     []EmotionLabel
+		wantErr  bool
+	}{
+		{name: "去掉空白和重复", labels: []string{" 高兴", "生气", "", "高兴"}, fallback: "正常", want: []EmotionLabel{"高兴", "生气"}},
+		{name: "标签为空", labels: []string{" ", ""}, fallback: "正常", wantErr: true},
+		{name: "默认情绪为空", labels: []string{"高兴"}, fallback: " ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewLabelSet(tt.labels, tt.fallback)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLabelSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !slices.Equal(s.Labels(), tt.want) {
+				t.Errorf("Labels() = %v, want %v", s.Labels(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelSet_Normalize(t *testing.T) {
+	s, err := NewLabelSet([]string{"高兴", "生气"}, "正常")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		set       *LabelSet
+		label     string
+		want      EmotionLabel
+		wantKnown bool
+	}{
+		{name: "已知标签", set: s, label: "生气", want: "生气", wantKnown: true},
+		{name: "默认情绪视为已知", set: s, label: "正常", want: "正常", wantKnown: true},
+		{name: "未知标签", set: s, label: "开心", want: "正常", wantKnown: false},
+		{name: "未配置集合时不校验", set: nil, label: "开心", want: "开心", wantKnown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, known := tt.set.Normalize(tt.label)
+			if got != tt.want || known != tt.wantKnown {
+				t.Errorf("Normalize(%q) = %q, %v, want %q, %v", tt.label, got, known, tt.want, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestLingChatService_CheckMotionCoverage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "motions.json")
+	if err := os.WriteFile(path, []byte(`{"default": "idle", "motions": {"高兴": "jump"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	motions, err := LoadMotionMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels, err := NewLabelSet([]string{"高兴", "生气", "哭泣"}, "正常")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &LingChatService{MotionMap: motions, EmotionLabels: labels}
+	err = l.CheckMotionCoverage()
+	if err == nil || !strings.Contains(err.Error(), "生气,哭泣") {
+		t.Errorf("CheckMotionCoverage() error = %v, want missing 生气,哭泣", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"default": "idle", "motions": {"高兴": "jump", "生气": "stomp", "哭泣": "cry"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.ReloadMotions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.CheckMotionCoverage(); err != nil {
+		t.Errorf("CheckMotionCoverage() after reload error = %v", err)
+	}
+
+	// 缺少动作映射或标签集合时不检查
+	for _, l := range []*LingChatService{{EmotionLabels: labels}, {MotionMap: motions}} {
+		if err := l.CheckMotionCoverage(); err != nil {
+			t.Errorf("CheckMotionCoverage() error = %v, want nil", err)
+		}
+	}
+}
+
+func Test_EmoPredictBatchUnknownLabels(t *testing.T) {
+	// 情绪服务把"生气"预测为模型新增的"暴怒"，不在配置的标签集合中
+	predicted := map[string]string{"开心": "高兴", "生气": "暴怒"}
+	tests := []struct {
+		name  string
+		batch bool
+	}{
+		{name: "逐个预测", batch: false},
+		{name: "批量预测", batch: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestService(t, "", func(w http.ResponseWriter, r *http.Request) {}, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if strings.HasSuffix(r.URL.Path, "/predict_batch") {
+					fmt.Fprintf(w, `{"results":[{"label":%q,"confidence":0.9},{"label":%q,"confidence":0.8}]}`, predicted["开心"], predicted["生气"])
+					return
+				}
+				var body struct {
+					Text string `json:"text"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Error(err)
+				}
+				fmt.Fprintf(w, `{"label":%q,"confidence":0.9}`, predicted[body.Text])
+			})
+			l.emotionPredictorClient.(*emotionPredictor.Client).Batch = tt.batch
+			labels, err := NewLabelSet([]string{"高兴", "生气"}, "正常")
+			if err != nil {
+				t.Fatal(err)
+			}
+			l.EmotionLabels = labels
+
+			results := l.EmoPredictBatch(context.Background(), []Result{{OriginalTag: "开心"}, {OriginalTag: "生气"}})
+			if results[0].Predicted != "高兴" || results[1].Predicted != "正常" {
+				t.Errorf("Predicted = %q, %q, want 高兴, 正常", results[0].Predicted, results[1].Predicted)
+			}
+		})
+	}
+}
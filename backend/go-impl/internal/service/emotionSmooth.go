@@ -0,0 +1,67 @@
+package service
+
+// 情绪平滑的默认参数
+const (
+	// DefaultSmoothingThreshold 置信度低于该值的预测视为不可靠
+	DefaultSmoothingThreshold = 0.5
+	// DefaultSmoothingWindow 连续不可靠的分段最多沿用前一情绪的个数
+	DefaultSmoothingWindow = 2
+)
+
+// EmotionSmoother 平滑一条回复中相邻分段的情绪，避免低置信度的预测让动作来回跳变。
+// 置信度不低于Threshold的预测总是采用并成为当前情绪；低于Threshold且与当前情绪不同的预测改用当前情绪，
+// 连续超过Window个分段都不可靠时才接受新情绪（迟滞）。没有情绪标签的分段不参与平滑。为nil时不平滑
+type EmotionSmoother struct {
+	Threshold float64
+	// Window <=0表示不可靠的预测永远沿用当前情绪
+	Window int
+}
+
+// NewEmotionSmoother 使用默认阈值和窗口
+func NewEmotionSmoother() *EmotionSmoother {
+	return &EmotionSmoother{
+		Threshold: DefaultSmoothingThreshold,
+		Window:    DefaultSmoothingWindow,
+	}
+}
+
+// Smooth 按PartIndex顺序就地平滑results并返回
+func (s *EmotionSmoother) Smooth(results []Result) []Result {
+	state := s.start()
+	for i := range results {
+		state.apply(&results[i])
+	}
+	return results
+}
+
+// start 开始平滑一条回复，流式回复可以按顺序逐段调用apply
+func (s *EmotionSmoother) start() *smoothingState {
+	return &smoothingState{smoother: s}
+}
+
+// smoothingState 一条回复的平滑进度
+type smoothingState struct {
+	smoother *EmotionSmoother
+	current  string
+	// held 当前情绪已连续替换的不可靠预测数
+	held int
+}
+
+// apply 平滑下一个分段，被替换的分段保留原来的置信度
+func (st *smoothingState) apply(result *Result) {
+	s := st.smoother
+	if s == nil || result.OriginalTag == "" {
+		return
+	}
+	if st.current == "" || result.Confidence >= s.Threshold || result.Predicted == st.current {
+		st.current, st.held = result.Predicted, 0
+		return
+	}
+	if s.Window > 0 && st.held >= s.Window {
+		// 持续不可靠地偏向另一种情绪，接受变化
+		st.current, st.held = result.Predicted, 0
+		return
+	}
+	result.Predicted = st.current
+	st.held++
+}
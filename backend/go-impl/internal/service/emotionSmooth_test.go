@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"LingChat/internal/clients/emotionPredictor"
+)
+
+// segmentsOf 由"情绪:置信度"序列构造预测结果
+func segmentsOf(predictions ...string) []Result {
+	results := make([]Result, 0, len(predictions))
+	for _, p := range predictions {
+		var r Result
+		label, confidence, _ := strings.Cut(p, ":")
+		r.OriginalTag, r.Predicted = label, label
+		r.Confidence, _ = strconv.ParseFloat(confidence, 64)
+		results = append(results, r)
+	}
+	return results
+}
+
+func TestEmotionSmoother_Smooth(t *testing.T) {
+	tests := []struct {
+		name     string
+		smoother *EmotionSmoother
+		results  []Result
+		want     []string
+	}{
+		{
+			name:     "低置信度的跳变被抹平",
+			smoother: &EmotionSmoother{Threshold: 0.5, Window: 2},
+			results:  segmentsOf("高兴:0.9", "生气:0.2", "高兴:0.4", "难过:0.3", "高兴:0.8"),
+			want:     []string{"高兴", "高兴", "高兴", "高兴", "高兴"},
+		},
+		{
+			name:     "高置信度的变化立即生效",
+			smoother: &EmotionSmoother{Threshold: 0.5, Window: 2},
+			results:  segmentsOf("高兴:0.9", "难过:0.7", "高兴:0.3"),
+			want:     []string{"高兴", "难过", "难过"},
+		},
+		{
+			name:     "超过窗口后接受新情绪",
+			smoother: &EmotionSmoother{Threshold: 0.5, Window: 2},
+			results:  segmentsOf("高兴:0.9", "难过:0.3", "难过:0.3", "难过:0.3", "高兴:0.3"),
+			want:     []string{"高兴", "高兴", "高兴", "难过", "难过"},
+		},
+		{
+			name:     "窗口为0时始终沿用",
+			smoother: &EmotionSmoother{Threshold: 0.5},
+			results:  segmentsOf("高兴:0.9", "难过:0.3", "难过:0.3", "难过:0.3"),
+			want:     []string{"高兴", "高兴", "高兴", "高兴"},
+		},
+		{
+			name:     "开头不可靠时没有可沿用的情绪",
+			smoother: &EmotionSmoother{Threshold: 0.5, Window: 2},
+			results:  segmentsOf("难过:0.1", "高兴:0.2"),
+			want:     []string{"难过", "难过"},
+		},
+		{
+			name:     "没有标签的分段不参与",
+			smoother: &EmotionSmoother{Threshold: 0.5, Window: 1},
+			results:  append(segmentsOf("高兴:0.9"), append([]Result{{Predicted: "正常"}}, segmentsOf("难过:0.2")...)...),
+			want:     []string{"高兴", "正常", "高兴"},
+		},
+		{
+			name:     "未设置时不平滑",
+			smoother: nil,
+			results:  segmentsOf("高兴:0.9", "生气:0.2"),
+			want:     []string{"高兴", "生气"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			confidences := make([]float64, 0, len(tt.results))
+			for _, r := range tt.results {
+				confidences = append(confidences, r.Confidence)
+			}
+			results := tt.smoother.Smooth(tt.results)
+			got := make([]string, 0, len(results))
+			for i, r := range results {
+				got = append(got, r.Predicted)
+				if r.Confidence != confidences[i] {
+					t.Errorf("results[%d].Confidence = %v, want unchanged %v", i, r.Confidence, confidences[i])
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Smooth() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_EmoPredictBatchSmoothing(t *testing.T) {
+	// 情绪服务对每个标签给出噪声很大的预测
+	predictions := map[string]emotionPredictor.PredictionResponse{
+		"开心": {Label: "高兴", Confidence: 0.9},
+		"嗯":  {Label: "生气", Confidence: 0.2},
+		"哈":  {Label: "难过", Confidence: 0.3},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(predictions[req.Text])
+	}))
+	defer server.Close()
+
+	l := NewLingChatService(emotionPredictor.NewClient(server.URL), nil, nil, nil, "", "")
+	l.Smoother = NewEmotionSmoother()
+	results := l.EmoPredictBatch(context.Background(), []Result{
+		{OriginalTag: "开心"},
+		{OriginalTag: "嗯"},
+		{OriginalTag: "哈"},
+	})
+	for i, r := range results {
+		if r.Predicted != "高兴" {
+			t.Errorf("results[%d].Predicted = %s, want 高兴", i, r.Predicted)
+		}
+	}
+}
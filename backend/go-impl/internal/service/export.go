@@ -0,0 +1,178 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/data/ent/ent/conversationmessage"
+	"LingChat/internal/errs"
+)
+
+// 会话导出的格式
+const (
+	// ExportFormatText 便于阅读的纯文本，助手回复只保留显示的正文
+	ExportFormatText = "txt"
+	// ExportFormatJSON 便于程序处理的JSON，助手回复保留LLM的原始输出
+	ExportFormatJSON = "json"
+)
+
+// exportBatchSize 导出时每次从数据库读取的消息数
+const exportBatchSize = 200
+
+// SessionExport 一个会话的导出，WriteTo时才逐批读取消息，不把整段对话读入内存
+type SessionExport struct {
+	Session *ent.Session
+	Format  string
+
+	repo        data.ConversationRepo
+	parseConfig ParseConfig
+}
+
+// ExportSession 检查会话属于当前用户并准备导出，错误与使用会话发送消息时相同；format不支持时返回ErrInvalidArgument
+func (l *LingChatService) ExportSession(ctx context.Context, sessionID, format string) (*SessionExport, error) {
+	if format != ExportFormatText && format != ExportFormatJSON {
+		return nil, fmt.Errorf("%w: 不支持的导出格式 %q", errs.ErrInvalidArgument, format)
+	}
+	session, err := l.ownedSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionExport{
+		Session:     session,
+		Format:      format,
+		repo:        l.conversationService.conversationRepo,
+		parseConfig: l.ParseConfig,
+	}, nil
+}
+
+// ContentType 导出内容的Content-Type
+func (e *SessionExport) ContentType() string {
+	if e.Format == ExportFormatJSON {
+		return "application/json; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Filename 下载时建议的文件名
+func (e *SessionExport) Filename() string {
+	return "session-" + strconv.FormatInt(e.Session.ID, 10) + "." + e.Format
+}
+
+// WriteTo 按时间顺序把会话中的用户消息和助手回复写入w。
+// 写入过程中出错时w中已有部分内容，调用方无法再返回错误响应
+func (e *SessionExport) WriteTo(ctx context.Context, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var err error
+	if e.Format == ExportFormatJSON {
+		err = e.writeJSON(ctx, bw)
+	} else {
+		err = e.writeText(ctx, bw)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// eachMessage 逐批读取会话的消息，对每条消息调用fn
+func (e *SessionExport) eachMessage(ctx context.Context, fn func(*ent.ConversationMessage) error) error {
+	var after *data.MessageCursor
+	for {
+		msgs, err := e.repo.ListConversationMessages(ctx, e.Session.ConversationID, after, exportBatchSize)
+		if err != nil {
+			return fmt.Errorf("读取会话消息失败: %w", err)
+		}
+		for _, msg := range msgs {
+			if err := fn(msg); err != nil {
+				return err
+			}
+		}
+		if len(msgs) < exportBatchSize {
+			return nil
+		}
+		last := msgs[len(msgs)-1]
+		after = &data.MessageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// writeJSON 输出{"session":{...},"messages":[...]}，消息逐条编码
+func (e *SessionExport) writeJSON(ctx context.Context, w *bufio.Writer) error {
+	session, err := json.Marshal(response.SessionResponse{
+		ID:        e.Session.ID,
+		Title:     e.Session.Title,
+		CreatedAt: e.Session.CreatedAt,
+		UpdatedAt: e.Session.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, `{"session":%s,"messages":[`, session)
+	first := true
+	err = e.eachMessage(ctx, func(msg *ent.ConversationMessage) error {
+		item, err := json.Marshal(response.HistoryMessage{
+			ID:             msg.ID,
+			ConversationID: msg.ConversationID,
+			Role:           string(msg.Role),
+			Content:        msg.Content,
+			Emotion:        msg.Emotion,
+			CreatedAt:      msg.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if !first {
+			w.WriteByte(',')
+		}
+		first = false
+		_, err = w.Write(item)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteString("]}\n")
+	return err
+}
+
+// writeText 每条消息一段：[时间] 角色（情绪）：正文
+func (e *SessionExport) writeText(ctx context.Context, w *bufio.Writer) error {
+	fmt.Fprintf(w, "%s\n创建于 %s\n", e.Session.Title, e.Session.CreatedAt.Format(time.DateTime))
+	return e.eachMessage(ctx, func(msg *ent.ConversationMessage) error {
+		speaker, content := "用户", msg.Content
+		if msg.Role == conversationmessage.RoleAssistant {
+			speaker, content = "助手", e.displayText(msg.Content)
+			if msg.Emotion != "" {
+				speaker += "（" + msg.Emotion + "）"
+			}
+		}
+		_, err := fmt.Fprintf(w, "\n[%s] %s：%s\n", msg.CreatedAt.Format(time.DateTime), speaker, content)
+		return err
+	})
+}
+
+// displayText 助手回复中前端显示的部分，去掉情绪标签和日语，动作放在括号中
+func (e *SessionExport) displayText(content string) string {
+	var parts []string
+	for _, segment := range AnalyzeEmotions(content, "", "", "", e.parseConfig) {
+		text := segment.FollowingText
+		if segment.MotionText != "" {
+			text += e.parseConfig.MotionOpen + segment.MotionText + e.parseConfig.MotionClose
+		}
+		if text != "" {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) == 0 {
+		return content
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/data"
+	"LingChat/internal/errs"
+)
+
+func TestLingChatService_ExportSession(t *testing.T) {
+	l, _ := newTestSessionService(t)
+	repo := l.conversationService.conversationRepo.(*fakeConversationRepo)
+	ctx := userContext(1)
+	session, err := l.CreateSession(ctx, "旅行计划")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := strconv.FormatInt(session.ID, 10)
+	user, _ := repo.AppendMessageToConversation(ctx, session.ConversationID, "user", "去哪里玩？", "")
+	reply, _ := repo.AppendMessageToConversation(ctx, session.ConversationID, "assistant", "【开心】去海边吧（挥手）<海に行こう>【害羞】和你一起<一緒に>", "")
+	reply.Emotion = "开心"
+
+	t.Run("文本", func(t *testing.T) {
+		export, err := l.ExportSession(ctx, sessionID, ExportFormatText)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := export.WriteTo(ctx, &buf); err != nil {
+			t.Fatal(err)
+		}
+		got := buf.String()
+		for _, want := range []string{
+			"旅行计划\n",
+			"] 用户：去哪里玩？\n",
+			"] 助手（开心）：去海边吧（挥手）和你一起\n",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("export = %q, want it to contain %q", got, want)
+			}
+		}
+		if strings.Contains(got, data.SystemPrompt) || strings.Contains(got, "海に行こう") {
+			t.Errorf("export = %q, want system prompt and Japanese text left out", got)
+		}
+		if export.Filename() != "session-"+sessionID+".txt" || !strings.HasPrefix(export.ContentType(), "text/plain") {
+			t.Errorf("filename = %s, content type = %s", export.Filename(), export.ContentType())
+		}
+	})
+
+	t.Run("JSON分批读取", func(t *testing.T) {
+		for i := range 2 * exportBatchSize {
+			repo.AppendMessageToConversation(ctx, session.ConversationID, "user", fmt.Sprintf("消息%d", i), "")
+		}
+		repo.listCalls = 0
+		export, err := l.ExportSession(ctx, sessionID, ExportFormatJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := export.WriteTo(ctx, &buf); err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			Session  response.SessionResponse  `json:"session"`
+			Messages []response.HistoryMessage `json:"messages"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("export is not valid JSON: %v", err)
+		}
+		if got.Session.ID != session.ID || len(got.Messages) != 2*exportBatchSize+2 {
+			t.Fatalf("export has session %d and %d messages, want %d and %d", got.Session.ID, len(got.Messages), session.ID, 2*exportBatchSize+2)
+		}
+		if got.Messages[0].ID != user.ID || got.Messages[1].Emotion != "开心" || got.Messages[1].Content != reply.Content {
+			t.Errorf("first messages = %+v, want raw user message and reply with emotion", got.Messages[:2])
+		}
+		if last := got.Messages[len(got.Messages)-1]; last.Content != fmt.Sprintf("消息%d", 2*exportBatchSize-1) {
+			t.Errorf("last message = %q, want messages in order", last.Content)
+		}
+		if repo.listCalls != 3 {
+			t.Errorf("ListConversationMessages calls = %d, want 3 batches", repo.listCalls)
+		}
+	})
+
+	tests := []struct {
+		name      string
+		userID    int64
+		sessionID string
+		format    string
+		wantErr   error
+	}{
+		{name: "其他用户的会话", userID: 2, sessionID: sessionID, format: ExportFormatText, wantErr: errs.ErrForbidden},
+		{name: "会话不存在", userID: 1, sessionID: "999", format: ExportFormatText, wantErr: errs.ErrForbidden},
+		{name: "不支持的格式", userID: 1, sessionID: sessionID, format: "pdf", wantErr: errs.ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := l.ExportSession(userContext(tt.userID), tt.sessionID, tt.format); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExportSession() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,480 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"LingChat/internal/clients/VitsTTS"
+	"LingChat/internal/clients/emotionPredictor"
+	"LingChat/internal/clients/llm"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/data/ent/ent/conversationmessage"
+)
+
+// fakeLLM 返回固定回复，并记录每次请求的消息
+type fakeLLM struct {
+	reply string
+	err   error
+	// delay 大于0时等待delay后才回复，ctx先结束则返回ctx.Err()
+	delay time.Duration
+
+	mu    sync.Mutex
+	calls [][]openai.ChatCompletionMessage
+}
+
+func (f *fakeLLM) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (string, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, messages)
+	f.mu.Unlock()
+	if f.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(f.delay):
+		}
+	}
+	return f.reply, f.err
+}
+
+// fakeStreamLLM 在fakeLLM之外实现llm.Streamer，把reply每两个字符作为一个片段发送；
+// midStreamErr不为nil时发送完reply后以该错误结束，模拟生成中途断开。
+// resume不为nil时发送完包含pause的片段后等待resume关闭，ctx先结束则关闭通道，回复不完整
+type fakeStreamLLM struct {
+	fakeLLM
+	midStreamErr error
+	pause        string
+	resume       chan struct{}
+
+	streams atomic.Int32
+}
+
+func (f *fakeStreamLLM) ChatStream(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (<-chan llm.StreamChunk, error) {
+	f.streams.Add(1)
+	if f.err != nil {
+		return nil, f.err
+	}
+	ch := make(chan llm.StreamChunk)
+	go func() {
+		defer close(ch)
+		send := func(chunk llm.StreamChunk) bool {
+			select {
+			case ch <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		runes := []rune(f.reply)
+		var sent strings.Builder
+		paused := f.resume == nil
+		for i := 0; i < len(runes); i += 2 {
+			token := string(runes[i:min(i+2, len(runes))])
+			if !send(llm.StreamChunk{Content: token}) {
+				return
+			}
+			sent.WriteString(token)
+			if !paused && strings.Contains(sent.String(), f.pause) {
+				paused = true
+				select {
+				case <-f.resume:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+		if f.midStreamErr != nil {
+			send(llm.StreamChunk{Err: f.midStreamErr})
+		}
+	}()
+	return ch, nil
+}
+
+// fakeTTS 每个分段都返回audio，failText中的文本返回err
+type fakeTTS struct {
+	audio    []byte
+	failText string
+	err      error
+
+	calls atomic.Int32
+}
+
+func (f *fakeTTS) VoiceVITS(ctx context.Context, text string, voice VitsTTS.Voice) ([]byte, error) {
+	f.calls.Add(1)
+	if text == f.failText {
+		return nil, f.err
+	}
+	return f.audio, nil
+}
+
+// fakePredictor 每个标签都预测为label，err不为nil时返回err
+type fakePredictor struct {
+	label string
+	err   error
+	// calls Predict的调用次数
+	calls atomic.Int32
+}
+
+func (f *fakePredictor) Predict(ctx context.Context, text string, confidenceThreshold float64) (*emotionPredictor.PredictionResponse, error) {
+	f.calls.Add(1)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &emotionPredictor.PredictionResponse{Label: f.label, Confidence: 0.8}, nil
+}
+
+// fakeConversationRepo 内存中的ConversationRepo，只实现聊天流程用到的方法，
+// 其他方法调用时会因嵌入的nil接口而panic
+type fakeConversationRepo struct {
+	data.ConversationRepo
+
+	mu            sync.Mutex
+	nextID        int64
+	conversations map[int64]*ent.Conversation
+	messages      map[int64]*ent.ConversationMessage
+	prev          map[int64]int64
+	// latest 按对话id记录最新一条消息的id
+	latest map[int64]int64
+	// emotions 按回复消息id记录SaveTurn保存的分段情绪
+	emotions map[int64][]data.SegmentEmotion
+	users    map[int64]int64
+	// purges 记录PurgeHistory的before参数
+	purges []time.Time
+	// deletes 记录DeleteUserHistory的用户id及是否永久删除
+	deletes map[int64]bool
+	// listCalls ListConversationMessages的调用次数
+	listCalls int
+	// saveTurnErr 不为nil时SaveTurn返回该错误，不保存任何消息
+	saveTurnErr error
+}
+
+func newFakeConversationRepo() *fakeConversationRepo {
+	return &fakeConversationRepo{
+		conversations: make(map[int64]*ent.Conversation),
+		messages:      make(map[int64]*ent.ConversationMessage),
+		prev:          make(map[int64]int64),
+		latest:        make(map[int64]int64),
+		emotions:      make(map[int64][]data.SegmentEmotion),
+		users:         make(map[int64]int64),
+		deletes:       make(map[int64]bool),
+	}
+}
+
+func (r *fakeConversationRepo) newMessage(conversationID, prevID int64, role, content string) *ent.ConversationMessage {
+	r.nextID++
+	msg := &ent.ConversationMessage{
+		ID:             r.nextID,
+		ConversationID: conversationID,
+		Role:           conversationmessage.Role(role),
+		Content:        content,
+		CreatedAt:      time.Now(),
+	}
+	r.messages[msg.ID] = msg
+	r.prev[msg.ID] = prevID
+	r.latest[conversationID] = msg.ID
+	if conv, ok := r.conversations[conversationID]; ok {
+		conv.LatestMessageID = &msg.ID
+	}
+	return msg
+}
+
+func (r *fakeConversationRepo) CreateConversationWithMessages(ctx context.Context, title string, userID int64, messages ...data.MessageInput) (*ent.Conversation, []*ent.ConversationMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	conv := &ent.Conversation{ID: r.nextID, Title: title, UserID: userID}
+	r.conversations[conv.ID] = conv
+	msgs := make([]*ent.ConversationMessage, 0, len(messages))
+	var prevID int64
+	for _, m := range messages {
+		msg := r.newMessage(conv.ID, prevID, m.Role, m.Content)
+		msgs = append(msgs, msg)
+		prevID = msg.ID
+	}
+	return conv, msgs, nil
+}
+
+// ListRecentUserMessages 与数据库实现一样按(created_at, id)倒序取limit条，再按正序返回
+func (r *fakeConversationRepo) ListRecentUserMessages(ctx context.Context, userID int64, limit int, before *data.MessageCursor) ([]*ent.ConversationMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var msgs []*ent.ConversationMessage
+	for _, msg := range r.messages {
+		conv := r.conversations[msg.ConversationID]
+		if conv == nil || conv.UserID != userID || msg.Role == conversationmessage.RoleSystem {
+			continue
+		}
+		if before != nil && !msg.CreatedAt.Before(before.CreatedAt) &&
+			!(msg.CreatedAt.Equal(before.CreatedAt) && msg.ID < before.ID) {
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	slices.SortFunc(msgs, func(a, b *ent.ConversationMessage) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	msgs = msgs[:min(limit, len(msgs))]
+	slices.Reverse(msgs)
+	return msgs, nil
+}
+
+func (r *fakeConversationRepo) ListConversationMessages(ctx context.Context, conversationID int64, after *data.MessageCursor, limit int) ([]*ent.ConversationMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listCalls++
+	var msgs []*ent.ConversationMessage
+	for _, msg := range r.messages {
+		if msg.ConversationID != conversationID || msg.Role == conversationmessage.RoleSystem {
+			continue
+		}
+		if after != nil && !msg.CreatedAt.After(after.CreatedAt) &&
+			!(msg.CreatedAt.Equal(after.CreatedAt) && msg.ID > after.ID) {
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	slices.SortFunc(msgs, func(a, b *ent.ConversationMessage) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return msgs[:min(limit, len(msgs))], nil
+}
+
+func (r *fakeConversationRepo) AppendMessage(ctx context.Context, prevMessageID int64, role, content, model string) (*ent.ConversationMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, ok := r.messages[prevMessageID]
+	if !ok {
+		return nil, fmt.Errorf("message %d not found", prevMessageID)
+	}
+	return r.newMessage(prev.ConversationID, prevMessageID, role, content), nil
+}
+
+func (r *fakeConversationRepo) GetMessage(ctx context.Context, id int64) (*ent.ConversationMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg, ok := r.messages[id]
+	if !ok {
+		return nil, fmt.Errorf("message %d not found", id)
+	}
+	return msg, nil
+}
+
+func (r *fakeConversationRepo) GetConversation(ctx context.Context, id int64) (*ent.Conversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conv, ok := r.conversations[id]
+	if !ok {
+		return nil, data.ErrConversationNotFound
+	}
+	return conv, nil
+}
+
+func (r *fakeConversationRepo) AppendMessageToConversation(ctx context.Context, conversationID int64, role, content, model string) (*ent.ConversationMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	latest, ok := r.latest[conversationID]
+	if !ok {
+		return nil, data.ErrConversationNotFound
+	}
+	return r.newMessage(conversationID, latest, role, content), nil
+}
+
+func (r *fakeConversationRepo) GetMessageChain(ctx context.Context, messageID int64) ([]*ent.ConversationMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var chain []*ent.ConversationMessage
+	for id := messageID; id != 0; id = r.prev[id] {
+		chain = append([]*ent.ConversationMessage{r.messages[id]}, chain...)
+	}
+	return chain, nil
+}
+
+func (r *fakeConversationRepo) SaveTurn(ctx context.Context, turn data.TurnInput) (*ent.ConversationMessage, *ent.ConversationMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.saveTurnErr != nil {
+		return nil, nil, r.saveTurnErr
+	}
+	var prev *ent.ConversationMessage
+	if turn.Conversation != nil {
+		r.nextID++
+		conv := &ent.Conversation{ID: r.nextID, Title: turn.Conversation.Title, UserID: turn.Conversation.UserID}
+		r.conversations[conv.ID] = conv
+		for _, m := range turn.Conversation.Messages {
+			var prevID int64
+			if prev != nil {
+				prevID = prev.ID
+			}
+			prev = r.newMessage(conv.ID, prevID, m.Role, m.Content)
+		}
+	} else {
+		var ok bool
+		if prev, ok = r.messages[turn.PrevMessageID]; !ok {
+			return nil, nil, data.ErrBaseMessageNotFound
+		}
+	}
+	userMsg := r.newMessage(prev.ConversationID, prev.ID, string(conversationmessage.RoleUser), turn.UserContent)
+	reply := r.newMessage(prev.ConversationID, userMsg.ID, string(conversationmessage.RoleAssistant), turn.AssistantContent)
+	reply.Emotion = turn.Emotion
+	if len(turn.Emotions) > 0 {
+		r.emotions[reply.ID] = turn.Emotions
+		r.users[reply.ID] = turn.UserID
+	}
+	return userMsg, reply, nil
+}
+
+func (r *fakeConversationRepo) DeleteUserHistory(ctx context.Context, userID int64, hard bool) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deletes[userID] = hard
+	n := len(r.messages)
+	clear(r.messages)
+	return n, nil
+}
+
+func (r *fakeConversationRepo) PurgeHistory(ctx context.Context, before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.purges = append(r.purges, before)
+	return 0, nil
+}
+
+// fakePreferencesRepo 内存中的PreferencesRepo，err非nil时读写都返回该错误
+type fakePreferencesRepo struct {
+	mu    sync.Mutex
+	prefs map[int64]data.Preferences
+	gets  int
+	err   error
+}
+
+func newFakePreferencesRepo() *fakePreferencesRepo {
+	return &fakePreferencesRepo{prefs: make(map[int64]data.Preferences)}
+}
+
+func (r *fakePreferencesRepo) Get(ctx context.Context, userID int64) (*data.Preferences, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.gets++
+	if r.err != nil {
+		return nil, r.err
+	}
+	prefs := r.prefs[userID]
+	return &prefs, nil
+}
+
+func (r *fakePreferencesRepo) Save(ctx context.Context, userID int64, p *data.Preferences) (*data.Preferences, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.prefs[userID] = *p
+	saved := *p
+	return &saved, nil
+}
+
+// fakeSessionRepo 内存中的SessionRepo
+type fakeSessionRepo struct {
+	mu       sync.Mutex
+	nextID   int64
+	sessions map[int64]*ent.Session
+	touches  map[int64]int
+}
+
+func newFakeSessionRepo() *fakeSessionRepo {
+	return &fakeSessionRepo{
+		sessions: make(map[int64]*ent.Session),
+		touches:  make(map[int64]int),
+	}
+}
+
+func (r *fakeSessionRepo) Create(ctx context.Context, userID int64, title string, titled bool, conversationID int64) (*ent.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	now := time.Now()
+	s := &ent.Session{ID: r.nextID, Title: title, Titled: titled, UserID: userID, ConversationID: conversationID, CreatedAt: now, UpdatedAt: now}
+	r.sessions[s.ID] = s
+	saved := *s
+	return &saved, nil
+}
+
+func (r *fakeSessionRepo) Get(ctx context.Context, id int64) (*ent.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil, data.ErrSessionNotFound
+	}
+	saved := *s
+	return &saved, nil
+}
+
+func (r *fakeSessionRepo) List(ctx context.Context, userID int64) ([]*ent.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var list []*ent.Session
+	for id := r.nextID; id > 0; id-- {
+		if s, ok := r.sessions[id]; ok && s.UserID == userID {
+			saved := *s
+			list = append(list, &saved)
+		}
+	}
+	return list, nil
+}
+
+func (r *fakeSessionRepo) Touch(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.touches[id]++
+	return nil
+}
+
+func (r *fakeSessionRepo) SetAutoTitle(ctx context.Context, id int64, title string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok || s.Titled {
+		return false, nil
+	}
+	s.Title, s.Titled = title, true
+	return true, nil
+}
+
+func (r *fakeSessionRepo) UpdateTitle(ctx context.Context, id int64, title string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return data.ErrSessionNotFound
+	}
+	s.Title, s.Titled = title, true
+	return nil
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+)
+
+// LLM调用失败时兜底回复的默认值
+const (
+	// DefaultFallbackReply 兜底回复显示的文本
+	DefaultFallbackReply = "对不起，我现在有点累，稍后再聊好吗？"
+	// DefaultFallbackEmotion 兜底回复的情绪
+	DefaultFallbackEmotion = "难过"
+	// DefaultFallbackVoice 兜底回复用于合成语音的日语
+	DefaultFallbackVoice = "ごめんね、今ちょっと疲れてるの。また後で話そう？"
+)
+
+// fallbackReply 按LLM回复的格式拼出兜底回复：【情绪】文本<日语>
+func (l *LingChatService) fallbackReply() string {
+	c := l.ParseConfig
+	return c.TagOpen + l.FallbackEmotion + c.TagClose + l.FallbackReply + c.VoiceOpen + l.FallbackVoice + c.VoiceClose
+}
+
+// llmFallback LLM调用失败时代替回复的文本，返回空字符串时本轮对话返回错误。
+// LLM超时且设置了LLMTimeoutReply时优先使用它；整个请求已结束（超时或调用方取消）时不兜底
+func (l *LingChatService) llmFallback(ctx, llmCtx context.Context) string {
+	if llmTimedOut(ctx, llmCtx) && l.LLMTimeoutReply != "" {
+		return l.LLMTimeoutReply
+	}
+	if l.Fallback && ctx.Err() == nil {
+		return l.fallbackReply()
+	}
+	return ""
+}
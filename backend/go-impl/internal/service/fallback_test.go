@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"LingChat/internal/data/ent/ent/conversationmessage"
+	"LingChat/internal/errs"
+)
+
+func Test_LingChatFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		fallback     bool
+		delay        time.Duration
+		timeoutReply string
+		wantErr      bool
+		wantMessage  string
+		wantTag      string
+	}{
+		{name: "未开启返回错误", wantErr: true},
+		{name: "兜底回复", fallback: true, wantMessage: DefaultFallbackReply, wantTag: "难过"},
+		{name: "超时优先使用LLMTimeoutReply", fallback: true, delay: 5 * time.Second, timeoutReply: "【无语】等太久啦<待ちくたびれた>", wantMessage: "等太久啦", wantTag: "无语"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, repo := newTestService(t, "",
+				func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+				emotionHandler("难过"),
+			)
+			llm := l.llmClient.(*fakeLLM)
+			llm.err, llm.delay = errors.New("boom"), tt.delay
+			l.LLMTimeout = 100 * time.Millisecond
+			l.LLMTimeoutReply = tt.timeoutReply
+			l.Fallback = tt.fallback
+
+			resp, err := l.LingChat(context.Background(), "你好", "", "")
+			if tt.wantErr {
+				if !errors.Is(err, errs.ErrLLM) {
+					t.Errorf("LingChat() error = %v, want ErrLLM", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Messages) != 1 {
+				t.Fatalf("Messages = %+v, want 1", resp.Messages)
+			}
+			part := resp.Messages[0]
+			if part.Message != tt.wantMessage || part.OriginalTag != tt.wantTag || part.AudioFile == "" {
+				t.Errorf("part = %+v, want %q【%s】 with audio", part, tt.wantMessage, tt.wantTag)
+			}
+			// 兜底回复与正常回复一样保存
+			wantSaved := l.fallbackReply()
+			if tt.timeoutReply != "" {
+				wantSaved = tt.timeoutReply
+			}
+			saved := false
+			for _, msg := range repo.messages {
+				saved = saved || (msg.Role == conversationmessage.RoleAssistant && msg.Content == wantSaved)
+			}
+			if !saved {
+				t.Errorf("assistant reply %q not recorded", wantSaved)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"LingChat/internal/breaker"
+	"LingChat/internal/clients/llm"
+)
+
+// 健康检查的依赖名称
+const (
+	DependencyLLM     = "llm"
+	DependencyVITS    = "vits"
+	DependencyEmotion = "emotion"
+)
+
+// BreakerStates 返回每个依赖的熔断器状态，未配置熔断器的依赖为closed
+func (l *LingChatService) BreakerStates() map[string]breaker.State {
+	return map[string]breaker.State{
+		DependencyLLM:     l.LLMBreaker.State(),
+		DependencyVITS:    l.TTSBreaker.State(),
+		DependencyEmotion: l.EmotionBreaker.State(),
+	}
+}
+
+// CheckHealth 并发探测下游服务，返回每个依赖的探测结果，nil表示可达。
+// 下游实现未提供Ping时视为可达；关闭情绪预测时不探测情绪服务，演练模式下只探测LLM
+func (l *LingChatService) CheckHealth(ctx context.Context) map[string]error {
+	probes := map[string]func(context.Context) error{}
+	if !l.DryRun {
+		// 主VITS服务不可达时即使有备用服务也报告出来
+		if l.VitsTTSClient != nil {
+			probes[DependencyVITS] = l.VitsTTSClient.Ping
+		} else {
+			probes[DependencyVITS] = pingProbe(l.TTSProvider)
+		}
+	}
+	if l.PredictEmotions && !l.DryRun {
+		probes[DependencyEmotion] = pingProbe(l.emotionPredictorClient)
+	}
+	probes[DependencyLLM] = pingProbe(l.llmClient)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]error, len(probes))
+	for name, probe := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := probe(ctx)
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// pingProbe dep实现了Ping时用它探测，否则视为可达
+func pingProbe(dep any) func(context.Context) error {
+	if pinger, ok := dep.(llm.Pinger); ok {
+		return pinger.Ping
+	}
+	return func(context.Context) error { return nil }
+}
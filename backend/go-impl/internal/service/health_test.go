@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestLingChatService_CheckHealth(t *testing.T) {
+	l, _ := newTestService(t, "",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/health" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"status":"healthy"}`))
+		},
+	)
+
+	results := l.CheckHealth(context.Background())
+	if len(results) != 3 {
+		t.Fatalf("CheckHealth() = %v, want 3 dependencies", results)
+	}
+	if results[DependencyVITS] == nil {
+		t.Error("vits should be unhealthy")
+	}
+	if results[DependencyEmotion] != nil || results[DependencyLLM] != nil {
+		t.Errorf("emotion = %v, llm = %v, want nil", results[DependencyEmotion], results[DependencyLLM])
+	}
+}
+
+func TestLingChatService_CheckHealthWithoutEmotion(t *testing.T) {
+	l, _ := newTestService(t, "",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("{}")) },
+		func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) },
+	)
+	l.PredictEmotions = false
+
+	results := l.CheckHealth(context.Background())
+	if _, ok := results[DependencyEmotion]; ok {
+		t.Errorf("CheckHealth() = %v, emotion should not be probed", results)
+	}
+}
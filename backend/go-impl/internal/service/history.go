@@ -0,0 +1,64 @@
+package service
+
+import (
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// TokenEstimator 估算一段文本的token数
+type TokenEstimator func(text string) int
+
+// EstimateTokens 默认的token估算：按字符数/4向上取整，只是粗略估计
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// TrimHistory 使用EstimateTokens将历史裁剪到maxTokens以内
+func TrimHistory(messages []openai.ChatCompletionMessage, maxTokens int) []openai.ChatCompletionMessage {
+	return trimHistory(messages, maxTokens, EstimateTokens)
+}
+
+// trimHistory 始终保留开头的系统提示词和最后一条当前用户消息，
+// 其余历史从最近往前保留，直到超出预算；maxTokens<=0表示不限制
+func trimHistory(messages []openai.ChatCompletionMessage, maxTokens int, estimate TokenEstimator) []openai.ChatCompletionMessage {
+	if maxTokens <= 0 || len(messages) == 0 {
+		return messages
+	}
+
+	head := 0
+	for head < len(messages) && messages[head].Role == openai.ChatMessageRoleSystem {
+		head++
+	}
+	if head == len(messages) {
+		return messages
+	}
+
+	used := 0
+	for _, msg := range messages[:head] {
+		used += estimate(msg.Content)
+	}
+	last := len(messages) - 1
+	used += estimate(messages[last].Content)
+
+	start := last
+	for start > head {
+		cost := estimate(messages[start-1].Content)
+		if used+cost > maxTokens {
+			break
+		}
+		used += cost
+		start--
+	}
+	// 不以助手回复开头，避免留下没有提问的半轮对话
+	for start < last && messages[start].Role == openai.ChatMessageRoleAssistant {
+		start++
+	}
+	if start == head {
+		return messages
+	}
+
+	trimmed := make([]openai.ChatCompletionMessage, 0, head+len(messages)-start)
+	trimmed = append(trimmed, messages[:head]...)
+	return append(trimmed, messages[start:]...)
+}
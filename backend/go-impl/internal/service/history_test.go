@@ -0,0 +1,67 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func msg(role, content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: role, Content: content}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{name: "空字符串", text: "", want: 0},
+		{name: "不足4字符", text: "abc", want: 1},
+		{name: "恰好4字符", text: "abcd", want: 1},
+		{name: "超出4字符", text: "abcde", want: 2},
+		{name: "中文按字符计", text: "你好世界", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateTokens(tt.text); got != tt.want {
+				t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimHistory(t *testing.T) {
+	// 每条内容8个字符，估算为2个token
+	system := msg(openai.ChatMessageRoleSystem, "system!!")
+	u1 := msg(openai.ChatMessageRoleUser, "user-001")
+	a1 := msg(openai.ChatMessageRoleAssistant, "asst-001")
+	u2 := msg(openai.ChatMessageRoleUser, "user-002")
+	a2 := msg(openai.ChatMessageRoleAssistant, "asst-002")
+	u3 := msg(openai.ChatMessageRoleUser, "user-003")
+	history := []openai.ChatCompletionMessage{system, u1, a1, u2, a2, u3}
+
+	tests := []struct {
+		name      string
+		messages  []openai.ChatCompletionMessage
+		maxTokens int
+		want      []openai.ChatCompletionMessage
+	}{
+		{name: "不限制", messages: history, maxTokens: 0, want: history},
+		{name: "预算充足", messages: history, maxTokens: 12, want: history},
+		{name: "恰好少一条，丢弃开头的半轮", messages: history, maxTokens: 10, want: []openai.ChatCompletionMessage{system, u2, a2, u3}},
+		{name: "保留最近一轮", messages: history, maxTokens: 8, want: []openai.ChatCompletionMessage{system, u2, a2, u3}},
+		{name: "只够系统提示词和当前消息", messages: history, maxTokens: 5, want: []openai.ChatCompletionMessage{system, u3}},
+		{name: "预算不足时仍保留系统提示词和当前消息", messages: history, maxTokens: 1, want: []openai.ChatCompletionMessage{system, u3}},
+		{name: "没有系统提示词", messages: history[1:], maxTokens: 6, want: []openai.ChatCompletionMessage{u2, a2, u3}},
+		{name: "只有当前消息", messages: []openai.ChatCompletionMessage{u3}, maxTokens: 1, want: []openai.ChatCompletionMessage{u3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimHistory(tt.messages, tt.maxTokens); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TrimHistory() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
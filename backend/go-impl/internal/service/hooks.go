@@ -0,0 +1,67 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// ResultHook 对回复的每个分段做业务上的后处理，如插入商品链接、为日语添加注音，不必修改聊天流程。
+// 在解析、清理（Sanitizer）和语言检测之后，语音合成和情绪预测之前执行，此时Predicted尚未确定；
+// 只应修改FollowingText和MotionText，语音仍按JapaneseText合成
+type ResultHook interface {
+	ProcessResult(ctx context.Context, result *Result)
+}
+
+// ResultHookFunc 把函数用作ResultHook
+type ResultHookFunc func(ctx context.Context, result *Result)
+
+func (f ResultHookFunc) ProcessResult(ctx context.Context, result *Result) {
+	f(ctx, result)
+}
+
+// runHooks 按注册顺序对每个分段执行Hooks
+func (l *LingChatService) runHooks(ctx context.Context, results []Result) {
+	if len(l.Hooks) == 0 {
+		return
+	}
+	for i := range results {
+		for _, hook := range l.Hooks {
+			hook.ProcessResult(ctx, &results[i])
+		}
+	}
+}
+
+// KeywordLinkHook 示例ResultHook：把显示文本中第一次出现的关键词替换为Markdown链接，如[猫粮](https://...)。
+// Links的key为关键词，value为链接；从前往后替换，同一位置优先匹配较长的关键词，插入的链接不再参与匹配
+type KeywordLinkHook struct {
+	Links map[string]string
+}
+
+func (h KeywordLinkHook) ProcessResult(_ context.Context, result *Result) {
+	keywords := slices.SortedFunc(maps.Keys(h.Links), func(a, b string) int {
+		return cmp.Or(cmp.Compare(utf8.RuneCountInString(b), utf8.RuneCountInString(a)), strings.Compare(a, b))
+	})
+	text := result.FollowingText
+	var out strings.Builder
+	for len(text) > 0 {
+		idx, keyword := -1, ""
+		for _, k := range keywords {
+			if i := strings.Index(text, k); k != "" && i >= 0 && (idx < 0 || i < idx) {
+				idx, keyword = i, k
+			}
+		}
+		if idx < 0 {
+			break
+		}
+		out.WriteString(text[:idx])
+		out.WriteString("[" + keyword + "](" + h.Links[keyword] + ")")
+		text = text[idx+len(keyword):]
+		keywords = slices.DeleteFunc(keywords, func(k string) bool { return k == keyword })
+	}
+	out.WriteString(text)
+	result.FollowingText = out.String()
+}
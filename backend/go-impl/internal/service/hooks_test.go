@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestKeywordLinkHook(t *testing.T) {
+	hook := KeywordLinkHook{Links: map[string]string{
+		"猫粮":   "https://shop.example.com/cat-food",
+		"猫粮罐头": "https://shop.example.com/can",
+		"猫":    "https://shop.example.com/cat",
+	}}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "没有关键词", text: "你好", want: "你好"},
+		{name: "每个关键词只替换第一次出现", text: "猫粮好吃，再来点猫粮，喂猫", want: "[猫粮](https://shop.example.com/cat-food)好吃，再来点[猫](https://shop.example.com/cat)粮，喂猫"},
+		{name: "同一位置优先较长的关键词", text: "买猫粮罐头吧", want: "买[猫粮罐头](https://shop.example.com/can)吧"},
+		{name: "链接中的文字不再匹配", text: "猫粮给猫", want: "[猫粮](https://shop.example.com/cat-food)给[猫](https://shop.example.com/cat)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Result{FollowingText: tt.text}
+			hook.ProcessResult(context.Background(), &result)
+			if result.FollowingText != tt.want {
+				t.Errorf("FollowingText = %q, want %q", result.FollowingText, tt.want)
+			}
+		})
+	}
+}
+
+func Test_LingChatHooks(t *testing.T) {
+	l, _ := newTestService(t, "【开心】买猫粮吗（摇尾巴）<こんにちは>【难过】再见<さよなら>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("开心"),
+	)
+	var order []string
+	l.Hooks = []ResultHook{
+		KeywordLinkHook{Links: map[string]string{"猫粮": "https://shop.example.com/cat-food"}},
+		ResultHookFunc(func(ctx context.Context, result *Result) {
+			order = append(order, result.FollowingText)
+			result.MotionText = "[" + result.MotionText + "]"
+		}),
+		// 什么也不做的Hook不影响其他分段
+		ResultHookFunc(func(ctx context.Context, result *Result) {}),
+	}
+
+	resp, err := l.LingChat(context.Background(), "你好", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 后注册的Hook看到先注册的Hook修改后的文本
+	if len(order) != 2 || order[0] != "买[猫粮](https://shop.example.com/cat-food)吗" {
+		t.Errorf("second hook saw %q, want text with link", order)
+	}
+	first, second := resp.Messages[0], resp.Messages[1]
+	if first.Message != "买[猫粮](https://shop.example.com/cat-food)吗" || first.MotionText != "[摇尾巴]" {
+		t.Errorf("first part = %q/%q, want hooked text and motion", first.Message, first.MotionText)
+	}
+	if second.Message != "再见" || second.MotionText != "[]" {
+		t.Errorf("second part = %q/%q", second.Message, second.MotionText)
+	}
+	if first.AudioFile == "" || first.Emotion != "开心" {
+		t.Errorf("first part audio/emotion = %q/%q, want unaffected by hooks", first.AudioFile, first.Emotion)
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"LingChat/api"
+	"LingChat/api/routes/common"
+	"LingChat/internal/errs"
+)
+
+// DefaultIdempotencyTTL 幂等键对应的回复默认保留时长
+const DefaultIdempotencyTTL = 10 * time.Minute
+
+// idempotencyCache 按幂等键缓存已完成的回复，客户端重试时直接返回上一次的结果。
+// 同一个键的请求仍在处理时，重试会等待它完成并共用结果；
+// 第一次请求失败（包括被取消）时不缓存，等待中的重试接手重新处理
+type idempotencyCache struct {
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastPrune time.Time
+
+	// now 便于测试替换时钟
+	now func() time.Time
+}
+
+type idempotencyEntry struct {
+	// content 第一次请求的消息内容，同一个键用于不同消息时拒绝
+	content string
+	// done 处理结束后关闭，之后resp、err、expires不再改变
+	done    chan struct{}
+	resp    []api.Response
+	err     error
+	expires time.Time
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{
+		entries: make(map[string]*idempotencyEntry),
+		now:     time.Now,
+	}
+}
+
+// idempotencyKey 按用户隔离的幂等键。没有幂等键、IdempotencyTTL<=0或请求未登录时ok为false，按普通消息处理：
+// 未登录的请求无法区分调用方，共用一个空间时别人用相同的键就能取走回复
+func (l *LingChatService) idempotencyKey(ctx context.Context, msg api.Message) (key string, ok bool) {
+	user := common.GetUserFromContext(ctx)
+	if msg.IdempotencyKey == "" || l.IdempotencyTTL <= 0 || user == nil {
+		return "", false
+	}
+	return fmt.Sprintf("user:%d:%s", user.ID, msg.IdempotencyKey), true
+}
+
+// do 对同一个key只执行一次成功的fn，结果保留ttl。replayed表示结果来自之前的请求
+func (c *idempotencyCache) do(ctx context.Context, key, content string, ttl time.Duration, fn func() ([]api.Response, error)) (resp []api.Response, replayed bool, err error) {
+	for {
+		c.mu.Lock()
+		now := c.now()
+		c.prune(now)
+
+		e, ok := c.entries[key]
+		if ok && !e.expires.IsZero() && !now.Before(e.expires) {
+			ok = false
+		}
+		if !ok {
+			e = &idempotencyEntry{content: content, done: make(chan struct{})}
+			c.entries[key] = e
+			c.mu.Unlock()
+			resp, err := c.run(key, e, ttl, fn)
+			return resp, false, err
+		}
+		c.mu.Unlock()
+
+		if e.content != content {
+			return nil, false, errs.ErrIdempotencyConflict
+		}
+
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+		if e.err == nil {
+			return e.resp, true, nil
+		}
+		// 第一次请求失败时条目已被删除，重新竞争执行权
+	}
+}
+
+// run 执行fn并记录结果，失败时删除条目以便重试
+func (c *idempotencyCache) run(key string, e *idempotencyEntry, ttl time.Duration, fn func() ([]api.Response, error)) ([]api.Response, error) {
+	defer close(e.done)
+
+	e.resp, e.err = fn()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e.err != nil {
+		delete(c.entries, key)
+		return nil, e.err
+	}
+	e.expires = c.now().Add(ttl)
+	return e.resp, nil
+}
+
+// prune 每分钟清理一次过期的条目，处理中的条目保留
+func (c *idempotencyCache) prune(now time.Time) {
+	if now.Sub(c.lastPrune) < time.Minute {
+		return
+	}
+	c.lastPrune = now
+	for key, e := range c.entries {
+		if !e.expires.IsZero() && !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"LingChat/api"
+	"LingChat/api/routes/common"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/errs"
+)
+
+func Test_idempotencyCache(t *testing.T) {
+	reply := []api.Response{{Message: "你好"}}
+
+	t.Run("重试返回缓存的回复", func(t *testing.T) {
+		c := newIdempotencyCache()
+		var calls atomic.Int32
+		fn := func() ([]api.Response, error) {
+			calls.Add(1)
+			return reply, nil
+		}
+		if _, replayed, err := c.do(context.Background(), "k", "你好", time.Minute, fn); err != nil || replayed {
+			t.Fatalf("first do() replayed = %v, err = %v", replayed, err)
+		}
+		resp, replayed, err := c.do(context.Background(), "k", "你好", time.Minute, fn)
+		if err != nil || !replayed || len(resp) != 1 {
+			t.Errorf("second do() = %v, %v, %v", resp, replayed, err)
+		}
+		if calls.Load() != 1 {
+			t.Errorf("fn called %d times, want 1", calls.Load())
+		}
+	})
+
+	t.Run("处理中的重试等待并共用结果", func(t *testing.T) {
+		c := newIdempotencyCache()
+		started, release := make(chan struct{}), make(chan struct{})
+		go c.do(context.Background(), "k", "你好", time.Minute, func() ([]api.Response, error) {
+			close(started)
+			<-release
+			return reply, nil
+		})
+		<-started
+
+		done := make(chan bool)
+		go func() {
+			_, replayed, err := c.do(context.Background(), "k", "你好", time.Minute, func() ([]api.Response, error) {
+				t.Error("retry should not run fn")
+				return nil, nil
+			})
+			done <- replayed && err == nil
+		}()
+		select {
+		case <-done:
+			t.Fatal("retry returned before the first request finished")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(release)
+		if !<-done {
+			t.Error("retry was not replayed")
+		}
+	})
+
+	t.Run("首次失败时由重试接手", func(t *testing.T) {
+		c := newIdempotencyCache()
+		started, release := make(chan struct{}), make(chan struct{})
+		firstErr := make(chan error)
+		go func() {
+			_, _, err := c.do(context.Background(), "k", "你好", time.Minute, func() ([]api.Response, error) {
+				close(started)
+				<-release
+				return nil, context.Canceled
+			})
+			firstErr <- err
+		}()
+		<-started
+
+		done := make(chan error)
+		go func() {
+			_, replayed, err := c.do(context.Background(), "k", "你好", time.Minute, func() ([]api.Response, error) {
+				return reply, nil
+			})
+			if replayed {
+				t.Error("retry replayed a failed request")
+			}
+			done <- err
+		}()
+		close(release)
+		if err := <-firstErr; !errors.Is(err, context.Canceled) {
+			t.Errorf("first err = %v, want context.Canceled", err)
+		}
+		if err := <-done; err != nil {
+			t.Errorf("retry err = %v", err)
+		}
+	})
+
+	t.Run("同一个键用于不同消息", func(t *testing.T) {
+		c := newIdempotencyCache()
+		c.do(context.Background(), "k", "你好", time.Minute, func() ([]api.Response, error) { return reply, nil })
+		_, _, err := c.do(context.Background(), "k", "再见", time.Minute, func() ([]api.Response, error) { return reply, nil })
+		if !errors.Is(err, errs.ErrIdempotencyConflict) {
+			t.Errorf("err = %v, want ErrIdempotencyConflict", err)
+		}
+	})
+
+	t.Run("过期后重新处理", func(t *testing.T) {
+		c := newIdempotencyCache()
+		now := time.Now()
+		c.now = func() time.Time { return now }
+		var calls atomic.Int32
+		fn := func() ([]api.Response, error) {
+			calls.Add(1)
+			return reply, nil
+		}
+		c.do(context.Background(), "k", "你好", time.Minute, fn)
+		now = now.Add(time.Minute)
+		if _, replayed, _ := c.do(context.Background(), "k", "你好", time.Minute, fn); replayed {
+			t.Error("expired entry was replayed")
+		}
+		if calls.Load() != 2 {
+			t.Errorf("fn called %d times, want 2", calls.Load())
+		}
+	})
+}
+
+func TestLingChatService_idempotencyKey(t *testing.T) {
+	user := context.WithValue(context.Background(), common.CurrentUserInfoKey, &ent.User{ID: 42})
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		key    string
+		ttl    time.Duration
+		want   string
+		wantOk bool
+	}{
+		{name: "按用户隔离", ctx: user, key: "k", ttl: time.Minute, want: "user:42:k", wantOk: true},
+		{name: "未登录时忽略幂等键", ctx: context.Background(), key: "k", ttl: time.Minute},
+		{name: "没有幂等键", ctx: user, ttl: time.Minute},
+		{name: "TTL为0时忽略幂等键", ctx: user, key: "k"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &LingChatService{IdempotencyTTL: tt.ttl}
+			got, ok := l.idempotencyKey(tt.ctx, api.Message{IdempotencyKey: tt.key})
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("idempotencyKey() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pemistahl/lingua-go"
+)
+
+// DefaultLanguageMinConfidence 最可能语言的置信度低于该值时视为无法判断
+const DefaultLanguageMinConfidence = 0.5
+
+// LanguageRouter 检测分段显示文本的主要语言，按语言选择合成语音的说话人，
+// 避免一个说话人读错另一种语言。语言检测使用LanguageDetector
+type LanguageRouter struct {
+	detector LanguageDetector
+	speakers map[string]int
+	// MinConfidence 置信度低于该值时不判断语言，使用默认说话人
+	MinConfidence float64
+}
+
+// NewLanguageRouter speakers为ISO 639-1语言代码（如zh、en）到VITS说话人ID的映射
+func NewLanguageRouter(detector LanguageDetector, speakers map[string]int) (*LanguageRouter, error) {
+	routes := make(map[string]int, len(speakers))
+	for code, speaker := range speakers {
+		lang := lingua.GetLanguageFromIsoCode639_1(lingua.GetIsoCode639_1FromValue(code))
+		if lang == lingua.Unknown {
+			return nil, fmt.Errorf("unknown language code %q", code)
+		}
+		routes[languageCode(lang)] = speaker
+	}
+	return &LanguageRouter{
+		detector:      detector,
+		speakers:      routes,
+		MinConfidence: DefaultLanguageMinConfidence,
+	}, nil
+}
+
+// DetectLanguage 返回text主要语言的ISO 639-1代码，文本为空或置信度不足时返回空字符串
+func (r *LanguageRouter) DetectLanguage(text string) string {
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	values := r.detector.ComputeLanguageConfidenceValues(text)
+	if len(values) == 0 || values[0].Value() < r.MinConfidence {
+		return ""
+	}
+	return languageCode(values[0].Language())
+}
+
+// Detect 记录每个分段显示文本的语言，r为nil时不检测
+func (r *LanguageRouter) Detect(results []Result) {
+	if r == nil {
+		return
+	}
+	for i := range results {
+		results[i].Language = r.DetectLanguage(results[i].FollowingText)
+	}
+}
+
+// Speaker 返回lang对应的说话人，未配置该语言时返回fallback
+func (r *LanguageRouter) Speaker(lang string, fallback int) int {
+	if r == nil || lang == "" {
+		return fallback
+	}
+	if speaker, ok := r.speakers[lang]; ok {
+		return speaker
+	}
+	return fallback
+}
+
+// validLanguageCode code是否为支持的ISO 639-1语言代码
+func validLanguageCode(code string) bool {
+	return lingua.GetLanguageFromIsoCode639_1(lingua.GetIsoCode639_1FromValue(code)) != lingua.Unknown
+}
+
+func languageCode(lang lingua.Language) string {
+	return strings.ToLower(lang.IsoCode639_1().String())
+}
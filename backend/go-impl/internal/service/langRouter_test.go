@@ -0,0 +1,112 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"LingChat/api/routes/common"
+	"LingChat/internal/data/ent/ent"
+)
+
+func TestLanguageRouter(t *testing.T) {
+	router, err := NewLanguageRouter(NewLanguageDetector(), map[string]int{"zh": 4, "EN": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		text        string
+		wantLang    string
+		wantSpeaker int
+	}{
+		{name: "中文", text: "今天天气真好，我们去公园散步吧。", wantLang: "zh", wantSpeaker: 4},
+		{name: "英文", text: "The weather is lovely today, let's take a walk in the park.", wantLang: "en", wantSpeaker: 7},
+		{name: "以中文为主", text: "好的，我马上帮你看看这个问题 OK", wantLang: "zh", wantSpeaker: 4},
+		{name: "空文本使用默认说话人", text: "  ", wantLang: "", wantSpeaker: 1},
+		{name: "只有标点使用默认说话人", text: "……！", wantLang: "", wantSpeaker: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang := router.DetectLanguage(tt.text)
+			if lang != tt.wantLang {
+				t.Errorf("DetectLanguage(%q) = %q, want %q", tt.text, lang, tt.wantLang)
+			}
+			if speaker := router.Speaker(lang, 1); speaker != tt.wantSpeaker {
+				t.Errorf("Speaker(%q) = %d, want %d", lang, speaker, tt.wantSpeaker)
+			}
+		})
+	}
+}
+
+func TestNewLanguageRouter_UnknownCode(t *testing.T) {
+	if _, err := NewLanguageRouter(NewLanguageDetector(), map[string]int{"chinese": 4}); err == nil {
+		t.Error("NewLanguageRouter() succeeded, want error")
+	}
+}
+
+func TestLanguageRouter_Nil(t *testing.T) {
+	var router *LanguageRouter
+	results := []Result{{FollowingText: "hello"}}
+	router.Detect(results)
+	if results[0].Language != "" {
+		t.Errorf("Language = %q, want empty", results[0].Language)
+	}
+	if speaker := router.Speaker("en", 3); speaker != 3 {
+		t.Errorf("Speaker() = %d, want 3", speaker)
+	}
+}
+
+func Test_LingChatLanguageRouting(t *testing.T) {
+	chosen := 5
+	tests := []struct {
+		name string
+		user *ent.User
+		// wantChinese/wantEnglish 为空表示默认说话人
+		wantChinese string
+		wantEnglish string
+	}{
+		// 中文未配置说话人，使用默认说话人
+		{name: "按语言选择说话人", wantEnglish: "7"},
+		{name: "用户选择了说话人时不切换", user: &ent.User{ID: 1, SpeakerID: &chosen}, wantChinese: "5", wantEnglish: "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			speakers := map[string]string{}
+			l, _ := newTestService(t, "【开心】今天天气真好，我们去公园散步吧。<こんにちは>【开心】The weather is lovely today.<さよなら>",
+				func(w http.ResponseWriter, r *http.Request) {
+					mu.Lock()
+					speakers[r.URL.Query().Get("text")] = r.URL.Query().Get("id")
+					mu.Unlock()
+					w.Write([]byte("audio"))
+				},
+				emotionHandler("开心"),
+			)
+			router, err := NewLanguageRouter(NewLanguageDetector(), map[string]int{"en": 7})
+			if err != nil {
+				t.Fatal(err)
+			}
+			l.LanguageRouter = router
+			defaultSpeaker := strconv.Itoa(l.VitsTTSClient.DefaultVoice().SpeakerID)
+
+			ctx := context.Background()
+			if tt.user != nil {
+				ctx = context.WithValue(ctx, common.CurrentUserInfoKey, tt.user)
+			}
+			if _, err := l.LingChat(ctx, "你好", "", ""); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := speakers["こんにちは"], cmp.Or(tt.wantChinese, defaultSpeaker); got != want {
+				t.Errorf("chinese segment speaker = %s, want %s", got, want)
+			}
+			if got, want := speakers["さよなら"], cmp.Or(tt.wantEnglish, defaultSpeaker); got != want {
+				t.Errorf("english segment speaker = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -2,82 +2,308 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"maps"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
 
 	"LingChat/api"
+	"LingChat/api/routes/common"
 	"LingChat/api/routes/v1/response"
+	"LingChat/internal/breaker"
 	"LingChat/internal/clients/VitsTTS"
 	"LingChat/internal/clients/emotionPredictor"
 	"LingChat/internal/clients/llm"
+	"LingChat/internal/clients/moderation"
+	"LingChat/internal/clients/retrybudget"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/errs"
+	"LingChat/internal/logging"
+	"LingChat/internal/metrics"
+	"LingChat/internal/storage"
+	"LingChat/internal/tracing"
 )
 
+// DefaultEmotionThreshold 情绪预测的默认置信度阈值
+const DefaultEmotionThreshold = 0.08
+
+// unknownEmotion 情绪预测失败时分段的情绪
+const unknownEmotion = "unknown"
+
+// DefaultRequestTimeout 单次聊天请求（LLM、语音合成、情绪预测）的默认超时
+const DefaultRequestTimeout = 2 * time.Minute
+
+// DefaultMaxConcurrency 单次批量处理时对VITS和情绪服务的默认最大并发请求数
+const DefaultMaxConcurrency = 4
+
 type LingChatService struct {
-	emotionPredictorClient *emotionPredictor.Client
-	VitsTTSClient          *VitsTTS.Client
-	llmClient              *llm.LLMClient
-	conversationService    *ConversationService
-	ConfigModel            string
-	tempFilePath           string
+	emotionPredictorClient emotionPredictor.Predictor
+	// VitsTTSClient 提供默认说话人、音频格式、说话人列表等VITS特有的功能；
+	// 构造时传入的语音合成后端不是*VitsTTS.Client时为nil，此时使用默认值
+	VitsTTSClient *VitsTTS.Client
+	// TTSProvider 实际用于合成语音的后端，为空时使用VitsTTSClient
+	TTSProvider         VitsTTS.TTSProvider
+	llmClient           llm.LLMProvider
+	conversationService *ConversationService
+	ConfigModel         string
+	tempFilePath        string
+	// Storage 保存生成的语音，默认写入tempFilePath；为对象存储时AudioFile是对象的URL
+	Storage storage.Storage
+
+	// EmotionThreshold 传给情绪预测服务的置信度阈值，调用Reload后以重新加载的Settings为准
+	EmotionThreshold float64
+	// HistoryTurns 发给LLM的历史轮数（一问一答为一轮），<=0表示不限制
+	HistoryTurns int
+	// MaxHistoryTokens 发给LLM的历史token预算，<=0表示不限制
+	MaxHistoryTokens int
+	// TokenEstimator 裁剪历史时使用的token估算方法
+	TokenEstimator TokenEstimator
+	// MaxConcurrency 分段批量合成语音、预测情绪时的最大并发请求数，<=0表示不限制；
+	// 调用Reload后以重新加载的Settings为准
+	MaxConcurrency int
+	// ParseConfig LLM输出中情绪、日语、动作的标记约定
+	ParseConfig ParseConfig
+	// Sanitizer 解析后清理显示文本，为nil时不清理
+	Sanitizer *OutputSanitizer
+	// Hooks 清理之后按顺序处理每个分段的显示文本，见ResultHook；需在开始处理对话前设置
+	Hooks []ResultHook
+	// LanguageRouter 用户没有选择说话人时按分段显示文本的语言选择说话人，为nil时都使用默认说话人
+	LanguageRouter *LanguageRouter
+	// RequestTimeout 单次聊天请求的超时，<=0表示只受调用方ctx控制
+	RequestTimeout time.Duration
+	// LLMTimeout 单次LLM调用（含客户端重试）的超时，避免一次慢调用耗尽RequestTimeout而没有时间合成语音、预测情绪。
+	// LLM调用的ctx派生自请求的ctx，截止时间取两者中较早的一个；<=0表示只受RequestTimeout控制
+	LLMTimeout time.Duration
+	// LLMTimeoutReply LLM调用超过LLMTimeout时代替LLM回复的文本，按LLM回复的格式书写（如【难过】……<……>），
+	// 照常解析、合成语音并保存；为空时本轮对话返回超时错误。整个请求超时（RequestTimeout或调用方取消）时不使用
+	LLMTimeoutReply string
+	// Fallback 为true时LLM调用失败（服务不可用、熔断、超时等）不返回错误，改用兜底回复：
+	// FallbackEmotion的情绪、FallbackReply的文本和FallbackVoice合成的语音，照常解析、合成语音并保存。
+	// LLM超时且设置了LLMTimeoutReply时优先使用LLMTimeoutReply；整个请求已结束时不兜底
+	Fallback bool
+	// FallbackReply 兜底回复显示的文本，默认为DefaultFallbackReply
+	FallbackReply string
+	// FallbackEmotion 兜底回复的情绪，默认为DefaultFallbackEmotion
+	FallbackEmotion string
+	// FallbackVoice 兜底回复用于合成语音的日语，默认为DefaultFallbackVoice
+	FallbackVoice string
+	// RetryBudget/RetryBudgetWait 单次聊天请求中LLM、VITS和情绪预测共享的重试预算：所有调用合计最多重试RetryBudget次，
+	// 退避等待累计不超过RetryBudgetWait，用尽后其余调用失败时不再重试；<=0表示该项不限制，只受各客户端自身的重试次数控制
+	RetryBudget     int
+	RetryBudgetWait time.Duration
+	// MaxMessageLength 用户消息的最大字符数，超过时拒绝，<=0表示不限制
+	MaxMessageLength int
+	// StripControlChars 调用LLM前删除用户消息中的控制字符
+	StripControlChars bool
+	// PredictEmotions 为false时不调用情绪预测服务，直接把情绪标签作为情绪，置信度为1
+	PredictEmotions bool
+	// InlineAudio 为true时音频以base64放在响应的AudioData中，不写入临时目录
+	InlineAudio bool
+	// ConcatAudio 为true时把一条回复各分段的WAV语音按顺序拼接，放在第一个分段返回。
+	// 只对非流式回复、输出格式为wav时生效，各段格式不一致时退回逐段返回
+	ConcatAudio bool
+	// DryRun 演练模式，只调用LLM并解析回复，不请求VITS和情绪服务：
+	// 分段没有音频，情绪直接取标签，便于压测和在没有这些服务时开发
+	DryRun bool
+	// OutputFormat TTSProvider输出的音频格式（如转码后的mp3），为空时与VitsTTSClient请求的格式一致
+	OutputFormat string
+	// MotionMap 情绪到虚拟形象动作的映射，为nil时不返回动作
+	MotionMap *MotionMap
+	// Smoother 平滑相邻分段中低置信度的情绪预测，为nil时不平滑
+	Smoother *EmotionSmoother
+	// EmotionCache 跨请求缓存常见标签的情绪预测结果，为nil时每次都请求情绪预测服务
+	EmotionCache *EmotionCache
+	// EmotionLabels 情绪预测模型的标签集合，预测出集合外的标签时换成其Fallback；为nil时不校验
+	EmotionLabels *LabelSet
+	// LLMBreaker/TTSBreaker/EmotionBreaker 下游服务的熔断器，为nil时不熔断
+	LLMBreaker     *breaker.Breaker
+	TTSBreaker     *breaker.Breaker
+	EmotionBreaker *breaker.Breaker
+	// IdempotencyTTL 带幂等键的消息的回复保留时长，<=0表示忽略幂等键；未登录的请求总是忽略幂等键
+	IdempotencyTTL time.Duration
+	// PreferencesRepo 用户偏好，为nil时所有用户都使用全局配置
+	PreferencesRepo data.PreferencesRepo
+	// SessionRepo 聊天会话，为nil时不支持带sessionId的消息
+	SessionRepo data.SessionRepo
+	// SessionLLMTitles 为true时由LLM概括会话的第一条消息作为标题（多一次LLM调用），否则截断消息作为标题
+	SessionLLMTitles bool
+	// SettingsLoader Reload时用于重新读取配置，为nil时不支持重新加载
+	SettingsLoader SettingsLoader
+	// ProgressEvents 为true时WS对话在LLM、语音合成、情绪预测各阶段开始时推送status事件
+	ProgressEvents bool
+	// PredictUserEmotion 为true时与LLM请求并行预测用户消息的情绪，回复构造时已完成则在第一个分段和响应中返回userEmotion，
+	// WS对话中预测完成后立即推送user_emotion事件；预测失败或较慢不影响回复
+	PredictUserEmotion bool
+	// TextFirst 为true时WS对话解析出分段后先推送各分段的text事件，每段语音合成后推送audio事件，
+	// 前端不必等语音就能显示文本；reply照常发送
+	TextFirst bool
+	// StreamAudio 为true时WS对话通过VITS流式接口合成分段语音，边合成边推送audio_chunk事件；
+	// 语音合成后端不支持流式、需要调整音调或采样率、为SSML时整段合成
+	StreamAudio bool
+	// Pipeline 为true且LLM支持流式接口（llm.Streamer）时，流式对话（LingChatStream）边接收LLM回复边解析，
+	// 每解析出一个完整的分段就开始合成语音、预测情绪，不等LLM生成完整条回复；分段仍在回复结束并通过审核后按顺序推送，
+	// 结果与不开启时相同，回复未通过审核或LLM调用失败时丢弃已开始处理的分段。
+	// 推送text或audio_chunk事件（TextFirst、StreamAudio）的对话不流水线处理；LLMClient的流式接口不调用注册的工具
+	Pipeline bool
+	// VoiceNamer 语音文件名的模板，为nil时使用DefaultVoiceNameTemplate
+	VoiceNamer *VoiceNamer
+	// Moderator 调用LLM前审核用户消息、返回前审核LLM回复，默认不审核
+	Moderator moderation.Moderator
+	// ModerationReply 未通过审核时代替回复的安全回复，为空时使用DefaultModerationReply
+	ModerationReply string
+	// Queue 限制同时处理的对话数并让超出的对话排队，为nil时不限制
+	Queue *TurnQueue
+	// Clock 清理临时语音、过期聊天记录和幂等缓存时判断是否过期所用的当前时间，为nil时使用time.Now，测试中可替换
+	Clock func() time.Time
+
+	// settings Reload后生效的参数，为nil时使用EmotionThreshold、MaxConcurrency字段
+	settings atomic.Pointer[Settings]
+
+	sweeperMu sync.Mutex
+	sweeper   *backgroundTask
+	purger    *backgroundTask
+	turns     turnGroup
+
+	idempotency *idempotencyCache
+	// streamUnsupported VITS服务拒绝过流式请求，之后都整段合成
+	streamUnsupported atomic.Bool
+	// dispatcher ChatHandlerStream按消息类型分发WS消息
+	dispatcher *api.Dispatcher
 }
 
+// NewLingChatService 三个下游服务都以接口传入，测试中可以替换为假实现。
+// tts为*VitsTTS.Client时同时设为VitsTTSClient，否则设为TTSProvider
 func NewLingChatService(
-	epClient *emotionPredictor.Client,
-	vtClient *VitsTTS.Client,
-	llmClient *llm.LLMClient,
+	epClient emotionPredictor.Predictor,
+	tts VitsTTS.TTSProvider,
+	llmClient llm.LLMProvider,
 	conversationService *ConversationService,
 	configModel string,
 	path string,
 ) *LingChatService {
 
-	return &LingChatService{
+	l := &LingChatService{
 		emotionPredictorClient: epClient,
-		VitsTTSClient:          vtClient,
 		llmClient:              llmClient,
 		conversationService:    conversationService,
 		ConfigModel:            configModel,
 		tempFilePath:           path,
+		Storage:                storage.NewLocal(path),
+		EmotionThreshold:       DefaultEmotionThreshold,
+		MaxConcurrency:         DefaultMaxConcurrency,
+		ParseConfig:            DefaultParseConfig,
+		RequestTimeout:         DefaultRequestTimeout,
+		TokenEstimator:         EstimateTokens,
+		PredictEmotions:        true,
+		MaxMessageLength:       DefaultMaxMessageLength,
+		StripControlChars:      true,
+		IdempotencyTTL:         DefaultIdempotencyTTL,
+		Moderator:              moderation.Noop{},
+		ModerationReply:        DefaultModerationReply,
+		FallbackReply:          DefaultFallbackReply,
+		FallbackEmotion:        DefaultFallbackEmotion,
+		FallbackVoice:          DefaultFallbackVoice,
+		idempotency:            newIdempotencyCache(),
+	}
+	l.idempotency.now = l.now
+	if client, ok := tts.(*VitsTTS.Client); ok {
+		l.VitsTTSClient = client
+	} else {
+		l.TTSProvider = tts
 	}
+	l.dispatcher = l.wsDispatcher()
+	return l
 }
 
+// EmoPredictBatch 批量预测情绪，相同标签只请求一次（EmotionCache中已有的不再请求），结果回填到所有对应分段；设置了Smoother时再平滑相邻分段的情绪
 func (l *LingChatService) EmoPredictBatch(ctx context.Context, results []Result) []Result {
+	return l.Smoother.Smooth(l.predictBatch(ctx, results))
+}
+
+// predictBatch 为EmoPredictBatch预测每个标签的情绪
+func (l *LingChatService) predictBatch(ctx context.Context, results []Result) []Result {
+	ctx, span := tracing.Start(ctx, "EmoPredictBatch", attribute.Int("segments", len(results)))
+	defer span.End()
+
+	// 按标签分组，保持首次出现的顺序
+	var tags []string
+	indexesByTag := make(map[string][]int)
+	for i, result := range results {
+		// 没有情绪标签的分段已由解析器设置默认情绪
+		if result.OriginalTag == "" {
+			continue
+		}
+		if _, ok := indexesByTag[result.OriginalTag]; !ok {
+			tags = append(tags, result.OriginalTag)
+		}
+		indexesByTag[result.OriginalTag] = append(indexesByTag[result.OriginalTag], i)
+	}
+	threshold := l.settingsFrom(ctx).EmotionThreshold
+	tags = l.useCachedEmotions(ctx, results, tags, indexesByTag, threshold)
+
+	// 服务端支持时一次请求预测全部标签，失败或不支持时退回逐个请求
+	if batch, ok := l.emotionPredictorClient.(emotionPredictor.BatchPredictor); ok && len(tags) > 1 && batch.BatchEnabled() {
+		for _, tag := range tags {
+			for _, index := range indexesByTag[tag] {
+				reportProgress(ctx, api.StageEmotion, index)
+			}
+		}
+		predictions, err := l.predictEmotionBatch(ctx, batch, tags, threshold)
+		if err == nil {
+			for i, tag := range tags {
+				for _, index := range indexesByTag[tag] {
+					results[index].Confidence = predictions[i].Confidence
+					results[index].Predicted = l.knownEmotion(ctx, tag, predictions[i].Label)
+				}
+			}
+			return results
+		}
+		if !errors.Is(err, emotionPredictor.ErrBatchUnsupported) {
+			logging.FromContext(ctx).Warn("批量情绪预测失败，改为逐个预测", "tags", len(tags), "err", err)
+		}
+	}
+
 	var wg sync.WaitGroup
 	resultsChannel := make(chan struct {
-		index      int
+		tag        string
 		Predicted  string
 		Confidence float64
-	}, len(results))
-	for i, result := range results {
+	}, len(tags))
+	sem := l.newSemaphore(ctx, len(tags))
+	for _, tag := range tags {
 		wg.Add(1)
-		go func(index int, result Result) {
+		go func(tag string) {
 			defer wg.Done()
-			resp, err := l.emotionPredictorClient.Predict(ctx, result.OriginalTag, 0.08)
-			if err != nil {
-				log.Printf("Failed to predict emotion: %v", err)
-				resultsChannel <- struct {
-					index      int
-					Predicted  string
-					Confidence float64
-				}{
-					index, "unknown", 0.0,
-				}
-			} else {
-				resultsChannel <- struct {
-					index      int
-					Predicted  string
-					Confidence float64
-				}{
-					index, resp.Label, resp.Confidence,
-				}
+			// 已取消时不再发起请求，对应分段保持解析器的结果
+			if !acquire(ctx, sem) {
+				return
 			}
-		}(i, result)
+			defer func() { <-sem }()
+			for _, index := range indexesByTag[tag] {
+				reportProgress(ctx, api.StageEmotion, index)
+			}
+			predicted, confidence := l.requestEmotion(ctx, tag, threshold)
+			resultsChannel <- struct {
+				tag        string
+				Predicted  string
+				Confidence float64
+			}{
+				tag, predicted, confidence,
+			}
+		}(tag)
 	}
 
 	go func() {
@@ -86,98 +312,915 @@ func (l *LingChatService) EmoPredictBatch(ctx context.Context, results []Result)
 	}()
 
 	for result := range resultsChannel {
-		index := result.index
-		results[index].Confidence = result.Confidence
-		results[index].Predicted = result.Predicted
+		for _, index := range indexesByTag[result.tag] {
+			results[index].Confidence = result.Confidence
+			results[index].Predicted = result.Predicted
+		}
 	}
 	return results
 }
 
-func (l *LingChatService) LingChatByWS(ctx context.Context, msg api.Message) ([]api.Response, error) {
+// useTagEmotions 不预测情绪时直接使用LLM给出的情绪标签，没有标签的分段保持默认情绪
+func useTagEmotions(results []Result) {
+	for i := range results {
+		if results[i].OriginalTag != "" {
+			results[i].Predicted = results[i].OriginalTag
+			results[i].Confidence = 1.0
+		}
+	}
+}
+
+// newSemaphore 返回容量为MaxConcurrency的信号量，用于限制n个分段的并发请求数。
+// n<=0表示分段数事先未知（见Pipeline），此时MaxConcurrency也不限制时返回nil，acquire总是成功
+func (l *LingChatService) newSemaphore(ctx context.Context, n int) chan struct{} {
+	limit := l.settingsFrom(ctx).MaxConcurrency
+	if n <= 0 {
+		if limit <= 0 {
+			return nil
+		}
+		return make(chan struct{}, limit)
+	}
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	return make(chan struct{}, max(limit, 1))
+}
+
+// acquire 获取信号量，ctx结束时放弃等待并返回false，避免取消后goroutine继续排队
+func acquire(ctx context.Context, sem chan struct{}) bool {
+	if sem == nil {
+		return true
+	}
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// PredictEmotion 直接调用情绪预测服务，threshold为置信度阈值
+func (l *LingChatService) PredictEmotion(ctx context.Context, text string, threshold float64) (*emotionPredictor.PredictionResponse, error) {
+	var resp *emotionPredictor.PredictionResponse
+	err := l.EmotionBreaker.Do(func() error {
+		var err error
+		resp, err = l.emotionPredictorClient.Predict(ctx, text, threshold)
+		return err
+	})
+	return resp, err
+}
+
+// predictEmotion 预测单个情绪标签，EmotionCache中有结果时直接使用，失败时返回unknown（配置了EmotionLabels时为其Fallback）
+func (l *LingChatService) predictEmotion(ctx context.Context, tag string) (string, float64) {
+	threshold := l.settingsFrom(ctx).EmotionThreshold
+	if resp, ok := l.EmotionCache.get(tag, threshold, l.now()); ok {
+		return l.knownEmotion(ctx, tag, resp.Label), resp.Confidence
+	}
+	return l.requestEmotion(ctx, tag, threshold)
+}
+
+// requestEmotion 请求情绪预测服务预测单个标签，成功的结果存入EmotionCache
+func (l *LingChatService) requestEmotion(ctx context.Context, tag string, threshold float64) (string, float64) {
+	ctx, span := tracing.Start(ctx, "emotion.predict", attribute.String("tag", tag))
+	start := time.Now()
+	resp, err := l.PredictEmotion(ctx, tag, threshold)
+	tracing.End(span, err)
+	if err != nil {
+		metrics.ObserveEmotion(start, unknownEmotion, err)
+		logging.FromContext(ctx).Warn("情绪预测失败", "tag", tag, "err", err)
+		return l.knownEmotion(ctx, tag, unknownEmotion), 0.0
+	}
+	metrics.ObserveEmotion(start, resp.Label, nil)
+	l.EmotionCache.put(tag, threshold, *resp, l.now())
+	return l.knownEmotion(ctx, tag, resp.Label), resp.Confidence
+}
+
+// useCachedEmotions 用EmotionCache中的预测结果填充对应的分段，返回缓存中没有、仍需请求的标签
+func (l *LingChatService) useCachedEmotions(ctx context.Context, results []Result, tags []string, indexesByTag map[string][]int, threshold float64) []string {
+	if l.EmotionCache == nil {
+		return tags
+	}
+	now := l.now()
+	missing := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		resp, ok := l.EmotionCache.get(tag, threshold, now)
+		if !ok {
+			missing = append(missing, tag)
+			continue
+		}
+		for _, index := range indexesByTag[tag] {
+			reportProgress(ctx, api.StageEmotion, index)
+			results[index].Confidence = resp.Confidence
+			results[index].Predicted = l.knownEmotion(ctx, tag, resp.Label)
+		}
+	}
+	return missing
+}
+
+// predictEmotionBatch 一次请求预测tags中的全部标签，成功的结果存入EmotionCache，服务端不支持批量时返回ErrBatchUnsupported
+func (l *LingChatService) predictEmotionBatch(ctx context.Context, batch emotionPredictor.BatchPredictor, tags []string, threshold float64) ([]emotionPredictor.PredictionResponse, error) {
+	ctx, span := tracing.Start(ctx, "emotion.predict_batch", attribute.Int("tags", len(tags)))
+	start := time.Now()
+	var predictions []emotionPredictor.PredictionResponse
+	var unsupported error
+	err := l.EmotionBreaker.Do(func() error {
+		var err error
+		predictions, err = batch.PredictBatch(ctx, tags, threshold)
+		if errors.Is(err, emotionPredictor.ErrBatchUnsupported) {
+			// 不支持批量不代表服务不可用，不计入熔断
+			unsupported = err
+			return nil
+		}
+		return err
+	})
+	if unsupported != nil {
+		span.End()
+		return nil, unsupported
+	}
+	tracing.End(span, err)
+	if err != nil {
+		metrics.ObserveEmotionBatch(start, nil, err)
+		return nil, err
+	}
+	now := l.now()
+	labels := make([]string, len(predictions))
+	for i, prediction := range predictions {
+		labels[i] = prediction.Label
+		l.EmotionCache.put(tags[i], threshold, prediction, now)
+	}
+	metrics.ObserveEmotionBatch(start, labels, nil)
+	return predictions, nil
+}
+
+// userVoice 当前用户设置了偏好说话人、语速时使用它们，否则使用VITS客户端的默认设置。
+// 用户偏好中的说话人优先于User上的speaker_id
+func (l *LingChatService) userVoice(ctx context.Context) VitsTTS.Voice {
+	voice := l.defaultVoice()
+	if speaker, ok := l.chosenSpeaker(ctx); ok {
+		voice.SpeakerID = speaker
+	}
+	if prefs := l.storedPreferences(ctx); prefs != nil && prefs.Speed != nil {
+		voice.Speed = *prefs.Speed
+	}
+	return voice
+}
+
+// chosenSpeaker 用户自己选择的说话人，偏好中的优先于账号中的；都没有选择时ok为false
+func (l *LingChatService) chosenSpeaker(ctx context.Context) (speaker int, ok bool) {
+	if prefs := l.storedPreferences(ctx); prefs != nil && prefs.SpeakerID != nil {
+		return *prefs.SpeakerID, true
+	}
+	if user := common.GetUserFromContext(ctx); user != nil && user.SpeakerID != nil {
+		return *user.SpeakerID, true
+	}
+	return 0, false
+}
+
+// now Clock的当前时间
+func (l *LingChatService) now() time.Time {
+	if l.Clock == nil {
+		return time.Now()
+	}
+	return l.Clock()
+}
+
+// defaultVoice VITS客户端的默认设置，没有VitsTTSClient时使用说话人0、默认语速和音调
+func (l *LingChatService) defaultVoice() VitsTTS.Voice {
+	if l.VitsTTSClient == nil {
+		return VitsTTS.Voice{}
+	}
+	return l.VitsTTSClient.DefaultVoice()
+}
+
+// ttsProvider 实际用于合成语音的后端
+func (l *LingChatService) ttsProvider() VitsTTS.TTSProvider {
+	if l.TTSProvider != nil {
+		return l.TTSProvider
+	}
+	return l.VitsTTSClient
+}
+
+// voiceVITS 合成单个分段的语音并记录耗时
+func (l *LingChatService) voiceVITS(ctx context.Context, text string, voice VitsTTS.Voice) ([]byte, error) {
+	ctx, span := tracing.Start(ctx, "tts.synthesize",
+		attribute.Int("text_length", utf8.RuneCountInString(text)),
+		attribute.Int("speaker_id", voice.SpeakerID),
+	)
+	start := time.Now()
+	provider := l.ttsProvider()
+	var audioData []byte
+	err := l.TTSBreaker.Do(func() error {
+		var err error
+		audioData, err = provider.VoiceVITS(ctx, text, voice)
+		return err
+	})
+	err = emptyAudio(audioData, err)
+	metrics.ObserveTTS(start, err)
+	tracing.End(span, err)
+	return audioData, err
+}
+
+// emptyAudio VITS返回成功但没有音频时计入TTSEmptyAudio并返回ErrEmptyAudio，其余情况原样返回err
+func emptyAudio(data []byte, err error) error {
+	if err != nil || len(data) != 0 {
+		return err
+	}
+	metrics.TTSEmptyAudio.Inc()
+	return errs.ErrEmptyAudio
+}
+
+// acceptWSMessage 检查WS消息类型，只有message类型需要进入聊天流程
+func acceptWSMessage(ctx context.Context, msg api.Message) (bool, error) {
 	switch msg.Type {
-	case "message":
-	case "handshake":
-		log.Printf("handshake with message:\"%s\"\n", msg.Content)
-		return nil, nil
-	case "ping":
-		log.Println("Ping received, Pong")
-		return nil, nil
+	case api.MessageTypeMessage:
+		return true, nil
+	case api.MessageTypeHandshake:
+		logging.FromContext(ctx).Info("handshake", "content", msg.Content)
+		return false, nil
+	case api.MessageTypePing:
+		logging.FromContext(ctx).Debug("ping received")
+		return false, nil
 	default:
-		return nil, fmt.Errorf("invalid type \"%s\" with message: \"%s\"", msg.Type, msg.Content)
+		return false, fmt.Errorf("%w \"%s\" with message: \"%s\"", errs.ErrInvalidMessageType, msg.Type, msg.Content)
 	}
+}
 
-	resp, err := l.LingChat(ctx, msg.Content, "", "")
+func (l *LingChatService) LingChatByWS(ctx context.Context, msg api.Message) ([]api.Response, error) {
+	if ok, err := acceptWSMessage(ctx, msg); !ok {
+		return nil, err
+	}
+	session, conversationID, err := l.sessionConversation(ctx, msg.SessionID)
 	if err != nil {
 		return nil, err
 	}
+	if session != nil {
+		ctx = withVoiceSession(ctx, session.ID)
+	}
+
+	key, ok := l.idempotencyKey(ctx, msg)
+	if !ok {
+		resp, err := l.LingChat(ctx, msg.Content, conversationID, "")
+		if moderated(err) {
+			return resp.Messages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		l.titleSession(ctx, session, msg.Content)
+		return resp.Messages, nil
+	}
+
+	resp, replayed, err := l.idempotency.do(ctx, key, msg.Content, l.IdempotencyTTL, func() ([]api.Response, error) {
+		resp, err := l.LingChat(ctx, msg.Content, conversationID, "")
+		if moderated(err) {
+			return resp.Messages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		l.titleSession(ctx, session, msg.Content)
+		return resp.Messages, nil
+	})
+	if replayed {
+		logging.FromContext(ctx).Info("重复的幂等键，返回之前的回复", "idempotency_key", msg.IdempotencyKey)
+	}
+	return resp, err
+}
+
+// LingChatByWSStream 与LingChatByWS相同，但每个分段准备好后立即通过emit推送。
+// 带幂等键的重试在之前的回复完成后一次性推送全部分段
+func (l *LingChatService) LingChatByWSStream(ctx context.Context, msg api.Message, emit func(api.Response) error) error {
+	if ok, err := acceptWSMessage(ctx, msg); !ok {
+		return err
+	}
+	session, conversationID, err := l.sessionConversation(ctx, msg.SessionID)
+	if err != nil {
+		return err
+	}
+	if session != nil {
+		ctx = withVoiceSession(ctx, session.ID)
+	}
+
+	key, ok := l.idempotencyKey(ctx, msg)
+	if !ok {
+		_, err := l.LingChatStream(ctx, msg.Content, conversationID, "", emit)
+		if moderated(err) {
+			return nil
+		}
+		if err == nil {
+			l.titleSession(ctx, session, msg.Content)
+		}
+		return err
+	}
+
+	resp, replayed, err := l.idempotency.do(ctx, key, msg.Content, l.IdempotencyTTL, func() ([]api.Response, error) {
+		var sent []api.Response
+		_, err := l.LingChatStream(ctx, msg.Content, conversationID, "", func(resp api.Response) error {
+			sent = append(sent, resp)
+			return emit(resp)
+		})
+		if moderated(err) {
+			return sent, nil
+		}
+		if err == nil {
+			l.titleSession(ctx, session, msg.Content)
+		}
+		return sent, err
+	})
+	if err != nil || !replayed {
+		return err
+	}
+	logging.FromContext(ctx).Info("重复的幂等键，返回之前的回复", "idempotency_key", msg.IdempotencyKey)
+	for _, r := range resp {
+		if err := emit(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withRequestTimeout 为单次聊天请求加上RequestTimeout和本次请求的重试预算
+func (l *LingChatService) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = retrybudget.WithBudget(ctx, retrybudget.New(l.RetryBudget, l.RetryBudgetWait))
+	if l.RequestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, l.RequestTimeout)
+}
+
+// withLLMTimeout 为LLM调用加上LLMTimeout
+func (l *LingChatService) withLLMTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.LLMTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, l.LLMTimeout)
+}
 
-	return resp.Messages, nil
+// llmTimedOut LLM调用因LLMTimeout而不是请求本身的截止时间结束
+func llmTimedOut(ctx, llmCtx context.Context) bool {
+	return errors.Is(llmCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
 }
 
+// LingChat 完成一轮对话。LLM回复后如果超时，已完成的分段照常返回，
+// 未完成的分段缺少语音或情绪，并将响应标记为Truncated。
+// 用户消息或LLM回复未通过内容审核时，返回只有安全回复的resp和包装了errs.ErrModerated的错误
 func (l *LingChatService) LingChat(ctx context.Context, message string, conversationID, prevMessageID string) (*response.CompletionResponse, error) {
-	cleanTempVoiceFiles(l.tempFilePath)
+	message, err := sanitizeMessage(message, l.MaxMessageLength, l.StripControlChars)
+	if err != nil {
+		return nil, err
+	}
+	ctx, endTurn, err := l.turns.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endTurn()
+	ctx = l.withSettings(logging.EnsureRequestID(ctx))
+	ctx = l.withPreferences(ctx)
+	ctx, cancel := l.withRequestTimeout(ctx)
+	defer cancel()
+	// 排队时间计入请求超时，等到超时的对话直接丢弃
+	release, err := l.acquireTurn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	status := metrics.StatusFailure
+	defer func() { metrics.ChatRequests.WithLabelValues(status).Inc() }()
+	ctx, span := tracing.Start(ctx, "LingChat", attribute.String("request_id", logging.RequestID(ctx)))
+	defer func() {
+		span.SetAttributes(attribute.String("status", status))
+		span.End()
+	}()
 
-	// 记录会话和消息
-	conv, userMsgObj, err := l.conversationService.RecordConversationAndMessage(ctx, message, conversationID, prevMessageID)
+	userEmotion := l.predictUserEmotion(ctx, message)
+	turn, emotionSegments, err := l.prepareReply(ctx, message, conversationID, prevMessageID)
+	if moderated(err) {
+		status = metrics.StatusModerated
+		return l.moderatedResponse(ctx, turn, conversationID, message), err
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// 获取消息链
-	messages, err := l.conversationService.GetChatContext(ctx, userMsgObj.ID)
+	emotionSegments = l.processSegments(ctx, emotionSegments)
+	// 超时后仍需保存本轮对话和已得到的情绪
+	l.saveTurn(context.WithoutCancel(ctx), turn, emotionSegments)
+
+	parts := l.CreateResponse(emotionSegments, message)
+	truncated := ctx.Err() != nil
+	for i := range parts {
+		parts[i].Truncated = truncated
+		parts[i].RequestID = logging.RequestID(ctx)
+	}
+	debugRaw := debugRawResponse(ctx, turn.Reply)
+	if len(parts) > 0 {
+		parts[0].RawLLMResponse = debugRaw
+	}
+	resp := newCompletionResponse(turn.Conversation, turn.ReplyMessage, parts)
+	resp.RequestID = logging.RequestID(ctx)
+	resp.Truncated = truncated
+	resp.RawLLMResponse = debugRaw
+	if label, ok := userEmotion.result(); ok {
+		resp.UserEmotion = label
+		if len(parts) > 0 {
+			parts[0].UserEmotion = label
+		}
+	}
+	status = chatStatus(truncated)
+	return resp, nil
+}
+
+// LingChatStream 与LingChat流程相同，但不等待全部分段完成：
+// 每个分段的语音和情绪预测完成后，按PartIndex顺序调用emit推送。
+// emit返回错误后不再推送，但仍会等待已启动的分段处理结束
+func (l *LingChatService) LingChatStream(ctx context.Context, message string, conversationID, prevMessageID string, emit func(api.Response) error) (*response.CompletionResponse, error) {
+	message, err := sanitizeMessage(message, l.MaxMessageLength, l.StripControlChars)
 	if err != nil {
 		return nil, err
 	}
+	ctx, endTurn, err := l.turns.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endTurn()
+	ctx = l.withSettings(logging.EnsureRequestID(ctx))
+	ctx = l.withPreferences(ctx)
+	ctx, cancel := l.withRequestTimeout(ctx)
+	defer cancel()
+	// 排队时间计入请求超时，等到超时的对话直接丢弃
+	release, err := l.acquireTurn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	status := metrics.StatusFailure
+	defer func() { metrics.ChatRequests.WithLabelValues(status).Inc() }()
+	ctx, span := tracing.Start(ctx, "LingChatStream", attribute.String("request_id", logging.RequestID(ctx)))
+	defer func() {
+		span.SetAttributes(attribute.String("status", status))
+		span.End()
+	}()
 
-	// 调用LLM获取回复
-	rawLLMResp, err := l.llmClient.Chat(ctx, messages, l.ConfigModel)
+	userEmotion := l.predictUserEmotion(ctx, message)
+	turn, tasks, err := l.startReply(ctx, message, conversationID, prevMessageID)
+	if moderated(err) {
+		status = metrics.StatusModerated
+		resp := l.moderatedResponse(ctx, turn, conversationID, message)
+		if emitErr := emit(resp.Messages[0]); emitErr != nil {
+			return nil, emitErr
+		}
+		return resp, err
+	}
 	if err != nil {
-		err = fmt.Errorf("LLM Chat error: %w", err)
 		return nil, err
 	}
+	defer tasks.stop()
+	debugRaw := debugRawResponse(ctx, turn.Reply)
+
+	// 分段并发完成，这里按顺序推送
+	total := len(tasks.segments)
+	parts := make([]api.Response, 0, total)
+	smoothing := l.Smoother.start()
+	var emitErr error
+	for next, segment := range tasks.segments {
+		<-tasks.done[next]
+		smoothing.apply(segment)
+		segment.Motion = l.MotionMap.Motion(segment.Predicted)
+		part := l.createResponsePart(*segment, next, total, message)
+		part.Truncated = ctx.Err() != nil
+		part.RequestID = logging.RequestID(ctx)
+		if next == 0 {
+			part.RawLLMResponse = debugRaw
+			part.UserEmotion, _ = userEmotion.result()
+		}
+		parts = append(parts, part)
+		if emitErr == nil {
+			emitErr = emit(part)
+		}
+	}
+	l.saveTurn(context.WithoutCancel(ctx), turn, tasks.results())
+	if emitErr != nil {
+		return nil, emitErr
+	}
+
+	resp := newCompletionResponse(turn.Conversation, turn.ReplyMessage, parts)
+	resp.Truncated = ctx.Err() != nil
+	resp.RequestID = logging.RequestID(ctx)
+	resp.RawLLMResponse = debugRaw
+	resp.UserEmotion, _ = userEmotion.result()
+	status = chatStatus(resp.Truncated)
+	return resp, nil
+}
+
+// chatStatus 聊天请求成功时的status标签
+func chatStatus(truncated bool) string {
+	if truncated {
+		return metrics.StatusTruncated
+	}
+	return metrics.StatusSuccess
+}
+
+// saveTurn 保存本轮的用户消息、回复和各分段预测的情绪，失败时只记录日志，照常返回回复
+func (l *LingChatService) saveTurn(ctx context.Context, turn *Turn, results []Result) {
+	if err := l.conversationService.SaveTurn(ctx, turn, results); err != nil {
+		logging.FromContext(ctx).Error("保存对话失败", "conversation_id", turn.Conversation.ID, "err", err)
+	}
+}
+
+// dominantEmotion 返回出现次数最多的预测情绪，次数相同时取先出现的
+func dominantEmotion(results []Result) string {
+	counts := make(map[string]int)
+	dominant := ""
+	for _, result := range results {
+		if result.Predicted == "" {
+			continue
+		}
+		counts[result.Predicted]++
+		if counts[result.Predicted] > counts[dominant] {
+			dominant = result.Predicted
+		}
+	}
+	return dominant
+}
+
+// debugRawResponse 调试请求（common.WithDebug）返回raw，其他请求返回空字符串
+func debugRawResponse(ctx context.Context, raw string) string {
+	if !common.IsDebug(ctx) {
+		return ""
+	}
+	return raw
+}
+
+// prepareReply 确定本轮对话，调用LLM获取回复（turn.Reply）并解析出情绪分段。
+// 用户消息和回复此时还没有保存，由调用方在处理完分段后用saveTurn一起保存，LLM调用失败时整轮都不保存。
+// 用户消息未通过审核时不记录也不调用LLM；回复未通过审核时直接保存安全回复代替原回复，
+// 两种情况都返回包装了errs.ErrModerated的错误
+func (l *LingChatService) prepareReply(ctx context.Context, message string, conversationID, prevMessageID string) (*Turn, []Result, error) {
+	turn, messages, err := l.beginTurn(ctx, message, conversationID, prevMessageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	rawLLMResp, err := l.chatLLM(ctx, messages, func(llmCtx context.Context) (string, error) {
+		return l.llmClient.Chat(llmCtx, messages, l.ConfigModel)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := l.acceptReply(ctx, turn, rawLLMResp); err != nil {
+		return turn, nil, err
+	}
+	return turn, l.parseReply(ctx, turn), nil
+}
+
+// beginTurn 审核用户消息，确定本轮对话并返回发给LLM的消息
+func (l *LingChatService) beginTurn(ctx context.Context, message string, conversationID, prevMessageID string) (*Turn, []openai.ChatCompletionMessage, error) {
+	if err := l.checkInput(ctx, message); err != nil {
+		return nil, nil, err
+	}
 
-	// 将助手回复保存到数据库
-	respMsg, err := l.conversationService.SaveAssistantMessage(ctx, userMsgObj.ID, rawLLMResp)
+	// 确定会话和用户消息接在哪条消息之后
+	turn, err := l.conversationService.PrepareTurn(ctx, message, conversationID, prevMessageID)
 	if err != nil {
-		log.Printf("保存助手回复失败: %s", err)
+		return nil, nil, err
 	}
 
-	emotionSegments := AnalyzeEmotions(rawLLMResp, l.tempFilePath, "wav")
+	// 获取消息链
+	messages, err := l.conversationService.TurnContext(ctx, turn)
+	if err != nil {
+		return nil, nil, err
+	}
+	messages = limitHistoryTurns(messages, l.HistoryTurns)
+	messages = trimHistory(messages, l.MaxHistoryTokens, l.TokenEstimator)
+	return turn, messages, nil
+}
+
+// chatLLM 在LLMTimeout、熔断器和监控下用chat获取LLM回复，失败时按llmFallback改用兜底回复
+func (l *LingChatService) chatLLM(ctx context.Context, messages []openai.ChatCompletionMessage, chat func(llmCtx context.Context) (string, error)) (string, error) {
+	reportProgress(ctx, api.StageLLM, 0)
+	llmCtx, cancel := l.withLLMTimeout(ctx)
+	defer cancel()
+	llmCtx, span := tracing.Start(llmCtx, "llm.chat", attribute.String("model", l.ConfigModel), attribute.Int("messages", len(messages)))
+	start := time.Now()
+	var rawLLMResp string
+	err := l.LLMBreaker.Do(func() error {
+		var err error
+		rawLLMResp, err = chat(llmCtx)
+		return err
+	})
+	metrics.ObserveLLM(start, err)
+	tracing.End(span, err)
+	if err == nil {
+		return rawLLMResp, nil
+	}
+	// 兜底回复照常解析、合成语音并保存，LLM的错误只记录日志
+	if reply := l.llmFallback(ctx, llmCtx); reply != "" {
+		logging.FromContext(ctx).Error("LLM调用失败，使用兜底回复", "timeout", llmTimedOut(ctx, llmCtx), "err", err)
+		return reply, nil
+	}
+	if llmTimedOut(ctx, llmCtx) {
+		return "", fmt.Errorf("%w: LLM调用超过 %s: %w (%v)", errs.ErrLLM, l.LLMTimeout, llmCtx.Err(), err)
+	}
+	return "", fmt.Errorf("%w: %w", errs.ErrLLM, err)
+}
+
+// acceptReply 审核LLM回复，通过时记为turn.Reply
+func (l *LingChatService) acceptReply(ctx context.Context, turn *Turn, rawLLMResp string) error {
+	if err := l.checkOutput(ctx, rawLLMResp); err != nil {
+		// 不保存违规的回复，免得它作为历史再次发给LLM
+		turn.Reply = l.moderationReply()
+		l.saveTurn(ctx, turn, nil)
+		return err
+	}
+	turn.Reply = rawLLMResp
+	return nil
+}
+
+// parseReply 把turn.Reply解析为情绪分段
+func (l *LingChatService) parseReply(ctx context.Context, turn *Turn) []Result {
+	segments := AnalyzeEmotions(turn.Reply, l.tempFilePath, l.replyVoicePrefix(ctx, turn), l.audioFormat(), l.ParseConfig)
+	return l.prepareSegments(ctx, segments)
+}
+
+// replyVoicePrefix 本轮回复的语音文件名前缀。此时用户消息还没有ID，文件名中的消息ID用它的前一条消息，
+// 新对话还没有保存，对话ID和消息ID都为0
+func (l *LingChatService) replyVoicePrefix(ctx context.Context, turn *Turn) string {
+	return l.turnVoicePrefix(ctx, turn.Conversation.ID, turn.parentID())
+}
+
+// prepareSegments 清理解析出的分段，检测语言并执行Hooks
+func (l *LingChatService) prepareSegments(ctx context.Context, segments []Result) []Result {
+	segments = l.Sanitizer.Apply(segments)
+	// 按LLM的原文检测语言，不受Hooks插入的内容影响
+	l.LanguageRouter.Detect(segments)
+	l.runHooks(ctx, segments)
+	return segments
+}
+
+// audioFormat 语音文件格式，决定文件扩展名和内嵌音频的AudioFormat
+func (l *LingChatService) audioFormat() string {
+	if l.OutputFormat != "" {
+		return l.OutputFormat
+	}
+	if l.VitsTTSClient == nil || l.VitsTTSClient.AudioFormat == "" {
+		return VitsTTS.FormatWAV
+	}
+	return l.VitsTTSClient.AudioFormat
+}
+
+// processSegments 为全部分段批量合成语音并预测情绪
+func (l *LingChatService) processSegments(ctx context.Context, segments []Result) []Result {
+	if l.DryRun {
+		dryRunSegments(segments)
+		return segments
+	}
+
+	// 拼接后的语音放在第一个分段的文件中，分段合成失败前先记下文件名
+	concat := l.concatEnabled()
+	var combinedFile string
+	if concat && len(segments) > 0 {
+		combinedFile = segments[0].VoiceFile
+	}
 
 	// TODO: 这里两条会耦合使用emotionSegments的字段，后面要改
-	_, err = l.GenerateVoice(ctx, emotionSegments, true)
+	audioDataList, err := l.GenerateVoice(ctx, segments, l.userVoice(ctx), !l.InlineAudio && !concat)
+	if l.InlineAudio && !concat {
+		for i, data := range audioDataList {
+			l.attachAudio(&segments[i], data)
+		}
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("语音合成失败", "err", err)
+		// 合成失败的分段不返回音频文件，其余分段照常返回
+		var voiceErrs VoiceErrors
+		if errors.As(err, &voiceErrs) {
+			for idx := range voiceErrs {
+				segments[idx].VoiceFile = ""
+				segments[idx].AudioUnavailable = true
+			}
+		}
+	}
+	if concat {
+		l.concatAudio(ctx, segments, audioDataList, combinedFile)
+	}
+	if l.predictEmotions(ctx) {
+		return l.EmoPredictBatch(ctx, segments)
+	}
+	useTagEmotions(segments)
+	return segments
+}
+
+// concatEnabled 拼接只支持wav
+func (l *LingChatService) concatEnabled() bool {
+	return l.ConcatAudio && l.audioFormat() == VitsTTS.FormatWAV
+}
+
+// concatAudio 把各分段的语音按PartIndex顺序拼接后放在第一个分段，其余分段不再返回音频。
+// 拼接失败时记录错误，改为每个分段单独返回音频
+func (l *LingChatService) concatAudio(ctx context.Context, segments []Result, audioDataList [][]byte, combinedFile string) {
+	parts := make([][]byte, 0, len(audioDataList))
+	for _, data := range audioDataList {
+		if len(data) != 0 {
+			parts = append(parts, data)
+		}
+	}
+	if len(parts) == 0 {
+		for i := range segments {
+			segments[i].VoiceFile = ""
+		}
+		return
+	}
+
+	combined, err := VitsTTS.ConcatWAV(parts)
+	if err != nil {
+		logging.FromContext(ctx).Error("拼接语音失败，改为逐段返回", "err", err)
+		for i, data := range audioDataList {
+			if l.InlineAudio {
+				l.attachAudio(&segments[i], data)
+			} else if len(data) != 0 {
+				l.saveVoiceFile(ctx, segments[i].VoiceFile, data)
+			}
+		}
+		return
+	}
+
+	for i := range segments {
+		segments[i].VoiceFile = ""
+	}
+	segments[0].CombinedAudio = true
+	if l.InlineAudio {
+		l.attachAudio(&segments[0], combined)
+		return
+	}
+	segments[0].VoiceFile = combinedFile
+	l.saveVoiceFile(ctx, combinedFile, combined)
+}
+
+// dryRunSegments 演练模式下不合成语音也不预测情绪：分段没有音频，情绪取自标签
+func dryRunSegments(segments []Result) {
+	for i := range segments {
+		segments[i].VoiceFile = ""
+	}
+	useTagEmotions(segments)
+}
+
+// processSegment 为第idx个分段生成语音文件并预测情绪
+func (l *LingChatService) processSegment(ctx context.Context, idx int, segment *Result, voice VitsTTS.Voice) {
+	if l.DryRun {
+		segments := []Result{*segment}
+		dryRunSegments(segments)
+		*segment = segments[0]
+		return
+	}
+	ctx, span := tracing.Start(ctx, "segment", attribute.Int("index", segment.Index))
+	defer span.End()
+
+	if noVoiceText(*segment) {
+		segment.VoiceFile = ""
+	} else {
+		l.voiceSegment(ctx, idx, segment, voice)
+	}
+	if segment.OriginalTag == "" {
+		return
+	}
+	if l.predictEmotions(ctx) {
+		reportProgress(ctx, api.StageEmotion, idx)
+		segment.Predicted, segment.Confidence = l.predictEmotion(ctx, segment.OriginalTag)
+	} else {
+		segment.Predicted, segment.Confidence = segment.OriginalTag, 1.0
+	}
+}
+
+// voiceSegment 合成分段的语音，失败时分段标记为AudioUnavailable
+func (l *LingChatService) voiceSegment(ctx context.Context, idx int, segment *Result, voice VitsTTS.Voice) {
+	reportProgress(ctx, api.StageTTS, idx)
+	audioData, err := l.segmentAudio(ctx, idx, segment.JapaneseText, l.segmentVoice(ctx, voice, *segment))
+	if err != nil {
+		logging.FromContext(ctx).Error("语音合成失败", "segment", segment.Index, "err", err)
+		segment.VoiceFile = ""
+		segment.AudioUnavailable = true
+		return
+	}
+	segment.DurationMs = audioDurationMs(audioData)
+	if l.InlineAudio {
+		l.attachAudio(segment, audioData)
+	} else if len(audioData) != 0 {
+		l.saveVoiceFile(ctx, segment.VoiceFile, audioData)
+	}
+	l.reportSegmentAudio(ctx, idx, *segment)
+}
+
+// noVoiceText 分段没有要朗读的日语文本，不请求VITS、没有语音，但不算语音不可用
+func noVoiceText(segment Result) bool {
+	return strings.TrimSpace(segment.JapaneseText) == ""
+}
+
+// audioDurationMs 语音的时长（毫秒），音频为空或不是WAV（如转码为mp3）时为0
+func audioDurationMs(data []byte) int64 {
+	if len(data) == 0 {
+		return 0
+	}
+	d, err := VitsTTS.WAVDuration(data)
 	if err != nil {
-		log.Printf("GenerateVoice error: %s", err)
+		return 0
 	}
-	emotionSegments = l.EmoPredictBatch(ctx, emotionSegments)
+	return d.Milliseconds()
+}
 
-	return &response.CompletionResponse{
-		ConversationID: strconv.Itoa(int(conv.ID)),
-		MessageID:      strconv.Itoa(int(respMsg.ID)),
-		Messages:       l.CreateResponse(emotionSegments, message),
-	}, nil
+// attachAudio 内嵌音频时不落盘，分段直接携带音频数据
+func (l *LingChatService) attachAudio(segment *Result, data []byte) {
+	segment.Audio = data
+	segment.AudioFormat = l.audioFormat()
+	segment.VoiceFile = ""
+}
+
+func newCompletionResponse(conv *ent.Conversation, respMsg *ent.ConversationMessage, messages []api.Response) *response.CompletionResponse {
+	resp := &response.CompletionResponse{Messages: messages}
+	// 新对话保存失败时还没有ID
+	if conv.ID != 0 {
+		resp.ConversationID = strconv.Itoa(int(conv.ID))
+	}
+	if respMsg != nil {
+		resp.MessageID = strconv.Itoa(int(respMsg.ID))
+	}
+	return resp
 }
 
 func (l *LingChatService) CreateResponse(results []Result, userMessage string) []api.Response {
 	var resp []api.Response
 	for i, result := range results {
-		resp = append(resp, api.Response{
-			Type:            "reply",
-			Emotion:         result.Predicted,
-			OriginalTag:     result.OriginalTag,
-			Message:         result.FollowingText,
-			MotionText:      result.MotionText,
-			AudioFile:       filepath.Base(result.VoiceFile),
-			OriginalMessage: userMessage,
-			IsMultiPart:     true,
-			PartIndex:       i,
-			TotalParts:      len(results),
-		})
+		result.Motion = l.MotionMap.Motion(result.Predicted)
+		resp = append(resp, l.createResponsePart(result, i, len(results), userMessage))
+	}
+	return resp
+}
+
+// createResponsePart 构造多段回复中的一段
+func (l *LingChatService) createResponsePart(result Result, index, total int, userMessage string) api.Response {
+	resp := api.Response{
+		Type:             "reply",
+		Emotion:          result.Predicted,
+		OriginalTag:      result.OriginalTag,
+		Message:          result.FollowingText,
+		MotionText:       result.MotionText,
+		Motion:           result.Motion,
+		AudioFile:        l.audioURL(result.VoiceFile),
+		OriginalMessage:  userMessage,
+		IsMultiPart:      true,
+		PartIndex:        index,
+		TotalParts:       total,
+		CombinedAudio:    result.CombinedAudio,
+		DurationMs:       result.DurationMs,
+		AudioUnavailable: result.AudioUnavailable,
+	}
+	if len(result.Audio) != 0 {
+		resp.AudioData = base64.StdEncoding.EncodeToString(result.Audio)
+		resp.AudioFormat = result.AudioFormat
 	}
 	return resp
 }
 
-func (l *LingChatService) GenerateVoice(ctx context.Context, textSegments []Result, saveFile bool) ([][]byte, error) {
+// audioURL 返回给前端的音频地址，本地存储时为文件名，没有音频时为空
+func (l *LingChatService) audioURL(voiceFile string) string {
+	if voiceFile == "" {
+		return ""
+	}
+	return l.storage().URL(voiceKey(voiceFile))
+}
+
+// VoiceErrors 记录GenerateVoice中失败的分段，key为分段下标
+type VoiceErrors map[int]error
+
+func (e VoiceErrors) Error() string {
+	indexes := slices.Sorted(maps.Keys(e))
+	parts := make([]string, 0, len(indexes))
+	for _, idx := range indexes {
+		parts = append(parts, fmt.Sprintf("segment %d: %v", idx, e[idx]))
+	}
+	return fmt.Sprintf("%d segments failed: %s", len(e), strings.Join(parts, "; "))
+}
+
+// Is 使errors.Is(err, errs.ErrTTS)能匹配语音合成失败
+func (e VoiceErrors) Is(target error) bool {
+	return target == errs.ErrTTS
+}
+
+func (e VoiceErrors) Unwrap() []error {
+	unwrapped := make([]error, 0, len(e))
+	for _, idx := range slices.Sorted(maps.Keys(e)) {
+		unwrapped = append(unwrapped, e[idx])
+	}
+	return unwrapped
+}
+
+// GenerateVoice 以voice并发合成每个分段的语音，返回的音频与分段一一对应，并记下每个分段的DurationMs。
+// 部分分段失败时，成功的音频照常返回，错误为按分段下标记录的VoiceErrors。
+// 没有日语文本的分段不请求VITS，音频为nil并清空VoiceFile
+func (l *LingChatService) GenerateVoice(ctx context.Context, textSegments []Result, voice VitsTTS.Voice, saveFile bool) ([][]byte, error) {
+	ctx, span := tracing.Start(ctx, "GenerateVoice", attribute.Int("segments", len(textSegments)))
+	defer span.End()
+
 	// 创建一个带缓冲的通道来收集结果
 	results := make(chan struct {
 		index int
@@ -187,20 +1230,35 @@ func (l *LingChatService) GenerateVoice(ctx context.Context, textSegments []Resu
 
 	// 创建 WaitGroup
 	var wg sync.WaitGroup
-	wg.Add(len(textSegments))
+	sem := l.newSemaphore(ctx, len(textSegments))
 
-	// 为每个文本片段启动一个goroutine
+	// 为每个文本片段启动一个goroutine，同时进行的请求数受MaxConcurrency限制；没有日语文本的分段不合成
 	for i, segment := range textSegments {
-		go func(idx int, text string) {
+		if noVoiceText(segment) {
+			textSegments[i].VoiceFile = ""
+			continue
+		}
+		wg.Add(1)
+		go func(idx int, text string, voice VitsTTS.Voice) {
 			defer wg.Done()
+			if !acquire(ctx, sem) {
+				results <- struct {
+					index int
+					data  []byte
+					err   error
+				}{idx, nil, ctx.Err()}
+				return
+			}
+			defer func() { <-sem }()
 			// 调用VITS TTS服务生成语音
-			audioData, err := l.VitsTTSClient.VoiceVITS(ctx, text)
+			reportProgress(ctx, api.StageTTS, idx)
+			audioData, err := l.voiceVITS(ctx, text, voice)
 			results <- struct {
 				index int
 				data  []byte
 				err   error
 			}{idx, audioData, err}
-		}(i, segment.JapaneseText)
+		}(i, segment.JapaneseText, l.segmentVoice(ctx, voice, segment))
 	}
 
 	// 等待所有goroutine完成
@@ -211,68 +1269,81 @@ func (l *LingChatService) GenerateVoice(ctx context.Context, textSegments []Resu
 
 	// 收集所有结果
 	audioDataList := make([][]byte, len(textSegments))
-	var firstErr error
+	voiceErrs := VoiceErrors{}
 
 	// 从通道中读取结果
 	for result := range results {
-		if result.err != nil && firstErr == nil {
-			firstErr = result.err
+		if result.err != nil {
+			voiceErrs[result.index] = result.err
+			continue
 		}
 		audioDataList[result.index] = result.data
+		textSegments[result.index].DurationMs = audioDurationMs(result.data)
 
 		// 如果保存文件，将音频数据写入文件
 		if saveFile && len(result.data) != 0 {
-			voiceFile := textSegments[result.index].VoiceFile
-			// 确保目录存在
-			dir := filepath.Dir(voiceFile)
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				log.Printf("Failed to create directory %s: %v", dir, err)
-				continue
-			}
-
-			// 写入文件
-			if err := os.WriteFile(voiceFile, result.data, 0644); err != nil {
-				log.Printf("Failed to write file %s: %v", voiceFile, err)
-				continue
-			}
+			l.saveVoiceFile(ctx, textSegments[result.index].VoiceFile, result.data)
 		}
 	}
 
-	return audioDataList, firstErr
+	if len(voiceErrs) != 0 {
+		span.RecordError(voiceErrs)
+		return audioDataList, voiceErrs
+	}
+	return audioDataList, nil
 }
 
-func cleanTempVoiceFiles(tempVoiceDir string) {
-	// 检查目录是否存在
-	if _, err := os.Stat(tempVoiceDir); err == nil {
-		// 获取所有.wav文件
-		wavFiles, err := filepath.Glob(filepath.Join(tempVoiceDir, "*.wav"))
-		if err != nil {
-			fmt.Printf("查找wav文件时出错: %v\n", err)
-			return
-		}
+// segmentVoice 分段为SSML时以SSML合成；用户没有选择说话人且配置了分段语言的说话人时使用该说话人，
+// 检测不出语言时按用户偏好的语言选择，其余参数沿用voice
+func (l *LingChatService) segmentVoice(ctx context.Context, voice VitsTTS.Voice, segment Result) VitsTTS.Voice {
+	voice.SSML = segment.SSML
+	if _, ok := l.chosenSpeaker(ctx); ok {
+		return voice
+	}
+	lang := segment.Language
+	if lang == "" {
+		lang = l.preferredLanguage(ctx)
+	}
+	voice.SpeakerID = l.LanguageRouter.Speaker(lang, voice.SpeakerID)
+	return voice
+}
 
-		// 删除每个文件
-		for _, file := range wavFiles {
-			if err := os.Remove(file); err != nil {
-				fmt.Printf("删除文件 %s 时出错: %v\n", file, err)
-			}
-		}
+// storage Storage未设置时与默认一样写入tempFilePath
+func (l *LingChatService) storage() storage.Storage {
+	if l.Storage == nil {
+		return storage.NewLocal(l.tempFilePath)
+	}
+	return l.Storage
+}
+
+// voiceKey 分段的VoiceFile在存储中的key，即不含目录的文件名
+func voiceKey(voiceFile string) string {
+	return filepath.Base(voiceFile)
+}
+
+// saveVoiceFile 将音频数据写入存储，失败时只记录日志
+func (l *LingChatService) saveVoiceFile(ctx context.Context, voiceFile string, data []byte) {
+	if err := l.storage().Put(ctx, voiceKey(voiceFile), data); err != nil {
+		logging.FromContext(ctx).Error("保存语音文件失败", "file", voiceFile, "err", err)
 	}
 }
 
-func (l *LingChatService) ChatHandler(rawMsg []byte) ([]api.Sentence, error) {
+// ChatHandler 处理一条WS消息，超时由RequestTimeout控制。
+// 每条消息生成一个请求ID，日志和响应中都会带上
+func (l *LingChatService) ChatHandler(ctx context.Context, rawMsg []byte) ([]api.Sentence, error) {
+	ctx = logging.WithRequestID(ctx, logging.NewRequestID())
+	logger := logging.FromContext(ctx)
+
 	var msg api.Message
 	err := json.Unmarshal(rawMsg, &msg)
 	if err != nil {
-		err = fmt.Errorf("JSON 解析错误: %w", err)
-		log.Println(err)
-		return nil, err
+		err = fmt.Errorf("%w: JSON 解析错误: %w", errs.ErrInvalidMessage, err)
+		logger.Warn("解析WS消息失败", "err", err)
+		return nil, withRequestID(ctx, err)
 	}
 
-	resp, err := l.LingChatByWS(context.Background(), msg)
+	resp, err := l.HandleMessage(ctx, msg)
 	if err != nil {
-		err = fmt.Errorf("LingChat error: %w", err)
-		log.Println(err)
 		return nil, err
 	}
 
@@ -280,8 +1351,7 @@ func (l *LingChatService) ChatHandler(rawMsg []byte) ([]api.Sentence, error) {
 	for _, msg := range resp {
 		msgJSON, err := json.Marshal(msg)
 		if err != nil {
-			err = fmt.Errorf("JSON 序列化错误: %w", err)
-			log.Println(err)
+			logger.Error("JSON 序列化错误", "err", err)
 		}
 		respSentences = append(respSentences, msgJSON)
 	}
@@ -289,6 +1359,127 @@ func (l *LingChatService) ChatHandler(rawMsg []byte) ([]api.Sentence, error) {
 	return respSentences, nil
 }
 
+// HandleMessage 处理一条已解析的消息，返回全部回复分段，ChatHandler和REST接口共用。
+// ctx中没有请求ID时生成一个，返回的错误带有请求ID
+func (l *LingChatService) HandleMessage(ctx context.Context, msg api.Message) ([]api.Response, error) {
+	ctx = logging.EnsureRequestID(ctx)
+	resp, err := l.LingChatByWS(ctx, msg)
+	if err != nil {
+		err = fmt.Errorf("LingChat error: %w", err)
+		logging.FromContext(ctx).Error("处理聊天失败", "err", err)
+		return nil, withRequestID(ctx, err)
+	}
+	return resp, nil
+}
+
+// ChatHandlerStream 与ChatHandler相同，但每个回复分段准备好后立即通过send发送。
+// 消息按type分发（见wsDispatcher），格式错误或类型未知时返回带请求ID的错误
+func (l *LingChatService) ChatHandlerStream(ctx context.Context, rawMsg []byte, send func([]byte) error) error {
+	ctx = logging.WithRequestID(ctx, logging.NewRequestID())
+	if err := l.dispatcher.ServeMessage(ctx, rawMsg, send); err != nil {
+		logger := logging.FromContext(ctx)
+		switch errs.Code(err) {
+		case errs.CodeInvalidMessage, errs.CodeInvalidMessageType:
+			logger.Warn("无法处理WS消息", "err", err)
+		default:
+			logger.Error("处理聊天失败", "err", err)
+		}
+		return withRequestID(ctx, err)
+	}
+	return nil
+}
+
+// wsDispatcher 注册每种WS消息的处理器
+func (l *LingChatService) wsDispatcher() *api.Dispatcher {
+	d := api.NewDispatcher()
+	api.On(d, api.MessageTypeMessage, l.handleChatMessage)
+	api.On(d, api.MessageTypeHandshake, func(ctx context.Context, msg api.HandshakeMessage, _ func([]byte) error) error {
+		logging.FromContext(ctx).Info("handshake", "content", msg.Content)
+		return nil
+	})
+	api.On(d, api.MessageTypePing, func(ctx context.Context, _ api.PingMessage, _ func([]byte) error) error {
+		logging.FromContext(ctx).Debug("ping received")
+		return nil
+	})
+	return d
+}
+
+// handleChatMessage 处理一条聊天消息，每个回复分段准备好后立即通过send发送
+func (l *LingChatService) handleChatMessage(ctx context.Context, msg api.Message, send func([]byte) error) error {
+	// 进度事件由各分段的goroutine发送，与回复分段共用send时需要串行化
+	var sendMu sync.Mutex
+	sendResponse := func(resp api.Response) error {
+		msgJSON, err := json.Marshal(resp)
+		if err != nil {
+			logging.FromContext(ctx).Error("JSON 序列化错误", "err", err)
+			return nil
+		}
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return send(msgJSON)
+	}
+	if l.ProgressEvents {
+		ctx = WithProgress(ctx, func(resp api.Response) { _ = sendResponse(resp) })
+	}
+	if l.PredictUserEmotion {
+		ctx = WithUserEmotion(ctx, func(resp api.Response) { _ = sendResponse(resp) })
+	}
+	if l.TextFirst {
+		ctx = WithSegmentEvents(ctx, func(resp api.Response) { _ = sendResponse(resp) })
+	}
+	if l.StreamAudio {
+		ctx = WithAudioChunks(ctx, func(resp api.Response) { _ = sendResponse(resp) })
+	}
+	err := l.LingChatByWSStream(ctx, msg, sendResponse)
+	if err != nil {
+		return fmt.Errorf("LingChat error: %w", err)
+	}
+	return nil
+}
+
+// withRequestID 在返回给用户的错误中附带请求ID，便于反馈问题时定位日志
+func withRequestID(ctx context.Context, err error) error {
+	return fmt.Errorf("%w (request_id: %s)", err, logging.RequestID(ctx))
+}
+
+// GetRecentMessages 获取当前用户最近的消息，见ConversationService.GetRecentMessages
+func (l *LingChatService) GetRecentMessages(ctx context.Context, limit int, before string) ([]*ent.ConversationMessage, string, error) {
+	return l.conversationService.GetRecentMessages(ctx, limit, before)
+}
+
+// ReloadMotions 重新加载情绪到动作的映射文件
+func (l *LingChatService) ReloadMotions() error {
+	if l.MotionMap == nil {
+		return errors.New("未配置动作映射")
+	}
+	if err := l.MotionMap.Reload(); err != nil {
+		return err
+	}
+	// 运行中不因为映射不完整而拒绝重新加载，只提示
+	if err := l.CheckMotionCoverage(); err != nil {
+		logging.FromContext(context.Background()).Warn("动作映射不完整，这些情绪将使用默认动作", "err", err)
+	}
+	return nil
+}
+
+// ListSpeakers 返回VITS服务可用的说话人
+func (l *LingChatService) ListSpeakers(ctx context.Context) ([]VitsTTS.Speaker, error) {
+	if l.VitsTTSClient == nil {
+		return nil, fmt.Errorf("%w: 语音合成后端不支持列出说话人", errs.ErrTTS)
+	}
+	return l.VitsTTSClient.ListSpeakers(ctx)
+}
+
+// DeleteHistory 删除当前用户的全部聊天记录，hard为false时软删除
+func (l *LingChatService) DeleteHistory(ctx context.Context, hard bool) (int, error) {
+	return l.conversationService.DeleteHistory(ctx, hard)
+}
+
+// EmotionStats 统计当前用户在[from, to)内各情绪出现的次数
+func (l *LingChatService) EmotionStats(ctx context.Context, from, to time.Time) ([]data.EmotionCount, error) {
+	return l.conversationService.EmotionStats(ctx, from, to)
+}
+
 func (l *LingChatService) GetChatHistory(ctx context.Context) []openai.ChatCompletionMessage {
 	return l.conversationService.GetChatHistory(ctx)
 }
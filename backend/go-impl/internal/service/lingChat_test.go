@@ -2,18 +2,41 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sashabaranov/go-openai"
 
 	"LingChat/api"
+	"LingChat/api/routes/common"
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/breaker"
 	"LingChat/internal/clients/VitsTTS"
 	"LingChat/internal/clients/emotionPredictor"
 	"LingChat/internal/clients/llm"
 	"LingChat/internal/config"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/data/ent/ent/conversationmessage"
+	"LingChat/internal/errs"
+	"LingChat/internal/metrics"
+	"LingChat/internal/storage"
 )
 
 var conf *config.Config
@@ -24,7 +47,9 @@ func init() {
 	fmt.Println(os.Getwd())
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatal("无法加载 .env 文件: ", err)
+		// 没有.env时跳过依赖外部服务的集成测试，不影响其他单元测试
+		log.Println("无法加载 .env 文件，跳过集成测试: ", err)
+		return
 	}
 	conf = config.GetConfigFromEnv()
 	fmt.Println(conf.Chat.BaseURL)
@@ -33,22 +58,1197 @@ func init() {
 	vitsTTSClient := VitsTTS.NewClient(conf.Vits.APIURL, conf.TempDirs.VoiceDir, 0)
 	llmClient := llm.NewLLMClient(conf.Chat.BaseURL, conf.Chat.APIKey)
 
-	service = NewLingChatService(emotionPredictorClient, vitsTTSClient, llmClient, conf.TempDirs.VoiceDir)
+	service = NewLingChatService(emotionPredictorClient, vitsTTSClient, llmClient, nil, conf.Chat.Model, conf.TempDirs.VoiceDir)
+}
+
+// requireService 集成测试需要.env中配置的真实服务
+func requireService(t *testing.T) {
+	t.Helper()
+	if service == nil {
+		t.Skip("未加载 .env，跳过集成测试")
+	}
 }
 
 func Test_ChatAndParse(t *testing.T) {
-	rawResp, err := service.llmClient.Chat(ctx, "你好", "deepseek-chat")
+	requireService(t)
+	rawResp, err := service.llmClient.Chat(ctx, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "你好"},
+	}, "deepseek-chat")
 	if err != nil {
 		t.Fatal(err)
 	}
-	fmt.Println(AnalyzeEmotions(rawResp, service.tempFilePath, "wav"))
+	fmt.Println(AnalyzeEmotions(rawResp, service.tempFilePath, "", "wav", service.ParseConfig))
 }
 
 func Test_LingChat(t *testing.T) {
+	requireService(t)
 	fmt.Println(service.LingChatByWS(ctx, api.Message{
 		Type:    "message",
 		Content: "你好",
-	},
-		"deepseek-chat",
-	))
+	}))
+}
+
+func Test_LingChatFakes(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name         string
+		llmErr       error
+		ttsFailText  string
+		predictErr   error
+		wantErr      error
+		wantAudio    []bool
+		wantEmotions []string
+	}{
+		{name: "成功", wantAudio: []bool{true, true}, wantEmotions: []string{"高兴", "高兴"}},
+		{name: "LLM失败", llmErr: boom, wantErr: errs.ErrLLM},
+		{name: "语音合成失败", ttsFailText: "さよなら", wantAudio: []bool{true, false}, wantEmotions: []string{"高兴", "高兴"}},
+		{name: "情绪预测失败", predictErr: boom, wantAudio: []bool{true, true}, wantEmotions: []string{unknownEmotion, unknownEmotion}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tts := &fakeTTS{audio: []byte("audio"), failText: tt.ttsFailText, err: boom}
+			l := NewLingChatService(
+				&fakePredictor{label: "高兴", err: tt.predictErr},
+				tts,
+				&fakeLLM{reply: "【开心】你好<こんにちは>【难过】再见<さよなら>", err: tt.llmErr},
+				NewConversationService(newFakeConversationRepo(), nil, "test-model"),
+				"test-model",
+				t.TempDir(),
+			)
+
+			resp, err := l.LingChat(context.Background(), "你好", "", "")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("LingChat() error = %v, want %v", err, tt.wantErr)
+				}
+				if n := tts.calls.Load(); n != 0 {
+					t.Errorf("TTS called %d times, want 0", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Messages) != len(tt.wantAudio) {
+				t.Fatalf("len(Messages) = %d, want %d", len(resp.Messages), len(tt.wantAudio))
+			}
+			for i, part := range resp.Messages {
+				if hasAudio := part.AudioFile != ""; hasAudio != tt.wantAudio[i] || part.AudioUnavailable == tt.wantAudio[i] {
+					t.Errorf("part %d AudioFile = %q, AudioUnavailable = %v, want audio %v", i, part.AudioFile, part.AudioUnavailable, tt.wantAudio[i])
+				}
+				if part.Emotion != tt.wantEmotions[i] {
+					t.Errorf("part %d Emotion = %q, want %q", i, part.Emotion, tt.wantEmotions[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_GenerateVoiceConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("audio"))
+	}))
+	defer server.Close()
+
+	l := NewLingChatService(nil, VitsTTS.NewClient(server.URL, "", 0), nil, nil, "", t.TempDir())
+	l.MaxConcurrency = 2
+
+	segments := make([]Result, 10)
+	for i := range segments {
+		segments[i].JapaneseText = fmt.Sprintf("text %d", i)
+	}
+	audio, err := l.GenerateVoice(context.Background(), segments, l.VitsTTSClient.DefaultVoice(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range audio {
+		if string(data) != "audio" {
+			t.Errorf("audio[%d] = %q", i, data)
+		}
+	}
+	if peak.Load() > 2 {
+		t.Errorf("peak concurrency = %d, want <= 2", peak.Load())
+	}
+}
+
+func Test_GenerateVoicePartialErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("text") == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("audio"))
+	}))
+	defer server.Close()
+
+	l := NewLingChatService(nil, VitsTTS.NewClient(server.URL, "", 0), nil, nil, "", t.TempDir())
+	segments := []Result{{JapaneseText: "ok"}, {JapaneseText: "bad"}, {JapaneseText: "ok"}, {JapaneseText: "bad"}}
+
+	audio, err := l.GenerateVoice(context.Background(), segments, l.VitsTTSClient.DefaultVoice(), false)
+	var voiceErrs VoiceErrors
+	if !errors.As(err, &voiceErrs) {
+		t.Fatalf("GenerateVoice() error = %v, want VoiceErrors", err)
+	}
+	if len(voiceErrs) != 2 || voiceErrs[1] == nil || voiceErrs[3] == nil {
+		t.Errorf("VoiceErrors = %v, want segments 1 and 3", voiceErrs)
+	}
+	var statusErr *VitsTTS.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("errors.As(StatusError) = %v", statusErr)
+	}
+	if string(audio[0]) != "audio" || string(audio[2]) != "audio" || audio[1] != nil {
+		t.Errorf("audio = %q", audio)
+	}
+}
+
+func Test_LingChatOversizedAudio(t *testing.T) {
+	l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>",
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("text") == "さよなら" {
+				w.Write(make([]byte, 4096))
+				return
+			}
+			w.Write([]byte("audio"))
+		},
+		emotionHandler("开心"),
+	)
+	l.VitsTTSClient.MaxAudioBytes = 1024
+
+	resp, err := l.LingChat(context.Background(), "你好", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Messages) != 2 {
+		t.Fatalf("messages = %d, want 2", len(resp.Messages))
+	}
+	if first := resp.Messages[0]; first.AudioUnavailable || first.AudioFile == "" {
+		t.Errorf("first part AudioFile = %q, AudioUnavailable = %v, want audio", first.AudioFile, first.AudioUnavailable)
+	}
+	// 超过上限的分段只返回文字
+	if second := resp.Messages[1]; !second.AudioUnavailable || second.AudioFile != "" || second.Message != "再见" {
+		t.Errorf("second part = %q, AudioFile = %q, AudioUnavailable = %v, want text only", second.Message, second.AudioFile, second.AudioUnavailable)
+	}
+}
+
+// newTestService 使用内存仓库和httptest假服务构造LingChatService
+func newTestService(t *testing.T, reply string, vits, emotion http.HandlerFunc) (*LingChatService, *fakeConversationRepo) {
+	t.Helper()
+	vitsServer := httptest.NewServer(vits)
+	t.Cleanup(vitsServer.Close)
+	emotionServer := httptest.NewServer(emotion)
+	t.Cleanup(emotionServer.Close)
+
+	repo := newFakeConversationRepo()
+	l := NewLingChatService(
+		emotionPredictor.NewClient(emotionServer.URL),
+		VitsTTS.NewClient(vitsServer.URL, "", 0),
+		&fakeLLM{reply: reply},
+		NewConversationService(repo, nil, "test-model"),
+		"test-model",
+		t.TempDir(),
+	)
+	l.VitsTTSClient.MaxRetries = 0
+	return l, repo
+}
+
+func emotionHandler(label string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"label":%q,"confidence":0.9}`, label)
+	}
+}
+
+func Test_LingChatTimeout(t *testing.T) {
+	l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>",
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("text") == "さよなら" {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+				return
+			}
+			w.Write([]byte("audio"))
+		},
+		emotionHandler("开心"),
+	)
+	l.RequestTimeout = 200 * time.Millisecond
+
+	resp, err := l.LingChat(context.Background(), "你好", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Truncated {
+		t.Error("Truncated = false, want true")
+	}
+	if len(resp.Messages) != 2 {
+		t.Fatalf("len(Messages) = %d, want 2", len(resp.Messages))
+	}
+	if resp.Messages[0].AudioFile == "" || resp.Messages[1].AudioFile != "" {
+		t.Errorf("AudioFile = %q, %q, want only the first part", resp.Messages[0].AudioFile, resp.Messages[1].AudioFile)
+	}
+	if !resp.Messages[1].Truncated {
+		t.Error("Messages[1].Truncated = false, want true")
+	}
+	if resp.RequestID == "" || resp.Messages[0].RequestID != resp.RequestID {
+		t.Errorf("RequestID = %q, Messages[0].RequestID = %q", resp.RequestID, resp.Messages[0].RequestID)
+	}
+}
+
+func Test_LingChatLLMTimeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		delay          time.Duration
+		requestTimeout time.Duration
+		timeoutReply   string
+		wantErr        bool
+		wantMessage    string
+	}{
+		{name: "未超时", wantMessage: "你好"},
+		{name: "超时返回错误", delay: 5 * time.Second, wantErr: true},
+		{name: "超时使用代替回复", delay: 5 * time.Second, timeoutReply: "【难过】对不起<ごめんね>", wantMessage: "对不起"},
+		{name: "请求超时不使用代替回复", delay: 5 * time.Second, requestTimeout: 50 * time.Millisecond, timeoutReply: "【难过】对不起<ごめんね>", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, repo := newTestService(t, "【开心】你好<こんにちは>",
+				func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+				emotionHandler("开心"),
+			)
+			l.llmClient.(*fakeLLM).delay = tt.delay
+			l.LLMTimeout = 100 * time.Millisecond
+			l.LLMTimeoutReply = tt.timeoutReply
+			if tt.requestTimeout > 0 {
+				l.RequestTimeout = tt.requestTimeout
+			}
+
+			resp, err := l.LingChat(context.Background(), "你好", "", "")
+			if tt.wantErr {
+				if !errors.Is(err, errs.ErrLLM) || errs.Code(err) != errs.CodeTimeout {
+					t.Errorf("LingChat() error = %v (code %q), want LLM timeout", err, errs.Code(err))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Messages) != 1 || resp.Messages[0].Message != tt.wantMessage || resp.Messages[0].AudioFile == "" {
+				t.Fatalf("Messages = %+v, want %q with audio", resp.Messages, tt.wantMessage)
+			}
+			if resp.Truncated {
+				t.Error("Truncated = true, want false")
+			}
+			// 代替回复与正常回复一样保存，对话记录中用户消息和回复成对出现
+			wantSaved := "【开心】你好<こんにちは>"
+			if tt.timeoutReply != "" {
+				wantSaved = tt.timeoutReply
+			}
+			saved := false
+			for _, msg := range repo.messages {
+				saved = saved || (msg.Role == conversationmessage.RoleAssistant && msg.Content == wantSaved)
+			}
+			if !saved {
+				t.Errorf("assistant reply %q not recorded", wantSaved)
+			}
+		})
+	}
+}
+
+func Test_LingChatRetryBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		budget   int
+		wantHits int32
+	}{
+		// 三个分段的语音和情绪各请求一次，每次再各自重试两次
+		{name: "不限制", budget: 0, wantHits: 18},
+		// 首次请求6次，所有调用合计只再重试3次
+		{name: "共享预算", budget: 3, wantHits: 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			unavailable := func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>【生气】哼<ふん>", unavailable, unavailable)
+			l.VitsTTSClient.MaxRetries, l.VitsTTSClient.BaseDelay = 2, time.Millisecond
+			predictor := l.emotionPredictorClient.(*emotionPredictor.Client)
+			predictor.MaxRetries, predictor.BaseDelay = 2, time.Millisecond
+			l.RetryBudget = tt.budget
+
+			resp, err := l.LingChat(context.Background(), "你好", "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Messages) != 3 {
+				t.Fatalf("Messages = %+v, want 3 text-only parts", resp.Messages)
+			}
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("downstream requests = %d, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func Test_userVoice(t *testing.T) {
+	l := NewLingChatService(nil, VitsTTS.NewClient("", "", 4), nil, nil, "", "")
+	speakerID := 7
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want int
+	}{
+		{name: "未登录", ctx: context.Background(), want: 4},
+		{name: "未设置说话人", ctx: context.WithValue(context.Background(), common.CurrentUserInfoKey, &ent.User{ID: 1}), want: 4},
+		{name: "用户偏好", ctx: context.WithValue(context.Background(), common.CurrentUserInfoKey, &ent.User{ID: 1, SpeakerID: &speakerID}), want: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := l.userVoice(tt.ctx).SpeakerID; got != tt.want {
+				t.Errorf("userVoice().SpeakerID = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_LingChatInlineAudio(t *testing.T) {
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("开心"),
+	)
+	l.InlineAudio = true
+
+	resp, err := l.LingChat(context.Background(), "你好", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Messages) != 1 {
+		t.Fatalf("len(Messages) = %d, want 1", len(resp.Messages))
+	}
+	part := resp.Messages[0]
+	if part.AudioFile != "" || part.AudioFormat != VitsTTS.FormatWAV {
+		t.Errorf("AudioFile = %q, AudioFormat = %q", part.AudioFile, part.AudioFormat)
+	}
+	if data, err := base64.StdEncoding.DecodeString(part.AudioData); err != nil || string(data) != "audio" {
+		t.Errorf("AudioData = %q, err = %v", part.AudioData, err)
+	}
+	if files, _ := os.ReadDir(l.tempFilePath); len(files) != 0 {
+		t.Errorf("temp dir has %d files, want none", len(files))
+	}
+}
+
+func Test_LingChatEmptyAudio(t *testing.T) {
+	tests := []struct {
+		name   string
+		inline bool
+		stream bool
+	}{
+		{name: "保存文件", inline: false},
+		{name: "内嵌音频", inline: true},
+		{name: "流式回复", stream: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>",
+				func(w http.ResponseWriter, r *http.Request) {
+					// 第二段返回200但没有音频
+					if r.URL.Query().Get("text") != "さよなら" {
+						w.Write([]byte("audio"))
+					}
+				},
+				emotionHandler("开心"),
+			)
+			l.InlineAudio = tt.inline
+			before := testutil.ToFloat64(metrics.TTSEmptyAudio)
+
+			var parts []api.Response
+			var err error
+			if tt.stream {
+				var mu sync.Mutex
+				parts = make([]api.Response, 2)
+				_, err = l.LingChatStream(context.Background(), "你好", "", "", func(part api.Response) error {
+					mu.Lock()
+					defer mu.Unlock()
+					parts[part.PartIndex] = part
+					return nil
+				})
+			} else {
+				var resp *response.CompletionResponse
+				resp, err = l.LingChat(context.Background(), "你好", "", "")
+				if resp != nil {
+					parts = resp.Messages
+				}
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(parts) != 2 {
+				t.Fatalf("len(parts) = %d, want 2", len(parts))
+			}
+
+			if parts[0].AudioUnavailable || (parts[0].AudioFile == "" && parts[0].AudioData == "") {
+				t.Errorf("first part = %+v, want audio", parts[0])
+			}
+			empty := parts[1]
+			if !empty.AudioUnavailable || empty.AudioFile != "" || empty.AudioData != "" {
+				t.Errorf("second part audio = %q/%q, unavailable = %v, want text only", empty.AudioFile, empty.AudioData, empty.AudioUnavailable)
+			}
+			if empty.Message != "再见" {
+				t.Errorf("second part message = %q, want 再见", empty.Message)
+			}
+			if got := testutil.ToFloat64(metrics.TTSEmptyAudio) - before; got != 1 {
+				t.Errorf("empty audio count += %v, want 1", got)
+			}
+			// 空音频不落盘
+			want := 1
+			if tt.inline {
+				want = 0
+			}
+			if files, _ := os.ReadDir(l.tempFilePath); len(files) != want {
+				t.Errorf("temp dir has %d files, want %d", len(files), want)
+			}
+		})
+	}
+}
+
+func Test_LingChatNoVoiceText(t *testing.T) {
+	tests := []struct {
+		name   string
+		inline bool
+		stream bool
+	}{
+		{name: "保存文件", inline: false},
+		{name: "内嵌音频", inline: true},
+		{name: "流式回复", stream: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var texts []string
+			l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见",
+				func(w http.ResponseWriter, r *http.Request) {
+					mu.Lock()
+					texts = append(texts, r.URL.Query().Get("text"))
+					mu.Unlock()
+					w.Write([]byte("audio"))
+				},
+				emotionHandler("开心"),
+			)
+			l.InlineAudio = tt.inline
+			before := testutil.ToFloat64(metrics.TTSEmptyAudio)
+
+			var parts []api.Response
+			var err error
+			if tt.stream {
+				parts = make([]api.Response, 2)
+				_, err = l.LingChatStream(context.Background(), "你好", "", "", func(part api.Response) error {
+					mu.Lock()
+					defer mu.Unlock()
+					parts[part.PartIndex] = part
+					return nil
+				})
+			} else {
+				var resp *response.CompletionResponse
+				resp, err = l.LingChat(context.Background(), "你好", "", "")
+				if resp != nil {
+					parts = resp.Messages
+				}
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(parts) != 2 {
+				t.Fatalf("len(parts) = %d, want 2", len(parts))
+			}
+
+			// 没有日语文本的分段不请求VITS，只显示文字，也不算语音不可用
+			if want := []string{"こんにちは"}; !reflect.DeepEqual(texts, want) {
+				t.Errorf("VITS texts = %q, want %q", texts, want)
+			}
+			silent := parts[1]
+			if silent.AudioUnavailable || silent.AudioFile != "" || silent.AudioData != "" {
+				t.Errorf("second part audio = %q/%q, unavailable = %v, want no audio", silent.AudioFile, silent.AudioData, silent.AudioUnavailable)
+			}
+			if silent.Message != "再见" || silent.Emotion == "" {
+				t.Errorf("second part = %+v, want message and emotion", silent)
+			}
+			if got := testutil.ToFloat64(metrics.TTSEmptyAudio) - before; got != 0 {
+				t.Errorf("empty audio count += %v, want 0", got)
+			}
+		})
+	}
+}
+
+// testWAV 构造采样率为rate、采样数据为samples的单声道16位PCM WAV
+func testWAV(rate uint32, samples string) []byte {
+	buf := []byte("RIFF")
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(36+len(samples)))
+	buf = append(buf, "WAVEfmt "...)
+	buf = binary.LittleEndian.AppendUint32(buf, 16)
+	buf = binary.LittleEndian.AppendUint16(buf, 1)
+	buf = binary.LittleEndian.AppendUint16(buf, 1)
+	buf = binary.LittleEndian.AppendUint32(buf, rate)
+	buf = binary.LittleEndian.AppendUint32(buf, rate*2)
+	buf = binary.LittleEndian.AppendUint16(buf, 2)
+	buf = binary.LittleEndian.AppendUint16(buf, 16)
+	buf = append(buf, "data"...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(samples)))
+	return append(buf, samples...)
+}
+
+func Test_LingChatConcatAudio(t *testing.T) {
+	tests := []struct {
+		name      string
+		rates     map[string]uint32
+		wantFiles []string
+	}{
+		{name: "拼接为一个文件", rates: map[string]uint32{"こんにちは": 16000, "さよなら": 16000}, wantFiles: []string{"part_1.wav", ""}},
+		{name: "采样率不同时逐段返回", rates: map[string]uint32{"こんにちは": 16000, "さよなら": 22050}, wantFiles: []string{"part_1.wav", "part_2.wav"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>",
+				func(w http.ResponseWriter, r *http.Request) {
+					text := r.URL.Query().Get("text")
+					w.Write(testWAV(tt.rates[text], text))
+				},
+				emotionHandler("开心"),
+			)
+			l.ConcatAudio = true
+
+			resp, err := l.LingChat(context.Background(), "你好", "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			combined := tt.wantFiles[1] == ""
+			for i, want := range tt.wantFiles {
+				part := resp.Messages[i]
+				if !strings.HasSuffix(part.AudioFile, want) || (want == "") != (part.AudioFile == "") {
+					t.Errorf("Messages[%d].AudioFile = %q, want suffix %q", i, part.AudioFile, want)
+				}
+				if part.CombinedAudio != (combined && i == 0) {
+					t.Errorf("Messages[%d].CombinedAudio = %v", i, part.CombinedAudio)
+				}
+				if want != "" {
+					if _, err := os.Stat(filepath.Join(l.tempFilePath, part.AudioFile)); err != nil {
+						t.Errorf("Messages[%d] audio file: %v", i, err)
+					}
+				}
+			}
+			if !combined {
+				return
+			}
+			data, err := os.ReadFile(filepath.Join(l.tempFilePath, resp.Messages[0].AudioFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := testWAV(16000, "こんにちはさよなら"); string(data) != string(want) {
+				t.Errorf("combined wav = %q, want %q", data, want)
+			}
+		})
+	}
+}
+
+// memStorage 内存中的对象存储，URL带上地址前缀
+type memStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *memStorage) Put(_ context.Context, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+	return nil
+}
+
+func (m *memStorage) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m *memStorage) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memStorage) URL(key string) string {
+	return "https://cdn.example.com/" + key
+}
+
+func Test_LingChatDuration(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>【开心】嗯<えっと>",
+				func(w http.ResponseWriter, r *http.Request) {
+					switch r.URL.Query().Get("text") {
+					case "こんにちは":
+						// 16000Hz单声道16位，3200字节为100毫秒
+						w.Write(testWAV(16000, strings.Repeat("a", 3200)))
+					case "さよなら":
+						w.Write(testWAV(16000, strings.Repeat("a", 16000)))
+					}
+					// えっと返回空音频
+				},
+				emotionHandler("开心"),
+			)
+
+			var resp *response.CompletionResponse
+			var err error
+			if stream {
+				resp, err = l.LingChatStream(context.Background(), "你好", "", "", func(api.Response) error { return nil })
+			} else {
+				resp, err = l.LingChat(context.Background(), "你好", "", "")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range []int64{100, 500, 0} {
+				if got := resp.Messages[i].DurationMs; got != want {
+					t.Errorf("Messages[%d].DurationMs = %d, want %d", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_LingChatStorage(t *testing.T) {
+	l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(r.URL.Query().Get("text"))) },
+		emotionHandler("开心"),
+	)
+	store := &memStorage{objects: map[string][]byte{}}
+	l.Storage = store
+
+	resp, err := l.LingChat(context.Background(), "你好", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, text := range []string{"こんにちは", "さよなら"} {
+		part := resp.Messages[i]
+		key, ok := strings.CutPrefix(part.AudioFile, "https://cdn.example.com/")
+		if !ok {
+			t.Fatalf("Messages[%d].AudioFile = %q, want storage url", i, part.AudioFile)
+		}
+		if data, _ := store.Get(context.Background(), key); string(data) != text {
+			t.Errorf("Messages[%d] stored audio = %q, want %q", i, data, text)
+		}
+	}
+	if files, _ := os.ReadDir(l.tempFilePath); len(files) != 0 {
+		t.Errorf("temp dir has %d files, want none", len(files))
+	}
+
+	// 共享存储中的语音退出时不删除
+	if err := l.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.objects) != 2 {
+		t.Errorf("objects after shutdown = %d, want 2", len(store.objects))
+	}
+}
+
+func Test_LingChatMemoryStorage(t *testing.T) {
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("开心"),
+	)
+	l.Storage = storage.NewMemory(AudioURLPrefix, time.Minute, 0)
+
+	resp, err := l.LingChat(context.Background(), "你好", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, ok := strings.CutPrefix(resp.Messages[0].AudioFile, AudioURLPrefix)
+	if !ok {
+		t.Fatalf("AudioFile = %q, want prefix %s", resp.Messages[0].AudioFile, AudioURLPrefix)
+	}
+	if data, contentType, err := l.TakeAudio(token); err != nil || string(data) != "audio" || contentType != "audio/wav" {
+		t.Errorf("TakeAudio() = %q, %q, %v", data, contentType, err)
+	}
+	if _, _, err := l.TakeAudio(token); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("second TakeAudio() error = %v, want ErrNotFound", err)
+	}
+}
+
+func Test_LingChatOutputFormat(t *testing.T) {
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("开心"),
+	)
+	l.OutputFormat = VitsTTS.FormatMP3
+
+	resp, err := l.LingChat(context.Background(), "你好", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Messages[0].AudioFile; !strings.HasSuffix(got, ".mp3") {
+		t.Errorf("AudioFile = %q, want .mp3 extension", got)
+	}
+	if _, err := os.Stat(filepath.Join(l.tempFilePath, resp.Messages[0].AudioFile)); err != nil {
+		t.Errorf("voice file not written: %v", err)
+	}
+}
+
+func Test_LingChatLLMBreaker(t *testing.T) {
+	l, _ := newTestService(t, "",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("开心"),
+	)
+	llmClient := &fakeLLM{err: errors.New("connection refused")}
+	l.llmClient = llmClient
+	l.LLMBreaker = breaker.New(1, time.Minute)
+
+	if _, err := l.LingChat(context.Background(), "你好", "", ""); errs.HTTPStatus(err) != http.StatusBadGateway {
+		t.Fatalf("first LingChat() error = %v, want 502", err)
+	}
+	llmClient.err = nil
+	_, err := l.LingChat(context.Background(), "你好", "", "")
+	if !errors.Is(err, breaker.ErrOpen) || errs.HTTPStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("LingChat() with open breaker error = %v, want ErrOpen (503)", err)
+	}
+	if got := l.BreakerStates()[DependencyLLM]; got != breaker.Open {
+		t.Errorf("BreakerStates()[llm] = %v, want open", got)
+	}
+}
+
+func Test_EmoPredictBatchRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int32
+		want      string
+		wantCalls int32
+	}{
+		{name: "短暂失败后重试成功", failures: 1, want: "难过", wantCalls: 2},
+		{name: "重试用尽后记为unknown", failures: 10, want: unknownEmotion, wantCalls: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			l, _ := newTestService(t, "",
+				func(w http.ResponseWriter, r *http.Request) {},
+				func(w http.ResponseWriter, r *http.Request) {
+					if calls.Add(1) <= tt.failures {
+						w.WriteHeader(http.StatusServiceUnavailable)
+						return
+					}
+					emotionHandler("难过")(w, r)
+				},
+			)
+			l.emotionPredictorClient.(*emotionPredictor.Client).BaseDelay = time.Millisecond
+
+			results := l.EmoPredictBatch(context.Background(), []Result{{OriginalTag: "哭"}})
+			if results[0].Predicted != tt.want {
+				t.Errorf("Predicted = %q, want %q", results[0].Predicted, tt.want)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func Test_EmoPredictBatchDedupe(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		emotionHandler("高兴")(w, r)
+	}))
+	defer server.Close()
+
+	l := NewLingChatService(emotionPredictor.NewClient(server.URL), nil, nil, nil, "", "")
+	results := []Result{
+		{OriginalTag: "开心"},
+		{OriginalTag: "", Predicted: "正常"},
+		{OriginalTag: "开心"},
+		{OriginalTag: "难过"},
+	}
+	results = l.EmoPredictBatch(context.Background(), results)
+	if calls.Load() != 2 {
+		t.Errorf("Predict calls = %d, want 2", calls.Load())
+	}
+	for i, r := range results {
+		if i == 1 {
+			if r.Predicted != "正常" || r.Confidence != 0 {
+				t.Errorf("results[1] = %+v, want untouched", r)
+			}
+			continue
+		}
+		if r.Predicted != "高兴" || r.Confidence != 0.9 {
+			t.Errorf("results[%d] = %+v", i, r)
+		}
+	}
+}
+
+func Test_EmoPredictBatchSingleRequest(t *testing.T) {
+	tests := []struct {
+		name             string
+		batchSupported   bool
+		wantBatchCalls   int32
+		wantPredictCalls int32
+	}{
+		{name: "一次请求预测全部标签", batchSupported: true, wantBatchCalls: 1, wantPredictCalls: 0},
+		{name: "不支持批量时逐个请求", batchSupported: false, wantBatchCalls: 1, wantPredictCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batchCalls, predictCalls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/predict_batch":
+					batchCalls.Add(1)
+					if !tt.batchSupported {
+						http.NotFound(w, r)
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(`{"results":[{"label":"高兴","confidence":0.9},{"label":"悲伤","confidence":0.8}]}`))
+				default:
+					predictCalls.Add(1)
+					emotionHandler("高兴")(w, r)
+				}
+			}))
+			defer server.Close()
+
+			client := emotionPredictor.NewClient(server.URL)
+			client.Batch = true
+			l := NewLingChatService(client, nil, nil, nil, "", "")
+			results := []Result{
+				{OriginalTag: "开心"},
+				{OriginalTag: "难过"},
+				{OriginalTag: "开心"},
+			}
+			results = l.EmoPredictBatch(context.Background(), results)
+			if batchCalls.Load() != tt.wantBatchCalls || predictCalls.Load() != tt.wantPredictCalls {
+				t.Errorf("calls: batch = %d, predict = %d, want %d, %d",
+					batchCalls.Load(), predictCalls.Load(), tt.wantBatchCalls, tt.wantPredictCalls)
+			}
+			want := []string{"高兴", "悲伤", "高兴"}
+			if !tt.batchSupported {
+				want = []string{"高兴", "高兴", "高兴"}
+			}
+			for i, r := range results {
+				if r.Predicted != want[i] {
+					t.Errorf("results[%d].Predicted = %q, want %q", i, r.Predicted, want[i])
+				}
+			}
+			if tt.batchSupported {
+				return
+			}
+			// 记住服务端不支持，后续不再尝试批量接口
+			l.EmoPredictBatch(context.Background(), []Result{{OriginalTag: "开心"}, {OriginalTag: "难过"}})
+			if batchCalls.Load() != 1 {
+				t.Errorf("batch calls after unsupported = %d, want 1", batchCalls.Load())
+			}
+		})
+	}
+}
+
+func Test_GenerateVoiceCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	l := NewLingChatService(nil, VitsTTS.NewClient(server.URL, "", 0), nil, nil, "", t.TempDir())
+	l.VitsTTSClient.MaxRetries = 0
+	l.MaxConcurrency = 1
+	segments := make([]Result, 5)
+	for i := range segments {
+		segments[i].JapaneseText = "こんにちは"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := l.GenerateVoice(ctx, segments, l.VitsTTSClient.DefaultVoice(), false)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GenerateVoice() took %v after cancel", elapsed)
+	}
+	var voiceErrs VoiceErrors
+	if !errors.As(err, &voiceErrs) || len(voiceErrs) != len(segments) {
+		t.Fatalf("GenerateVoice() error = %v, want all segments failed", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("errors.Is(err, context.Canceled) = false, err = %v", err)
+	}
+}
+
+func Test_LingChatWithoutEmotionPredict(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			var calls atomic.Int32
+			l, _ := newTestService(t, "你好【开心】早上好<おはよう>",
+				func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+				func(w http.ResponseWriter, r *http.Request) {
+					calls.Add(1)
+					emotionHandler("难过")(w, r)
+				},
+			)
+			l.PredictEmotions = false
+
+			var resp *response.CompletionResponse
+			var err error
+			if stream {
+				resp, err = l.LingChatStream(context.Background(), "你好", "", "", func(api.Response) error { return nil })
+			} else {
+				resp, err = l.LingChat(context.Background(), "你好", "", "")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if calls.Load() != 0 {
+				t.Errorf("emotion predictor called %d times, want 0", calls.Load())
+			}
+			if len(resp.Messages) != 2 {
+				t.Fatalf("len(Messages) = %d, want 2", len(resp.Messages))
+			}
+			if got := resp.Messages[0].Emotion; got != DefaultParseConfig.DefaultEmotion {
+				t.Errorf("Messages[0].Emotion = %q, want default", got)
+			}
+			if got := resp.Messages[1].Emotion; got != "开心" {
+				t.Errorf("Messages[1].Emotion = %q, want 开心", got)
+			}
+		})
+	}
+}
+
+func Test_LingChatDryRun(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			unexpected := func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("unexpected request to %s in dry-run mode", r.URL.Path)
+			}
+			l, _ := newTestService(t, "你好【开心】早上好<おはよう>", unexpected, unexpected)
+			l.DryRun = true
+
+			var resp *response.CompletionResponse
+			var err error
+			if stream {
+				resp, err = l.LingChatStream(context.Background(), "你好", "", "", func(api.Response) error { return nil })
+			} else {
+				resp, err = l.LingChat(context.Background(), "你好", "", "")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Messages) != 2 {
+				t.Fatalf("len(Messages) = %d, want 2", len(resp.Messages))
+			}
+			for i, want := range []string{DefaultParseConfig.DefaultEmotion, "开心"} {
+				part := resp.Messages[i]
+				if part.Emotion != want {
+					t.Errorf("Messages[%d].Emotion = %q, want %q", i, part.Emotion, want)
+				}
+				if part.AudioFile != "" || part.AudioData != "" {
+					t.Errorf("Messages[%d] has audio: file %q, data %d bytes", i, part.AudioFile, len(part.AudioData))
+				}
+			}
+			if files, _ := os.ReadDir(l.tempFilePath); len(files) != 0 {
+				t.Errorf("temp dir has %d files, want none", len(files))
+			}
+			health := l.CheckHealth(context.Background())
+			if _, ok := health[DependencyVITS]; ok {
+				t.Errorf("CheckHealth() probed vits in dry-run mode")
+			}
+			if _, ok := health[DependencyEmotion]; ok {
+				t.Errorf("CheckHealth() probed emotion in dry-run mode")
+			}
+		})
+	}
+}
+
+func Test_LingChatDebugRawResponse(t *testing.T) {
+	const reply = "你好【开心】早上好<おはよう>"
+	for _, stream := range []bool{false, true} {
+		for _, debug := range []bool{false, true} {
+			t.Run(fmt.Sprintf("stream=%v/debug=%v", stream, debug), func(t *testing.T) {
+				l, _ := newTestService(t, reply, nil, nil)
+				l.DryRun = true
+				ctx := context.Background()
+				if debug {
+					ctx = common.WithDebug(ctx)
+				}
+
+				var resp *response.CompletionResponse
+				var err error
+				if stream {
+					resp, err = l.LingChatStream(ctx, "你好", "", "", func(api.Response) error { return nil })
+				} else {
+					resp, err = l.LingChat(ctx, "你好", "", "")
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := ""
+				if debug {
+					want = reply
+				}
+				if resp.RawLLMResponse != want {
+					t.Errorf("RawLLMResponse = %q, want %q", resp.RawLLMResponse, want)
+				}
+				if got := resp.Messages[0].RawLLMResponse; got != want {
+					t.Errorf("Messages[0].RawLLMResponse = %q, want %q", got, want)
+				}
+				if got := resp.Messages[1].RawLLMResponse; got != "" {
+					t.Errorf("Messages[1].RawLLMResponse = %q, want empty", got)
+				}
+			})
+		}
+	}
+}
+
+func Test_LingChatSavesSegmentEmotions(t *testing.T) {
+	l, repo := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("开心"),
+	)
+	ctx := context.WithValue(context.Background(), common.CurrentUserInfoKey, &ent.User{ID: 42})
+
+	resp, err := l.LingChat(ctx, "你好", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgID, _ := strconv.ParseInt(resp.MessageID, 10, 64)
+	got := repo.emotions[msgID]
+	want := []data.SegmentEmotion{
+		{Index: 1, Emotion: "开心", Confidence: 0.9},
+		{Index: 2, Emotion: "开心", Confidence: 0.9},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("saved emotions = %+v, want %+v", got, want)
+	}
+	if repo.users[msgID] != 42 {
+		t.Errorf("saved user id = %d, want 42", repo.users[msgID])
+	}
+}
+
+func Test_LingChatSaveTurn(t *testing.T) {
+	const reply = "【开心】你好<こんにちは>"
+	tests := []struct {
+		name    string
+		llmErr  error
+		saveErr error
+		// wantMessages 保存的消息数，包括系统提示词；本轮失败时新对话也不保存
+		wantMessages int
+		wantErr      bool
+	}{
+		{name: "保存用户消息和回复", wantMessages: 3},
+		{name: "LLM失败时不创建对话", llmErr: errors.New("connection refused"), wantErr: true},
+		{name: "保存失败时照常返回回复", saveErr: errors.New("database is locked")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, repo := newTestService(t, reply,
+				func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+				emotionHandler("开心"),
+			)
+			l.llmClient = &fakeLLM{reply: reply, err: tt.llmErr}
+			repo.saveTurnErr = tt.saveErr
+
+			resp, err := l.LingChat(context.Background(), "你好", "", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LingChat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := len(repo.messages); got != tt.wantMessages {
+				t.Errorf("saved messages = %d, want %d", got, tt.wantMessages)
+			}
+			if got, want := len(repo.conversations), min(tt.wantMessages, 1); got != want {
+				t.Errorf("saved conversations = %d, want %d", got, want)
+			}
+			if err != nil {
+				return
+			}
+			if len(resp.Messages) != 1 {
+				t.Fatalf("messages = %d, want 1", len(resp.Messages))
+			}
+			if tt.saveErr != nil {
+				if resp.MessageID != "" || resp.ConversationID != "" {
+					t.Errorf("MessageID = %q, ConversationID = %q, want empty", resp.MessageID, resp.ConversationID)
+				}
+				return
+			}
+
+			// 下一轮接在已保存的回复之后，LLM能看到上一轮的用户消息和回复
+			msgID, _ := strconv.ParseInt(resp.MessageID, 10, 64)
+			if repo.messages[msgID].Emotion != "开心" {
+				t.Errorf("reply emotion = %q, want 开心", repo.messages[msgID].Emotion)
+			}
+			if _, err := l.LingChat(context.Background(), "再见", resp.ConversationID, ""); err != nil {
+				t.Fatal(err)
+			}
+			chain, _ := repo.GetMessageChain(context.Background(), repo.latest[repo.messages[msgID].ConversationID])
+			var contents []string
+			for _, msg := range chain[1:] {
+				contents = append(contents, msg.Content)
+			}
+			if want := []string{"你好", reply, "再见", reply}; !reflect.DeepEqual(contents, want) {
+				t.Errorf("chain = %q, want %q", contents, want)
+			}
+		})
+	}
+}
+
+func Test_ChatHandlerStreamErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawMsg  string
+		llmErr  error
+		wantErr error
+	}{
+		{name: "JSON格式错误", rawMsg: `{"type":`, wantErr: errs.ErrInvalidMessage},
+		{name: "未知消息类型", rawMsg: `{"type":"foo","content":"hi"}`, wantErr: errs.ErrInvalidMessageType},
+		{name: "LLM失败", rawMsg: `{"type":"message","content":"hi"}`, llmErr: errors.New("connection refused"), wantErr: errs.ErrLLM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestService(t, "", nil, nil)
+			l.llmClient = &fakeLLM{err: tt.llmErr}
+			err := l.ChatHandlerStream(context.Background(), []byte(tt.rawMsg), func([]byte) error { return nil })
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ChatHandlerStream() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_HandleMessage(t *testing.T) {
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("开心"),
+	)
+
+	resp, err := l.HandleMessage(context.Background(), api.Message{Type: "message", Content: "你好"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp) != 1 || resp[0].Emotion != "开心" || resp[0].RequestID == "" {
+		t.Errorf("HandleMessage() = %+v", resp)
+	}
+
+	_, err = l.HandleMessage(context.Background(), api.Message{Type: "message", Content: "   "})
+	if !errors.Is(err, errs.ErrEmptyMessage) || !strings.Contains(err.Error(), "request_id") {
+		t.Errorf("HandleMessage() error = %v, want ErrEmptyMessage with request id", err)
+	}
 }
@@ -1,10 +1,14 @@
 package service
 
 import (
+	"context"
+	"encoding/xml"
 	"fmt"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"unicode/utf8"
 )
 
 // Result 表示parse结果
@@ -17,68 +21,402 @@ type Result struct {
 	Predicted     string  `json:"predicted"`
 	Confidence    float64 `json:"confidence"`
 	VoiceFile     string  `json:"voice_file"`
+	// Motion 按情绪映射得到的虚拟形象动作，未配置MotionMap时为空
+	Motion string `json:"motion,omitempty"`
+	// Audio/AudioFormat 开启内嵌音频时的音频数据及格式，不写入文件
+	Audio       []byte `json:"-"`
+	AudioFormat string `json:"-"`
+	// DurationMs 该分段语音的时长（毫秒），由WAV头计算；没有音频或不是WAV时为0
+	DurationMs int64 `json:"duration_ms,omitempty"`
+	// CombinedAudio 开启ConcatAudio时，该分段的音频是整条回复拼接后的语音
+	CombinedAudio bool `json:"-"`
+	// AudioUnavailable 该分段的语音合成失败或VITS返回了空音频，前端只显示文字
+	AudioUnavailable bool `json:"-"`
+	// SSML JapaneseText为SSML片段（开启ParseConfig.Markup且含强调标记时），需以SSML合成
+	SSML bool `json:"ssml,omitempty"`
+	// Language 检测到的FollowingText语言（ISO 639-1），未配置LanguageRouter或无法判断时为空
+	Language string `json:"language,omitempty"`
 }
 
-// AnalyzeEmotions 分析文本中每个【】标记的情绪，并提取日语和中文部分
-func AnalyzeEmotions(text string, tempVoiceDir string, ttsFormat string) []Result {
-	// 正则表达式查找情绪段落
-	emotionRegex := regexp.MustCompile(`(【(.*?)】)([^【】]*)`)
-	matches := emotionRegex.FindAllStringSubmatch(text, -1)
+// ParseConfig LLM输出的标记约定，不同的提示词可以使用不同的括号
+type ParseConfig struct {
+	// TagOpen/TagClose 情绪标签，如【开心】
+	TagOpen  string
+	TagClose string
+	// VoiceOpen/VoiceClose 用于合成语音的日语部分，如<こんにちは>
+	VoiceOpen  string
+	VoiceClose string
+	// MotionOpen/MotionClose 动作描写，如（摇尾巴）
+	MotionOpen  string
+	MotionClose string
+	// ParseMotion 为false时不提取动作，动作描写保留在正文中
+	ParseMotion bool
+	// Replacements 解析前对标签后文本做的替换，成对出现（旧、新），用于统一全半角括号
+	Replacements []string
+	// DefaultEmotion 没有情绪标签的文本（整段未标记、第一个标签之前的内容或空标签）使用的情绪，
+	// 这类分段的OriginalTag为空，不再调用情绪预测
+	DefaultEmotion string
+	// EmphasisOpen/EmphasisClose 强调标记，如*大好き*
+	EmphasisOpen  string
+	EmphasisClose string
+	// Markup 为true时日语部分中的强调标记转换为SSML的<emphasis>交给VITS合成，
+	// 显示的正文和动作中去掉强调标记只保留内容；为false时强调标记按普通文本处理
+	Markup bool
+	// MaxSegments 最多拆出的分段数（包括第一个标签之前的未标记分段），超出部分去掉标签后合并到最后一个分段，
+	// 避免异常输出产生大量分段压垮TTS；<=0表示不限制
+	MaxSegments int
+	// MinSegmentLength 日语部分短于该字符数的分段与相邻的同一情绪标签的分段合并，减少很短的TTS请求；
+	// 不跨越情绪标签，也不合并SSML分段；<=0表示不合并
+	MinSegmentLength int
+}
 
-	var results []Result
+// DefaultParseConfig 默认的【情绪】正文<日语>（动作）格式
+var DefaultParseConfig = ParseConfig{
+	TagOpen:        "【",
+	TagClose:       "】",
+	VoiceOpen:      "<",
+	VoiceClose:     ">",
+	MotionOpen:     "（",
+	MotionClose:    "）",
+	ParseMotion:    true,
+	Replacements:   []string{"(", "（", ")", "）"},
+	DefaultEmotion: "正常",
+	EmphasisOpen:   "*",
+	EmphasisClose:  "*",
+	MaxSegments:    32,
+}
 
-	for i, match := range matches {
-		emotionTag := match[2]    // 【】内的内容
-		followingText := match[3] // 标签后面的文本
+// tagSpan 情绪标签在原文中的位置
+type tagSpan struct {
+	start, end int // 整个标签（含括号）的范围
+	tag        string
+	// overflow 超出MaxSegments后合并进本分段的标签，解析时从正文中去掉
+	overflow []tagSpan
+}
 
-		// 统一处理括号（兼容中英文括号）
-		followingText = strings.ReplaceAll(followingText, "(", "（")
-		followingText = strings.ReplaceAll(followingText, ")", "）")
+// findTags 查找所有情绪标签。标签内不能再出现开闭括号：
+// 嵌套时取最内层，未闭合的开括号和多余的闭括号当作普通文本
+func (c ParseConfig) findTags(text string) []tagSpan {
+	if c.TagOpen == "" || c.TagClose == "" {
+		return nil
+	}
 
-		// 提取日语部分（<...>）
-		japaneseRegex := regexp.MustCompile(`<(.*?)>`)
-		japaneseMatch := japaneseRegex.FindStringSubmatch(followingText)
-		japaneseText := ""
-		if len(japaneseMatch) > 1 {
-			japaneseText = strings.TrimSpace(japaneseMatch[1])
+	var spans []tagSpan
+	pos := 0
+	for {
+		open := strings.Index(text[pos:], c.TagOpen)
+		if open < 0 {
+			return spans
 		}
+		open += pos
+		contentStart := open + len(c.TagOpen)
 
-		// 提取动作部分（（...））
-		motionRegex := regexp.MustCompile(`（(.*?)）`)
-		motionMatch := motionRegex.FindStringSubmatch(followingText)
-		motionText := ""
-		if len(motionMatch) > 1 {
-			motionText = strings.TrimSpace(motionMatch[1])
+		closeIdx := strings.Index(text[contentStart:], c.TagClose)
+		if closeIdx < 0 {
+			return spans
 		}
+		closeIdx += contentStart
+
+		// 闭括号之前又出现开括号，从更内层的开括号重新匹配
+		if inner := strings.LastIndex(text[contentStart:closeIdx], c.TagOpen); inner >= 0 {
+			open = contentStart + inner
+			contentStart = open + len(c.TagOpen)
+		}
+
+		spans = append(spans, tagSpan{
+			start: open,
+			end:   closeIdx + len(c.TagClose),
+			tag:   text[contentStart:closeIdx],
+		})
+		pos = closeIdx + len(c.TagClose)
+	}
+}
+
+// enclosedRegex 匹配 open...close 并捕获其中内容
+func enclosedRegex(open, close string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(open) + `(.*?)` + regexp.QuoteMeta(close))
+}
+
+// segmentParser 按ParseConfig把回复拆成分段，批量和流式解析共用
+type segmentParser struct {
+	cfg              ParseConfig
+	tempVoiceDir     string
+	filePrefix       string
+	ttsFormat        string
+	voiceRegex       *regexp.Regexp
+	motionRegex      *regexp.Regexp
+	emphasisRegex    *regexp.Regexp
+	replacer         *strings.Replacer
+	strayTagReplacer *strings.Replacer
+}
+
+func newSegmentParser(tempVoiceDir string, filePrefix string, ttsFormat string, cfg ParseConfig) *segmentParser {
+	p := &segmentParser{
+		cfg:          cfg,
+		tempVoiceDir: tempVoiceDir,
+		filePrefix:   filePrefix,
+		ttsFormat:    ttsFormat,
+		voiceRegex:   enclosedRegex(cfg.VoiceOpen, cfg.VoiceClose),
+		motionRegex:  enclosedRegex(cfg.MotionOpen, cfg.MotionClose),
+		replacer:     strings.NewReplacer(cfg.Replacements...),
+		// 标签后文本中残留的括号来自格式错误的输出，直接去掉
+		strayTagReplacer: strings.NewReplacer(cfg.TagOpen, "", cfg.TagClose, ""),
+	}
+	if cfg.Markup && cfg.EmphasisOpen != "" && cfg.EmphasisClose != "" {
+		p.emphasisRegex = enclosedRegex(cfg.EmphasisOpen, cfg.EmphasisClose)
+	}
+	return p
+}
+
+// stripMarkup 去掉显示文本中的强调标记，只保留内容
+func (p *segmentParser) stripMarkup(text string) string {
+	if p.emphasisRegex == nil {
+		return text
+	}
+	return p.emphasisRegex.ReplaceAllString(text, "$1")
+}
+
+// ssml 把日语文本中的强调标记转换为SSML的<emphasis>，其余内容做XML转义。
+// 没有强调标记时原样返回false，按普通文本合成
+func (p *segmentParser) ssml(text string) (string, bool) {
+	if p.emphasisRegex == nil {
+		return text, false
+	}
+	matches := p.emphasisRegex.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, false
+	}
+	var b strings.Builder
+	pos := 0
+	for _, m := range matches {
+		xml.EscapeText(&b, []byte(text[pos:m[0]]))
+		b.WriteString("<emphasis>")
+		xml.EscapeText(&b, []byte(text[m[2]:m[3]]))
+		b.WriteString("</emphasis>")
+		pos = m[1]
+	}
+	xml.EscapeText(&b, []byte(text[pos:]))
+	return b.String(), true
+}
 
-		// 清理后的文本（移除日语部分和动作部分）
-		cleanRegex := regexp.MustCompile(`<.*?>|（.*?）`)
-		cleanedText := strings.TrimSpace(cleanRegex.ReplaceAllString(followingText, ""))
+// segments 返回每个分段的起始标签，第一个标签之前的文本（没有标签时即整段文本）作为一个未标记的分段
+func (p *segmentParser) segments(text string) []tagSpan {
+	tags := p.cfg.findTags(text)
+	leadingEnd := len(text)
+	if len(tags) > 0 {
+		leadingEnd = tags[0].start
+	}
+	if strings.TrimSpace(p.strayTagReplacer.Replace(text[:leadingEnd])) != "" {
+		tags = append([]tagSpan{{start: 0, end: 0}}, tags...)
+	}
+	if limit := p.cfg.MaxSegments; limit > 0 && len(tags) > limit {
+		last := tags[limit-1]
+		last.overflow = slices.Clone(tags[limit:])
+		tags = append(tags[:limit-1], last)
+	}
+	return tags
+}
+
+// removeSpans 返回text[start:end]去掉spans（均在该范围内）之后的内容
+func removeSpans(text string, start, end int, spans []tagSpan) string {
+	var b strings.Builder
+	for _, span := range spans {
+		b.WriteString(text[start:span.start])
+		start = span.end
+	}
+	b.WriteString(text[start:end])
+	return b.String()
+}
+
+// result 解析第i个分段，分段内容为空时返回false
+func (p *segmentParser) result(text string, tags []tagSpan, i int) (Result, bool) {
+	tag := tags[i]
+	end := len(text)
+	if i+1 < len(tags) {
+		end = tags[i+1].start
+	}
+	followingText := text[tag.end:end]
+	if len(tag.overflow) > 0 {
+		followingText = removeSpans(text, tag.end, end, tag.overflow)
+	}
+	followingText = p.strayTagReplacer.Replace(followingText)
+
+	// 统一处理括号（兼容中英文括号）
+	followingText = p.replacer.Replace(followingText)
+
+	// 提取日语部分
+	japaneseText := ""
+	if len(tag.overflow) > 0 {
+		// 合并的分段包含原来多个分段的日语，全部合成
+		var parts []string
+		for _, m := range p.voiceRegex.FindAllStringSubmatch(followingText, -1) {
+			parts = append(parts, strings.TrimSpace(m[1]))
+		}
+		japaneseText = strings.Join(parts, "")
+	} else if m := p.voiceRegex.FindStringSubmatch(followingText); len(m) > 1 {
+		japaneseText = strings.TrimSpace(m[1])
+	}
+
+	// 提取动作部分
+	motionText := ""
+	cleanedText := p.voiceRegex.ReplaceAllString(followingText, "")
+	if p.cfg.ParseMotion {
+		if m := p.motionRegex.FindStringSubmatch(followingText); len(m) > 1 {
+			motionText = strings.TrimSpace(m[1])
+		}
+		cleanedText = p.motionRegex.ReplaceAllString(cleanedText, "")
 
 		// 清理日语文本中的动作部分
 		if japaneseText != "" {
-			japaneseCleanRegex := regexp.MustCompile(`（.*?）`)
-			japaneseText = strings.TrimSpace(japaneseCleanRegex.ReplaceAllString(japaneseText, ""))
+			japaneseText = strings.TrimSpace(p.motionRegex.ReplaceAllString(japaneseText, ""))
 		}
+	}
+	// 清理后的文本（移除日语部分和动作部分）
+	cleanedText = strings.TrimSpace(p.stripMarkup(cleanedText))
+	motionText = p.stripMarkup(motionText)
 
-		// 跳过完全空的文本
-		if followingText == "" && japaneseText == "" && motionText == "" {
-			continue
-		}
+	// 跳过完全空的文本
+	if followingText == "" && japaneseText == "" && motionText == "" {
+		return Result{}, false
+	}
 
-		// TODO: 省略了原语言检测和交换逻辑
+	// TODO: 省略了原语言检测和交换逻辑
 
-		voiceFile := filepath.Join(tempVoiceDir, fmt.Sprintf("part_%d.%s", i+1, ttsFormat))
+	voiceFile := filepath.Join(p.tempVoiceDir, fmt.Sprintf("%spart_%d.%s", p.filePrefix, i+1, p.ttsFormat))
 
-		results = append(results, Result{
-			Index:         i + 1,
-			OriginalTag:   emotionTag,
-			FollowingText: cleanedText,
-			MotionText:    motionText,
-			JapaneseText:  japaneseText,
-			VoiceFile:     voiceFile,
-		})
+	result := Result{
+		Index:         i + 1,
+		OriginalTag:   tag.tag,
+		FollowingText: cleanedText,
+		MotionText:    motionText,
+		JapaneseText:  japaneseText,
+		VoiceFile:     voiceFile,
 	}
+	result.JapaneseText, result.SSML = p.ssml(japaneseText)
+	if strings.TrimSpace(tag.tag) == "" {
+		result.OriginalTag = ""
+		result.Predicted = p.cfg.DefaultEmotion
+	}
+	return result, true
+}
 
+// mergeable 判断next能否合并到prev：情绪标签相同、都不是SSML，且至少有一个的日语部分短于MinSegmentLength
+func (c ParseConfig) mergeable(prev, next Result) bool {
+	if c.MinSegmentLength <= 0 || prev.OriginalTag != next.OriginalTag || prev.SSML || next.SSML {
+		return false
+	}
+	return utf8.RuneCountInString(prev.JapaneseText) < c.MinSegmentLength ||
+		utf8.RuneCountInString(next.JapaneseText) < c.MinSegmentLength
+}
+
+// mergeSegments 把next的内容接在prev之后，序号和语音文件沿用prev；动作取第一个非空的，与MaxSegments的合并一致
+func mergeSegments(prev, next Result) Result {
+	prev.FollowingText += next.FollowingText
+	prev.JapaneseText += next.JapaneseText
+	if prev.MotionText == "" {
+		prev.MotionText = next.MotionText
+	}
+	return prev
+}
+
+// AnalyzeEmotions 按cfg约定的标记分析文本中每个情绪标签，并提取日语和中文部分。
+// 语音文件命名为 <filePrefix>part_<序号>.<ttsFormat>
+func AnalyzeEmotions(text string, tempVoiceDir string, filePrefix string, ttsFormat string, cfg ParseConfig) []Result {
+	p := newSegmentParser(tempVoiceDir, filePrefix, ttsFormat, cfg)
+	tags := p.segments(text)
+
+	var results []Result
+	for i := range tags {
+		result, ok := p.result(text, tags, i)
+		if !ok {
+			continue
+		}
+		if last := len(results) - 1; last >= 0 && cfg.mergeable(results[last], result) {
+			results[last] = mergeSegments(results[last], result)
+			continue
+		}
+		results = append(results, result)
+	}
 	return results
 }
+
+// AnalyzeEmotionsStream 是AnalyzeEmotions的增量版本：从tokens读取LLM的流式输出，
+// 每当下一个情绪标签完整出现时，上一个分段即已完整，立即发送到返回的通道，
+// 最后一个分段在tokens关闭后发送。结果与对完整文本调用AnalyzeEmotions相同；
+// 设置了MinSegmentLength时，分段要等到确定不与下一个分段合并后才发送。
+// tokens关闭或ctx结束后返回的通道被关闭
+func AnalyzeEmotionsStream(ctx context.Context, tokens <-chan string, tempVoiceDir string, filePrefix string, ttsFormat string, cfg ParseConfig) <-chan Result {
+	out := make(chan Result)
+	go func() {
+		defer close(out)
+		p := newSegmentParser(tempVoiceDir, filePrefix, ttsFormat, cfg)
+		var buf strings.Builder
+		// 已处理的分段数，包括跳过的空分段
+		done := 0
+		// pending 可能还要与下一个分段合并、尚未发送的分段
+		var pending *Result
+
+		send := func(result Result) bool {
+			select {
+			case out <- result:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// flush 发送已经完整的分段，final为true时最后一个分段也视为完整
+		flush := func(final bool) bool {
+			text := buf.String()
+			tags := p.segments(text)
+			complete := len(tags) - 1
+			if final {
+				complete = len(tags)
+			}
+			for ; done < complete; done++ {
+				result, ok := p.result(text, tags, done)
+				if !ok {
+					continue
+				}
+				if pending != nil {
+					if cfg.mergeable(*pending, result) {
+						*pending = mergeSegments(*pending, result)
+						continue
+					}
+					if !send(*pending) {
+						return false
+					}
+					pending = nil
+				}
+				if cfg.MinSegmentLength <= 0 {
+					if !send(result) {
+						return false
+					}
+					continue
+				}
+				pending = &result
+			}
+			if final && pending != nil {
+				return send(*pending)
+			}
+			return true
+		}
+
+		for {
+			select {
+			case token, ok := <-tokens:
+				if !ok {
+					flush(true)
+					return
+				}
+				buf.WriteString(token)
+				if !flush(false) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
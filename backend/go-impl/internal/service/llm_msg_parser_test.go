@@ -0,0 +1,476 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// segment 只比较解析出的文本字段
+type segment struct {
+	Tag, Text, Motion, Japanese string
+}
+
+func toSegments(results []Result) []segment {
+	segments := make([]segment, 0, len(results))
+	for _, r := range results {
+		segments = append(segments, segment{r.OriginalTag, r.FollowingText, r.MotionText, r.JapaneseText})
+	}
+	return segments
+}
+
+func TestAnalyzeEmotions(t *testing.T) {
+	bracketConfig := ParseConfig{
+		TagOpen:     "[",
+		TagClose:    "]",
+		VoiceOpen:   "{",
+		VoiceClose:  "}",
+		MotionOpen:  "*",
+		MotionClose: "*",
+		ParseMotion: true,
+	}
+	noMotionConfig := DefaultParseConfig
+	noMotionConfig.ParseMotion = false
+
+	tests := []struct {
+		name string
+		text string
+		cfg  ParseConfig
+		want []segment
+	}{
+		{
+			name: "默认格式",
+			text: "【开心】你好呀（摇尾巴）<こんにちは>【害羞】才没有<そんなことない>",
+			cfg:  DefaultParseConfig,
+			want: []segment{
+				{"开心", "你好呀", "摇尾巴", "こんにちは"},
+				{"害羞", "才没有", "", "そんなことない"},
+			},
+		},
+		{
+			name: "半角括号动作",
+			text: "【开心】你好(蹭蹭)<やあ>",
+			cfg:  DefaultParseConfig,
+			want: []segment{{"开心", "你好", "蹭蹭", "やあ"}},
+		},
+		{
+			name: "自定义括号",
+			text: "[happy]hello *wave* {こんにちは}[sad]bye",
+			cfg:  bracketConfig,
+			want: []segment{
+				{"happy", "hello", "wave", "こんにちは"},
+				{"sad", "bye", "", ""},
+			},
+		},
+		{
+			name: "不解析动作",
+			text: "【开心】你好（摇尾巴）<こんにちは>",
+			cfg:  noMotionConfig,
+			want: []segment{{"开心", "你好（摇尾巴）", "", "こんにちは"}},
+		},
+		{
+			name: "未闭合的标签",
+			text: "【开心】你好【生气",
+			cfg:  DefaultParseConfig,
+			want: []segment{{"开心", "你好生气", "", ""}},
+		},
+		{
+			name: "多余的闭括号",
+			text: "【开心】你好】再见",
+			cfg:  DefaultParseConfig,
+			want: []segment{{"开心", "你好再见", "", ""}},
+		},
+		{
+			name: "嵌套标签取最内层",
+			text: "【外【开心】】你好",
+			cfg:  DefaultParseConfig,
+			want: []segment{{"", "外", "", ""}, {"开心", "你好", "", ""}},
+		},
+		{
+			name: "空标签后无内容",
+			text: "【开心】【难过】呜呜",
+			cfg:  DefaultParseConfig,
+			want: []segment{{"难过", "呜呜", "", ""}},
+		},
+		{
+			name: "空分隔符时整段不解析",
+			text: "【开心】你好",
+			cfg:  ParseConfig{},
+			want: []segment{{"", "【开心】你好", "", ""}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toSegments(AnalyzeEmotions(tt.text, "", "", "wav", tt.cfg))
+			if len(got) != len(tt.want) {
+				t.Fatalf("AnalyzeEmotions() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("segment %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeEmotions_VoiceFile(t *testing.T) {
+	results := AnalyzeEmotions("【开心】你好【难过】再见", "voice", "c1_m2_", "mp3", DefaultParseConfig)
+	want := []string{filepath.Join("voice", "c1_m2_part_1.mp3"), filepath.Join("voice", "c1_m2_part_2.mp3")}
+	for i, r := range results {
+		if r.VoiceFile != want[i] || r.Index != i+1 {
+			t.Errorf("results[%d] = %d %s, want %d %s", i, r.Index, r.VoiceFile, i+1, want[i])
+		}
+	}
+}
+
+func TestAnalyzeEmotions_Untagged(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []segment
+	}{
+		{
+			name: "没有标签",
+			text: "今天天气真好（摇尾巴）<いい天気>",
+			want: []segment{{"", "今天天气真好", "摇尾巴", "いい天気"}},
+		},
+		{
+			name: "标签前有文本",
+			text: "嗯……【开心】好呀",
+			want: []segment{{"", "嗯……", "", ""}, {"开心", "好呀", "", ""}},
+		},
+		{
+			name: "最后一个标签后的文本",
+			text: "【开心】好呀<いいよ>那我们走吧",
+			want: []segment{{"开心", "好呀那我们走吧", "", "いいよ"}},
+		},
+		{
+			name: "空标签",
+			text: "【】好呀",
+			want: []segment{{"", "好呀", "", ""}},
+		},
+		{
+			name: "只有空白",
+			text: "  \n",
+			want: []segment{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := AnalyzeEmotions(tt.text, "", "", "wav", DefaultParseConfig)
+			got := toSegments(results)
+			if len(got) != len(tt.want) {
+				t.Fatalf("AnalyzeEmotions() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("segment %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+				wantEmotion := ""
+				if tt.want[i].Tag == "" {
+					wantEmotion = DefaultParseConfig.DefaultEmotion
+				}
+				if results[i].Predicted != wantEmotion || results[i].Index != i+1 {
+					t.Errorf("segment %d Predicted = %q Index = %d, want %q %d", i, results[i].Predicted, results[i].Index, wantEmotion, i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeEmotions_MaxSegments(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []segment
+	}{
+		{
+			name:  "恰好达到上限",
+			text:  "【开心】你好<こんにちは>【难过】再见<さよなら>【生气】哼",
+			limit: 3,
+			want: []segment{
+				{"开心", "你好", "", "こんにちは"},
+				{"难过", "再见", "", "さよなら"},
+				{"生气", "哼", "", ""},
+			},
+		},
+		{
+			name:  "超出部分合并到最后一个分段",
+			text:  "【开心】你好<こんにちは>【难过】再见<さよなら>【生气】哼（跺脚）<ふん>【害羞】才没有<そんなことない>",
+			limit: 2,
+			want: []segment{
+				{"开心", "你好", "", "こんにちは"},
+				{"难过", "再见哼才没有", "跺脚", "さよならふんそんなことない"},
+			},
+		},
+		{
+			name:  "未标记分段也计入上限",
+			text:  "嗯……【开心】好呀<いいよ>【难过】再见",
+			limit: 2,
+			want: []segment{
+				{"", "嗯……", "", ""},
+				{"开心", "好呀再见", "", "いいよ"},
+			},
+		},
+		{
+			name:  "上限为1",
+			text:  "【开心】你好【难过】再见",
+			limit: 1,
+			want:  []segment{{"开心", "你好再见", "", ""}},
+		},
+		{
+			name:  "不限制",
+			text:  "【开心】你好【难过】再见",
+			limit: 0,
+			want:  []segment{{"开心", "你好", "", ""}, {"难过", "再见", "", ""}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultParseConfig
+			cfg.MaxSegments = tt.limit
+			want := AnalyzeEmotions(tt.text, "", "", "wav", cfg)
+			if got := toSegments(want); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AnalyzeEmotions() = %+v, want %+v", got, tt.want)
+			}
+
+			var streamed []Result
+			for r := range AnalyzeEmotionsStream(context.Background(), streamTokens(tt.text, 2), "", "", "wav", cfg) {
+				streamed = append(streamed, r)
+			}
+			if !reflect.DeepEqual(streamed, want) {
+				t.Errorf("AnalyzeEmotionsStream() = %+v, want %+v", streamed, want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeEmotions_MinSegmentLength(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		min       int
+		want      []segment
+		wantIndex []int
+	}{
+		{
+			name: "合并同一情绪的短分段",
+			text: "【开心】嗯<うん>【开心】今天天气真好<今日はいい天気だね>【开心】。<。>",
+			min:  5,
+			want: []segment{
+				{"开心", "嗯今天天气真好。", "", "うん今日はいい天気だね。"},
+			},
+			wantIndex: []int{1},
+		},
+		{
+			name: "不跨越情绪标签",
+			text: "【开心】嗯<うん>【难过】唉<はぁ>【难过】算了（叹气）<もういいよ>",
+			min:  5,
+			want: []segment{
+				{"开心", "嗯", "", "うん"},
+				{"难过", "唉算了", "叹气", "はぁもういいよ"},
+			},
+			wantIndex: []int{1, 2},
+		},
+		{
+			name: "足够长的分段不合并",
+			text: "【开心】你好<こんにちは>【开心】再见<さようなら>",
+			min:  5,
+			want: []segment{
+				{"开心", "你好", "", "こんにちは"},
+				{"开心", "再见", "", "さようなら"},
+			},
+			wantIndex: []int{1, 2},
+		},
+		{
+			name: "未标记分段之间合并",
+			text: "嗯<うん>【】好<いい>【开心】走吧<行こう>",
+			min:  3,
+			want: []segment{
+				{"", "嗯好", "", "うんいい"},
+				{"开心", "走吧", "", "行こう"},
+			},
+			wantIndex: []int{1, 3},
+		},
+		{
+			name: "不合并",
+			text: "【开心】嗯<うん>【开心】。<。>",
+			min:  0,
+			want: []segment{
+				{"开心", "嗯", "", "うん"},
+				{"开心", "。", "", "。"},
+			},
+			wantIndex: []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultParseConfig
+			cfg.MinSegmentLength = tt.min
+			want := AnalyzeEmotions(tt.text, "", "", "wav", cfg)
+			if got := toSegments(want); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AnalyzeEmotions() = %+v, want %+v", got, tt.want)
+			}
+			// 合并后的分段沿用第一个分段的序号和语音文件
+			for i, r := range want {
+				if r.Index != tt.wantIndex[i] || r.VoiceFile != fmt.Sprintf("part_%d.wav", tt.wantIndex[i]) {
+					t.Errorf("results[%d] index = %d, voice file = %s, want %d", i, r.Index, r.VoiceFile, tt.wantIndex[i])
+				}
+			}
+
+			for _, chunk := range []int{1, 3, 1000} {
+				var streamed []Result
+				for r := range AnalyzeEmotionsStream(context.Background(), streamTokens(tt.text, chunk), "", "", "wav", cfg) {
+					streamed = append(streamed, r)
+				}
+				if !reflect.DeepEqual(streamed, want) {
+					t.Errorf("AnalyzeEmotionsStream(chunk=%d) = %+v, want %+v", chunk, streamed, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeEmotions_Markup(t *testing.T) {
+	const text = "【开心】*最喜欢*你了（*摇*尾巴）<*大好き*だよ>【难过】A&B<さよなら>"
+	tests := []struct {
+		name     string
+		markup   bool
+		want     []segment
+		wantSSML []bool
+	}{
+		{
+			name:   "关闭时按普通文本处理",
+			markup: false,
+			want: []segment{
+				{"开心", "*最喜欢*你了", "*摇*尾巴", "*大好き*だよ"},
+				{"难过", "A&B", "", "さよなら"},
+			},
+			wantSSML: []bool{false, false},
+		},
+		{
+			name:   "开启时日语转换为SSML，正文去掉标记",
+			markup: true,
+			want: []segment{
+				{"开心", "最喜欢你了", "摇尾巴", "<emphasis>大好き</emphasis>だよ"},
+				{"难过", "A&B", "", "さよなら"},
+			},
+			wantSSML: []bool{true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultParseConfig
+			cfg.Markup = tt.markup
+			results := AnalyzeEmotions(text, "", "", "wav", cfg)
+			if got := toSegments(results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AnalyzeEmotions() = %+v, want %+v", got, tt.want)
+			}
+			for i, r := range results {
+				if r.SSML != tt.wantSSML[i] {
+					t.Errorf("results[%d].SSML = %v, want %v", i, r.SSML, tt.wantSSML[i])
+				}
+			}
+		})
+	}
+
+	cfg := DefaultParseConfig
+	cfg.Markup = true
+	results := AnalyzeEmotions("【开心】<*A&B*だ>", "", "", "wav", cfg)
+	if got := results[0].JapaneseText; got != "<emphasis>A&amp;B</emphasis>だ" {
+		t.Errorf("JapaneseText = %q, want escaped ssml", got)
+	}
+}
+
+// streamTokens 按每chunk个字符把text切分后依次发送
+func streamTokens(text string, chunk int) <-chan string {
+	tokens := make(chan string)
+	go func() {
+		defer close(tokens)
+		runes := []rune(text)
+		for i := 0; i < len(runes); i += chunk {
+			tokens <- string(runes[i:min(i+chunk, len(runes))])
+		}
+	}()
+	return tokens
+}
+
+func TestAnalyzeEmotionsStream(t *testing.T) {
+	texts := []struct {
+		name string
+		text string
+	}{
+		{name: "默认格式", text: "【开心】你好呀（摇尾巴）<こんにちは>【害羞】才没有<そんなことない>"},
+		{name: "开头未标记", text: "嗯……【开心】你好<こんにちは>"},
+		{name: "没有标签", text: "你好呀<こんにちは>"},
+		{name: "空标签与空分段", text: "【】你好<やあ>【开心】【难过】再见<さよなら>"},
+		{name: "嵌套与残留括号", text: "【开【心】你好】<こんにちは>【未闭合"},
+		{name: "空文本", text: ""},
+	}
+	for _, tt := range texts {
+		want := AnalyzeEmotions(tt.text, "voice", "p_", "wav", DefaultParseConfig)
+		for _, chunk := range []int{1, 2, 3, 7, 1000} {
+			t.Run(fmt.Sprintf("%s/chunk=%d", tt.name, chunk), func(t *testing.T) {
+				var got []Result
+				for r := range AnalyzeEmotionsStream(context.Background(), streamTokens(tt.text, chunk), "voice", "p_", "wav", DefaultParseConfig) {
+					got = append(got, r)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("AnalyzeEmotionsStream() = %+v, want %+v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestAnalyzeEmotionsStream_Incremental(t *testing.T) {
+	tokens := make(chan string)
+	results := AnalyzeEmotionsStream(context.Background(), tokens, "", "", "wav", DefaultParseConfig)
+
+	// 下一个标签完整出现即可得到上一个分段，不必等待输出结束
+	tokens <- "【开心】你好<こんにちは>"
+	tokens <- "【难"
+	tokens <- "过】"
+	select {
+	case r := <-results:
+		if r.OriginalTag != "开心" || r.JapaneseText != "こんにちは" {
+			t.Errorf("first result = %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("first segment not emitted before stream ended")
+	}
+
+	tokens <- "再见<さよなら>"
+	close(tokens)
+	r, ok := <-results
+	if !ok || r.OriginalTag != "难过" || r.JapaneseText != "さよなら" {
+		t.Errorf("second result = %+v, ok = %v", r, ok)
+	}
+	if _, ok := <-results; ok {
+		t.Error("results should be closed after tokens")
+	}
+}
+
+func TestAnalyzeEmotionsStream_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tokens := make(chan string)
+	results := AnalyzeEmotionsStream(ctx, tokens, "", "", "wav", DefaultParseConfig)
+	cancel()
+	select {
+	case _, ok := <-results:
+		if ok {
+			t.Error("unexpected result after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("results not closed after cancel")
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"LingChat/api"
+	"LingChat/api/routes/v1/response"
+	"LingChat/internal/clients/moderation"
+	"LingChat/internal/errs"
+	"LingChat/internal/logging"
+)
+
+// DefaultModerationReply 内容未通过审核时代替回复发给用户的话
+const DefaultModerationReply = "抱歉，这个话题我没办法陪你聊呢，我们换个话题吧～"
+
+// 审核的阶段，用于日志和错误信息
+const (
+	moderationInput  = "input"
+	moderationOutput = "output"
+)
+
+// moderate 用check审核text，违规时返回包装了errs.ErrModerated和*moderation.Violation的错误。
+// 审核服务本身出错时只记录警告并放行，避免审核不可用时聊天也不可用
+func (l *LingChatService) moderate(ctx context.Context, stage, text string, check func(context.Context, string) error) error {
+	if l.Moderator == nil {
+		return nil
+	}
+	err := check(ctx, text)
+	switch {
+	case err == nil:
+		return nil
+	case moderation.IsViolation(err):
+		logging.FromContext(ctx).Warn("内容未通过审核", "stage", stage, "err", err)
+		return fmt.Errorf("%w: %s: %w", errs.ErrModerated, stage, err)
+	default:
+		logging.FromContext(ctx).Warn("内容审核失败，放行", "stage", stage, "err", err)
+		return nil
+	}
+}
+
+// checkInput 调用LLM前审核用户消息
+func (l *LingChatService) checkInput(ctx context.Context, message string) error {
+	if l.Moderator == nil {
+		return nil
+	}
+	return l.moderate(ctx, moderationInput, message, l.Moderator.CheckInput)
+}
+
+// checkOutput 解析和合成语音前审核LLM的原始回复
+func (l *LingChatService) checkOutput(ctx context.Context, reply string) error {
+	if l.Moderator == nil {
+		return nil
+	}
+	return l.moderate(ctx, moderationOutput, reply, l.Moderator.CheckOutput)
+}
+
+// moderated 内容未通过审核。此时已有安全回复发给用户，WS消息的处理不再视为失败
+func moderated(err error) bool {
+	return errors.Is(err, errs.ErrModerated)
+}
+
+// moderationReply ModerationReply未设置时使用DefaultModerationReply
+func (l *LingChatService) moderationReply() string {
+	if l.ModerationReply == "" {
+		return DefaultModerationReply
+	}
+	return l.ModerationReply
+}
+
+// moderatedPart 代替回复的安全回复，没有语音，ErrorCode为errs.CodeModerated
+func (l *LingChatService) moderatedPart(ctx context.Context, message string) api.Response {
+	emotion := l.ParseConfig.DefaultEmotion
+	part := l.createResponsePart(Result{
+		FollowingText: l.moderationReply(),
+		Predicted:     emotion,
+		Motion:        l.MotionMap.Motion(emotion),
+	}, 0, 1, message)
+	part.ErrorCode = errs.CodeModerated
+	part.RequestID = logging.RequestID(ctx)
+	return part
+}
+
+// moderatedResponse 未通过审核时的响应。用户消息违规时对话中没有记录，turn为nil
+func (l *LingChatService) moderatedResponse(ctx context.Context, turn *Turn, conversationID, message string) *response.CompletionResponse {
+	parts := []api.Response{l.moderatedPart(ctx, message)}
+	resp := &response.CompletionResponse{ConversationID: conversationID, Messages: parts}
+	if turn != nil {
+		resp = newCompletionResponse(turn.Conversation, turn.ReplyMessage, parts)
+	}
+	resp.RequestID = logging.RequestID(ctx)
+	return resp
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"LingChat/api"
+	"LingChat/internal/clients/moderation"
+	"LingChat/internal/errs"
+)
+
+// fakeModerator 包含blocked的内容视为违规，err非nil时审核本身失败
+type fakeModerator struct {
+	blockInput  string
+	blockOutput string
+	err         error
+}
+
+func (m *fakeModerator) check(text, blocked string) error {
+	if m.err != nil {
+		return m.err
+	}
+	if blocked != "" && strings.Contains(text, blocked) {
+		return &moderation.Violation{Categories: []string{"harassment"}}
+	}
+	return nil
+}
+
+func (m *fakeModerator) CheckInput(_ context.Context, text string) error {
+	return m.check(text, m.blockInput)
+}
+
+func (m *fakeModerator) CheckOutput(_ context.Context, text string) error {
+	return m.check(text, m.blockOutput)
+}
+
+func Test_LingChatModeration(t *testing.T) {
+	tests := []struct {
+		name          string
+		moderator     *fakeModerator
+		wantModerated bool
+		wantLLMCalls  int
+		wantTTSCalls  int32
+	}{
+		{name: "通过审核", moderator: &fakeModerator{blockInput: "坏话", blockOutput: "脏话"}, wantLLMCalls: 1, wantTTSCalls: 1},
+		{name: "用户消息违规", moderator: &fakeModerator{blockInput: "你好"}, wantModerated: true},
+		{name: "回复违规", moderator: &fakeModerator{blockOutput: "こんにちは"}, wantModerated: true, wantLLMCalls: 1},
+		{name: "审核服务出错时放行", moderator: &fakeModerator{blockInput: "你好", err: errors.New("unavailable")}, wantLLMCalls: 1, wantTTSCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ttsCalls atomic.Int32
+			l, repo := newTestService(t, "【开心】你好<こんにちは>",
+				func(w http.ResponseWriter, r *http.Request) {
+					ttsCalls.Add(1)
+					w.Write([]byte("audio"))
+				},
+				emotionHandler("开心"),
+			)
+			l.Moderator = tt.moderator
+
+			resp, err := l.LingChat(context.Background(), "你好", "", "")
+			if got := errors.Is(err, errs.ErrModerated); got != tt.wantModerated {
+				t.Fatalf("LingChat() error = %v, want moderated %v", err, tt.wantModerated)
+			}
+			if !tt.wantModerated && err != nil {
+				t.Fatal(err)
+			}
+			if got := len(l.llmClient.(*fakeLLM).calls); got != tt.wantLLMCalls {
+				t.Errorf("llm calls = %d, want %d", got, tt.wantLLMCalls)
+			}
+			if got := ttsCalls.Load(); got != tt.wantTTSCalls {
+				t.Errorf("tts calls = %d, want %d", got, tt.wantTTSCalls)
+			}
+			if !tt.wantModerated {
+				return
+			}
+
+			if !moderation.IsViolation(err) {
+				t.Errorf("error = %v, want to wrap *moderation.Violation", err)
+			}
+			if len(resp.Messages) != 1 {
+				t.Fatalf("len(Messages) = %d, want 1", len(resp.Messages))
+			}
+			part := resp.Messages[0]
+			if part.Message != DefaultModerationReply || part.ErrorCode != errs.CodeModerated || part.AudioFile != "" {
+				t.Errorf("Messages[0] = %+v, want moderation reply without audio", part)
+			}
+			// 违规的回复不保存，历史中是安全回复
+			if resp.MessageID != "" {
+				id, _ := strconv.ParseInt(resp.MessageID, 10, 64)
+				if got := repo.messages[id].Content; got != DefaultModerationReply {
+					t.Errorf("saved reply = %q, want moderation reply", got)
+				}
+			}
+		})
+	}
+}
+
+func Test_LingChatByWSModeration(t *testing.T) {
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("开心"),
+	)
+	l.Moderator = &fakeModerator{blockInput: "你好"}
+	l.ModerationReply = "换个话题吧"
+	msg := api.Message{Type: api.MessageTypeMessage, Content: "你好"}
+
+	// 对WS客户端来说安全回复是正常的回复，通过errorCode区分
+	resp, err := l.LingChatByWS(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp) != 1 || resp[0].Message != "换个话题吧" || resp[0].ErrorCode != errs.CodeModerated {
+		t.Errorf("LingChatByWS() = %+v, want moderation reply", resp)
+	}
+
+	var streamed []api.Response
+	err = l.LingChatByWSStream(context.Background(), msg, func(resp api.Response) error {
+		streamed = append(streamed, resp)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streamed) != 1 || streamed[0].Message != "换个话题吧" || streamed[0].ErrorCode != errs.CodeModerated {
+		t.Errorf("LingChatByWSStream() sent %+v, want moderation reply", streamed)
+	}
+}
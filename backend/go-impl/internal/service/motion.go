@@ -0,0 +1,77 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// motionFile 动作映射文件的格式：
+//
+//	{"default": "idle", "motions": {"开心": "jump", "难过": "cry"}}
+type motionFile struct {
+	Default string            `json:"default"`
+	Motions map[string]string `json:"motions"`
+}
+
+// MotionMap 情绪到虚拟形象动作的映射，从JSON文件加载，可在运行中调用Reload重新加载。
+// 与LLM输出的动作描写（MotionText）不同，Motion是前端播放的动作名
+type MotionMap struct {
+	path string
+
+	mu      sync.RWMutex
+	def     string
+	motions map[string]string
+}
+
+// LoadMotionMap 从path加载动作映射
+func LoadMotionMap(path string) (*MotionMap, error) {
+	m := &MotionMap{path: path}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload 重新读取映射文件，读取或解析失败时保留原来的映射
+func (m *MotionMap) Reload() error {
+	raw, err := os.ReadFile(m.path)
+	if err != nil {
+		return fmt.Errorf("读取动作映射失败: %w", err)
+	}
+	var file motionFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return fmt.Errorf("解析动作映射失败: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.def = file.Default
+	m.motions = file.Motions
+	return nil
+}
+
+// Motion 返回emotion对应的动作，没有映射时返回默认动作；m为nil时返回空字符串
+func (m *MotionMap) Motion(emotion string) string {
+	if m == nil {
+		return ""
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if motion, ok := m.motions[emotion]; ok {
+		return motion
+	}
+	return m.def
+}
+
+// Len 映射中的情绪数量
+func (m *MotionMap) Len() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.motions)
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMotionMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "motions.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"default": "idle", "motions": {"开心": "jump"}}`)
+
+	m, err := LoadMotionMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		emotion string
+		want    string
+	}{
+		{name: "已映射的情绪", emotion: "开心", want: "jump"},
+		{name: "未映射的情绪使用默认动作", emotion: "难过", want: "idle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.Motion(tt.emotion); got != tt.want {
+				t.Errorf("Motion(%q) = %q, want %q", tt.emotion, got, tt.want)
+			}
+		})
+	}
+
+	write(`{"default": "stand", "motions": {"开心": "wave"}}`)
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Motion("开心"); got != "wave" {
+		t.Errorf("Motion after reload = %q, want wave", got)
+	}
+
+	write(`not json`)
+	if err := m.Reload(); err == nil {
+		t.Error("Reload() with invalid file error = nil")
+	}
+	if got := m.Motion("难过"); got != "stand" {
+		t.Errorf("Motion after failed reload = %q, want previous mapping", got)
+	}
+
+	var empty *MotionMap
+	if got := empty.Motion("开心"); got != "" {
+		t.Errorf("nil MotionMap.Motion() = %q, want empty", got)
+	}
+}
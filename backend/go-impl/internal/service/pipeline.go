@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"LingChat/internal/logging"
+)
+
+// PipelineSegment 调试流水线中一个分段的中间结果
+type PipelineSegment struct {
+	Result
+	// AudioURL 语音在存储中的地址，内嵌音频或合成失败时为空
+	AudioURL string
+	// VoiceError 该分段语音合成失败的原因
+	VoiceError string
+}
+
+// PipelineTimings 调试流水线各阶段的耗时
+type PipelineTimings struct {
+	Parse   time.Duration
+	Voice   time.Duration
+	Emotion time.Duration
+	Total   time.Duration
+}
+
+// PipelineResult 调试流水线的结果
+type PipelineResult struct {
+	Segments []PipelineSegment
+	Timings  PipelineTimings
+}
+
+// DebugPipeline 跳过LLM，把text当作LLM的回复依次解析分段、合成语音、预测情绪，返回每一步的中间结果，
+// 用于调整解析规则和情绪映射而不消耗LLM token。结果不写入聊天记录；演练模式下不合成语音也不预测情绪
+func (l *LingChatService) DebugPipeline(ctx context.Context, text string) (*PipelineResult, error) {
+	text, err := sanitizeMessage(text, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	ctx = l.withSettings(logging.EnsureRequestID(ctx))
+	ctx = l.withPreferences(ctx)
+	ctx, cancel := l.withRequestTimeout(ctx)
+	defer cancel()
+
+	var timings PipelineTimings
+	start := time.Now()
+	prefix := fmt.Sprintf("debug_%s_", randomToken())
+	segments := AnalyzeEmotions(text, l.tempFilePath, prefix, l.audioFormat(), l.ParseConfig)
+	segments = l.Sanitizer.Apply(segments)
+	l.LanguageRouter.Detect(segments)
+	l.runHooks(ctx, segments)
+	timings.Parse = time.Since(start)
+
+	voiceErrs := VoiceErrors{}
+	if l.DryRun {
+		dryRunSegments(segments)
+	} else {
+		voiceStart := time.Now()
+		audioDataList, err := l.GenerateVoice(ctx, segments, l.userVoice(ctx), !l.InlineAudio)
+		timings.Voice = time.Since(voiceStart)
+		if err != nil && !errors.As(err, &voiceErrs) {
+			return nil, err
+		}
+		for i := range segments {
+			if _, failed := voiceErrs[i]; failed {
+				segments[i].VoiceFile = ""
+				segments[i].AudioUnavailable = true
+			} else if l.InlineAudio {
+				l.attachAudio(&segments[i], audioDataList[i])
+			}
+		}
+
+		emotionStart := time.Now()
+		if l.predictEmotions(ctx) {
+			segments = l.EmoPredictBatch(ctx, segments)
+		} else {
+			useTagEmotions(segments)
+		}
+		timings.Emotion = time.Since(emotionStart)
+	}
+	timings.Total = time.Since(start)
+
+	result := &PipelineResult{Segments: make([]PipelineSegment, 0, len(segments)), Timings: timings}
+	for i, segment := range segments {
+		segment.Motion = l.MotionMap.Motion(segment.Predicted)
+		part := PipelineSegment{Result: segment, AudioURL: l.audioURL(segment.VoiceFile)}
+		if err := voiceErrs[i]; err != nil {
+			part.VoiceError = err.Error()
+		}
+		result.Segments = append(result.Segments, part)
+	}
+	logging.FromContext(ctx).Info("调试流水线完成", "segments", len(segments), "total_ms", timings.Total.Milliseconds())
+	return result, nil
+}
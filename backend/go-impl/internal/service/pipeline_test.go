@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"LingChat/internal/errs"
+)
+
+func TestLingChatService_DebugPipeline(t *testing.T) {
+	l, repo := newTestService(t, "",
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("text") == "さよなら" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write(testWAV(16000, strings.Repeat("a", 3200)))
+		},
+		emotionHandler("高兴"),
+	)
+	store := &memStorage{objects: map[string][]byte{}}
+	l.Storage = store
+
+	result, err := l.DebugPipeline(context.Background(), "【开心】你好<こんにちは>【难过】再见<さよなら>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Segments) != 2 {
+		t.Fatalf("segments = %d, want 2", len(result.Segments))
+	}
+
+	first, second := result.Segments[0], result.Segments[1]
+	if first.OriginalTag != "开心" || first.FollowingText != "你好" || first.JapaneseText != "こんにちは" {
+		t.Errorf("first segment = %+v, want parsed 开心/你好/こんにちは", first.Result)
+	}
+	if first.Predicted != "高兴" || first.Confidence != 0.9 {
+		t.Errorf("first prediction = %s/%v, want 高兴/0.9", first.Predicted, first.Confidence)
+	}
+	key, ok := strings.CutPrefix(first.AudioURL, "https://cdn.example.com/")
+	if !ok || store.objects[key] == nil || !strings.HasPrefix(key, "debug_") {
+		t.Errorf("first AudioURL = %q, want stored debug_ audio", first.AudioURL)
+	}
+	if first.DurationMs != 100 || first.VoiceError != "" {
+		t.Errorf("first audio = %dms, error %q, want 100ms without error", first.DurationMs, first.VoiceError)
+	}
+	// 合成失败的分段照常预测情绪，并带上失败原因
+	if second.AudioURL != "" || second.VoiceError == "" || second.Predicted != "高兴" {
+		t.Errorf("second segment = %+v, want voice error without audio", second)
+	}
+	if result.Timings.Total < result.Timings.Voice+result.Timings.Emotion {
+		t.Errorf("timings = %+v, want total to include each stage", result.Timings)
+	}
+	// 不经过LLM，也不写入聊天记录
+	if len(repo.messages) != 0 {
+		t.Errorf("recorded %d messages, want none", len(repo.messages))
+	}
+
+	if _, err := l.DebugPipeline(context.Background(), "  "); !errors.Is(err, errs.ErrEmptyMessage) {
+		t.Errorf("DebugPipeline(blank) error = %v, want ErrEmptyMessage", err)
+	}
+}
+
+func TestLingChatService_DebugPipelineDryRun(t *testing.T) {
+	l, _ := newTestService(t, "",
+		func(w http.ResponseWriter, r *http.Request) { t.Error("VITS requested in dry run") },
+		func(w http.ResponseWriter, r *http.Request) { t.Error("emotion requested in dry run") },
+	)
+	l.DryRun = true
+
+	result, err := l.DebugPipeline(context.Background(), "【开心】你好<こんにちは>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Segments[0]; got.Predicted != "开心" || got.AudioURL != "" {
+		t.Errorf("segment = %+v, want tag emotion without audio", got)
+	}
+}
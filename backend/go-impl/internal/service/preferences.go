@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"LingChat/api/routes/common"
+	"LingChat/internal/clients/VitsTTS"
+	"LingChat/internal/data"
+	"LingChat/internal/errs"
+	"LingChat/internal/logging"
+)
+
+// Preferences 当前用户生效的回复偏好，未设置的项取全局配置
+type Preferences struct {
+	SpeakerID int
+	Speed     float64
+	// Language 检测不出回复语言时按该语言选择说话人，为空表示使用默认说话人
+	Language        string
+	PredictEmotions bool
+}
+
+type preferencesKey struct{}
+
+// withPreferences 本轮对话开始时读取一次当前用户的偏好，之后的语音合成和情绪预测都使用它。
+// 未登录、未配置PreferencesRepo或读取失败时使用全局配置
+func (l *LingChatService) withPreferences(ctx context.Context) context.Context {
+	user := common.GetUserFromContext(ctx)
+	if user == nil || l.PreferencesRepo == nil {
+		return ctx
+	}
+	prefs, err := l.PreferencesRepo.Get(ctx, user.ID)
+	if err != nil {
+		logging.FromContext(ctx).Warn("读取用户偏好失败，使用默认设置", "user", user.ID, "err", err)
+		// 放入nil，本轮对话不再重复读取
+		prefs = nil
+	}
+	return context.WithValue(ctx, preferencesKey{}, prefs)
+}
+
+// storedPreferences 返回ctx中本轮对话的偏好，不在对话中时读取当前用户的偏好，都没有时返回nil
+func (l *LingChatService) storedPreferences(ctx context.Context) *data.Preferences {
+	if prefs, ok := ctx.Value(preferencesKey{}).(*data.Preferences); ok {
+		return prefs
+	}
+	prefs, _ := l.withPreferences(ctx).Value(preferencesKey{}).(*data.Preferences)
+	return prefs
+}
+
+// effectivePreferences 用全局配置补全未设置的偏好
+func (l *LingChatService) effectivePreferences(ctx context.Context, prefs *data.Preferences) Preferences {
+	voice := l.userVoice(ctx)
+	effective := Preferences{
+		SpeakerID:       voice.SpeakerID,
+		Speed:           voice.Speed,
+		PredictEmotions: l.PredictEmotions,
+	}
+	if prefs == nil {
+		return effective
+	}
+	if prefs.Language != nil {
+		effective.Language = *prefs.Language
+	}
+	if prefs.PredictEmotions != nil {
+		effective.PredictEmotions = *prefs.PredictEmotions
+	}
+	return effective
+}
+
+// GetPreferences 返回当前用户生效的偏好
+func (l *LingChatService) GetPreferences(ctx context.Context) Preferences {
+	return l.effectivePreferences(ctx, l.storedPreferences(ctx))
+}
+
+// UpdatePreferences 校验并整体替换当前用户的偏好，nil字段恢复为全局配置
+func (l *LingChatService) UpdatePreferences(ctx context.Context, prefs *data.Preferences) (Preferences, error) {
+	user := common.GetUserFromContext(ctx)
+	if user == nil {
+		return Preferences{}, errors.New("user not found in context")
+	}
+	if l.PreferencesRepo == nil {
+		return Preferences{}, errors.New("preferences are not configured")
+	}
+	if err := l.validatePreferences(ctx, prefs); err != nil {
+		return Preferences{}, err
+	}
+	saved, err := l.PreferencesRepo.Save(ctx, user.ID, prefs)
+	if err != nil {
+		return Preferences{}, err
+	}
+	return l.effectivePreferences(context.WithValue(ctx, preferencesKey{}, saved), saved), nil
+}
+
+// validatePreferences 检查偏好的取值，语言代码统一为小写。
+// 说话人不存在时拒绝；VITS暂时不可达时只记录警告，与启动时校验默认说话人一致
+func (l *LingChatService) validatePreferences(ctx context.Context, prefs *data.Preferences) error {
+	if prefs.Speed != nil && (*prefs.Speed < VitsTTS.MinSpeed || *prefs.Speed > VitsTTS.MaxSpeed) {
+		return fmt.Errorf("%w: speed %v out of range [%v, %v]", errs.ErrInvalidArgument, *prefs.Speed, VitsTTS.MinSpeed, VitsTTS.MaxSpeed)
+	}
+	if prefs.Language != nil {
+		lang := strings.ToLower(strings.TrimSpace(*prefs.Language))
+		if !validLanguageCode(lang) {
+			return fmt.Errorf("%w: unknown language code %q", errs.ErrInvalidArgument, *prefs.Language)
+		}
+		prefs.Language = &lang
+	}
+	if prefs.SpeakerID != nil {
+		if *prefs.SpeakerID < 0 {
+			return fmt.Errorf("%w: speaker id must not be negative", errs.ErrInvalidArgument)
+		}
+		if l.VitsTTSClient != nil {
+			err := l.VitsTTSClient.ValidateSpeaker(ctx, *prefs.SpeakerID)
+			if errors.Is(err, VitsTTS.ErrSpeakerNotFound) {
+				return fmt.Errorf("%w: %w", errs.ErrInvalidArgument, err)
+			}
+			if err != nil {
+				logging.FromContext(ctx).Warn("无法校验VITS说话人", "speaker", *prefs.SpeakerID, "err", err)
+			}
+		}
+	}
+	return nil
+}
+
+// predictEmotions 本轮对话是否预测情绪，用户偏好优先于PredictEmotions
+func (l *LingChatService) predictEmotions(ctx context.Context) bool {
+	if prefs := l.storedPreferences(ctx); prefs != nil && prefs.PredictEmotions != nil {
+		return *prefs.PredictEmotions
+	}
+	return l.PredictEmotions
+}
+
+// preferredLanguage 用户偏好的语言，未设置时为空
+func (l *LingChatService) preferredLanguage(ctx context.Context) string {
+	if prefs := l.storedPreferences(ctx); prefs != nil && prefs.Language != nil {
+		return *prefs.Language
+	}
+	return ""
+}
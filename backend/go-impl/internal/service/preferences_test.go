@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"LingChat/api/routes/common"
+	"LingChat/internal/clients/VitsTTS"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/errs"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func userContext(id int64) context.Context {
+	return context.WithValue(context.Background(), common.CurrentUserInfoKey, &ent.User{ID: id})
+}
+
+func Test_userVoicePreferences(t *testing.T) {
+	repo := newFakePreferencesRepo()
+	repo.prefs[1] = data.Preferences{SpeakerID: ptr(9), Speed: ptr(1.5)}
+	l := NewLingChatService(nil, VitsTTS.NewClient("", "", 4), nil, nil, "", "")
+	l.PreferencesRepo = repo
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		wantSpeaker int
+		wantSpeed   float64
+	}{
+		{name: "未登录", ctx: context.Background(), wantSpeaker: 4, wantSpeed: 1},
+		{name: "没有偏好", ctx: userContext(2), wantSpeaker: 4, wantSpeed: 1},
+		{name: "偏好优先于默认值", ctx: userContext(1), wantSpeaker: 9, wantSpeed: 1.5},
+		{
+			name:        "偏好优先于User上的说话人",
+			ctx:         context.WithValue(context.Background(), common.CurrentUserInfoKey, &ent.User{ID: 1, SpeakerID: ptr(7)}),
+			wantSpeaker: 9,
+			wantSpeed:   1.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			voice := l.userVoice(tt.ctx)
+			if voice.SpeakerID != tt.wantSpeaker || voice.Speed != tt.wantSpeed {
+				t.Errorf("userVoice() = %+v, want speaker %d speed %v", voice, tt.wantSpeaker, tt.wantSpeed)
+			}
+		})
+	}
+}
+
+func Test_LingChatPreferences(t *testing.T) {
+	var mu sync.Mutex
+	var speakers []string
+	var emotionCalls atomic.Int32
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			speakers = append(speakers, r.URL.Query().Get("id"))
+			mu.Unlock()
+			w.Write([]byte("audio"))
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			emotionCalls.Add(1)
+			emotionHandler("难过")(w, r)
+		},
+	)
+	repo := newFakePreferencesRepo()
+	repo.prefs[1] = data.Preferences{SpeakerID: ptr(9), PredictEmotions: ptr(false)}
+	l.PreferencesRepo = repo
+
+	resp, err := l.LingChat(userContext(1), "你好", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emotionCalls.Load() != 0 || resp.Messages[0].Emotion != "开心" {
+		t.Errorf("emotion calls = %d, emotion = %q, want tag emotion without prediction", emotionCalls.Load(), resp.Messages[0].Emotion)
+	}
+	if len(speakers) != 1 || speakers[0] != "9" {
+		t.Errorf("speakers = %v, want [9]", speakers)
+	}
+	// 一轮对话只读取一次偏好
+	if repo.gets != 1 {
+		t.Errorf("preferences read %d times, want 1", repo.gets)
+	}
+}
+
+func Test_LingChatPreferencesReadFailure(t *testing.T) {
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("难过"),
+	)
+	repo := newFakePreferencesRepo()
+	repo.err = errors.New("db down")
+	l.PreferencesRepo = repo
+
+	resp, err := l.LingChat(userContext(1), "你好", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Messages[0].Emotion != "难过" {
+		t.Errorf("Emotion = %q, want predicted emotion with default settings", resp.Messages[0].Emotion)
+	}
+	if repo.gets != 1 {
+		t.Errorf("preferences read %d times, want 1", repo.gets)
+	}
+}
+
+func TestLingChatService_UpdatePreferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefs   data.Preferences
+		wantErr error
+		want    Preferences
+	}{
+		{name: "全部使用默认值", prefs: data.Preferences{}, want: Preferences{SpeakerID: 4, Speed: 1, PredictEmotions: true}},
+		{
+			name:  "设置全部偏好",
+			prefs: data.Preferences{SpeakerID: ptr(2), Speed: ptr(0.8), Language: ptr(" EN "), PredictEmotions: ptr(false)},
+			want:  Preferences{SpeakerID: 2, Speed: 0.8, Language: "en", PredictEmotions: false},
+		},
+		{name: "语速超出范围", prefs: data.Preferences{Speed: ptr(3.0)}, wantErr: errs.ErrInvalidArgument},
+		{name: "未知语言", prefs: data.Preferences{Language: ptr("klingon")}, wantErr: errs.ErrInvalidArgument},
+		{name: "说话人为负数", prefs: data.Preferences{SpeakerID: ptr(-1)}, wantErr: errs.ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// VITS不可达时只记录警告，不拒绝说话人
+			vits := VitsTTS.NewClient("http://127.0.0.1:1", "", 4)
+			vits.MaxRetries = 0
+			l := NewLingChatService(nil, vits, nil, nil, "", "")
+			l.PreferencesRepo = newFakePreferencesRepo()
+
+			got, err := l.UpdatePreferences(userContext(1), &tt.prefs)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdatePreferences() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("UpdatePreferences() = %+v, want %+v", got, tt.want)
+			}
+			if again := l.GetPreferences(userContext(1)); again != tt.want {
+				t.Errorf("GetPreferences() = %+v, want %+v", again, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"LingChat/api"
+)
+
+type progressKey struct{}
+
+// progressReporter 把进度事件交给report，各阶段的goroutine并发调用时串行化
+type progressReporter struct {
+	mu     sync.Mutex
+	report func(api.Response)
+}
+
+// WithProgress 对话的各阶段开始时调用report发送status事件（见api.ResponseTypeStatus），
+// ctx中没有report时不发送。report在持有锁时调用，不会并发执行
+func WithProgress(ctx context.Context, report func(api.Response)) context.Context {
+	return context.WithValue(ctx, progressKey{}, &progressReporter{report: report})
+}
+
+// reportProgress 报告stage阶段开始，partIndex为分段下标，LLM阶段为0
+func reportProgress(ctx context.Context, stage string, partIndex int) {
+	if p, ok := ctx.Value(progressKey{}).(*progressReporter); ok {
+		p.send(ctx, api.Response{Type: api.ResponseTypeStatus, Stage: stage, PartIndex: partIndex})
+	}
+}
+
+// send ctx结束后不再发送
+func (p *progressReporter) send(ctx context.Context, resp api.Response) {
+	if ctx.Err() != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.report(resp)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"LingChat/api"
+)
+
+func Test_ChatHandlerStreamProgress(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(map[bool]string{false: "关闭", true: "开启"}[enabled], func(t *testing.T) {
+			l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>",
+				func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+				emotionHandler("开心"),
+			)
+			l.ProgressEvents = enabled
+
+			var mu sync.Mutex
+			var received []api.Response
+			err := l.ChatHandlerStream(context.Background(), []byte(`{"type":"message","content":"你好"}`), func(msg []byte) error {
+				var resp api.Response
+				if err := json.Unmarshal(msg, &resp); err != nil {
+					t.Error(err)
+				}
+				mu.Lock()
+				received = append(received, resp)
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var statuses []string
+			replies := 0
+			for i, resp := range received {
+				switch resp.Type {
+				case api.ResponseTypeStatus:
+					statuses = append(statuses, fmt.Sprintf("%s:%d", resp.Stage, resp.PartIndex))
+					if resp.Stage == api.StageLLM && i != 0 {
+						t.Errorf("llm status at position %d, want first", i)
+					}
+				case "reply":
+					replies++
+					// 分段的语音合成和情绪预测都在回复之前开始
+					for _, stage := range []string{api.StageTTS, api.StageEmotion} {
+						if enabled && !slices.Contains(statuses, fmt.Sprintf("%s:%d", stage, resp.PartIndex)) {
+							t.Errorf("reply %d sent before %s status", resp.PartIndex, stage)
+						}
+					}
+				}
+			}
+			if replies != 2 {
+				t.Errorf("replies = %d, want 2", replies)
+			}
+			slices.Sort(statuses)
+			want := []string{"emotion:0", "emotion:1", "llm:0", "tts:0", "tts:1"}
+			if !enabled {
+				want = nil
+			}
+			if !slices.Equal(statuses, want) {
+				t.Errorf("statuses = %v, want %v", statuses, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"LingChat/internal/errs"
+	"LingChat/internal/metrics"
+)
+
+// TurnQueue 限制同时处理的对话数，超出的对话排队等待，排队数达到上限时直接拒绝。
+// 突发流量下按固定的并发处理对话，而不是全部同时请求下游后一起超时
+type TurnQueue struct {
+	slots     chan struct{}
+	maxQueued int
+
+	mu      sync.Mutex
+	waiting int
+}
+
+// NewTurnQueue maxInFlight为同时处理的对话数，maxQueued为最多排队等待的对话数，0表示不排队
+func NewTurnQueue(maxInFlight, maxQueued int) *TurnQueue {
+	return &TurnQueue{slots: make(chan struct{}, max(maxInFlight, 1)), maxQueued: max(maxQueued, 0)}
+}
+
+// Acquire 占用一个处理名额，返回处理结束时必须调用的release。
+// 排队已满时返回errs.ErrOverloaded；ctx在排队期间结束（如超过请求的截止时间）时放弃排队，返回ctx的错误
+func (q *TurnQueue) Acquire(ctx context.Context) (func(), error) {
+	select {
+	case q.slots <- struct{}{}:
+		return q.release(), nil
+	default:
+	}
+
+	q.mu.Lock()
+	if q.waiting >= q.maxQueued {
+		q.mu.Unlock()
+		return nil, fmt.Errorf("%w: %d turns queued", errs.ErrOverloaded, q.maxQueued)
+	}
+	q.waiting++
+	metrics.ChatQueueDepth.Inc()
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		q.waiting--
+		metrics.ChatQueueDepth.Dec()
+		q.mu.Unlock()
+	}()
+
+	select {
+	case q.slots <- struct{}{}:
+		return q.release(), nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("排队等待超时: %w", ctx.Err())
+	}
+}
+
+func (q *TurnQueue) release() func() {
+	metrics.ChatInFlight.Inc()
+	return func() {
+		metrics.ChatInFlight.Dec()
+		<-q.slots
+	}
+}
+
+// Depth 当前排队等待的对话数
+func (q *TurnQueue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiting
+}
+
+// acquireTurn 开启排队时等待处理名额，未设置Queue时不限制
+func (l *LingChatService) acquireTurn(ctx context.Context) (func(), error) {
+	if l.Queue == nil {
+		return func() {}, nil
+	}
+	return l.Queue.Acquire(ctx)
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"LingChat/internal/errs"
+	"LingChat/internal/metrics"
+)
+
+func TestTurnQueue(t *testing.T) {
+	q := NewTurnQueue(1, 1)
+	release, err := q.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第二个对话排队，等第一个结束后开始处理
+	acquired := make(chan func())
+	go func() {
+		r, err := q.Acquire(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- r
+	}()
+	for q.Depth() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := testutil.ToFloat64(metrics.ChatQueueDepth); got != 1 {
+		t.Errorf("queue depth metric = %v, want 1", got)
+	}
+
+	// 排队已满
+	if _, err := q.Acquire(context.Background()); !errors.Is(err, errs.ErrOverloaded) {
+		t.Errorf("Acquire() error = %v, want ErrOverloaded", err)
+	}
+
+	release()
+	second := <-acquired
+	if q.Depth() != 0 {
+		t.Errorf("Depth() = %d, want 0", q.Depth())
+	}
+	second()
+}
+
+func TestTurnQueue_Deadline(t *testing.T) {
+	q := NewTurnQueue(1, 1)
+	release, err := q.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := q.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() error = %v, want DeadlineExceeded", err)
+	}
+	// 超时放弃排队后不再占用排队名额
+	if q.Depth() != 0 {
+		t.Errorf("Depth() = %d, want 0", q.Depth())
+	}
+}
+
+func Test_LingChatQueueFull(t *testing.T) {
+	unblock := make(chan struct{})
+	started := make(chan struct{}, 1)
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			<-unblock
+			w.Write([]byte("audio"))
+		},
+		emotionHandler("开心"),
+	)
+	l.Queue = NewTurnQueue(1, 0)
+
+	done := make(chan error)
+	go func() {
+		_, err := l.LingChat(context.Background(), "你好", "", "")
+		done <- err
+	}()
+	<-started
+
+	if _, err := l.LingChat(context.Background(), "你好", "", ""); errs.HTTPStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("LingChat() error = %v, want 503", err)
+	}
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
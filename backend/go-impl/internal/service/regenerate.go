@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"LingChat/internal/clients/VitsTTS"
+	"LingChat/internal/data"
+	"LingChat/internal/errs"
+)
+
+// RegenerateAudioRequest 重新合成一个分段的语音，未设置的声音参数沿用当前用户的偏好和默认设置
+type RegenerateAudioRequest struct {
+	// Text 要合成的文本，即分段的日语部分
+	Text      string
+	SpeakerID *int
+	Speed     *float64
+	Pitch     *float64
+	// SSML Text是否为SSML片段
+	SSML bool
+}
+
+// RegeneratedAudio 重新合成的语音，内嵌音频时Audio有值，否则AudioFile为存储中的地址
+type RegeneratedAudio struct {
+	AudioFile   string
+	Audio       []byte
+	AudioFormat string
+}
+
+// RegenerateAudio 单独重新合成一个分段的语音，前端重试合成失败或听不清的句子时不必重放整轮对话。
+// 文本由调用方提供，与用户消息一样经过审核，SSML片段只能含VitsTTS.SSMLElements中的元素。
+// 与对话中的分段一样经过熔断和VITS客户端的音频缓存，每次都保存为新的文件
+func (l *LingChatService) RegenerateAudio(ctx context.Context, req RegenerateAudioRequest) (*RegeneratedAudio, error) {
+	text, err := sanitizeMessage(req.Text, l.MaxMessageLength, l.StripControlChars)
+	if err != nil {
+		return nil, err
+	}
+	if l.DryRun {
+		return nil, fmt.Errorf("%w: 演练模式下不合成语音", errs.ErrInvalidArgument)
+	}
+	if req.SSML {
+		if err := VitsTTS.ValidateSSML(text); err != nil {
+			return nil, fmt.Errorf("%w: %w", errs.ErrInvalidArgument, err)
+		}
+	}
+	if req.Pitch != nil && (*req.Pitch < VitsTTS.MinPitch || *req.Pitch > VitsTTS.MaxPitch) {
+		return nil, fmt.Errorf("%w: pitch %v out of range [%v, %v]", errs.ErrInvalidArgument, *req.Pitch, VitsTTS.MinPitch, VitsTTS.MaxPitch)
+	}
+	if err := l.validatePreferences(ctx, &data.Preferences{SpeakerID: req.SpeakerID, Speed: req.Speed}); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := l.withRequestTimeout(ctx)
+	defer cancel()
+	if err := l.checkInput(ctx, text); err != nil {
+		return nil, err
+	}
+	ctx = l.withPreferences(ctx)
+	voice := l.userVoice(ctx)
+	if req.SpeakerID == nil {
+		// 没有指定说话人时与对话中的分段一样按语言选择
+		voice = l.segmentVoice(ctx, voice, Result{SSML: req.SSML})
+	} else {
+		voice.SpeakerID = *req.SpeakerID
+		voice.SSML = req.SSML
+	}
+	if req.Speed != nil {
+		voice.Speed = *req.Speed
+	}
+	if req.Pitch != nil {
+		voice.Pitch = *req.Pitch
+	}
+
+	audioData, err := l.voiceVITS(ctx, text, voice)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrTTS, err)
+	}
+
+	format := l.audioFormat()
+	if l.InlineAudio {
+		return &RegeneratedAudio{Audio: audioData, AudioFormat: format}, nil
+	}
+	voiceFile := fmt.Sprintf("regen_%s.%s", uuid.NewString(), format)
+	if err := l.storage().Put(ctx, voiceFile, audioData); err != nil {
+		return nil, fmt.Errorf("保存语音文件失败: %w", err)
+	}
+	return &RegeneratedAudio{AudioFile: l.audioURL(voiceFile), AudioFormat: format}, nil
+}
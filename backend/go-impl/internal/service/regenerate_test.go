@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"LingChat/internal/errs"
+)
+
+func TestLingChatService_RegenerateAudio(t *testing.T) {
+	l, _ := newTestService(t, "",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.URL.Query().Get("text") + "/" + r.URL.Query().Get("id")))
+		},
+		emotionHandler("开心"),
+	)
+	store := &memStorage{objects: map[string][]byte{}}
+	l.Storage = store
+
+	first, err := l.RegenerateAudio(context.Background(), RegenerateAudioRequest{Text: "こんにちは", SpeakerID: ptr(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok := strings.CutPrefix(first.AudioFile, "https://cdn.example.com/")
+	if !ok {
+		t.Fatalf("AudioFile = %q, want storage url", first.AudioFile)
+	}
+	if data, _ := store.Get(context.Background(), key); string(data) != "こんにちは/3" {
+		t.Errorf("stored audio = %q, want こんにちは/3", data)
+	}
+
+	// 每次重新合成都保存为新文件，不覆盖之前的语音
+	second, err := l.RegenerateAudio(context.Background(), RegenerateAudioRequest{Text: "こんにちは", SpeakerID: ptr(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.AudioFile == first.AudioFile {
+		t.Errorf("AudioFile = %q for both requests, want distinct files", first.AudioFile)
+	}
+}
+
+func TestLingChatService_RegenerateAudioInline(t *testing.T) {
+	l, _ := newTestService(t, "",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("开心"),
+	)
+	l.InlineAudio = true
+
+	audio, err := l.RegenerateAudio(context.Background(), RegenerateAudioRequest{Text: "こんにちは"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(audio.Audio) != "audio" || audio.AudioFile != "" || audio.AudioFormat != "wav" {
+		t.Errorf("RegenerateAudio() = %+v, want inline wav audio", audio)
+	}
+}
+
+func TestLingChatService_RegenerateAudioErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     RegenerateAudioRequest
+		dryRun  bool
+		status  int
+		blocked string
+		wantErr error
+	}{
+		{name: "文本为空", req: RegenerateAudioRequest{Text: "  "}, wantErr: errs.ErrEmptyMessage},
+		{name: "语速超出范围", req: RegenerateAudioRequest{Text: "こんにちは", Speed: ptr(3.0)}, wantErr: errs.ErrInvalidArgument},
+		{name: "音调超出范围", req: RegenerateAudioRequest{Text: "こんにちは", Pitch: ptr(0.1)}, wantErr: errs.ErrInvalidArgument},
+		{name: "说话人为负数", req: RegenerateAudioRequest{Text: "こんにちは", SpeakerID: ptr(-1)}, wantErr: errs.ErrInvalidArgument},
+		{name: "SSML注入其他元素", req: RegenerateAudioRequest{Text: `x</voice></speak>`, SSML: true}, wantErr: errs.ErrInvalidArgument},
+		{name: "文本未通过审核", req: RegenerateAudioRequest{Text: "ばか"}, blocked: "ばか", wantErr: errs.ErrModerated},
+		{name: "演练模式", req: RegenerateAudioRequest{Text: "こんにちは"}, dryRun: true, wantErr: errs.ErrInvalidArgument},
+		{name: "语音合成失败", req: RegenerateAudioRequest{Text: "こんにちは"}, status: http.StatusInternalServerError, wantErr: errs.ErrTTS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestService(t, "",
+				func(w http.ResponseWriter, r *http.Request) {
+					if tt.status != 0 {
+						w.WriteHeader(tt.status)
+						return
+					}
+					w.Write([]byte("audio"))
+				},
+				emotionHandler("开心"),
+			)
+			l.DryRun = tt.dryRun
+			if tt.blocked != "" {
+				l.Moderator = &fakeModerator{blockInput: tt.blocked}
+			}
+
+			if _, err := l.RegenerateAudio(context.Background(), tt.req); !errors.Is(err, tt.wantErr) {
+				t.Errorf("RegenerateAudio() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
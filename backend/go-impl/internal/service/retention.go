@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// StartHistoryPurger 启动后台任务，每隔interval永久删除超过retention不再活跃的对话和已软删除的消息。
+// retention<=0时不启动；重复调用会先停止之前的任务；ctx取消或调用StopHistoryPurger时退出
+func (l *LingChatService) StartHistoryPurger(ctx context.Context, interval, retention time.Duration) {
+	l.StopHistoryPurger()
+	if retention <= 0 || interval <= 0 {
+		return
+	}
+
+	purger := startBackgroundTask(ctx, interval, func(ctx context.Context) {
+		l.purgeHistory(ctx, l.now().Add(-retention))
+	})
+
+	l.sweeperMu.Lock()
+	l.purger = purger
+	l.sweeperMu.Unlock()
+}
+
+// StopHistoryPurger 停止聊天记录清理任务并等待其退出，未启动时直接返回
+func (l *LingChatService) StopHistoryPurger() {
+	l.sweeperMu.Lock()
+	purger := l.purger
+	l.purger = nil
+	l.sweeperMu.Unlock()
+
+	purger.stop()
+}
+
+// purgeHistory 删除before之前的聊天记录，失败只记录日志，等待下一次执行
+func (l *LingChatService) purgeHistory(ctx context.Context, before time.Time) {
+	n, err := l.conversationService.PurgeHistory(ctx, before)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("清理过期聊天记录失败: %v", err)
+		}
+		return
+	}
+	if n > 0 {
+		log.Printf("已清理 %d 条过期聊天记录", n)
+	}
+}
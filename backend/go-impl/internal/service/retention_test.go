@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"LingChat/api/routes/common"
+	"LingChat/internal/data/ent/ent"
+)
+
+func TestLingChatService_HistoryPurger(t *testing.T) {
+	repo := newFakeConversationRepo()
+	l := &LingChatService{conversationService: NewConversationService(repo, nil, "")}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Now()
+	l.StartHistoryPurger(ctx, 10*time.Millisecond, time.Hour)
+	defer l.StopHistoryPurger()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		repo.mu.Lock()
+		purges := append([]time.Time(nil), repo.purges...)
+		repo.mu.Unlock()
+		if len(purges) > 0 {
+			if before := purges[0]; before.Before(start.Add(-time.Hour)) || before.After(time.Now().Add(-time.Hour)) {
+				t.Errorf("PurgeHistory before = %v, want about an hour before %v", before, start)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("purger did not run")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLingChatService_HistoryPurgerDisabled(t *testing.T) {
+	l := &LingChatService{}
+	l.StartHistoryPurger(context.Background(), time.Millisecond, 0)
+	if l.purger != nil {
+		t.Error("purger started with zero retention")
+	}
+	l.StopHistoryPurger()
+}
+
+func TestConversationService_DeleteHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    *ent.User
+		hard    bool
+		wantErr bool
+	}{
+		{name: "未登录", wantErr: true},
+		{name: "软删除", user: &ent.User{ID: 7}},
+		{name: "永久删除", user: &ent.User{ID: 7}, hard: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeConversationRepo()
+			s := NewConversationService(repo, nil, "")
+			ctx := context.Background()
+			if tt.user != nil {
+				ctx = context.WithValue(ctx, common.CurrentUserInfoKey, tt.user)
+			}
+
+			_, err := s.DeleteHistory(ctx, tt.hard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeleteHistory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(repo.deletes) != 0 {
+					t.Errorf("repo called without user: %v", repo.deletes)
+				}
+				return
+			}
+			if hard, ok := repo.deletes[tt.user.ID]; !ok || hard != tt.hard {
+				t.Errorf("deletes = %v, want user %d hard=%v", repo.deletes, tt.user.ID, tt.hard)
+			}
+		})
+	}
+}
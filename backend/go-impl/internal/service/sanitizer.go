@@ -0,0 +1,72 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+// OutputSanitizer 在解析之后清理分段的显示文本（Result.FollowingText）：
+// 去掉LLM漏出的情绪标签和残缺的括号，删除屏蔽的短语。情绪标签的提取在解析阶段已经完成，不受影响
+type OutputSanitizer struct {
+	// strayMarkers 完整的标记已在解析时提取，显示文本中剩下的都是残缺的括号
+	strayMarkers *strings.Replacer
+	// leakedTag 漏出的完整情绪标签，如【开心】
+	leakedTag *regexp.Regexp
+	blocklist *regexp.Regexp
+}
+
+// NewOutputSanitizer 按cfg的标记约定创建清理器，blocklist中的短语不区分大小写地从显示文本中删除
+func NewOutputSanitizer(cfg ParseConfig, blocklist []string) *OutputSanitizer {
+	var markers []string
+	for _, marker := range []string{cfg.TagOpen, cfg.TagClose, cfg.VoiceOpen, cfg.VoiceClose} {
+		if marker != "" {
+			markers = append(markers, marker, "")
+		}
+	}
+	// 不提取动作时，动作描写按约定保留在正文中
+	if cfg.ParseMotion {
+		for _, marker := range []string{cfg.MotionOpen, cfg.MotionClose} {
+			if marker != "" {
+				markers = append(markers, marker, "")
+			}
+		}
+	}
+
+	s := &OutputSanitizer{strayMarkers: strings.NewReplacer(markers...)}
+	if cfg.TagOpen != "" && cfg.TagClose != "" {
+		s.leakedTag = enclosedRegex(cfg.TagOpen, cfg.TagClose)
+	}
+	var phrases []string
+	for _, phrase := range blocklist {
+		if phrase = strings.TrimSpace(phrase); phrase != "" {
+			phrases = append(phrases, regexp.QuoteMeta(phrase))
+		}
+	}
+	if len(phrases) > 0 {
+		s.blocklist = regexp.MustCompile(`(?i)` + strings.Join(phrases, "|"))
+	}
+	return s
+}
+
+// Sanitize 清理一段显示文本
+func (s *OutputSanitizer) Sanitize(text string) string {
+	if s.leakedTag != nil {
+		text = s.leakedTag.ReplaceAllString(text, "")
+	}
+	text = s.strayMarkers.Replace(text)
+	if s.blocklist != nil {
+		text = s.blocklist.ReplaceAllString(text, "")
+	}
+	return strings.TrimSpace(text)
+}
+
+// Apply 清理每个分段的显示文本，s为nil时不做处理
+func (s *OutputSanitizer) Apply(results []Result) []Result {
+	if s == nil {
+		return results
+	}
+	for i := range results {
+		results[i].FollowingText = s.Sanitize(results[i].FollowingText)
+	}
+	return results
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOutputSanitizer(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		blocklist []string
+		want      string
+	}{
+		{name: "正常文本不变", text: "你好呀", want: "你好呀"},
+		{name: "漏出的完整标签", text: "你好【开心】呀", want: "你好呀"},
+		{name: "残缺的情绪括号", text: "开心】你好【", want: "开心你好"},
+		{name: "未闭合的日语括号", text: "你好<こんにち", want: "你好こんにち"},
+		{name: "未闭合的动作括号", text: "你好（摇尾巴", want: "你好摇尾巴"},
+		{name: "屏蔽短语不区分大小写", text: "作为AI语言模型，我很开心", blocklist: []string{"作为ai语言模型，"}, want: "我很开心"},
+		{name: "忽略空的屏蔽短语", text: "[SYSTEM]你好 [system]呀", blocklist: []string{"[system]", " ", ""}, want: "你好 呀"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewOutputSanitizer(DefaultParseConfig, tt.blocklist)
+			if got := s.Sanitize(tt.text); got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputSanitizer_Apply(t *testing.T) {
+	const text = "【开心】【【你好<こんにちは>（摇尾巴【难过】再见<さよなら"
+	results := AnalyzeEmotions(text, "", "", "wav", DefaultParseConfig)
+	NewOutputSanitizer(DefaultParseConfig, nil).Apply(results)
+
+	// 情绪标签和日语照常提取，只清理显示文本
+	want := []segment{
+		{"开心", "你好摇尾巴", "", "こんにちは"},
+		{"难过", "再见さよなら", "", ""},
+	}
+	if got := toSegments(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %+v, want %+v", got, want)
+	}
+
+	var s *OutputSanitizer
+	if got := s.Apply([]Result{{FollowingText: "【"}}); got[0].FollowingText != "【" {
+		t.Errorf("nil sanitizer changed text to %q", got[0].FollowingText)
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+
+	"LingChat/api"
+	"LingChat/internal/logging"
+)
+
+type segmentEventsKey struct{}
+
+// WithSegmentEvents 开启TextFirst时，回复解析出分段后立即把每个分段的文本以text事件交给report，
+// 各分段语音合成完成后再发送audio事件（见api.ResponseTypeText、api.ResponseTypeAudio）；
+// ctx中没有report时不发送。report在持有锁时调用，不会并发执行
+func WithSegmentEvents(ctx context.Context, report func(api.Response)) context.Context {
+	return context.WithValue(ctx, segmentEventsKey{}, &progressReporter{report: report})
+}
+
+// reportSegmentTexts 在合成语音前发送全部分段的文本，情绪和音频随之后的reply发送
+func reportSegmentTexts(ctx context.Context, segments []Result, userMessage string) {
+	p, ok := ctx.Value(segmentEventsKey{}).(*progressReporter)
+	if !ok {
+		return
+	}
+	for i, segment := range segments {
+		p.send(ctx, api.Response{
+			Type:            api.ResponseTypeText,
+			OriginalTag:     segment.OriginalTag,
+			Message:         segment.FollowingText,
+			MotionText:      segment.MotionText,
+			OriginalMessage: userMessage,
+			IsMultiPart:     true,
+			PartIndex:       i,
+			TotalParts:      len(segments),
+			RequestID:       logging.RequestID(ctx),
+		})
+	}
+}
+
+// reportSegmentAudio 第idx个分段的语音已保存或内嵌，合成失败的分段不发送
+func (l *LingChatService) reportSegmentAudio(ctx context.Context, idx int, segment Result) {
+	p, ok := ctx.Value(segmentEventsKey{}).(*progressReporter)
+	if !ok {
+		return
+	}
+	resp := l.createResponsePart(segment, idx, 0, "")
+	p.send(ctx, api.Response{
+		Type:        api.ResponseTypeAudio,
+		AudioFile:   resp.AudioFile,
+		AudioData:   resp.AudioData,
+		AudioFormat: resp.AudioFormat,
+		DurationMs:  resp.DurationMs,
+		PartIndex:   idx,
+		RequestID:   logging.RequestID(ctx),
+	})
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"LingChat/api"
+)
+
+func Test_ChatHandlerStreamTextFirst(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(map[bool]string{false: "关闭", true: "开启"}[enabled], func(t *testing.T) {
+			l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>",
+				func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Query().Get("text") == "さよなら" {
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					w.Write([]byte("audio"))
+				},
+				emotionHandler("开心"),
+			)
+			l.TextFirst = enabled
+
+			var mu sync.Mutex
+			var received []api.Response
+			err := l.ChatHandlerStream(context.Background(), []byte(`{"type":"message","content":"你好"}`), func(msg []byte) error {
+				var resp api.Response
+				if err := json.Unmarshal(msg, &resp); err != nil {
+					t.Error(err)
+				}
+				mu.Lock()
+				received = append(received, resp)
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			texts := map[int]api.Response{}
+			audios := map[int]api.Response{}
+			replies := 0
+			for _, resp := range received {
+				switch resp.Type {
+				case api.ResponseTypeText:
+					texts[resp.PartIndex] = resp
+				case api.ResponseTypeAudio:
+					if _, ok := texts[resp.PartIndex]; !ok {
+						t.Errorf("audio %d sent before its text", resp.PartIndex)
+					}
+					audios[resp.PartIndex] = resp
+				case "reply":
+					replies++
+					if !enabled {
+						continue
+					}
+					// 全部分段的文本在第一个回复之前发送
+					if len(texts) != 2 {
+						t.Errorf("reply %d sent after %d texts, want 2", resp.PartIndex, len(texts))
+					}
+					if text := texts[resp.PartIndex]; text.Message != resp.Message || text.TotalParts != resp.TotalParts {
+						t.Errorf("text %+v does not match reply %+v", text, resp)
+					}
+					if audio, ok := audios[resp.PartIndex]; ok && audio.AudioFile != resp.AudioFile {
+						t.Errorf("audio file = %q, reply has %q", audio.AudioFile, resp.AudioFile)
+					}
+				}
+			}
+			if replies != 2 {
+				t.Errorf("replies = %d, want 2", replies)
+			}
+			if !enabled {
+				if len(texts)+len(audios) != 0 {
+					t.Errorf("received %d text and %d audio events, want none", len(texts), len(audios))
+				}
+				return
+			}
+			if texts[0].Message != "你好" || texts[1].Message != "再见" || texts[0].Emotion != "" {
+				t.Errorf("texts = %+v, want parsed messages without emotion", texts)
+			}
+			// 合成失败的分段没有audio事件
+			if len(audios) != 1 || audios[0].AudioFile == "" {
+				t.Errorf("audios = %+v, want only part 0", audios)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+
+	"LingChat/api/routes/common"
+	"LingChat/internal/clients/llm"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent"
+	"LingChat/internal/data/ent/ent/conversationmessage"
+	"LingChat/internal/errs"
+	"LingChat/internal/logging"
+)
+
+const (
+	// DefaultSessionTitle 创建会话时未指定标题使用的标题
+	DefaultSessionTitle = "新会话"
+	// MaxSessionTitleLength 会话标题的最大字符数
+	MaxSessionTitleLength = 128
+	// MaxAutoTitleLength 自动生成的标题的最大字符数
+	MaxAutoTitleLength = 20
+	// DefaultTitleTimeout LLM生成标题的超时
+	DefaultTitleTimeout = 30 * time.Second
+
+	titlePrompt = "用不超过%d个字概括用户这句话的主题，作为聊天会话的标题。只输出标题本身，不要解释，不要加引号。"
+	// titleMaxTokens 标题很短，限制输出长度避免模型长篇回复
+	titleMaxTokens = 32
+	// titleQuotes 模型有时仍会给标题加上的引号和书名号
+	titleQuotes = "\"'“”‘’「」『』《》"
+)
+
+// CreateSession 为当前用户创建会话，同时创建保存其消息的对话。title为空时使用DefaultSessionTitle
+func (l *LingChatService) CreateSession(ctx context.Context, title string) (*ent.Session, error) {
+	user := common.GetUserFromContext(ctx)
+	if user == nil {
+		return nil, errors.New("未登录")
+	}
+	if l.SessionRepo == nil {
+		return nil, errors.New("未启用会话")
+	}
+	title = strings.TrimSpace(title)
+	// 用户指定了标题的会话不再自动生成标题
+	titled := title != ""
+	if !titled {
+		title = DefaultSessionTitle
+	}
+	if utf8.RuneCountInString(title) > MaxSessionTitleLength {
+		return nil, fmt.Errorf("%w: 会话标题超过%d个字符", errs.ErrInvalidArgument, MaxSessionTitleLength)
+	}
+
+	conv, _, err := l.conversationService.conversationRepo.CreateConversationWithMessages(ctx, title, user.ID, data.MessageInput{
+		Role:    string(conversationmessage.RoleSystem),
+		Content: data.SystemPrompt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建对话失败: %w", err)
+	}
+	session, err := l.SessionRepo.Create(ctx, user.ID, title, titled, conv.ID)
+	if err != nil {
+		return nil, fmt.Errorf("创建会话失败: %w", err)
+	}
+	return session, nil
+}
+
+// ListSessions 按最近活跃时间从新到旧列出当前用户的会话
+func (l *LingChatService) ListSessions(ctx context.Context) ([]*ent.Session, error) {
+	user := common.GetUserFromContext(ctx)
+	if user == nil {
+		return nil, errors.New("未登录")
+	}
+	if l.SessionRepo == nil {
+		return []*ent.Session{}, nil
+	}
+	return l.SessionRepo.List(ctx, user.ID)
+}
+
+// sessionConversation 返回消息所属的会话及其对话ID，并更新会话的活跃时间。sessionID为空时返回nil和空字符串，
+// 即开始一段新对话。会话不存在或不属于当前用户（包括未登录）时返回ErrForbidden，
+// 不区分这两种情况，避免泄露其他用户的会话ID
+func (l *LingChatService) sessionConversation(ctx context.Context, sessionID string) (*ent.Session, string, error) {
+	if sessionID == "" {
+		return nil, "", nil
+	}
+	session, err := l.ownedSession(ctx, sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := l.SessionRepo.Touch(ctx, session.ID); err != nil {
+		logging.FromContext(ctx).Warn("更新会话活跃时间失败", "session", session.ID, "err", err)
+	}
+	return session, strconv.FormatInt(session.ConversationID, 10), nil
+}
+
+// ownedSession 返回当前用户ID为sessionID的会话，错误与sessionConversation相同
+func (l *LingChatService) ownedSession(ctx context.Context, sessionID string) (*ent.Session, error) {
+	if l.SessionRepo == nil {
+		return nil, fmt.Errorf("%w: 未启用会话", errs.ErrInvalidArgument)
+	}
+	id, err := strconv.ParseInt(sessionID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 无效的会话ID %q", errs.ErrInvalidArgument, sessionID)
+	}
+
+	user := common.GetUserFromContext(ctx)
+	if user == nil {
+		return nil, fmt.Errorf("%w: 使用会话需要登录", errs.ErrForbidden)
+	}
+	session, err := l.SessionRepo.Get(ctx, id)
+	if errors.Is(err, data.ErrSessionNotFound) || (err == nil && session.UserID != user.ID) {
+		return nil, fmt.Errorf("%w: 会话%d不存在或不属于当前用户", errs.ErrForbidden, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取会话失败: %w", err)
+	}
+	return session, nil
+}
+
+// titleSession 会话还没有标题时用这一轮的用户消息生成标题，session为nil时什么也不做。
+// 先同步设置截断消息得到的标题，开启SessionLLMTitles时再在后台请求LLM概括，成功后替换。
+// titled标记保证每个会话只自动生成一次标题
+func (l *LingChatService) titleSession(ctx context.Context, session *ent.Session, message string) {
+	if session == nil || session.Titled {
+		return
+	}
+	title := heuristicTitle(message)
+	if title == "" {
+		return
+	}
+	logger := logging.FromContext(ctx)
+	ok, err := l.SessionRepo.SetAutoTitle(ctx, session.ID, title)
+	if err != nil {
+		logger.Warn("设置会话标题失败", "session", session.ID, "err", err)
+		return
+	}
+	// 同一会话并发的另一条消息已经设置了标题
+	if !ok || !l.SessionLLMTitles {
+		return
+	}
+
+	// 总结标题不应拖慢回复，也不随请求结束而取消，关闭服务时与进行中的对话一起等待
+	titleCtx, done, err := l.turns.begin(context.WithoutCancel(ctx))
+	if err != nil {
+		return
+	}
+	go func() {
+		defer done()
+		titleCtx, cancel := context.WithTimeout(titleCtx, DefaultTitleTimeout)
+		defer cancel()
+
+		title, err := l.summarizeTitle(titleCtx, message)
+		if err != nil {
+			logger.Warn("LLM生成会话标题失败，保留截断的标题", "session", session.ID, "err", err)
+			return
+		}
+		if err := l.SessionRepo.UpdateTitle(titleCtx, session.ID, title); err != nil {
+			logger.Warn("设置会话标题失败", "session", session.ID, "err", err)
+		}
+	}()
+}
+
+// summarizeTitle 请求LLM把消息概括为不超过MaxAutoTitleLength个字的标题
+func (l *LingChatService) summarizeTitle(ctx context.Context, message string) (string, error) {
+	ctx = llm.WithSystemPrompt(ctx, fmt.Sprintf(titlePrompt, MaxAutoTitleLength))
+	ctx = llm.WithOptions(ctx, llm.Options{MaxTokens: titleMaxTokens})
+	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: message}}
+
+	var reply string
+	err := l.LLMBreaker.Do(func() error {
+		var err error
+		reply, err = l.llmClient.Chat(ctx, messages, l.ConfigModel)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	title := heuristicTitle(strings.Trim(strings.TrimSpace(reply), titleQuotes))
+	if title == "" {
+		return "", errors.New("empty title")
+	}
+	return title, nil
+}
+
+// heuristicTitle 取消息的前MaxAutoTitleLength个字作为标题，空白合并为一个空格，去掉控制字符
+func heuristicTitle(message string) string {
+	message = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, message)
+	title := strings.Join(strings.Fields(message), " ")
+	if runes := []rune(title); len(runes) > MaxAutoTitleLength {
+		title = strings.TrimSpace(string(runes[:MaxAutoTitleLength])) + "…"
+	}
+	return title
+}
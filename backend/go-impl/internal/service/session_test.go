@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+
+	"LingChat/api"
+	"LingChat/internal/clients/llm"
+	"LingChat/internal/errs"
+)
+
+func newTestSessionService(t *testing.T) (*LingChatService, *fakeSessionRepo) {
+	t.Helper()
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("开心"),
+	)
+	sessions := newFakeSessionRepo()
+	l.SessionRepo = sessions
+	return l, sessions
+}
+
+func TestLingChatService_CreateSession(t *testing.T) {
+	l, _ := newTestSessionService(t)
+	ctx := userContext(1)
+
+	first, err := l.CreateSession(ctx, "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Title != DefaultSessionTitle || first.UserID != 1 || first.ConversationID == 0 {
+		t.Errorf("CreateSession() = %+v, want default title owned by user 1", first)
+	}
+	second, err := l.CreateSession(ctx, "旅行计划")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ConversationID == first.ConversationID {
+		t.Error("sessions share a conversation")
+	}
+	if _, err := l.CreateSession(userContext(2), "别人的会话"); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := l.ListSessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Title != "旅行计划" || list[1].Title != DefaultSessionTitle {
+		t.Errorf("ListSessions() = %+v, want user 1's two sessions newest first", list)
+	}
+
+	if _, err := l.CreateSession(context.Background(), ""); err == nil {
+		t.Error("CreateSession() without user succeeded")
+	}
+	title := make([]rune, MaxSessionTitleLength+1)
+	for i := range title {
+		title[i] = '长'
+	}
+	if _, err := l.CreateSession(ctx, string(title)); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Errorf("CreateSession() with long title error = %v, want ErrInvalidArgument", err)
+	}
+}
+
+func Test_LingChatByWSSession(t *testing.T) {
+	l, sessions := newTestSessionService(t)
+	session, err := l.CreateSession(userContext(1), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := strconv.FormatInt(session.ID, 10)
+
+	for _, content := range []string{"第一句", "第二句"} {
+		msg := api.Message{Type: api.MessageTypeMessage, Content: content, SessionID: sessionID}
+		if _, err := l.LingChatByWS(userContext(1), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 不带会话的消息开始新对话，不带入会话的历史
+	if _, err := l.LingChatByWS(userContext(1), api.Message{Type: api.MessageTypeMessage, Content: "第三句"}); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := l.llmClient.(*fakeLLM).calls
+	if len(calls) != 3 {
+		t.Fatalf("LLM called %d times, want 3", len(calls))
+	}
+	// 系统提示词 + 第一轮问答 + 当前消息
+	if got := calls[1]; len(got) != 4 || got[1].Content != "第一句" || got[3].Content != "第二句" {
+		t.Errorf("second turn messages = %+v, want session history", got)
+	}
+	if got := calls[2]; len(got) != 2 || got[1].Content != "第三句" {
+		t.Errorf("third turn messages = %+v, want a fresh conversation", got)
+	}
+	if sessions.touches[session.ID] != 2 {
+		t.Errorf("session touched %d times, want 2", sessions.touches[session.ID])
+	}
+}
+
+func Test_LingChatByWSSessionRejected(t *testing.T) {
+	l, _ := newTestSessionService(t)
+	session, err := l.CreateSession(userContext(1), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := strconv.FormatInt(session.ID, 10)
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		sessionID string
+		wantErr   error
+	}{
+		{name: "其他用户的会话", ctx: userContext(2), sessionID: sessionID, wantErr: errs.ErrForbidden},
+		{name: "未登录", ctx: context.Background(), sessionID: sessionID, wantErr: errs.ErrForbidden},
+		{name: "会话不存在", ctx: userContext(1), sessionID: "999", wantErr: errs.ErrForbidden},
+		{name: "会话ID格式错误", ctx: userContext(1), sessionID: "abc", wantErr: errs.ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := api.Message{Type: api.MessageTypeMessage, Content: "你好", SessionID: tt.sessionID}
+			_, err := l.LingChatByWS(tt.ctx, msg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("LingChatByWS() error = %v, want %v", err, tt.wantErr)
+			}
+			err = l.LingChatByWSStream(tt.ctx, msg, func(api.Response) error { return nil })
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("LingChatByWSStream() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if n := len(l.llmClient.(*fakeLLM).calls); n != 0 {
+		t.Errorf("LLM called %d times for rejected messages", n)
+	}
+}
+
+func Test_heuristicTitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{name: "短消息", message: "  你好呀 ", want: "你好呀"},
+		{name: "合并空白", message: "第一行\n\n第二行\t结尾", want: "第一行 第二行 结尾"},
+		{name: "去掉控制字符", message: "你\x00好\x1b", want: "你好"},
+		{name: "按字截断", message: "今天天气很好我们一起去公园散步然后去吃火锅吧", want: "今天天气很好我们一起去公园散步然后去吃火…"},
+		{name: "只有空白", message: " \n ", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := heuristicTitle(tt.message); got != tt.want {
+				t.Errorf("heuristicTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_LingChatByWSSessionTitle(t *testing.T) {
+	l, sessions := newTestSessionService(t)
+	untitled, err := l.CreateSession(userContext(1), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	named, err := l.CreateSession(userContext(1), "我的会话")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, session := range []int64{untitled.ID, named.ID} {
+		for _, content := range []string{"第一条消息", "第二条消息"} {
+			msg := api.Message{Type: api.MessageTypeMessage, Content: content, SessionID: strconv.FormatInt(session, 10)}
+			if _, err := l.LingChatByWS(userContext(1), msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if got := sessions.sessions[untitled.ID].Title; got != "第一条消息" {
+		t.Errorf("untitled session title = %q, want first message", got)
+	}
+	if got := sessions.sessions[named.ID].Title; got != "我的会话" {
+		t.Errorf("named session title = %q, want user title kept", got)
+	}
+}
+
+// titleLLM 带WithSystemPrompt的请求（生成标题）返回title/titleErr，其他请求返回聊天回复
+type titleLLM struct {
+	title    string
+	titleErr error
+
+	mu     sync.Mutex
+	titles int
+}
+
+func (f *titleLLM) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, model string) (string, error) {
+	if llm.SystemPromptFrom(ctx) == "" {
+		return "【开心】你好<こんにちは>", nil
+	}
+	f.mu.Lock()
+	f.titles++
+	f.mu.Unlock()
+	return f.title, f.titleErr
+}
+
+func Test_LingChatByWSSessionLLMTitle(t *testing.T) {
+	tests := []struct {
+		name     string
+		title    string
+		titleErr error
+		want     string
+	}{
+		{name: "使用LLM概括的标题", title: " 「周末出游计划」\n", want: "周末出游计划"},
+		{name: "LLM失败时保留截断的标题", titleErr: errors.New("boom"), want: "周末我们去哪里玩比较好"},
+		{name: "LLM返回空标题", title: "“”", want: "周末我们去哪里玩比较好"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, sessions := newTestSessionService(t)
+			fake := &titleLLM{title: tt.title, titleErr: tt.titleErr}
+			l.llmClient = fake
+			l.SessionLLMTitles = true
+			session, err := l.CreateSession(userContext(1), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, content := range []string{"周末我们去哪里玩比较好", "还有别的建议吗"} {
+				msg := api.Message{Type: api.MessageTypeMessage, Content: content, SessionID: strconv.FormatInt(session.ID, 10)}
+				if err := l.LingChatByWSStream(userContext(1), msg, func(api.Response) error { return nil }); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 等待后台的标题请求完成
+			l.turns.wg.Wait()
+
+			if fake.titles != 1 {
+				t.Errorf("title requested %d times, want 1", fake.titles)
+			}
+			if got := sessions.sessions[session.ID].Title; got != tt.want {
+				t.Errorf("session title = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"LingChat/internal/clients/llm"
+)
+
+// Settings 可以在运行中重新加载的参数。每轮对话开始时取一份快照，进行中的对话不受之后的重载影响
+type Settings struct {
+	// EmotionThreshold 传给情绪预测服务的置信度阈值
+	EmotionThreshold float64 `json:"emotion_threshold"`
+	// MaxConcurrency 分段批量合成语音、预测情绪时的最大并发请求数，<=0表示不限制
+	MaxConcurrency int `json:"max_concurrency"`
+	// SystemPrompt 人设提示词，为空时使用LLM客户端启动时的SystemPrompt；请求自带的提示词优先
+	SystemPrompt string `json:"-"`
+}
+
+// Validate 检查参数范围
+func (s Settings) Validate() error {
+	if s.EmotionThreshold < 0 || s.EmotionThreshold > 1 {
+		return fmt.Errorf("emotion threshold %v out of range [0, 1]", s.EmotionThreshold)
+	}
+	return nil
+}
+
+// SettingsLoader 重新读取配置并返回新的参数
+type SettingsLoader func() (Settings, error)
+
+// Settings 返回当前生效的参数，未重新加载过时取自EmotionThreshold、MaxConcurrency字段
+func (l *LingChatService) Settings() Settings {
+	if s := l.settings.Load(); s != nil {
+		return *s
+	}
+	return Settings{
+		EmotionThreshold: l.EmotionThreshold,
+		MaxConcurrency:   l.MaxConcurrency,
+	}
+}
+
+// Reload 用SettingsLoader重新读取配置并原子地替换当前参数，同时重新加载动作映射。
+// 任何一步失败时返回错误，继续使用原来的参数和映射
+func (l *LingChatService) Reload() (Settings, error) {
+	if l.SettingsLoader == nil {
+		return Settings{}, errors.New("config reload is not configured")
+	}
+	s, err := l.SettingsLoader()
+	if err != nil {
+		return Settings{}, fmt.Errorf("load settings: %w", err)
+	}
+	if err := s.Validate(); err != nil {
+		return Settings{}, err
+	}
+	if l.MotionMap != nil {
+		if err := l.ReloadMotions(); err != nil {
+			return Settings{}, err
+		}
+	}
+	l.settings.Store(&s)
+	return s, nil
+}
+
+type settingsKey struct{}
+
+// withSettings 把当前参数的快照放入ctx，本轮对话之后都使用这份快照
+func (l *LingChatService) withSettings(ctx context.Context) context.Context {
+	s := l.Settings()
+	if s.SystemPrompt != "" && llm.SystemPromptFrom(ctx) == "" {
+		ctx = llm.WithSystemPrompt(ctx, s.SystemPrompt)
+	}
+	return context.WithValue(ctx, settingsKey{}, s)
+}
+
+// settingsFrom 返回本轮对话的参数快照，不在对话中时返回当前参数
+func (l *LingChatService) settingsFrom(ctx context.Context) Settings {
+	if s, ok := ctx.Value(settingsKey{}).(Settings); ok {
+		return s
+	}
+	return l.Settings()
+}
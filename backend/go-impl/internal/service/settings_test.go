@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"LingChat/internal/clients/llm"
+)
+
+func TestLingChatService_ReloadKeepsInFlightSettings(t *testing.T) {
+	var mu sync.Mutex
+	var thresholds []float64
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Threshold float64 `json:"confidence_threshold"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			thresholds = append(thresholds, body.Threshold)
+			first := len(thresholds) == 1
+			mu.Unlock()
+			if first {
+				close(entered)
+				<-release
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"label":"开心","confidence":0.9}`)
+		},
+	)
+	l.SettingsLoader = func() (Settings, error) {
+		return Settings{EmotionThreshold: 0.5, MaxConcurrency: 2}, nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.LingChat(context.Background(), "你好", "", "")
+		done <- err
+	}()
+	<-entered
+	settings, err := l.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.EmotionThreshold != 0.5 || l.Settings().MaxConcurrency != 2 {
+		t.Errorf("Settings() after reload = %+v", l.Settings())
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.LingChat(context.Background(), "你好", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(thresholds) != 2 || thresholds[0] != DefaultEmotionThreshold || thresholds[1] != 0.5 {
+		t.Errorf("thresholds = %v, want [%v 0.5]", thresholds, DefaultEmotionThreshold)
+	}
+}
+
+func TestLingChatService_ReloadFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		loader SettingsLoader
+	}{
+		{name: "未配置", loader: nil},
+		{name: "读取失败", loader: func() (Settings, error) { return Settings{}, errors.New("broken .env") }},
+		{name: "阈值超出范围", loader: func() (Settings, error) { return Settings{EmotionThreshold: 2}, nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &LingChatService{EmotionThreshold: 0.1, MaxConcurrency: 3, SettingsLoader: tt.loader}
+			if _, err := l.Reload(); err == nil {
+				t.Fatal("Reload() succeeded, want error")
+			}
+			if got := l.Settings(); got != (Settings{EmotionThreshold: 0.1, MaxConcurrency: 3}) {
+				t.Errorf("Settings() = %+v, want unchanged", got)
+			}
+		})
+	}
+}
+
+func TestLingChatService_withSettingsSystemPrompt(t *testing.T) {
+	l := &LingChatService{SettingsLoader: func() (Settings, error) {
+		return Settings{SystemPrompt: "reloaded"}, nil
+	}}
+	if _, err := l.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := llm.SystemPromptFrom(l.withSettings(context.Background())); got != "reloaded" {
+		t.Errorf("system prompt = %q, want reloaded", got)
+	}
+	// 请求自带的提示词优先于重新加载的提示词
+	ctx := l.withSettings(llm.WithSystemPrompt(context.Background(), "request"))
+	if got := llm.SystemPromptFrom(ctx); got != "request" {
+		t.Errorf("system prompt = %q, want request", got)
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"LingChat/internal/errs"
+	"LingChat/internal/storage"
+)
+
+// turnGroup 记录正在处理的对话，关闭时用于等待或取消它们
+type turnGroup struct {
+	mu      sync.Mutex
+	closing bool
+	wg      sync.WaitGroup
+	nextID  int
+	cancels map[int]context.CancelFunc
+}
+
+// begin 登记一轮对话，返回可被强制取消的ctx和结束时必须调用的done
+func (g *turnGroup) begin(ctx context.Context) (context.Context, func(), error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closing {
+		return ctx, nil, errs.ErrShuttingDown
+	}
+	if g.cancels == nil {
+		g.cancels = make(map[int]context.CancelFunc)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	id := g.nextID
+	g.nextID++
+	g.cancels[id] = cancel
+	g.wg.Add(1)
+	return ctx, func() {
+		g.mu.Lock()
+		delete(g.cancels, id)
+		g.mu.Unlock()
+		cancel()
+		g.wg.Done()
+	}, nil
+}
+
+// close 停止接受新的对话
+func (g *turnGroup) close() {
+	g.mu.Lock()
+	g.closing = true
+	g.mu.Unlock()
+}
+
+// cancelAll 取消所有正在处理的对话
+func (g *turnGroup) cancelAll() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, cancel := range g.cancels {
+		cancel()
+	}
+}
+
+// Shutdown 停止接受新的对话，等待正在处理的对话（包括其语音合成、情绪预测）完成后清理本地的临时语音文件。
+// ctx结束时取消剩余的对话并等待它们退出，返回ctx.Err()
+func (l *LingChatService) Shutdown(ctx context.Context) error {
+	l.turns.close()
+
+	done := make(chan struct{})
+	go func() {
+		l.turns.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		// 对话中的请求都遵循ctx，取消后很快返回，等待的goroutine随之退出
+		l.turns.cancelAll()
+		<-done
+	}
+
+	l.StopTempSweeper()
+	l.StopHistoryPurger()
+	// 对象存储由多个实例共享，其中的语音只按保留时长清理，退出时不删除
+	if local, ok := l.storage().(*storage.Local); ok {
+		sweepVoiceFiles(context.Background(), local, 0, time.Now())
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"LingChat/internal/errs"
+)
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		wantErr error
+	}{
+		{name: "等待对话完成", timeout: 5 * time.Second, wantErr: nil},
+		{name: "超时后取消对话", timeout: 100 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 语音合成在收到请求后阻塞，第一个用例中500ms后返回
+			started := make(chan struct{}, 1)
+			l, _ := newTestService(t, "【开心】你好<こんにちは>",
+				func(w http.ResponseWriter, r *http.Request) {
+					started <- struct{}{}
+					select {
+					case <-r.Context().Done():
+						return
+					case <-time.After(500 * time.Millisecond):
+					}
+					w.Write([]byte("audio"))
+				},
+				emotionHandler("开心"),
+			)
+			stale := filepath.Join(l.tempFilePath, "stale.wav")
+			if err := os.WriteFile(stale, []byte("audio"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			chatDone := make(chan *bool, 1)
+			go func() {
+				resp, err := l.LingChat(context.Background(), "你好", "", "")
+				if err != nil {
+					t.Errorf("LingChat() error = %v", err)
+					chatDone <- nil
+					return
+				}
+				chatDone <- &resp.Truncated
+			}()
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if err := l.Shutdown(ctx); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Shutdown() error = %v, want %v", err, tt.wantErr)
+			}
+			// Shutdown返回时对话已经结束，只剩把结果发到channel
+			select {
+			case truncated := <-chatDone:
+				if truncated != nil && *truncated != (tt.wantErr != nil) {
+					t.Errorf("Truncated = %v", *truncated)
+				}
+			case <-time.After(100 * time.Millisecond):
+				t.Error("LingChat still running after Shutdown")
+			}
+
+			if _, err := l.LingChat(context.Background(), "你好", "", ""); !errors.Is(err, errs.ErrShuttingDown) {
+				t.Errorf("LingChat() after Shutdown error = %v, want ErrShuttingDown", err)
+			}
+			if files, _ := os.ReadDir(l.tempFilePath); len(files) != 0 {
+				t.Errorf("temp dir has %d entries after Shutdown", len(files))
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"strings"
+	"sync"
+
+	"LingChat/internal/clients/VitsTTS"
+	"LingChat/internal/clients/llm"
+	"LingChat/internal/logging"
+)
+
+// segmentTasks 为一轮回复的每个分段启动一个goroutine合成语音、预测情绪，同时进行的请求数受MaxConcurrency限制。
+// 开启Pipeline时分段在LLM回复结束前陆续加入
+type segmentTasks struct {
+	l      *LingChatService
+	ctx    context.Context
+	cancel context.CancelFunc
+	voice  VitsTTS.Voice
+	sem    chan struct{}
+	wg     sync.WaitGroup
+	// segments/done 只由调用add的goroutine修改，done[i]在第i个分段处理完后关闭
+	segments []*Result
+	done     []chan struct{}
+}
+
+// newSegmentTasks n为分段数，事先未知时为0
+func (l *LingChatService) newSegmentTasks(ctx context.Context, n int) *segmentTasks {
+	ctx, cancel := context.WithCancel(ctx)
+	return &segmentTasks{l: l, ctx: ctx, cancel: cancel, voice: l.userVoice(ctx), sem: l.newSemaphore(ctx, n)}
+}
+
+// startSegments 为已解析出的全部分段开始处理
+func (l *LingChatService) startSegments(ctx context.Context, segments []Result) *segmentTasks {
+	t := l.newSegmentTasks(ctx, len(segments))
+	for _, segment := range segments {
+		t.add(segment)
+	}
+	return t
+}
+
+// add 加入下一个分段并立即开始处理，ctx结束前没有轮到的分段不合成语音
+func (t *segmentTasks) add(segment Result) {
+	idx := len(t.segments)
+	s := &segment
+	done := make(chan struct{})
+	t.segments = append(t.segments, s)
+	t.done = append(t.done, done)
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer close(done)
+		if !acquire(t.ctx, t.sem) {
+			s.VoiceFile = ""
+			s.AudioUnavailable = true
+			return
+		}
+		t.l.processSegment(t.ctx, idx, s, t.voice)
+		if t.sem != nil {
+			<-t.sem
+		}
+	}()
+}
+
+// stop 取消还没有完成的分段并等待全部goroutine结束，t为nil时不做处理
+func (t *segmentTasks) stop() {
+	if t == nil {
+		return
+	}
+	t.cancel()
+	t.wg.Wait()
+}
+
+// discard 停止全部分段并删除已经保存的语音，回复被丢弃（未通过审核或没有生成完）时使用，t为nil时不做处理
+func (t *segmentTasks) discard() {
+	if t == nil {
+		return
+	}
+	t.stop()
+	// t.ctx已经取消，删除不应随之中断
+	ctx := context.WithoutCancel(t.ctx)
+	for _, s := range t.segments {
+		if s.VoiceFile == "" {
+			continue
+		}
+		if err := t.l.storage().Delete(ctx, voiceKey(s.VoiceFile)); err != nil {
+			logging.FromContext(ctx).Error("删除丢弃的语音文件失败", "file", s.VoiceFile, "err", err)
+		}
+	}
+}
+
+// results 按加入的顺序返回各分段，须在全部分段处理完后调用
+func (t *segmentTasks) results() []Result {
+	results := make([]Result, len(t.segments))
+	for i, s := range t.segments {
+		results[i] = *s
+	}
+	return results
+}
+
+// startReply 与prepareReply相同，但返回时各分段已经开始合成语音、预测情绪。
+// 能流水线处理时（见pipelineStreamer）边接收LLM回复边开始处理分段，否则收到完整回复后再开始
+func (l *LingChatService) startReply(ctx context.Context, message string, conversationID, prevMessageID string) (*Turn, *segmentTasks, error) {
+	if streamer, ok := l.pipelineStreamer(ctx); ok {
+		return l.pipelineReply(ctx, streamer, message, conversationID, prevMessageID)
+	}
+	turn, segments, err := l.prepareReply(ctx, message, conversationID, prevMessageID)
+	if err != nil {
+		return turn, nil, err
+	}
+	reportSegmentTexts(ctx, segments, message)
+	return turn, l.startSegments(ctx, segments), nil
+}
+
+// pipelineStreamer 开启Pipeline且LLM支持流式时返回LLM的流式接口。
+// 本轮要推送text或audio_chunk事件时不流水线处理：text事件需要分段总数，且这些事件都不能在回复通过审核前发送
+func (l *LingChatService) pipelineStreamer(ctx context.Context) (llm.Streamer, bool) {
+	if !l.Pipeline {
+		return nil, false
+	}
+	if _, ok := ctx.Value(segmentEventsKey{}).(*progressReporter); ok {
+		return nil, false
+	}
+	if _, ok := ctx.Value(audioChunkKey{}).(*progressReporter); ok {
+		return nil, false
+	}
+	streamer, ok := l.llmClient.(llm.Streamer)
+	return streamer, ok
+}
+
+// pipelineReply 流式接收LLM回复，每解析出一个完整的分段就开始处理，得到的分段与prepareReply解析完整回复的相同。
+// LLM调用失败、超时或回复未通过审核时丢弃已开始处理的分段及其语音文件，其余同prepareReply
+func (l *LingChatService) pipelineReply(ctx context.Context, streamer llm.Streamer, message string, conversationID, prevMessageID string) (*Turn, *segmentTasks, error) {
+	turn, messages, err := l.beginTurn(ctx, message, conversationID, prevMessageID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tasks *segmentTasks
+	rawLLMResp, err := l.chatLLM(ctx, messages, func(llmCtx context.Context) (string, error) {
+		stream, err := streamer.ChatStream(llmCtx, messages, l.ConfigModel)
+		if err != nil {
+			return "", err
+		}
+		// 解析的同时记下完整的回复，用于审核和保存；streamErr为生成中途的错误。
+		// 两者在finished关闭后才读取
+		var reply strings.Builder
+		var streamErr error
+		tokens := make(chan string)
+		finished := make(chan struct{})
+		go func() {
+			defer close(finished)
+			defer close(tokens)
+			for chunk := range stream {
+				if chunk.Err != nil {
+					streamErr = chunk.Err
+					return
+				}
+				reply.WriteString(chunk.Content)
+				select {
+				case tokens <- chunk.Content:
+				case <-llmCtx.Done():
+					return
+				}
+			}
+		}()
+
+		tasks = l.newSegmentTasks(ctx, 0)
+		for segment := range AnalyzeEmotionsStream(llmCtx, tokens, l.tempFilePath, l.replyVoicePrefix(ctx, turn), l.audioFormat(), l.ParseConfig) {
+			tasks.add(l.prepareSegments(ctx, []Result{segment})[0])
+		}
+		<-finished
+		// 生成中途出错或ctx结束时回复不完整，按LLM调用失败处理
+		if err := cmp.Or(streamErr, llmCtx.Err()); err != nil {
+			tasks.discard()
+			tasks = nil
+			return "", err
+		}
+		return reply.String(), nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := l.acceptReply(ctx, turn, rawLLMResp); err != nil {
+		tasks.discard()
+		return turn, nil, err
+	}
+	if tasks == nil {
+		// 兜底回复不经过流式接口
+		tasks = l.startSegments(ctx, l.parseReply(ctx, turn))
+	}
+	return turn, tasks, nil
+}
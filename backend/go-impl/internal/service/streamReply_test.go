@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"LingChat/api"
+	"LingChat/internal/data"
+	"LingChat/internal/data/ent/ent/conversationmessage"
+	"LingChat/internal/errs"
+)
+
+func Test_LingChatPipeline(t *testing.T) {
+	// 部分回复：第二个分段还没生成完就断开
+	const partial = "【开心】你好<こんにちは>【难过】再"
+	tests := []struct {
+		name   string
+		reply  string
+		llmErr error
+		// midStreamErr 流式接口发送reply后以该错误结束，非流水线时由Chat返回该错误
+		midStreamErr error
+		noFallback   bool
+		minSegment   int
+		moderator    *fakeModerator
+		// waitFiles 流水线处理时等到保存了waitFiles个语音文件再审核回复，确保审核前分段已经合成了语音
+		waitFiles int
+		// segmentEvents 推送text事件的对话不流水线处理
+		segmentEvents bool
+		wantStreams   int32
+		wantErr       bool
+	}{
+		{name: "多个分段", reply: "【开心】你好<こんにちは>【难过】再见<さよなら>【害羞】谢谢<ありがとう>", wantStreams: 1},
+		{name: "合并短分段", reply: "【开心】嗯<うん>【开心】你好<こんにちは>【难过】再见<さよなら>", minSegment: 4, wantStreams: 1},
+		{name: "LLM调用失败时使用兜底回复", llmErr: errors.New("unavailable"), wantStreams: 1},
+		{name: "生成中途出错时使用兜底回复", reply: partial, midStreamErr: errors.New("connection reset"), wantStreams: 1},
+		{name: "生成中途出错且不兜底时返回错误", reply: partial, midStreamErr: errors.New("connection reset"), noFallback: true, wantStreams: 1, wantErr: true},
+		{name: "回复未通过审核", reply: "【开心】你好<こんにちは>【难过】再见<さよなら>", moderator: &fakeModerator{blockOutput: "さよなら"}, waitFiles: 2, wantStreams: 1},
+		{name: "推送text事件时不流水线处理", reply: "【开心】你好<こんにちは>【难过】再见<さよなら>", segmentEvents: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := func(pipeline bool) ([]api.Response, map[int64][]data.SegmentEmotion, []string, int, *fakeStreamLLM) {
+				l, repo := newTestService(t, "", func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("audio"))
+				}, emotionHandler("开心"))
+				fake := &fakeStreamLLM{fakeLLM: fakeLLM{reply: tt.reply, err: tt.llmErr}}
+				if pipeline {
+					fake.midStreamErr = tt.midStreamErr
+				} else if tt.midStreamErr != nil {
+					fake.err = tt.midStreamErr
+				}
+				l.llmClient = fake
+				l.Pipeline = pipeline
+				l.Fallback = !tt.noFallback
+				l.ParseConfig.MinSegmentLength = tt.minSegment
+				if tt.moderator != nil {
+					l.Moderator = tt.moderator
+					if pipeline && tt.waitFiles > 0 {
+						l.Moderator = &waitingModerator{fakeModerator: tt.moderator, wait: func() { waitVoiceFiles(t, l.tempFilePath, tt.waitFiles) }}
+					}
+				}
+				ctx := context.Background()
+				if tt.segmentEvents {
+					ctx = WithSegmentEvents(ctx, func(api.Response) {})
+				}
+
+				var parts []api.Response
+				_, err := l.LingChatStream(ctx, "你好", "", "", func(part api.Response) error {
+					// 语音文件名带有时间和随机串，只比较是否有文件
+					if part.AudioFile != "" {
+						part.AudioFile = "audio"
+					}
+					part.RequestID = ""
+					parts = append(parts, part)
+					return nil
+				})
+				if tt.wantErr {
+					if !errors.Is(err, errs.ErrLLM) {
+						t.Fatalf("LingChatStream(pipeline=%v) error = %v, want %v", pipeline, err, errs.ErrLLM)
+					}
+				} else if err != nil && !moderated(err) {
+					t.Fatalf("LingChatStream(pipeline=%v) error = %v", pipeline, err)
+				}
+				var replies []string
+				for _, msg := range repo.messages {
+					if msg.Role == conversationmessage.RoleAssistant {
+						replies = append(replies, msg.Content)
+					}
+				}
+				return parts, repo.emotions, replies, len(voiceFiles(t, l.tempFilePath)), fake
+			}
+
+			wantParts, wantEmotions, wantReplies, wantFiles, _ := run(false)
+			parts, emotions, replies, files, fake := run(true)
+			if !reflect.DeepEqual(parts, wantParts) {
+				t.Errorf("pipelined parts = %+v\nwant %+v", parts, wantParts)
+			}
+			if !reflect.DeepEqual(emotions, wantEmotions) {
+				t.Errorf("pipelined saved emotions = %+v, want %+v", emotions, wantEmotions)
+			}
+			if !reflect.DeepEqual(replies, wantReplies) {
+				t.Errorf("pipelined saved replies = %q, want %q", replies, wantReplies)
+			}
+			// 丢弃的分段不留下语音文件
+			if files != wantFiles {
+				t.Errorf("pipelined voice files = %d, want %d", files, wantFiles)
+			}
+			// 不完整的回复不保存
+			if slices.Contains(replies, partial) {
+				t.Errorf("saved partial reply %q", partial)
+			}
+			if tt.wantErr && (len(parts) != 0 || len(replies) != 0) {
+				t.Errorf("parts = %d, saved replies = %q, want none", len(parts), replies)
+			}
+			if got := fake.streams.Load(); got != tt.wantStreams {
+				t.Errorf("ChatStream calls = %d, want %d", got, tt.wantStreams)
+			}
+			if tt.wantStreams > 0 && len(fake.calls) != 0 {
+				t.Errorf("Chat calls = %d, want 0", len(fake.calls))
+			}
+		})
+	}
+}
+
+// waitingModerator 审核回复前先调用wait
+type waitingModerator struct {
+	*fakeModerator
+	wait func()
+}
+
+func (m *waitingModerator) CheckOutput(ctx context.Context, text string) error {
+	m.wait()
+	return m.fakeModerator.CheckOutput(ctx, text)
+}
+
+// voiceFiles 返回dir中的文件名
+func voiceFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// waitVoiceFiles 等到dir中有n个文件
+func waitVoiceFiles(t *testing.T, dir string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(voiceFiles(t, dir)) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("voice files = %v, want %d", voiceFiles(t, dir), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func Test_LingChatPipelineOverlap(t *testing.T) {
+	firstVoice := make(chan struct{})
+	var once sync.Once
+	l, _ := newTestService(t, "", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("text") == "こんにちは" {
+			once.Do(func() { close(firstVoice) })
+		}
+		w.Write([]byte("audio"))
+	}, emotionHandler("开心"))
+	// 第一个分段解析完成后LLM暂停生成，直到开始合成它的语音
+	l.llmClient = &fakeStreamLLM{
+		fakeLLM: fakeLLM{reply: "【开心】你好<こんにちは>【难过】再见<さよなら>"},
+		pause:   "【难过】",
+		resume:  firstVoice,
+	}
+	l.Pipeline = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var parts []api.Response
+	_, err := l.LingChatStream(ctx, "你好", "", "", func(part api.Response) error {
+		parts = append(parts, part)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("LingChatStream() error = %v, want first segment voiced before the LLM finished", err)
+	}
+	if len(parts) != 2 || parts[0].Message != "你好" || parts[1].Message != "再见" || parts[0].TotalParts != 2 {
+		t.Errorf("parts = %+v, want 你好, 再见", parts)
+	}
+}
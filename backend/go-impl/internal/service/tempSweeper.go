@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"LingChat/internal/clients/VitsTTS"
+	"LingChat/internal/storage"
+)
+
+// backgroundTask 按固定间隔执行的后台任务
+type backgroundTask struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startBackgroundTask 每隔interval调用一次run，直到ctx取消或调用stop
+func startBackgroundTask(ctx context.Context, interval time.Duration, run func(ctx context.Context)) *backgroundTask {
+	ctx, cancel := context.WithCancel(ctx)
+	task := &backgroundTask{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(task.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run(ctx)
+			}
+		}
+	}()
+	return task
+}
+
+// stop 停止任务并等待其退出，task为nil时直接返回
+func (t *backgroundTask) stop() {
+	if t == nil {
+		return
+	}
+	t.cancel()
+	<-t.done
+}
+
+// StartTempSweeper 启动后台任务，每隔interval删除Storage中修改时间早于ttl的语音文件。
+// interval或ttl<=0时不启动；重复调用会先停止之前的任务；ctx取消或调用StopTempSweeper时退出
+func (l *LingChatService) StartTempSweeper(ctx context.Context, interval, ttl time.Duration) {
+	l.StopTempSweeper()
+	if interval <= 0 || ttl <= 0 {
+		return
+	}
+
+	sweeper := startBackgroundTask(ctx, interval, func(ctx context.Context) {
+		sweepVoiceFiles(ctx, l.storage(), ttl, l.now())
+	})
+
+	l.sweeperMu.Lock()
+	l.sweeper = sweeper
+	l.sweeperMu.Unlock()
+}
+
+// StopTempSweeper 停止后台清理任务并等待其退出，未启动时直接返回
+func (l *LingChatService) StopTempSweeper() {
+	l.sweeperMu.Lock()
+	sweeper := l.sweeper
+	l.sweeper = nil
+	l.sweeperMu.Unlock()
+
+	sweeper.stop()
+}
+
+// sweepTempVoiceFiles 删除目录下修改时间早于 now-ttl 的语音文件
+func sweepTempVoiceFiles(tempVoiceDir string, ttl time.Duration, now time.Time) {
+	sweepVoiceFiles(context.Background(), storage.NewLocal(tempVoiceDir), ttl, now)
+}
+
+// sweepVoiceFiles 删除存储中修改时间早于 now-ttl 的语音文件，存储不支持列出对象时不清理
+func sweepVoiceFiles(ctx context.Context, store storage.Storage, ttl time.Duration, now time.Time) {
+	lister, ok := store.(storage.Lister)
+	if !ok {
+		return
+	}
+	objects, err := lister.List(ctx)
+	if err != nil {
+		log.Printf("列出语音文件时出错: %v", err)
+		return
+	}
+
+	for _, object := range objects {
+		format := strings.TrimPrefix(path.Ext(object.Key), ".")
+		if !VitsTTS.ValidAudioFormat(format) || now.Sub(object.ModTime) < ttl {
+			continue
+		}
+		if err := store.Delete(ctx, object.Key); err != nil {
+			log.Printf("删除文件 %s 时出错: %v", object.Key, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_sweepTempVoiceFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	files := map[string]time.Duration{
+		"old.wav":   2 * time.Hour,
+		"old.mp3":   2 * time.Hour,
+		"fresh.wav": time.Minute,
+		"old.txt":   2 * time.Hour,
+	}
+	for name, age := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sweepTempVoiceFiles(dir, time.Hour, now)
+
+	for name, wantExist := range map[string]bool{"old.wav": false, "old.mp3": false, "fresh.wav": true, "old.txt": true} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exist := err == nil; exist != wantExist {
+			t.Errorf("%s exist = %v, want %v", name, exist, wantExist)
+		}
+	}
+}
+
+func TestLingChatService_TempSweeper(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "part_1.wav")
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &LingChatService{tempFilePath: dir}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l.StartTempSweeper(ctx, 10*time.Millisecond, time.Nanosecond)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("sweeper did not remove expired file")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 停止后应可重复调用且不阻塞
+	l.StopTempSweeper()
+	l.StopTempSweeper()
+}
+
+func TestLingChatService_TempSweeperDisabled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "part_1.wav")
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &LingChatService{tempFilePath: dir}
+	for _, tt := range []struct {
+		name          string
+		interval, ttl time.Duration
+	}{
+		{name: "间隔为0", ttl: time.Nanosecond},
+		{name: "保留时长为0", interval: 5 * time.Millisecond},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l.StartTempSweeper(context.Background(), tt.interval, tt.ttl)
+			defer l.StopTempSweeper()
+			if l.sweeper != nil {
+				t.Fatal("sweeper started, want disabled")
+			}
+			time.Sleep(20 * time.Millisecond)
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("file removed by disabled sweeper: %v", err)
+			}
+		})
+	}
+}
+
+func TestLingChatService_TempSweeperClock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "part_1.wav")
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var now atomic.Pointer[time.Time]
+	start := time.Now()
+	now.Store(&start)
+	l := &LingChatService{tempFilePath: dir, Clock: func() time.Time { return *now.Load() }}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l.StartTempSweeper(ctx, 5*time.Millisecond, time.Hour)
+	defer l.StopTempSweeper()
+
+	// 时钟未走过ttl时不清理
+	time.Sleep(30 * time.Millisecond)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file removed before ttl: %v", err)
+	}
+
+	later := start.Add(2 * time.Hour)
+	now.Store(&later)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("sweeper did not use Clock to expire the file")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_LingChatSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		emotionHandler("开心"),
+	)
+	if _, err := l.LingChat(context.Background(), "你好", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	if len(spans["LingChat"]) != 1 {
+		t.Fatalf("got %d LingChat spans, want 1", len(spans["LingChat"]))
+	}
+	root := spans["LingChat"][0].SpanContext().SpanID()
+
+	tests := []struct {
+		name   string
+		count  int
+		parent string
+	}{
+		{name: "llm.chat", count: 1, parent: "LingChat"},
+		{name: "GenerateVoice", count: 1, parent: "LingChat"},
+		{name: "tts.synthesize", count: 2, parent: "GenerateVoice"},
+		{name: "EmoPredictBatch", count: 1, parent: "LingChat"},
+		{name: "emotion.predict", count: 2, parent: "EmoPredictBatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(spans[tt.name]) != tt.count {
+				t.Fatalf("got %d %s spans, want %d", len(spans[tt.name]), tt.name, tt.count)
+			}
+			parent := root
+			if tt.parent != "LingChat" {
+				parent = spans[tt.parent][0].SpanContext().SpanID()
+			}
+			for _, span := range spans[tt.name] {
+				if span.Parent().SpanID() != parent {
+					t.Errorf("%s parent = %s, want %s", tt.name, span.Parent().SpanID(), tt.parent)
+				}
+			}
+		})
+	}
+}
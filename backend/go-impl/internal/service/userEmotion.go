@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"LingChat/api"
+	"LingChat/internal/logging"
+	"LingChat/internal/metrics"
+	"LingChat/internal/tracing"
+)
+
+type userEmotionKey struct{}
+
+// WithUserEmotion 开启PredictUserEmotion时，用户消息的情绪预测完成后立即以user_emotion事件
+// （见api.ResponseTypeUserEmotion）交给report，不等LLM回复；ctx中没有report时只在回复中返回
+func WithUserEmotion(ctx context.Context, report func(api.Response)) context.Context {
+	return context.WithValue(ctx, userEmotionKey{}, &progressReporter{report: report})
+}
+
+// userEmotion 与LLM请求并行的用户消息情绪预测
+type userEmotion struct {
+	done  chan struct{}
+	label string
+	ok    bool
+}
+
+// predictUserEmotion 在后台预测用户消息的情绪，未开启PredictUserEmotion或不预测情绪时返回nil。
+// 预测随ctx结束而取消，失败只记录日志
+func (l *LingChatService) predictUserEmotion(ctx context.Context, message string) *userEmotion {
+	if !l.PredictUserEmotion || l.DryRun || l.emotionPredictorClient == nil || !l.predictEmotions(ctx) {
+		return nil
+	}
+	u := &userEmotion{done: make(chan struct{})}
+	go func() {
+		defer close(u.done)
+		ctx, span := tracing.Start(ctx, "emotion.predict_user", attribute.Int("text_length", utf8.RuneCountInString(message)))
+		start := time.Now()
+		resp, err := l.PredictEmotion(ctx, message, l.settingsFrom(ctx).EmotionThreshold)
+		tracing.End(span, err)
+		if err != nil {
+			metrics.ObserveEmotion(start, unknownEmotion, err)
+			logging.FromContext(ctx).Warn("用户消息情绪预测失败", "err", err)
+			return
+		}
+		metrics.ObserveEmotion(start, resp.Label, nil)
+		u.label, u.ok = l.knownEmotion(ctx, "user", resp.Label), true
+
+		if p, ok := ctx.Value(userEmotionKey{}).(*progressReporter); ok {
+			p.send(ctx, api.Response{
+				Type:        api.ResponseTypeUserEmotion,
+				UserEmotion: u.label,
+				RequestID:   logging.RequestID(ctx),
+			})
+		}
+	}()
+	return u
+}
+
+// result 不等待预测完成：尚未完成、失败或u为nil时返回false，回复照常发送
+func (u *userEmotion) result() (string, bool) {
+	if u == nil {
+		return "", false
+	}
+	select {
+	case <-u.done:
+		return u.label, u.ok
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"LingChat/api"
+)
+
+// userEmotionHandler 用户消息预测为userLabel（userStatus不为200时返回该状态码），情绪标签都预测为开心；
+// 用户消息的请求处理完后关闭userDone
+func userEmotionHandler(message, userLabel string, userStatus int, userDone chan struct{}) http.HandlerFunc {
+	var once sync.Once
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Text != message {
+			emotionHandler("开心")(w, r)
+			return
+		}
+		defer once.Do(func() { close(userDone) })
+		if userStatus != http.StatusOK {
+			w.WriteHeader(userStatus)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"label":%q,"confidence":0.7}`, userLabel)
+	}
+}
+
+func Test_LingChatUserEmotion(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		userStatus int
+		want       string
+	}{
+		{name: "开启", enabled: true, userStatus: http.StatusOK, want: "难过"},
+		{name: "预测失败不影响回复", enabled: true, userStatus: http.StatusInternalServerError, want: ""},
+		{name: "关闭", enabled: false, userStatus: http.StatusOK, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userDone := make(chan struct{})
+			l, _ := newTestService(t, "【开心】你好<こんにちは>",
+				func(w http.ResponseWriter, r *http.Request) {
+					// 语音合成比用户消息的情绪预测慢，回复构造时预测已完成
+					if tt.enabled {
+						select {
+						case <-userDone:
+							time.Sleep(20 * time.Millisecond)
+						case <-time.After(5 * time.Second):
+						}
+					}
+					w.Write([]byte("audio"))
+				},
+				userEmotionHandler("我今天考试没考好", "难过", tt.userStatus, userDone),
+			)
+			l.PredictUserEmotion = tt.enabled
+
+			resp, err := l.LingChat(context.Background(), "我今天考试没考好", "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.UserEmotion != tt.want || resp.Messages[0].UserEmotion != tt.want {
+				t.Errorf("user emotion = %q / %q, want %q", resp.UserEmotion, resp.Messages[0].UserEmotion, tt.want)
+			}
+			if resp.Messages[0].Emotion != "开心" {
+				t.Errorf("reply emotion = %q, want 开心", resp.Messages[0].Emotion)
+			}
+		})
+	}
+}
+
+func Test_ChatHandlerStreamUserEmotion(t *testing.T) {
+	l, _ := newTestService(t, "【开心】你好<こんにちは>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("audio")) },
+		userEmotionHandler("我今天考试没考好", "难过", http.StatusOK, make(chan struct{})),
+	)
+	l.PredictUserEmotion = true
+
+	var mu sync.Mutex
+	var events []api.Response
+	err := l.ChatHandlerStream(context.Background(), []byte(`{"type":"message","content":"我今天考试没考好"}`), func(msg []byte) error {
+		var resp api.Response
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if resp.Type == api.ResponseTypeUserEmotion {
+			events = append(events, resp)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].UserEmotion != "难过" || events[0].RequestID == "" {
+		t.Errorf("user_emotion events = %+v, want one with 难过", events)
+	}
+}
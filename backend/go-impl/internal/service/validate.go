@@ -0,0 +1,34 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"LingChat/internal/errs"
+)
+
+// DefaultMaxMessageLength 用户消息的默认最大长度（字符数）
+const DefaultMaxMessageLength = 2000
+
+// sanitizeMessage 去除首尾空白，按需删除控制字符（保留换行和制表符），
+// 内容为空或超过maxLen个字符时返回错误；maxLen<=0表示不限制长度
+func sanitizeMessage(content string, maxLen int, stripControl bool) (string, error) {
+	if stripControl {
+		content = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) && r != '\n' && r != '\t' {
+				return -1
+			}
+			return r
+		}, content)
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", errs.ErrEmptyMessage
+	}
+	if n := utf8.RuneCountInString(content); maxLen > 0 && n > maxLen {
+		return "", fmt.Errorf("%w: %d个字符，最多%d个", errs.ErrMessageTooLong, n, maxLen)
+	}
+	return content, nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"LingChat/internal/errs"
+)
+
+func Test_sanitizeMessage(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		maxLen       int
+		stripControl bool
+		want         string
+		wantErr      error
+	}{
+		{name: "普通消息", content: "你好", maxLen: 10, want: "你好"},
+		{name: "去除首尾空白", content: "  你好\n ", maxLen: 10, want: "你好"},
+		{name: "空消息", content: "", maxLen: 10, wantErr: errs.ErrEmptyMessage},
+		{name: "只有空白", content: " \t\n　", maxLen: 10, wantErr: errs.ErrEmptyMessage},
+		{name: "恰好达到上限", content: strings.Repeat("灵", 10), maxLen: 10, want: strings.Repeat("灵", 10)},
+		{name: "超过上限", content: strings.Repeat("灵", 11), maxLen: 10, wantErr: errs.ErrMessageTooLong},
+		{name: "不限制长度", content: strings.Repeat("a", 5000), maxLen: 0, want: strings.Repeat("a", 5000)},
+		{name: "删除控制字符", content: "你\x00好\x1b[0m\n再见\t!", maxLen: 20, stripControl: true, want: "你好[0m\n再见\t!"},
+		{name: "保留控制字符", content: "你\x00好", maxLen: 20, want: "你\x00好"},
+		{name: "只有控制字符", content: "\x00\x07", maxLen: 10, stripControl: true, wantErr: errs.ErrEmptyMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitizeMessage(tt.content, tt.maxLen, tt.stripControl)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("sanitizeMessage() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errs.ErrInvalidMessage) {
+				t.Errorf("error %v should wrap ErrInvalidMessage", err)
+			}
+			if got != tt.want {
+				t.Errorf("sanitizeMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
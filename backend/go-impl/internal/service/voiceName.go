@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultVoiceNameTemplate 默认的语音文件名模板，对应 c<对话ID>_m<消息ID>_<随机串>_part_<序号>.<格式>
+const DefaultVoiceNameTemplate = "c{conversation}_m{message}_{token}_"
+
+// 语音文件名模板中的占位符
+const (
+	// voiceNameConversation 对话ID
+	voiceNameConversation = "{conversation}"
+	// voiceNameMessage 本轮用户消息所回复的前一条消息的ID（合成语音时用户消息还没有保存）
+	voiceNameMessage = "{message}"
+	// voiceNameSession 会话ID，消息不属于会话时为空
+	voiceNameSession = "{session}"
+	// voiceNameTime 本轮开始时的Unix毫秒时间戳
+	voiceNameTime = "{time}"
+	// voiceNameToken 每轮对话生成的随机串
+	voiceNameToken = "{token}"
+)
+
+var (
+	voiceNamePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+	// voiceNameLiteral 模板中占位符以外的部分只允许这些字符，保证文件名不含路径分隔符
+	voiceNameLiteral = regexp.MustCompile(`^[A-Za-z0-9_.-]*$`)
+)
+
+// VoiceNamer 按模板生成每轮对话的语音文件名前缀，分段的文件名为 <前缀>part_<序号>.<格式>。
+// 模板必须包含{token}，即使两轮对话的其他字段相同（如对话记录失败、重放同一条消息）也不会互相覆盖语音
+type VoiceNamer struct {
+	template string
+
+	now   func() time.Time
+	token func() string
+}
+
+// NewVoiceNamer 校验模板，可用的占位符为{conversation}、{message}、{session}、{time}和{token}
+func NewVoiceNamer(template string) (*VoiceNamer, error) {
+	if !strings.Contains(template, voiceNameToken) {
+		return nil, fmt.Errorf("voice name template %q must contain %s", template, voiceNameToken)
+	}
+	for _, placeholder := range voiceNamePlaceholder.FindAllString(template, -1) {
+		switch placeholder {
+		case voiceNameConversation, voiceNameMessage, voiceNameSession, voiceNameTime, voiceNameToken:
+		default:
+			return nil, fmt.Errorf("unknown placeholder %s in voice name template", placeholder)
+		}
+	}
+	literal := voiceNamePlaceholder.ReplaceAllString(template, "")
+	if !voiceNameLiteral.MatchString(literal) || strings.Contains(literal, "..") {
+		return nil, fmt.Errorf("voice name template %q may only contain letters, digits, '_', '-' and '.'", template)
+	}
+	return &VoiceNamer{template: template, now: time.Now, token: randomToken}, nil
+}
+
+// randomToken 16个十六进制字符的随机串
+func randomToken() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Prefix 本轮对话的语音文件名前缀，sessionID为0表示消息不属于会话
+func (n *VoiceNamer) Prefix(conversationID, messageID, sessionID int64) string {
+	session := ""
+	if sessionID != 0 {
+		session = strconv.FormatInt(sessionID, 10)
+	}
+	return strings.NewReplacer(
+		voiceNameConversation, strconv.FormatInt(conversationID, 10),
+		voiceNameMessage, strconv.FormatInt(messageID, 10),
+		voiceNameSession, session,
+		voiceNameTime, strconv.FormatInt(n.now().UnixMilli(), 10),
+		voiceNameToken, n.token(),
+	).Replace(n.template)
+}
+
+// defaultVoiceNamer VoiceNamer未设置时使用的默认模板
+var defaultVoiceNamer = &VoiceNamer{template: DefaultVoiceNameTemplate, now: time.Now, token: randomToken}
+
+type voiceSessionKey struct{}
+
+// withVoiceSession 记下消息所属的会话，生成语音文件名时用于{session}
+func withVoiceSession(ctx context.Context, sessionID int64) context.Context {
+	return context.WithValue(ctx, voiceSessionKey{}, sessionID)
+}
+
+// turnVoicePrefix 按VoiceNamer生成本轮对话的语音文件名前缀
+func (l *LingChatService) turnVoicePrefix(ctx context.Context, conversationID, messageID int64) string {
+	namer := l.VoiceNamer
+	if namer == nil {
+		namer = defaultVoiceNamer
+	}
+	sessionID, _ := ctx.Value(voiceSessionKey{}).(int64)
+	return namer.Prefix(conversationID, messageID, sessionID)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewVoiceNamer(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  bool
+	}{
+		{name: "默认模板", template: DefaultVoiceNameTemplate},
+		{name: "全部占位符", template: "s{session}-c{conversation}-m{message}-{time}-{token}."},
+		{name: "缺少token", template: "c{conversation}_m{message}_", wantErr: true},
+		{name: "未知占位符", template: "{user}_{token}_", wantErr: true},
+		{name: "包含路径分隔符", template: "voice/{token}_", wantErr: true},
+		{name: "包含上级目录", template: "..{token}_", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewVoiceNamer(tt.template); (err != nil) != tt.wantErr {
+				t.Errorf("NewVoiceNamer(%q) error = %v, wantErr %v", tt.template, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVoiceNamer_Prefix(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		sessionID int64
+		want      string
+	}{
+		{name: "默认模板", template: DefaultVoiceNameTemplate, want: "c1_m2_abc_"},
+		{name: "会话和时间", template: "s{session}_{time}_{token}_", sessionID: 7, want: "s7_1700000000000_abc_"},
+		{name: "不在会话中", template: "s{session}_{token}_", want: "s_abc_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namer, err := NewVoiceNamer(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			namer.now = func() time.Time { return time.UnixMilli(1700000000000) }
+			namer.token = func() string { return "abc" }
+			if got := namer.Prefix(1, 2, tt.sessionID); got != tt.want {
+				t.Errorf("Prefix() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_LingChatVoiceNamesUnique(t *testing.T) {
+	l, _ := newTestService(t, "【开心】你好<こんにちは>【难过】再见<さよなら>",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(r.URL.Query().Get("text"))) },
+		emotionHandler("开心"),
+	)
+	store := &memStorage{objects: map[string][]byte{}}
+	l.Storage = store
+	// 模板不含对话和消息ID时，只靠随机串区分并发的对话
+	namer, err := NewVoiceNamer("{token}_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.VoiceNamer = namer
+
+	const turns = 20
+	var wg sync.WaitGroup
+	files := make([][]string, turns)
+	for i := range turns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := l.LingChat(context.Background(), "你好", "", "")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for _, part := range resp.Messages {
+				files[i] = append(files[i], part.AudioFile)
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, turn := range files {
+		for _, file := range turn {
+			if file == "" || seen[file] {
+				t.Fatalf("audio file %q is empty or reused", file)
+			}
+			seen[file] = true
+			key := strings.TrimPrefix(file, "https://cdn.example.com/")
+			if key != filepath.Base(key) {
+				t.Errorf("audio key %q contains a directory", key)
+			}
+		}
+	}
+	if len(store.objects) != 2*turns {
+		t.Errorf("stored %d objects, want %d", len(store.objects), 2*turns)
+	}
+}
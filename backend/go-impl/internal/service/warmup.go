@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"LingChat/internal/clients/llm"
+	"LingChat/internal/logging"
+)
+
+// 预热请求的内容，尽量短以减少开销
+const (
+	warmupMessage = "你好"
+	warmupVoice   = "こんにちは"
+)
+
+// Warmup 向每个下游服务发送一次很小的请求，提前建立连接（含TLS握手）并触发模型加载，
+// 避免部署后的第一轮对话特别慢。返回每个依赖的结果，nil表示成功；失败只记录日志，不影响启动。
+// 预热请求不经过熔断器，也不计入指标；依赖的选择与CheckHealth一致
+func (l *LingChatService) Warmup(ctx context.Context) map[string]error {
+	warmups := map[string]func(context.Context) error{
+		DependencyLLM: l.warmupLLM,
+	}
+	if !l.DryRun {
+		warmups[DependencyVITS] = l.warmupVITS
+	}
+	if l.PredictEmotions && !l.DryRun {
+		warmups[DependencyEmotion] = l.warmupEmotion
+	}
+
+	logger := logging.FromContext(ctx)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]error, len(warmups))
+	for name, warmup := range warmups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := warmup(ctx)
+			if err != nil {
+				logger.Warn("预热下游服务失败", "dependency", name, "elapsed", time.Since(start), "err", err)
+			} else {
+				logger.Info("预热下游服务完成", "dependency", name, "elapsed", time.Since(start))
+			}
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// warmupLLM 只要求生成1个token
+func (l *LingChatService) warmupLLM(ctx context.Context) error {
+	ctx = llm.WithOptions(ctx, llm.Options{MaxTokens: 1})
+	_, err := l.llmClient.Chat(ctx, []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: warmupMessage}}, l.ConfigModel)
+	return err
+}
+
+func (l *LingChatService) warmupVITS(ctx context.Context) error {
+	_, err := l.ttsProvider().VoiceVITS(ctx, warmupVoice, l.defaultVoice())
+	return err
+}
+
+func (l *LingChatService) warmupEmotion(ctx context.Context) error {
+	_, err := l.emotionPredictorClient.Predict(ctx, warmupMessage, l.settingsFrom(ctx).EmotionThreshold)
+	return err
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"LingChat/internal/breaker"
+)
+
+func TestLingChatService_Warmup(t *testing.T) {
+	var vitsCalls, emotionCalls atomic.Int32
+	l, _ := newTestService(t, "好",
+		func(w http.ResponseWriter, r *http.Request) {
+			vitsCalls.Add(1)
+			w.Write([]byte("audio"))
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			emotionCalls.Add(1)
+			emotionHandler("开心")(w, r)
+		},
+	)
+
+	results := l.Warmup(context.Background())
+	for _, dep := range []string{DependencyLLM, DependencyVITS, DependencyEmotion} {
+		if err, ok := results[dep]; !ok || err != nil {
+			t.Errorf("results[%s] = %v, %v, want nil, true", dep, err, ok)
+		}
+	}
+	if len(l.llmClient.(*fakeLLM).calls) != 1 || vitsCalls.Load() != 1 || emotionCalls.Load() != 1 {
+		t.Errorf("calls = llm %d, vits %d, emotion %d, want one each",
+			len(l.llmClient.(*fakeLLM).calls), vitsCalls.Load(), emotionCalls.Load())
+	}
+}
+
+func TestLingChatService_WarmupFailure(t *testing.T) {
+	l, _ := newTestService(t, "",
+		func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+		emotionHandler("开心"),
+	)
+	l.llmClient.(*fakeLLM).err = errors.New("connection refused")
+	l.LLMBreaker = breaker.New(1, time.Minute)
+	l.TTSBreaker = breaker.New(1, time.Minute)
+
+	results := l.Warmup(context.Background())
+	if results[DependencyLLM] == nil || results[DependencyVITS] == nil {
+		t.Errorf("results = %v, want llm and vits errors", results)
+	}
+	if results[DependencyEmotion] != nil {
+		t.Errorf("results[emotion] = %v, want nil", results[DependencyEmotion])
+	}
+	// 预热失败不计入熔断，以免启动时下游还没就绪就把熔断器打开
+	for dep, state := range l.BreakerStates() {
+		if state != breaker.Closed {
+			t.Errorf("BreakerStates()[%s] = %v, want closed", dep, state)
+		}
+	}
+}
+
+func TestLingChatService_WarmupDryRun(t *testing.T) {
+	var vitsCalls atomic.Int32
+	l, _ := newTestService(t, "好",
+		func(w http.ResponseWriter, r *http.Request) { vitsCalls.Add(1) },
+		emotionHandler("开心"),
+	)
+	l.DryRun = true
+
+	results := l.Warmup(context.Background())
+	if _, ok := results[DependencyVITS]; ok {
+		t.Error("warmed up vits in dry run mode")
+	}
+	if _, ok := results[DependencyEmotion]; ok {
+		t.Error("warmed up emotion in dry run mode")
+	}
+	if vitsCalls.Load() != 0 {
+		t.Errorf("vits calls = %d, want 0", vitsCalls.Load())
+	}
+}
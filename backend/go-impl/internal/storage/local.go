@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 语音文件需要能被前端静态服务读取
+const (
+	dirMode  os.FileMode = 0755
+	fileMode os.FileMode = 0644
+)
+
+// Local 把对象保存为Dir下的文件，URL是文件名，由前端静态服务提供
+type Local struct {
+	Dir string
+}
+
+var (
+	_ Storage = (*Local)(nil)
+	_ Lister  = (*Local)(nil)
+)
+
+func NewLocal(dir string) *Local {
+	return &Local{Dir: dir}
+}
+
+// path 拒绝带目录的key，避免读写Dir以外的文件
+func (l *Local) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || filepath.Base(key) != key {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return filepath.Join(l.Dir, key), nil
+}
+
+// Put 写入文件。权限通过逐个文件Chmod保证，不修改进程级的umask，并发写入互不影响
+func (l *Local) Put(_ context.Context, key string, data []byte) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		return fmt.Errorf("create dir: %w", err)
+	}
+	if err := os.WriteFile(path, data, fileMode); err != nil {
+		return err
+	}
+	// WriteFile的mode会被umask过滤，这里显式设置最终权限
+	return os.Chmod(path, fileMode)
+}
+
+func (l *Local) Get(_ context.Context, key string) ([]byte, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return key
+}
+
+// List 列出Dir下的文件，目录不存在时返回空
+func (l *Local) List(_ context.Context) ([]Object, error) {
+	entries, err := os.ReadDir(l.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]Object, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		objects = append(objects, Object{Key: entry.Name(), ModTime: info.ModTime()})
+	}
+	return objects, nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "audio")
+	s := NewLocal(dir)
+
+	if err := s.Put(ctx, "part_1.wav", []byte("wav")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "part_1.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != fileMode {
+		t.Errorf("file mode = %v, want %v", mode, fileMode)
+	}
+	if data, err := s.Get(ctx, "part_1.wav"); err != nil || !bytes.Equal(data, []byte("wav")) {
+		t.Errorf("Get() = %q, %v", data, err)
+	}
+	if got := s.URL("part_1.wav"); got != "part_1.wav" {
+		t.Errorf("URL() = %q, want part_1.wav", got)
+	}
+
+	objects, err := s.List(ctx)
+	if err != nil || len(objects) != 1 || objects[0].Key != "part_1.wav" {
+		t.Errorf("List() = %v, %v", objects, err)
+	}
+
+	if err := s.Delete(ctx, "part_1.wav"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "part_1.wav"); err != nil {
+		t.Errorf("Delete() missing object error = %v", err)
+	}
+	if _, err := s.Get(ctx, "part_1.wav"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocal_InvalidKey(t *testing.T) {
+	s := NewLocal(t.TempDir())
+	for _, key := range []string{"", "..", "../escape.wav", "sub/part_1.wav"} {
+		if err := s.Put(context.Background(), key, []byte("x")); err == nil {
+			t.Errorf("Put(%q) succeeded, want error", key)
+		}
+	}
+}
+
+func TestLocal_ListMissingDir(t *testing.T) {
+	objects, err := NewLocal(filepath.Join(t.TempDir(), "missing")).List(context.Background())
+	if err != nil || len(objects) != 0 {
+		t.Errorf("List() = %v, %v, want empty", objects, err)
+	}
+}
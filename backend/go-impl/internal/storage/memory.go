@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultMemoryMaxBytes Memory默认最多保存的音频字节数
+const DefaultMemoryMaxBytes = 64 << 20
+
+// Memory 把语音保存在进程内存中，URL为 <URLPrefix><随机token>，由Take取出。
+// 每段语音只能取一次，超过TTL或总大小超过MaxBytes时从最早保存的开始丢弃。
+// 适合没有共享磁盘、又不想把base64内嵌在响应中的部署；取音频的请求必须落到生成它的实例上
+type Memory struct {
+	// URLPrefix 取音频的接口地址前缀，如"/api/v1/audio/"
+	URLPrefix string
+	// TTL 语音的保留时长，<=0表示只在取出或被挤出时删除
+	TTL time.Duration
+	// MaxBytes 所有语音合计的最大字节数
+	MaxBytes int
+
+	mu      sync.Mutex
+	size    int
+	byKey   map[string]*list.Element
+	byToken map[string]*list.Element
+	// order 按保存时间排列，最早的在前
+	order *list.List
+
+	now func() time.Time
+}
+
+type memoryEntry struct {
+	key     string
+	token   string
+	data    []byte
+	created time.Time
+}
+
+var (
+	_ Storage = (*Memory)(nil)
+	_ Lister  = (*Memory)(nil)
+)
+
+func NewMemory(urlPrefix string, ttl time.Duration, maxBytes int) *Memory {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMemoryMaxBytes
+	}
+	return &Memory{
+		URLPrefix: urlPrefix,
+		TTL:       ttl,
+		MaxBytes:  maxBytes,
+		byKey:     make(map[string]*list.Element),
+		byToken:   make(map[string]*list.Element),
+		order:     list.New(),
+		now:       time.Now,
+	}
+}
+
+// Put 保存语音并分配新的token，key已存在时替换。单段语音超过MaxBytes时返回错误
+func (m *Memory) Put(_ context.Context, key string, data []byte) error {
+	if len(data) > m.MaxBytes {
+		return fmt.Errorf("storage: %d bytes exceeds memory limit %d", len(data), m.MaxBytes)
+	}
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.byKey[key]; ok {
+		m.remove(elem)
+	}
+	for m.size+len(data) > m.MaxBytes {
+		m.remove(m.order.Front())
+	}
+	elem := m.order.PushBack(&memoryEntry{key: key, token: token, data: data, created: m.now()})
+	m.byKey[key] = elem
+	m.byToken[token] = elem
+	m.size += len(data)
+	return nil
+}
+
+// Get 按key读取语音，不影响之后用token取出
+func (m *Memory) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.byKey[key]
+	if !ok || m.expired(elem) {
+		return nil, ErrNotFound
+	}
+	return elem.Value.(*memoryEntry).data, nil
+}
+
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.byKey[key]; ok {
+		m.remove(elem)
+	}
+	return nil
+}
+
+// URL 返回key当前token的地址，key不存在时为空
+func (m *Memory) URL(key string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.byKey[key]
+	if !ok {
+		return ""
+	}
+	return m.URLPrefix + elem.Value.(*memoryEntry).token
+}
+
+// Take 按token取出语音并删除，返回音频和按扩展名推断的Content-Type；
+// token不存在、已被取过或已过期时返回ErrNotFound
+func (m *Memory) Take(token string) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.byToken[token]
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+	m.remove(elem)
+	if m.expired(elem) {
+		return nil, "", ErrNotFound
+	}
+	entry := elem.Value.(*memoryEntry)
+	return entry.data, contentType(entry.key), nil
+}
+
+// List 列出尚未取出的语音，后台清理据此删除超过保留时长的语音
+func (m *Memory) List(_ context.Context) ([]Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	objects := make([]Object, 0, m.order.Len())
+	for elem := m.order.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*memoryEntry)
+		objects = append(objects, Object{Key: entry.key, ModTime: entry.created})
+	}
+	return objects, nil
+}
+
+// Size 当前保存的音频字节数
+func (m *Memory) Size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.size
+}
+
+func (m *Memory) expired(elem *list.Element) bool {
+	return m.TTL > 0 && m.now().Sub(elem.Value.(*memoryEntry).created) >= m.TTL
+}
+
+// remove 调用方需持有mu
+func (m *Memory) remove(elem *list.Element) {
+	entry := elem.Value.(*memoryEntry)
+	m.order.Remove(elem)
+	delete(m.byKey, entry.key)
+	delete(m.byToken, entry.token)
+	m.size -= len(entry.data)
+}
+
+// newToken 128位随机数，不可猜测
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("storage: generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory("/api/v1/audio/", time.Minute, 0)
+
+	if err := m.Put(ctx, "part_1.wav", []byte("wav")); err != nil {
+		t.Fatal(err)
+	}
+	url := m.URL("part_1.wav")
+	token, ok := strings.CutPrefix(url, "/api/v1/audio/")
+	if !ok || len(token) != 32 || strings.Contains(token, "part_1") {
+		t.Fatalf("URL() = %q, want prefix and random token", url)
+	}
+	if data, err := m.Get(ctx, "part_1.wav"); err != nil || string(data) != "wav" {
+		t.Errorf("Get() = %q, %v", data, err)
+	}
+
+	data, contentType, err := m.Take(token)
+	if err != nil || string(data) != "wav" || contentType != "audio/wav" {
+		t.Fatalf("Take() = %q, %q, %v", data, contentType, err)
+	}
+	// 每段语音只能取一次
+	if _, _, err := m.Take(token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Take() error = %v, want ErrNotFound", err)
+	}
+	if m.URL("part_1.wav") != "" || m.Size() != 0 {
+		t.Errorf("URL() = %q, Size() = %d after Take, want empty", m.URL("part_1.wav"), m.Size())
+	}
+}
+
+func TestMemory_TTL(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory("/audio/", time.Minute, 0)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	if err := m.Put(ctx, "part_1.wav", []byte("wav")); err != nil {
+		t.Fatal(err)
+	}
+	token := strings.TrimPrefix(m.URL("part_1.wav"), "/audio/")
+	now = now.Add(time.Minute)
+	if _, _, err := m.Take(token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Take() after TTL error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemory_MaxBytes(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory("/audio/", 0, 10)
+
+	for _, key := range []string{"a.wav", "b.wav", "c.wav"} {
+		if err := m.Put(ctx, key, []byte("1234")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 超出上限时丢弃最早保存的语音
+	if _, err := m.Get(ctx, "a.wav"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(a.wav) error = %v, want ErrNotFound", err)
+	}
+	if m.Size() != 8 {
+		t.Errorf("Size() = %d, want 8", m.Size())
+	}
+	objects, _ := m.List(ctx)
+	if len(objects) != 2 || objects[0].Key != "b.wav" || objects[1].Key != "c.wav" {
+		t.Errorf("List() = %v, want b.wav and c.wav", objects)
+	}
+	if err := m.Put(ctx, "big.wav", []byte("12345678901")); err == nil {
+		t.Error("Put() larger than MaxBytes succeeded, want error")
+	}
+}
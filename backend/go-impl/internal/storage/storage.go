@@ -0,0 +1,34 @@
+// Package storage 生成语音的存储后端：默认写入本地目录，也可以存到S3兼容的对象存储，
+// 多个实例共享同一份语音
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("storage: object not found")
+
+// Object 存储中的一个对象
+type Object struct {
+	Key     string
+	ModTime time.Time
+}
+
+// Storage 按key存取语音文件，key是不含目录的文件名
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get 对象不存在时返回ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete 对象不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// URL 返回给前端的音频地址：本地存储为文件名，对象存储为完整URL
+	URL(key string) string
+}
+
+// Lister 可选接口，列出全部对象，用于清理过期语音
+type Lister interface {
+	List(ctx context.Context) ([]Object, error)
+}
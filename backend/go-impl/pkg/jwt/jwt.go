@@ -71,6 +71,7 @@ func (j *JWT) ParseToken(input string) (*CustomClaims, error) {
 			}
 			return j.secret, nil
 		},
+		jwt.WithIssuer(j.issuer),
 	)
 	if err != nil {
 		return nil, err
@@ -48,6 +48,15 @@ class PredictionResponse(BaseModel):
     warning: Optional[str] = None
 
 
+class BatchPredictionRequest(BaseModel):
+    texts: List[str]
+    confidence_threshold: Optional[float] = 0.08
+
+
+class BatchPredictionResponse(BaseModel):
+    results: List[PredictionResponse]
+
+
 @app.get("/health")
 async def health_check():
     return {"status": "healthy"}
@@ -64,6 +73,21 @@ async def predict_emotion(request: PredictionRequest):
         raise HTTPException(status_code=500, detail=str(e))
 
 
+@app.post("/predict_batch", response_model=BatchPredictionResponse)
+async def predict_emotion_batch(request: BatchPredictionRequest):
+    """一次预测多段文本，结果与texts顺序一致"""
+    if classifier is None:
+        raise HTTPException(status_code=500, detail="Classifier not initialized")
+    try:
+        results = [
+            classifier.predict(text, request.confidence_threshold)
+            for text in request.texts
+        ]
+        return {"results": results}
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=str(e))
+
+
 if __name__ == "__main__":
     dotenv.load_dotenv()
     host = os.environ.get("EMOTION_BIND_ADDR", "0.0.0.0")